@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/server"
+)
+
+// runMigrate implements `server migrate [-dir PATH] [-rekey]`: upgrade every
+// persisted entry to the schema version of this binary and, with -rekey,
+// re-seal every entry with the primary at-rest key.
+func runMigrate(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := fs.String("dir", cfg.PersistDir, "persistence directory (defaults to PERSIST_DIR)")
+	rekey := fs.Bool("rekey", false, "re-encrypt all entries with the primary key of PERSIST_KEYS(_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("migrate: no persistence directory (set PERSIST_DIR or -dir)")
+	}
+	d, err := persist.NewDir(*dir)
+	if err != nil {
+		return err
+	}
+	var kv persist.KV = d
+	kr, err := server.LoadKeyring(cfg)
+	if err != nil {
+		return err
+	}
+	var enc *persist.Encrypted
+	if kr != nil {
+		enc = persist.NewEncrypted(kv, kr)
+		enc.AllowPlaintext = *rekey
+		kv = enc
+	} else if *rekey {
+		return fmt.Errorf("migrate: -rekey needs PERSIST_KEYS or PERSIST_KEYS_FILE")
+	}
+	if *rekey {
+		// seal first so the schema pass below reads and writes ciphertext only
+		n, err := enc.Rekey()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("re-encrypted %d entries with key %q\n", n, kr.Primary)
+	}
+	n, err := persist.Migrate(kv)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("migrated %d entries to schema v%d\n", n, persist.CurrentVersion)
+	return nil
+}
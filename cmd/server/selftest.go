@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/server"
+)
+
+// runSelfTest implements `server --selftest`: boot against cfg, exercise every
+// subsystem once (see server.SelfTest), print the JSON report to stdout and
+// return the exit code, 0 if every step passed.
+func runSelfTest(cfg config.Config) int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	rep := server.SelfTest(ctx, cfg)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(rep)
+	if !rep.OK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,345 @@
+// Command soak keeps thousands of rooms busy against an in-process server for
+// a long time, with churn, and fails if memory or goroutines leave their
+// envelopes. Run it before releases (make soak) to catch leaks in the hub
+// and mailbox code that short tests don't see.
+//
+// Each room pairs two peers that trade offer/answer/ice, mailbox sends with
+// acks, and activity frames for a random lifetime, then leaves and is
+// replaced by a fresh room. A share of rooms is abandoned half-joined or
+// dropped without a close frame. After warm-up, the peak RSS over -settle is
+// the baseline; from then on RSS and the goroutine count are checked every
+// -sample. At the end, with every room gone, the hub must be empty and the
+// goroutines back near the starting count.
+//
+// Both ends run in this process, so RSS covers clients too; the gate is on
+// growth relative to the settled baseline. 5000 rooms need ~20k file
+// descriptors (ulimit -n).
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+type options struct {
+	rooms         int
+	duration      time.Duration
+	warmup        time.Duration
+	settle        time.Duration
+	lifetime      time.Duration
+	interval      time.Duration
+	sample        time.Duration
+	abandon, drop float64
+	maxRSSGrowth  float64
+	maxRSSMB      int
+	maxGoroutines int
+}
+
+func main() {
+	var o options
+	flag.IntVar(&o.rooms, "rooms", 5000, "rooms kept active at once")
+	flag.DurationVar(&o.duration, "duration", time.Hour, "how long to run after warm-up")
+	flag.DurationVar(&o.warmup, "warmup", 2*time.Minute, "ramp-up time before the baseline is taken")
+	flag.DurationVar(&o.settle, "settle", 10*time.Minute, "time after warm-up whose peak RSS is the baseline (part of -duration)")
+	flag.DurationVar(&o.lifetime, "lifetime", 3*time.Minute, "mean room lifetime (uniform 0.5x..1.5x)")
+	flag.DurationVar(&o.interval, "interval", 2*time.Second, "mean time between a room's signaling bursts")
+	flag.DurationVar(&o.sample, "sample", 10*time.Second, "envelope check period")
+	flag.Float64Var(&o.abandon, "abandon", 0.05, "share of rooms whose second peer never joins")
+	flag.Float64Var(&o.drop, "drop", 0.05, "share of peers that disconnect without a close frame")
+	flag.Float64Var(&o.maxRSSGrowth, "max-rss-growth", 0.25, "allowed RSS growth over the settled baseline (0.25 = +25%)")
+	flag.IntVar(&o.maxRSSMB, "max-rss-mb", 0, "absolute RSS ceiling in MiB (0: none)")
+	flag.IntVar(&o.maxGoroutines, "max-goroutines", 0, "goroutine ceiling (0: 8 per room + 500)")
+	flag.Parse()
+	if o.maxGoroutines == 0 {
+		o.maxGoroutines = 8*o.rooms + 500
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, o); err != nil {
+		log.Fatalf("soak: FAIL: %v", err)
+	}
+	log.Printf("soak: PASS")
+}
+
+func run(ctx context.Context, o options) error {
+	startGoroutines := runtime.NumGoroutine()
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithMetrics(m)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	var st stats
+	load, stopLoad := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < o.rooms; i++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			// spread the first rooms over the warm-up
+			if !sleep(load, time.Duration(rand.Int64N(int64(o.warmup)+1))) {
+				return
+			}
+			for load.Err() == nil {
+				if err := room(load, base, o, &st); err != nil && load.Err() == nil {
+					st.errors.Add(1)
+					log.Printf("room %d: %v", slot, err)
+					sleep(load, time.Second)
+				}
+			}
+		}(i)
+	}
+
+	if !sleep(ctx, o.warmup) {
+		stopLoad()
+		wg.Wait()
+		return ctx.Err()
+	}
+	log.Printf("warmed up: rss=%dMiB goroutines=%d %s", rss()>>20, runtime.NumGoroutine(), hubStats(h))
+
+	var failure error
+	var baseRSS uint64
+	settled := time.Now().Add(o.settle)
+	end := time.After(o.duration)
+	tick := time.NewTicker(o.sample)
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			failure = ctx.Err()
+			break loop
+		case <-end:
+			break loop
+		case <-tick.C:
+			cur, g := rss(), runtime.NumGoroutine()
+			log.Printf("rss=%dMiB goroutines=%d %s %s", cur>>20, g, hubStats(h), st.String())
+			if time.Now().Before(settled) {
+				baseRSS = max(baseRSS, cur)
+				continue
+			}
+			if baseRSS == 0 { // -settle shorter than -sample
+				baseRSS = cur
+			}
+			switch {
+			case float64(cur) > float64(baseRSS)*(1+o.maxRSSGrowth):
+				failure = fmt.Errorf("rss %dMiB grew more than %.0f%% over the %dMiB baseline", cur>>20, 100*o.maxRSSGrowth, baseRSS>>20)
+			case o.maxRSSMB > 0 && cur > uint64(o.maxRSSMB)<<20:
+				failure = fmt.Errorf("rss %dMiB over the %dMiB ceiling", cur>>20, o.maxRSSMB)
+			case g > o.maxGoroutines:
+				failure = fmt.Errorf("%d goroutines over the ceiling of %d", g, o.maxGoroutines)
+			}
+			if failure != nil {
+				break loop
+			}
+		}
+	}
+	tick.Stop()
+	stopLoad()
+	wg.Wait()
+	if failure != nil {
+		return failure
+	}
+
+	// every room is closed: nothing may be left behind
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		rooms, conns, mailbox := h.Stats()
+		g := runtime.NumGoroutine()
+		if rooms == 0 && conns == 0 && mailbox == 0 && g <= startGoroutines+20 {
+			log.Printf("drained: goroutines=%d (started with %d) %s", g, startGoroutines, st.String())
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not drained: %s, goroutines=%d (started with %d)", hubStats(h), g, startGoroutines)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+type stats struct {
+	rooms, frames, acks, errors atomic.Int64
+}
+
+func (s *stats) String() string {
+	return fmt.Sprintf("roomsDone=%d frames=%d acks=%d errors=%d", s.rooms.Load(), s.frames.Load(), s.acks.Load(), s.errors.Load())
+}
+
+func hubStats(h *hub.Hub) string {
+	rooms, conns, mailbox := h.Stats()
+	return fmt.Sprintf("hubRooms=%d hubConns=%d mailbox=%d", rooms, conns, mailbox)
+}
+
+// peer is one client connection; writes are serialized because the reader
+// acks mailbox items while the room loop is sending.
+type peer struct {
+	c  *websocket.Conn
+	mu sync.Mutex
+}
+
+func (p *peer) write(v any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return p.c.WriteJSON(v)
+}
+
+// leave closes the connection, politely unless drop is set.
+func (p *peer) leave(drop bool) {
+	if !drop {
+		p.mu.Lock()
+		_ = p.c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		p.mu.Unlock()
+	}
+	_ = p.c.Close()
+}
+
+func dial(ctx context.Context, base, appID, side string) (*peer, error) {
+	u := base + "?" + url.Values{"appID": {appID}, "side": {side}}.Encode()
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &peer{c: c}, nil
+}
+
+// read drains p until its connection closes, acking mailbox items.
+func (p *peer) read(st *stats) {
+	for {
+		_, msg, err := p.c.ReadMessage()
+		if err != nil {
+			return
+		}
+		st.frames.Add(1)
+		var f struct {
+			Type string `json:"type"`
+			Seq  uint64 `json:"seq"`
+		}
+		if json.Unmarshal(msg, &f) == nil && f.Type == "send" {
+			if p.write(map[string]any{"type": "delivered", "seq": f.Seq}) == nil {
+				st.acks.Add(1)
+			}
+		}
+	}
+}
+
+// room runs one room for a random lifetime.
+func room(ctx context.Context, base string, o options, st *stats) error {
+	appID := uuid.NewString()
+	life := o.lifetime/2 + time.Duration(rand.Int64N(int64(o.lifetime)+1))
+	a, err := dial(ctx, base, appID, "A")
+	if err != nil {
+		return err
+	}
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() { defer readers.Done(); a.read(st) }()
+	defer readers.Wait()
+	defer a.leave(rand.Float64() < o.drop)
+
+	if rand.Float64() < o.abandon {
+		sleep(ctx, life/4) // the partner never shows up
+		st.rooms.Add(1)
+		return nil
+	}
+	b, err := dial(ctx, base, appID, "B")
+	if err != nil {
+		return err
+	}
+	readers.Add(1)
+	go func() { defer readers.Done(); b.read(st) }()
+	defer b.leave(rand.Float64() < o.drop)
+
+	_ = a.write(map[string]any{"type": "hello", "features": []string{"soak"}})
+	_ = b.write(map[string]any{"type": "hello", "features": []string{"soak"}})
+	sdp := strings.Repeat("a=candidate:soak\r\n", 40) // a few KB, like a real SDP
+	done := time.After(life)
+	for n := 0; ; n++ {
+		jitter := time.Duration(rand.Int64N(int64(o.interval) + 1))
+		select {
+		case <-ctx.Done():
+			st.rooms.Add(1)
+			return nil
+		case <-done:
+			st.rooms.Add(1)
+			return nil
+		case <-time.After(o.interval/2 + jitter):
+		}
+		var err error
+		switch n % 4 {
+		case 0:
+			err = a.write(map[string]any{"type": "offer", "sdp": sdp})
+			if err == nil {
+				err = b.write(map[string]any{"type": "answer", "sdp": sdp})
+			}
+		case 1:
+			for i := 0; i < 4 && err == nil; i++ {
+				err = a.write(map[string]any{"type": "ice", "candidate": "candidate:" + strconv.Itoa(i) + " 1 udp 2122260223 192.0.2.1 5000 typ host"})
+			}
+		case 2:
+			err = a.write(map[string]any{"type": "send", "to": "B", "payload": map[string]any{"chunk": n}})
+		case 3:
+			err = b.write(map[string]any{"type": "activity", "state": "typing"})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// rss returns the resident set size (VmRSS on Linux, else the Go runtime's
+// view of memory obtained from the OS).
+func rss() uint64 {
+	if f, err := os.Open("/proc/self/status"); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if rest, ok := strings.CutPrefix(sc.Text(), "VmRSS:"); ok {
+				if kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64); err == nil {
+					return kb << 10
+				}
+			}
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
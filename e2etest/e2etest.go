@@ -0,0 +1,129 @@
+// Package e2etest runs the signaling server in-process for end-to-end tests.
+// It serves /ws, /rendezvous/ and /ice-servers on a loopback httptest server,
+// optionally with artificial latency, jitter and drops on the relay path (the
+// same mechanism as the server's CHAOS_* settings), so client tests can run
+// against realistic, reproducible conditions with plain go test.
+package e2etest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ice"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+// Conditions are the network conditions applied to every relayed frame. The
+// zero value relays untouched.
+type Conditions struct {
+	Latency time.Duration // added before every relayed frame
+	Jitter  time.Duration // plus a uniform 0..Jitter
+	Drop    float64       // probability that a relayed frame is dropped
+	Seed    uint64        // same seed and frame sequence, same jitter and drops
+}
+
+// Server is an in-process signaling server.
+type Server struct {
+	// URL is the base URL, e.g. http://127.0.0.1:41234.
+	URL string
+
+	srv *httptest.Server
+	hub *hub.Hub
+}
+
+// Start runs a server with conditions c until tb finishes. Each server has
+// its own metrics registry, so servers in parallel tests don't interfere.
+func Start(tb testing.TB, c Conditions) *Server {
+	tb.Helper()
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	rz := rendezvous.NewStore(10 * time.Minute).SetMetrics(m)
+
+	mux := http.NewServeMux()
+	mux.Handle("/rendezvous/", http.StripPrefix("/rendezvous", rz.Routes()))
+	mux.Handle("/ice-servers", ice.Handler(nil, 0))
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithMetrics(m)))
+
+	s := &Server{srv: httptest.NewServer(mux), hub: h}
+	s.URL = s.srv.URL
+	s.SetConditions(c)
+	tb.Cleanup(s.srv.Close)
+	return s
+}
+
+// SetConditions changes the network conditions for frames relayed from now on.
+func (s *Server) SetConditions(c Conditions) {
+	s.hub.SetChaos(hub.Chaos{Latency: c.Latency, Jitter: c.Jitter, Drop: c.Drop, Seed: c.Seed})
+}
+
+// WSURL is the signaling URL for side ("A" or "B") of appID.
+func (s *Server) WSURL(appID, side string) string {
+	u, _ := url.Parse(s.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	u.RawQuery = url.Values{"appID": {appID}, "side": {side}}.Encode()
+	return u.String()
+}
+
+// Dial connects side of appID, failing tb if the server refuses.
+func (s *Server) Dial(tb testing.TB, appID, side string) *websocket.Conn {
+	tb.Helper()
+	c, _, err := websocket.DefaultDialer.Dial(s.WSURL(appID, side), nil)
+	if err != nil {
+		tb.Fatalf("dial %s: %v", side, err)
+	}
+	tb.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// Code mints a pairing code the way clients do and returns it with its appID.
+func (s *Server) Code(tb testing.TB) (code, appID string) {
+	tb.Helper()
+	res, err := http.Post(s.URL+"/rendezvous/code", "application/json", bytes.NewReader(nil))
+	if err != nil {
+		tb.Fatalf("mint code: %v", err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Code  string `json:"code"`
+		AppID string `json:"appID"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil || res.StatusCode != http.StatusOK {
+		tb.Fatalf("mint code: %s %v", res.Status, err)
+	}
+	return out.Code, out.AppID
+}
+
+// Redeem redeems code and returns its appID.
+func (s *Server) Redeem(tb testing.TB, code string) string {
+	tb.Helper()
+	res, err := http.Post(s.URL+"/rendezvous/redeem", "application/json", strings.NewReader(`{"code":`+jsonString(code)+`}`))
+	if err != nil {
+		tb.Fatalf("redeem: %v", err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		AppID string `json:"appID"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil || res.StatusCode != http.StatusOK {
+		tb.Fatalf("redeem %q: %s %v", code, res.Status, err)
+	}
+	return out.AppID
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
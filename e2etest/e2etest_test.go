@@ -0,0 +1,74 @@
+package e2etest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/e2etest"
+)
+
+// pair connects both sides of a fresh room and consumes the room_full frames.
+func pair(t *testing.T, s *e2etest.Server) (a, b *websocket.Conn) {
+	t.Helper()
+	code, _ := s.Code(t)
+	appID := s.Redeem(t, code)
+	a, b = s.Dial(t, appID, "A"), s.Dial(t, appID, "B")
+	for _, c := range []*websocket.Conn{a, b} {
+		_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := c.ReadMessage(); err != nil {
+			t.Fatalf("room_full: %v", err)
+		}
+	}
+	return a, b
+}
+
+func TestLatency(t *testing.T) {
+	s := e2etest.Start(t, e2etest.Conditions{Latency: 50 * time.Millisecond})
+	a, b := pair(t, s)
+	start := time.Now()
+	_ = a.WriteMessage(websocket.TextMessage, []byte(`{"type":"offer","sdp":"x"}`))
+	if _, _, err := b.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("relayed after %v, want >= 50ms", d)
+	}
+}
+
+// received relays n ice frames from A to B and returns which ones arrived.
+func received(t *testing.T, c e2etest.Conditions, n int) []int {
+	s := e2etest.Start(t, c)
+	a, b := pair(t, s)
+	for i := 0; i < n; i++ {
+		_ = a.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"ice","n":%d}`, i)))
+	}
+	// anything could be dropped, so read until the stream goes quiet
+	var got []int
+	for {
+		_ = b.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		var f struct {
+			N int `json:"n"`
+		}
+		if err := b.ReadJSON(&f); err != nil {
+			return got
+		}
+		got = append(got, f.N)
+	}
+}
+
+func TestDropIsReproducible(t *testing.T) {
+	c := e2etest.Conditions{Drop: 0.5, Seed: 42}
+	first, second := received(t, c, 40), received(t, c, 40)
+	if len(first) == 0 || len(first) == 40 {
+		t.Fatalf("drop 0.5 delivered %d/40", len(first))
+	}
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatalf("same seed, different outcome:\n%v\n%v", first, second)
+	}
+	if got := received(t, e2etest.Conditions{Drop: 1}, 5); len(got) != 0 {
+		t.Fatalf("drop 1 delivered %v", got)
+	}
+}
@@ -0,0 +1,296 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/audit"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ice"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/usage"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+)
+
+// Server exposes operator endpoints. All routes require "Authorization: Bearer <token>".
+type Server struct {
+	hub   *hub.Hub
+	token string
+	hooks *webhook.Dispatcher
+	ice   *ice.Analytics
+	audit *audit.Logger
+	usage *usage.Tracker
+
+	bmu           sync.Mutex // guards lastBroadcast
+	lastBroadcast time.Time
+
+	mux *http.ServeMux // built by Routes, for Pattern
+}
+
+func New(h *hub.Hub, token string) *Server { return &Server{hub: h, token: token} }
+
+// WithWebhooks enables the webhook outbox routes.
+func (s *Server) WithWebhooks(d *webhook.Dispatcher) *Server {
+	s.hooks = d
+	return s
+}
+
+// WithAudit records operator actions (broadcasts, evictions) to a.
+func (s *Server) WithAudit(a *audit.Logger) *Server {
+	s.audit = a
+	return s
+}
+
+// WithUsage enables GET /usage.
+func (s *Server) WithUsage(u *usage.Tracker) *Server {
+	s.usage = u
+	return s
+}
+
+// WithICEAnalytics enables GET /analytics/ice.
+func (s *Server) WithICEAnalytics(a *ice.Analytics) *Server {
+	s.ice = a
+	return s
+}
+
+// Routes exposes (relative to the /admin prefix):
+// - GET    /rooms/{appID}                       -> {"state","since","peers"}, or 404 if no such room
+// - GET    /rooms/{appID}/frames/{side}         -> {"frames":[{"dir","type","size","at"}]}; last frames, oldest first
+// - GET    /rooms/{appID}/mailbox/{side}        -> {"items":[{"seq","size","enqueuedAt"}]}
+// - DELETE /rooms/{appID}/mailbox/{side}/{seq}  -> 204, or 404 if no such item
+// - DELETE /rooms/{appID}/mailbox/{side}        -> {"purged":N}
+// - PUT    /rooms/{appID}/debug?ttl=10m&sample=1 -> {"until","sample"}; frame-level logs for one room
+// - DELETE /rooms/{appID}/debug                 -> 204, or 404 if not enabled
+// - GET    /debug                               -> {"rooms":{appID:{"until","sample"}}}
+// - GET    /webhooks?dead=1                     -> {"deliveries":[...]}; outbox entries (only dead-lettered with dead=1)
+// - POST   /webhooks/{id}/retry                 -> 202; 404 if unknown or the outbox is not enabled
+// - GET    /analytics/ice                       -> {"windows":[{"window","total","direct","relay","directPct","relayPct","pairs"}]}
+// - GET    /usage?from=&to=&bucket=1h&tenant=   -> {"usage":[{"start","tenant","messagesIn","messagesOut","bytesIn","bytesOut"}]}
+// - POST   /broadcast {"message","level","eventAt","selector"} -> 202 {"id","recipients"}; announcement frame to every client (or those matching selector), 429 if too frequent
+// - POST   /evict {"selector","reason"}         -> {"evicted":N}; closes the connections whose labels match selector
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /rooms/{appID}", func(w http.ResponseWriter, r *http.Request) {
+		st, ok := s.hub.RoomState(r.PathValue("appID"))
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, st)
+	})
+
+	mux.HandleFunc("GET /rooms/{appID}/frames/{side}", func(w http.ResponseWriter, r *http.Request) {
+		side, ok := parseSide(w, r)
+		if !ok {
+			return
+		}
+		frames, ok := s.hub.Frames(r.PathValue("appID"), side)
+		if !ok {
+			http.Error(w, "side not connected", http.StatusNotFound)
+			return
+		}
+		if frames == nil {
+			frames = []hub.FrameMeta{}
+		}
+		writeJSON(w, map[string]any{"frames": frames})
+	})
+
+	mux.HandleFunc("GET /rooms/{appID}/mailbox/{side}", func(w http.ResponseWriter, r *http.Request) {
+		side, ok := parseSide(w, r)
+		if !ok {
+			return
+		}
+		items, ok := s.hub.MailboxItems(r.PathValue("appID"), side)
+		if !ok {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"items": items})
+	})
+
+	mux.HandleFunc("DELETE /rooms/{appID}/mailbox/{side}/{seq}", func(w http.ResponseWriter, r *http.Request) {
+		side, ok := parseSide(w, r)
+		if !ok {
+			return
+		}
+		seq, err := strconv.ParseUint(r.PathValue("seq"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid seq", http.StatusBadRequest)
+			return
+		}
+		if !s.hub.DeleteMailboxItem(r.PathValue("appID"), side, seq) {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /rooms/{appID}/mailbox/{side}", func(w http.ResponseWriter, r *http.Request) {
+		side, ok := parseSide(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, map[string]any{"purged": s.hub.PurgeMailbox(r.PathValue("appID"), side)})
+	})
+
+	mux.HandleFunc("PUT /rooms/{appID}/debug", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ttl := defaultDebugTTL
+		if v := q.Get("ttl"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 || d > maxDebugTTL {
+				http.Error(w, "invalid ttl (max "+maxDebugTTL.String()+")", http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		var sample uint64 = 1
+		if v := q.Get("sample"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil || n == 0 {
+				http.Error(w, "invalid sample", http.StatusBadRequest)
+				return
+			}
+			sample = n
+		}
+		writeJSON(w, s.hub.SetDebug(r.PathValue("appID"), ttl, sample))
+	})
+
+	mux.HandleFunc("DELETE /rooms/{appID}/debug", func(w http.ResponseWriter, r *http.Request) {
+		if !s.hub.ClearDebug(r.PathValue("appID")) {
+			http.Error(w, "debug not enabled", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /debug", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"rooms": s.hub.DebugStates()})
+	})
+
+	mux.HandleFunc("GET /webhooks", func(w http.ResponseWriter, r *http.Request) {
+		list, err := s.hooks.Deliveries(r.URL.Query().Get("dead") == "1")
+		if err != nil {
+			webhookError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"deliveries": list})
+	})
+
+	mux.HandleFunc("POST /webhooks/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.hooks.Retry(r.PathValue("id")); err != nil {
+			webhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("POST /broadcast", s.broadcast)
+	mux.HandleFunc("POST /evict", s.evict)
+
+	mux.HandleFunc("GET /usage", func(w http.ResponseWriter, r *http.Request) {
+		if s.usage == nil {
+			http.Error(w, "usage accounting not enabled", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		to := time.Now()
+		from := to.Add(-24 * time.Hour)
+		bucket := time.Hour
+		var err error
+		if v := q.Get("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid from (RFC 3339)", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid to (RFC 3339)", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("bucket"); v != "" {
+			if bucket, err = time.ParseDuration(v); err != nil || bucket < time.Hour || bucket%time.Hour != 0 {
+				http.Error(w, "invalid bucket (whole hours)", http.StatusBadRequest)
+				return
+			}
+		}
+		if !from.Before(to) {
+			http.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{"usage": s.usage.Report(from, to, bucket, q.Get("tenant"))})
+	})
+
+	mux.HandleFunc("GET /analytics/ice", func(w http.ResponseWriter, r *http.Request) {
+		if s.ice == nil {
+			http.Error(w, "ice analytics not enabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"windows": s.ice.Summary(time.Now())})
+	})
+
+	s.mux = mux
+	return s.auth(mux)
+}
+
+// Pattern returns the route pattern serving r (its path relative to the
+// admin prefix), or "" if none does or Routes wasn't called. For metrics
+// labels; r is not authenticated.
+func (s *Server) Pattern(r *http.Request) string {
+	if s.mux == nil {
+		return ""
+	}
+	_, pattern := s.mux.Handler(r)
+	return pattern
+}
+
+func webhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNoOutbox):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, persist.ErrNotFound):
+		http.Error(w, "delivery not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Per-room debug logging is noisy by design; overrides always expire.
+const (
+	defaultDebugTTL = 10 * time.Minute
+	maxDebugTTL     = time.Hour
+)
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token == "" || !found || subtle.ConstantTimeCompare([]byte(tok), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseSide(w http.ResponseWriter, r *http.Request) (string, bool) {
+	side := strings.ToUpper(r.PathValue("side"))
+	if side != "A" && side != "B" {
+		http.Error(w, "invalid side", http.StatusBadRequest)
+		return "", false
+	}
+	return side, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("content-type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
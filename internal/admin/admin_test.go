@@ -0,0 +1,195 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/admin"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/usage"
+)
+
+func do(t *testing.T, h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMailboxListDeletePurge(t *testing.T) {
+	h := hub.New()
+	for i := 0; i < 3; i++ {
+		_ = h.Enqueue("app", "A", "B", json.RawMessage(`{"x":1}`))
+	}
+	srv := admin.New(h, "s3cret").Routes()
+
+	if rr := do(t, srv, http.MethodGet, "/rooms/app/mailbox/B", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token: want 401, got %d", rr.Code)
+	}
+
+	rr := do(t, srv, http.MethodGet, "/rooms/app/mailbox/B", "s3cret")
+	var list struct{ Items []hub.MailboxItem }
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list.Items) != 3 {
+		t.Fatalf("list: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := do(t, srv, http.MethodDelete, "/rooms/app/mailbox/B/1", "s3cret"); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: want 204, got %d", rr.Code)
+	}
+	if rr := do(t, srv, http.MethodDelete, "/rooms/app/mailbox/B/1", "s3cret"); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete: want 404, got %d", rr.Code)
+	}
+
+	rr = do(t, srv, http.MethodDelete, "/rooms/app/mailbox/B", "s3cret")
+	var purged struct{ Purged int }
+	_ = json.Unmarshal(rr.Body.Bytes(), &purged)
+	if purged.Purged != 2 {
+		t.Fatalf("purge: want 2, got %d", purged.Purged)
+	}
+	if items, _ := h.MailboxItems("app", "B"); len(items) != 0 {
+		t.Fatalf("mailbox not empty after purge: %+v", items)
+	}
+}
+
+func TestRoomDebugOverride(t *testing.T) {
+	h := hub.New()
+	srv := admin.New(h, "s3cret").Routes()
+
+	if rr := do(t, srv, http.MethodPut, "/rooms/app/debug?ttl=2h", "s3cret"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("ttl above max: want 400, got %d", rr.Code)
+	}
+	if rr := do(t, srv, http.MethodPut, "/rooms/app/debug?ttl=1m&sample=2", "s3cret"); rr.Code != http.StatusOK {
+		t.Fatalf("enable: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// sample=2: every other event is logged
+	if got := []bool{h.Debug("app"), h.Debug("app"), h.Debug("app")}; !got[0] || got[1] || !got[2] {
+		t.Fatalf("sampling = %v", got)
+	}
+	if h.Debug("other") {
+		t.Fatal("override leaked to another room")
+	}
+
+	rr := do(t, srv, http.MethodGet, "/debug", "s3cret")
+	var list struct{ Rooms map[string]hub.DebugState }
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if _, ok := list.Rooms["app"]; !ok {
+		t.Fatalf("list: %s", rr.Body.String())
+	}
+
+	if rr := do(t, srv, http.MethodDelete, "/rooms/app/debug", "s3cret"); rr.Code != http.StatusNoContent {
+		t.Fatalf("disable: want 204, got %d", rr.Code)
+	}
+	if h.Debug("app") {
+		t.Fatal("override still active after delete")
+	}
+}
+
+func TestRoomState(t *testing.T) {
+	h := hub.New()
+	_ = h.Register("app", "A", "", nil)
+	srv := admin.New(h, "s3cret").Routes()
+
+	rr := do(t, srv, http.MethodGet, "/rooms/app", "s3cret")
+	var st hub.RoomStatus
+	_ = json.Unmarshal(rr.Body.Bytes(), &st)
+	if rr.Code != http.StatusOK || st.State != hub.StateHalfJoined || st.Peers != 1 {
+		t.Fatalf("state: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(t, srv, http.MethodGet, "/rooms/nope", "s3cret"); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown room: want 404, got %d", rr.Code)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	h := hub.New()
+	h.SetTraceFrames(2)
+	_ = h.Register("app", "A", "", nil)
+	h.TraceIn("app", "A", "offer", 10)
+	h.TraceIn("app", "A", "ice", 20)
+	h.TraceIn("app", "A", "answer", 30)
+	srv := admin.New(h, "s3cret").Routes()
+
+	rr := do(t, srv, http.MethodGet, "/rooms/app/frames/A", "s3cret")
+	var body struct{ Frames []hub.FrameMeta }
+	_ = json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusOK || len(body.Frames) != 2 || body.Frames[0].Type != "ice" || body.Frames[1].Type != "answer" {
+		t.Fatalf("frames: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(t, srv, http.MethodGet, "/rooms/app/frames/B", "s3cret"); rr.Code != http.StatusNotFound {
+		t.Fatalf("unconnected side: want 404, got %d", rr.Code)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	srv := admin.New(hub.New(), "s3cret").Routes()
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(`{"message":"x","level":"panic"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad level: want 400, got %d", rr.Code)
+	}
+	rr := post(`{"message":"service restarting in 5 minutes","level":"warning"}`)
+	var res struct {
+		ID         string
+		Recipients int
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != http.StatusAccepted || res.ID == "" {
+		t.Fatalf("broadcast: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"message":"again"}`); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("second broadcast: want 429 with Retry-After, got %d", rr.Code)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	srv := admin.New(hub.New(), "s3cret").Routes()
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/evict", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, body := range []string{`{}`, `{"selector":"platform"}`, `{"selector":"platform=ios","reason":"` + strings.Repeat("x", 200) + `"}`} {
+		if rr := post(body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: want 400, got %d", body, rr.Code)
+		}
+	}
+	rr := post(`{"selector":"platform=ios,app_version<1.4","reason":"please update"}`)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"evicted":0}` {
+		t.Fatalf("evict: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	u := usage.New().WithMetrics(metrics.New())
+	u.Record("acme", "in", 10)
+	u.Record("acme", "out", 10)
+	srv := admin.New(hub.New(), "s3cret").WithUsage(u).Routes()
+
+	if rr := do(t, srv, http.MethodGet, "/usage?bucket=90m", "s3cret"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("partial-hour bucket: want 400, got %d", rr.Code)
+	}
+	rr := do(t, srv, http.MethodGet, "/usage?tenant=acme", "s3cret")
+	var res struct{ Usage []usage.Row }
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != http.StatusOK || len(res.Usage) != 1 || res.Usage[0].BytesIn != 10 || res.Usage[0].MessagesOut != 1 {
+		t.Fatalf("usage: code=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
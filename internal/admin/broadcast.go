@@ -0,0 +1,120 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+// Announcements reach every connected client, so they are rate limited
+// across all operators and kept short.
+const (
+	minBroadcastInterval = 10 * time.Second
+	maxAnnouncementLen   = 1024
+)
+
+// announcement is the frame clients receive.
+type announcement struct {
+	Type    string     `json:"type"` // always "announcement"
+	ID      string     `json:"id"`
+	Level   string     `json:"level"`
+	Message string     `json:"message"`
+	EventAt *time.Time `json:"eventAt,omitempty"` // when the announced event happens, if scheduled
+	SentAt  time.Time  `json:"sentAt"`
+}
+
+// broadcast handles POST /broadcast with {"message","level","eventAt","selector"}.
+func (s *Server) broadcast(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message  string     `json:"message"`
+		Level    string     `json:"level"`
+		EventAt  *time.Time `json:"eventAt"`
+		Selector string     `json:"selector"` // connection labels, see hub.ParseSelector
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxAnnouncementLen)).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if req.Level == "" {
+		req.Level = "info"
+	}
+	switch {
+	case req.Message == "" || len(req.Message) > maxAnnouncementLen:
+		http.Error(w, "message must be 1.."+strconv.Itoa(maxAnnouncementLen)+" bytes", http.StatusBadRequest)
+		return
+	case req.Level != "info" && req.Level != "warning" && req.Level != "critical":
+		http.Error(w, "level must be info, warning or critical", http.StatusBadRequest)
+		return
+	}
+	sel, err := hub.ParseSelector(req.Selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	s.bmu.Lock()
+	if wait := minBroadcastInterval - now.Sub(s.lastBroadcast); wait > 0 {
+		s.bmu.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "too many broadcasts", http.StatusTooManyRequests)
+		return
+	}
+	s.lastBroadcast = now
+	s.bmu.Unlock()
+
+	a := announcement{Type: "announcement", ID: uuid.NewString(), Level: req.Level, Message: req.Message, EventAt: req.EventAt, SentAt: now.UTC()}
+	var conns int
+	if len(sel) == 0 {
+		_, conns, _ = s.hub.Stats()
+		// a stalled peer may take a write timeout; don't hold the request for it
+		go s.hub.BroadcastEventAll(a)
+	} else {
+		conns = s.hub.CountMatching(sel)
+		go s.hub.BroadcastEventMatching(sel, a)
+	}
+	s.audit.AdminBroadcast(r, a.ID, a.Level, a.Message, sel.String(), conns)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]any{"id": a.ID, "recipients": conns})
+}
+
+// maxEvictReason bounds the close reason, which must fit a control frame.
+const maxEvictReason = 100
+
+// evict handles POST /evict with {"selector","reason"}: every connection the
+// (required) selector matches is closed with ClosePolicyViolation and reason.
+func (s *Server) evict(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Selector string `json:"selector"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	sel, err := hub.ParseSelector(req.Selector)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case len(sel) == 0:
+		http.Error(w, "selector required", http.StatusBadRequest)
+		return
+	case len(req.Reason) > maxEvictReason:
+		http.Error(w, "reason must be at most "+strconv.Itoa(maxEvictReason)+" bytes", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "evicted"
+	}
+	n := s.hub.CloseMatching(sel, websocket.ClosePolicyViolation, req.Reason)
+	s.audit.AdminEvict(r, sel.String(), req.Reason, n)
+	writeJSON(w, map[string]any{"evicted": n})
+}
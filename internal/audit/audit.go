@@ -0,0 +1,164 @@
+// Package audit records security-relevant events (WS upgrade attempts, admin
+// broadcasts) to a dedicated structured log stream, separate from the
+// operational logs.
+package audit
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+)
+
+// Outcome of a connection attempt.
+type Outcome string
+
+const (
+	Accepted       Outcome = "accepted"
+	BadAppID       Outcome = "bad_app_id"
+	BadSide        Outcome = "bad_side"
+	BadSID         Outcome = "bad_sid"
+	BadClient      Outcome = "bad_client"
+	BadRegion      Outcome = "bad_region"
+	BadLabels      Outcome = "bad_labels"
+	OriginDenied   Outcome = "origin_denied"
+	RateLimited    Outcome = "rate_limited"
+	AuthFailed     Outcome = "auth_failed"
+	SideBusy       Outcome = "side_busy"
+	QuotaExceeded  Outcome = "quota_exceeded"
+	ClientRejected Outcome = "client_rejected"
+	Redirected     Outcome = "redirected"
+	SelfPair       Outcome = "self_pair"
+	UpgradeFailed  Outcome = "upgrade_failed"
+	Insecure       Outcome = "insecure"
+)
+
+// Logger writes audit records. A nil *Logger is valid and discards everything.
+type Logger struct {
+	l       *zap.Logger
+	proxies middleware.TrustedProxies
+	geo     *geo.Resolver // nil => records carry no country/asn
+}
+
+// New opens the audit stream: "stdout", "stderr", or a file path (appended).
+func New(dest string, tp middleware.TrustedProxies) (*Logger, error) {
+	cfg := zap.NewProductionConfig()
+	cfg.Encoding = "json"
+	cfg.Sampling = nil // never sample audit records
+	cfg.EncoderConfig.TimeKey = "ts"
+	cfg.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339Nano)
+	cfg.OutputPaths = []string{dest}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+	l, err := cfg.Build(zap.Fields(zap.String("sys", "audit")))
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{l: l, proxies: tp}, nil
+}
+
+// NewWithLogger wraps an existing zap logger (tests, embedding).
+func NewWithLogger(l *zap.Logger, tp middleware.TrustedProxies) *Logger {
+	return &Logger{l: l, proxies: tp}
+}
+
+// WithGeo adds the client's country and ASN to WS records. Call before use.
+func (a *Logger) WithGeo(g *geo.Resolver) *Logger {
+	if a != nil {
+		a.geo = g
+	}
+	return a
+}
+
+// WSAttempt records one WebSocket upgrade attempt.
+func (a *Logger) WSAttempt(r *http.Request, appID, side string, o Outcome) {
+	if a == nil {
+		return
+	}
+	ip := a.proxies.ClientIP(r)
+	a.l.Info("ws_attempt", append([]zap.Field{
+		zap.String("outcome", string(o)),
+		zap.String("ip", ip),
+		zap.String("origin", r.Header.Get("Origin")),
+		zap.String("ua", r.UserAgent()),
+		zap.String("appID", appID),
+		zap.String("side", side),
+	}, a.geoFields(ip)...)...)
+}
+
+// WSAbnormalClose records a session that ended without a normal close, with
+// its last frames (metadata only) for diagnosing hangs.
+func (a *Logger) WSAbnormalClose(r *http.Request, appID, side string, err error, frames any) {
+	if a == nil {
+		return
+	}
+	ip := a.proxies.ClientIP(r)
+	a.l.Info("ws_abnormal_close", append([]zap.Field{
+		zap.String("ip", ip),
+		zap.String("appID", appID),
+		zap.String("side", side),
+		zap.Error(err),
+		zap.Any("frames", frames),
+	}, a.geoFields(ip)...)...)
+}
+
+func (a *Logger) geoFields(ip string) []zap.Field {
+	if a.geo == nil {
+		return nil
+	}
+	info := a.geo.Lookup(ip)
+	return []zap.Field{zap.String("country", info.Country), zap.Uint64("asn", info.ASN)}
+}
+
+// AdminBroadcast records an operator announcement sent to all clients, or
+// to those matching a label selector.
+func (a *Logger) AdminBroadcast(r *http.Request, id, level, message, selector string, recipients int) {
+	if a == nil {
+		return
+	}
+	a.l.Info("admin_broadcast",
+		zap.String("ip", a.proxies.ClientIP(r)),
+		zap.String("id", id),
+		zap.String("level", level),
+		zap.String("message", message),
+		zap.String("selector", selector),
+		zap.Int("recipients", recipients),
+	)
+}
+
+// AdminEvict records an operator closing the connections matching a label
+// selector.
+func (a *Logger) AdminEvict(r *http.Request, selector, reason string, evicted int) {
+	if a == nil {
+		return
+	}
+	a.l.Info("admin_evict",
+		zap.String("ip", a.proxies.ClientIP(r)),
+		zap.String("selector", selector),
+		zap.String("reason", reason),
+		zap.Int("evicted", evicted),
+	)
+}
+
+// IPDenied records a request refused by the ALLOW_CIDRS allowlist.
+func (a *Logger) IPDenied(r *http.Request, ip string) {
+	if a == nil {
+		return
+	}
+	a.l.Info("ip_denied", append([]zap.Field{
+		zap.String("ip", ip),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("ua", r.UserAgent()),
+	}, a.geoFields(ip)...)...)
+}
+
+func (a *Logger) Sync() error {
+	if a == nil {
+		return nil
+	}
+	return a.l.Sync()
+}
@@ -0,0 +1,58 @@
+package audit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/audit"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo/geotest"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+)
+
+func TestWSAttemptRecord(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	tp, _ := middleware.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	a := audit.NewWithLogger(zap.New(core), tp)
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = "10.0.0.5:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.4")
+	r.Header.Set("Origin", "https://evil.example")
+	a.WSAttempt(r, "app", "A", audit.OriginDenied)
+
+	if logs.Len() != 1 {
+		t.Fatalf("want 1 record, got %d", logs.Len())
+	}
+	f := logs.All()[0].ContextMap()
+	if f["outcome"] != "origin_denied" || f["ip"] != "203.0.113.4" || f["origin"] != "https://evil.example" {
+		t.Fatalf("unexpected fields: %v", f)
+	}
+
+	var nilLogger *audit.Logger
+	nilLogger.WSAttempt(r, "app", "A", audit.Accepted) // must not panic
+}
+
+func TestWSAttemptGeo(t *testing.T) {
+	db := geotest.WriteDB(t, 6, 24, map[string]map[string]any{
+		"203.0.113.0/24": {"country": geotest.Shared{"iso_code": "NL"}, "autonomous_system_number": 64500},
+	})
+	g, err := geo.Open(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	a := audit.NewWithLogger(zap.New(core), nil).WithGeo(g)
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = "203.0.113.4:5555"
+	a.WSAttempt(r, "app", "A", audit.Accepted)
+	f := logs.All()[0].ContextMap()
+	if f["country"] != "NL" || f["asn"] != uint64(64500) {
+		t.Fatalf("unexpected fields: %v", f)
+	}
+}
@@ -0,0 +1,179 @@
+// Package breaker guards calls to an external dependency (e.g. Redis) with a
+// circuit breaker: after a run of failures the breaker opens and callers skip
+// the dependency for a cooldown, using their local fallback instead; then a
+// single probe call is let through, and its result closes the breaker again
+// or restarts the cooldown. This keeps a dead dependency from adding its
+// timeout to every request, and recovers without a restart once it is back.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Defaults for New.
+const (
+	DefaultFailures = 5
+	DefaultCooldown = 10 * time.Second
+)
+
+// ErrOpen is returned by Allow and Do while the breaker skips the dependency.
+var ErrOpen = errors.New("circuit open")
+
+// State is the breaker state.
+type State int
+
+const (
+	Closed   State = iota // calls go through
+	HalfOpen              // one probe call is in flight
+	Open                  // calls are skipped until the cooldown ends
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// Breaker counts consecutive failures of one dependency. It is safe for
+// concurrent use.
+type Breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+	met      *metrics.Metrics
+
+	mu      sync.Mutex
+	state   State
+	fails   int       // consecutive failures while closed
+	until   time.Time // end of the cooldown while open
+	since   time.Time // last state change
+	lastErr error
+}
+
+// New returns a closed breaker for the dependency name that opens after
+// failures consecutive failures (<= 0: DefaultFailures) and probes again
+// after cooldown (<= 0: DefaultCooldown).
+func New(name string, failures int, cooldown time.Duration) *Breaker {
+	if failures <= 0 {
+		failures = DefaultFailures
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	b := &Breaker{name: name, failures: failures, cooldown: cooldown, since: time.Now()}
+	return b.WithMetrics(metrics.Default)
+}
+
+// WithMetrics reports to m instead of metrics.Default; nil reports nothing,
+// e.g. for a private breaker that shares its name with others.
+func (b *Breaker) WithMetrics(m *metrics.Metrics) *Breaker {
+	b.met = m
+	if m != nil {
+		m.BreakerState.WithLabelValues(b.name).Set(float64(Closed))
+	}
+	return b
+}
+
+// Name returns the dependency name.
+func (b *Breaker) Name() string { return b.name }
+
+// Allow reports whether a call may go to the dependency now: nil while
+// closed and for the first caller after the cooldown (the probe), ErrOpen
+// otherwise. Every nil must be followed by Done with the call's result.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		return nil
+	case Open:
+		if time.Now().Before(b.until) {
+			return ErrOpen
+		}
+		b.set(HalfOpen)
+		return nil
+	}
+	return ErrOpen // a probe is already in flight
+}
+
+// Done records the result of a call admitted by Allow.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.fails = 0
+		if b.state != Closed {
+			b.set(Closed)
+		}
+		return
+	}
+	b.lastErr = err
+	b.fails++
+	if b.state == HalfOpen || (b.state == Closed && b.fails >= b.failures) {
+		b.until = time.Now().Add(b.cooldown)
+		b.set(Open)
+	}
+}
+
+// Do calls fn unless the breaker is open, and records its result.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Done(err)
+	return err
+}
+
+// set switches state; b.mu must be held.
+func (b *Breaker) set(s State) {
+	b.state, b.since = s, time.Now()
+	if s == Closed {
+		b.fails = 0
+	}
+	if b.met != nil {
+		b.met.BreakerState.WithLabelValues(b.name).Set(float64(s))
+		b.met.BreakerTransitions.WithLabelValues(b.name, s.String()).Inc()
+	}
+}
+
+// State returns the current state. An open breaker whose cooldown has ended
+// stays Open until the next Allow starts the probe.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status describes a breaker for /healthz and /statusz.
+type Status struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	// Error is the last failure, kept after recovery for debugging.
+	Error string `json:"error,omitempty"`
+	// RetryAt is when an open breaker lets the next probe through.
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+}
+
+// Status reports the breaker's state.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := Status{State: b.state.String(), Since: b.since.UTC()}
+	if b.lastErr != nil {
+		st.Error = b.lastErr.Error()
+	}
+	if b.state == Open {
+		t := b.until.UTC()
+		st.RetryAt = &t
+	}
+	return st
+}
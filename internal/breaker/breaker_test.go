@@ -0,0 +1,65 @@
+package breaker_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/breaker"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	m := metrics.New()
+	b := breaker.New("redis", 2, 50*time.Millisecond).WithMetrics(m)
+	down := errors.New("connection refused")
+	calls := 0
+	fail := func() error { calls++; return down }
+
+	if err := b.Do(fail); !errors.Is(err, down) || b.State() != breaker.Closed {
+		t.Fatalf("first failure: %v, %v", err, b.State())
+	}
+	if err := b.Do(fail); !errors.Is(err, down) || b.State() != breaker.Open {
+		t.Fatalf("second failure: %v, %v", err, b.State())
+	}
+	if err := b.Do(fail); !errors.Is(err, breaker.ErrOpen) || calls != 2 {
+		t.Fatalf("open breaker called through: %v, %d calls", err, calls)
+	}
+	if st := b.Status(); st.State != "open" || st.RetryAt == nil || st.Error != "connection refused" {
+		t.Fatalf("status: %+v", st)
+	}
+	if v := testutil.ToFloat64(m.BreakerState.WithLabelValues("redis")); v != 2 {
+		t.Fatalf("state gauge %v", v)
+	}
+
+	// after the cooldown one probe goes through; a failure reopens
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Allow(); err != nil || b.State() != breaker.HalfOpen {
+		t.Fatalf("probe: %v, %v", err, b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("second caller during probe: %v", err)
+	}
+	b.Done(down)
+	if b.State() != breaker.Open {
+		t.Fatalf("failed probe: %v", b.State())
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Do(func() error { return nil }); err != nil || b.State() != breaker.Closed {
+		t.Fatalf("recovery: %v, %v", err, b.State())
+	}
+	if v := testutil.ToFloat64(m.BreakerTransitions.WithLabelValues("redis", "open")); v != 2 {
+		t.Fatalf("open transitions %v", v)
+	}
+	if v := testutil.ToFloat64(m.BreakerState.WithLabelValues("redis")); v != 0 {
+		t.Fatalf("state gauge after recovery %v", v)
+	}
+	// a failure after recovery starts a fresh count
+	if b.Do(fail); b.State() != breaker.Closed {
+		t.Fatalf("single failure after recovery: %v", b.State())
+	}
+}
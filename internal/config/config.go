@@ -1,8 +1,10 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,46 +20,380 @@ type Config struct {
 
 	DevMode     bool
 	CORSOrigins []string
-	WSReadBuf   int
-	WSWriteBuf  int
-	WSMaxMsg    int64
+	// External origin decision service (overrides CORS_ORIGINS when set)
+	OriginCallbackURL string
+	OriginCallbackTTL time.Duration
+	WSReadBuf         int
+	WSWriteBuf        int
+	// Size WS buffers from observed frame sizes (WS_READ_BUFFER/WS_WRITE_BUFFER
+	// become the upper bound) and share write buffers between connections
+	WSBuffersAuto     bool
+	WSWriteBufferPool bool
+	WSMaxMsg          int64
+	// Adaptive heartbeat bounds (0 keeps WS_HEARTBEAT fixed)
+	HeartbeatMin        time.Duration
+	HeartbeatMax        time.Duration
+	HeartbeatWidenAfter int
+	// Heartbeat for parked solo peers
+	WSParkedHeartbeat time.Duration
+	// Shared secret for HMAC connect tokens (empty disables WS auth) and first-frame deadline
+	WSAuthSecret  string
+	WSAuthTimeout time.Duration
+	// Secret for one-time WS tickets handed out by rendezvous (empty disables) and their lifetime
+	WSTicketSecret string
+	WSTicketTTL    time.Duration
+	// Per-owner (client IP) caps on outstanding rendezvous codes and open rooms (0 disables)
+	MaxCodesPerOwner int
+	MaxRoomsPerOwner int
+	// Single-sided rooms kept per instance; the oldest is evicted beyond it (0 disables)
+	MaxUnpairedRooms int
+	// Viewers per fan-out room (/ws/fanout)
+	FanoutMaxViewers int
+	// "name:key,..." API keys (X-API-Key) whose traffic is reported per tenant
+	TenantKeys string
+	// Connection label keys counted in nt_ws_connections_by_label
+	WSLabelMetrics []string
+	// Room id formats "uuidv4|uuidv7|ulid,...": the first mints appIDs, all are accepted
+	AppIDFormats string
+	// JSON object echoed to clients as "branding" in GET /config
+	ClientBranding string
+	// Rooms are warned MaxSessionWarn before and closed at MaxSessionDuration
+	// (0 disables); requests carrying one of MaxSessionExemptKeys in X-API-Key are exempt
+	MaxSessionDuration   time.Duration
+	MaxSessionWarn       time.Duration
+	MaxSessionExemptKeys string
+	// Keep rendezvous codes redeemable until both peers have joined the room
+	RendezvousMultiRedeem bool
+	// How long an Idempotency-Key on code creation replays its response (0 disables)
+	RendezvousIdempotencyTTL time.Duration
+	// Minimum client versions "name:version,..." (empty accepts all)
+	MinClientVersions string
+	// Protocol feature flags "name=bool,..." (unset flags are on), optionally
+	// overridden at runtime by a config service polled every interval
+	FeatureFlags         string
+	FeatureFlagsURL      string
+	FeatureFlagsInterval time.Duration
+	// off|warn|deny when both sides of a room join from the same IP+User-Agent
+	// (deny is downgraded to warn with DEV=true)
+	WSSelfPair string
+	// Frames traced per WS connection for diagnostics (0 disables)
+	WSTraceFrames int
+	// Size limit of a room's shared metadata object (0 disables set_meta)
+	RoomMetaMaxBytes int
+	// How long an emptied room remembers it was established, so peers
+	// reconnecting in time don't count a second session (0 disables)
+	RoomResumeGrace time.Duration
+	// Mailboxed offer/answer items older than this are dropped instead of
+	// replayed, and their sender is told (0 disables)
+	MailboxOfferMaxAge time.Duration
+	// Longest a mailbox item is held; senders may ask for less (default
+	// ROOM_TTL, 0 keeps items until acked or the room closes)
+	MailboxTTL time.Duration
+	// How long a drop box room (set_mode dropBox) outlives its peers while
+	// mail is queued (default ROOM_TTL, 0 disables drop boxes)
+	DropBoxTTL time.Duration
+	// Injected relay latency, jitter and drop probability (DEV=true only),
+	// seeded for reproducible runs (see hub.Chaos)
+	ChaosLatency time.Duration
+	ChaosJitter  time.Duration
+	ChaosDrop    float64
+	ChaosSeed    int
+	// Region of this instance, and "region=wss://.../ws,..." for steering peers
+	// whose room lives elsewhere (see ws.WithRegion)
+	Region     string
+	RegionURLs string
+	// "url;region=r;weight=n,..." alternate signaling endpoints sent to clients
+	// in the welcome frame (empty: the other REGION_URLS, if any)
+	AltEndpoints string
+	// Server-side glare arbitration window for simultaneous offers (0 disables)
+	GlareWindow time.Duration
+	// Room lifecycle webhooks (empty URL disables)
+	WebhookURL    string
+	WebhookSecret string
+	// Deliveries are dead-lettered after this many failed attempts (outbox only,
+	// i.e. with PERSIST_DIR set)
+	WebhookMaxAttempts int
+	// Push notifications waking a backgrounded side when its room is
+	// half-joined: VAPID key pair (base64url) and contact for WebPush, and/or a
+	// Firebase service account file for FCM; title/body are text/templates
+	PushVAPIDPublicKey     string
+	PushVAPIDPrivateKey    string
+	PushVAPIDSubject       string
+	PushFCMCredentialsFile string
+	PushTitle              string
+	PushBody               string
+	PushSubscriptionTTL    time.Duration
+	// Per-connection inbound frame rate (0 disables) and burst
+	WSMsgRate  int
+	WSMsgBurst int
+	// Per-room relay budget shared by both sides (0 disables) and burst
+	RoomMsgRate  int
+	RoomMsgBurst int
+	// Per-room relay frame anomaly limits over the room's lifetime and per
+	// minute (0 disables); see hub.FrameLimits
+	RoomMaxFrames       int
+	RoomMaxFramesPerMin int
+	// Per-connection telemetry cap and replay protection
+	TelemetryMaxPerConn int
+	TelemetryRequireSeq bool
 	// HTTP server timeouts
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
 	IdleTimeout       time.Duration
+	// Time between failing /readyz and closing the listener on shutdown
+	DrainDelay time.Duration
 
+	// Listener socket options: TCP keepalive period (0 = Go default, <0 disables),
+	// TCP_NODELAY, and SO_REUSEPORT for running several processes on one port
+	TCPKeepAlive time.Duration
+	TCPNoDelay   bool
+	ReusePort    bool
+
+	// Serve cleartext HTTP/2 (h2c) alongside HTTP/1.1
+	H2C bool
+
+	// Reject WS upgrades not made over TLS (directly or per X-Forwarded-Proto
+	// from a trusted proxy)
+	WSRequireTLS bool
 	// TLS (if both set -> serve HTTPS)
 	TLSCertFile string
 	TLSKeyFile  string
+	// More "cert.pem:key.pem" pairs; the certificate is picked by SNI
+	TLSCerts []string
+
+	// Security headers on every response; HSTS (TLS requests only, 0 disables)
+	// and the admin route group's Content-Security-Policy (empty = middleware.AdminCSP)
+	SecurityHeaders bool
+	HSTSMaxAge      time.Duration
+	AdminCSP        string
+
+	// Directory for on-disk persistence (empty = in-memory only)
+	PersistDir string
+	// Save queued mailbox items to PersistDir on graceful shutdown and load
+	// them on startup (if no older than RoomTTL)
+	HubSnapshot bool
+	// At-rest encryption keyring "id:base64key,..." (first is primary), inline or from a file
+	PersistKeys     string
+	PersistKeysFile string
+
+	// Embedded STUN listener (empty disables) and extra ICE server URLs for /ice-servers
+	STUNAddr   string
+	ICEServers []string
+	// UDP echo listener for /whoami (empty disables)
+	WhoamiUDPAddr string
+
+	// Kubernetes Lease leader election for the janitor (needs in-cluster service account)
+	K8sLeaderElection bool
+	K8sLeaseName      string
+	K8sLeaseDuration  time.Duration
+
+	// Proxies whose X-Forwarded-For is trusted (CIDRs or IPs; empty = legacy: trust XFF)
+	TrustedProxies []string
+	// Only clients in these CIDRs or IPs are served, on every route (empty = everyone)
+	AllowCIDRs []string
+	// Audit stream for WS upgrade attempts: "", "stdout", "stderr" or a file path
+	AuditLog string
+	// Comma-separated mmdb files (e.g. GeoLite2-Country, GeoLite2-ASN) for country/ASN
+	// enrichment of WS logs, audit records and metrics (empty disables), and the lookup cache size
+	GeoIPDB        string
+	GeoIPCacheSize int
+
+	// Operational logs (HTTP and WS): level, json|console, stderr|stdout|file
+	// path (rotated at LogMaxSizeMB), and "initial/thereafter" sampling per
+	// message and second ("0" = off); WS logs have their own sampling.
+	LogLevel      string
+	LogFormat     string
+	LogOutput     string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogSample     string
+	LogWSSample   string
+	// Frame contents in logs are always stripped of SDP addresses and
+	// candidate IPs; these add comma-separated JSON field paths to blank out
+	// and a regexp whose matches are replaced
+	LogRedactFields  string
+	LogRedactPattern string
+
+	// Bearer token for /admin endpoints (empty disables the admin API)
+	AdminToken string
 
 	// Simple per-minute rate limits (0 disables)
 	WSRatePerMin   int
 	HTTPRatePerMin int
+	// /readyz fails when the numeric code keyspace is fuller than this percent (0 disables)
+	RendezvousReadyMaxUtil float64
+	// Separate bucket for POST /rendezvous/codes/batch
+	BatchRatePerMin int
+	// Separate, stricter bucket for GET /rendezvous/check, and checks allowed per code and TTL
+	CheckRatePerMin      int
+	RendezvousCheckLimit int
+	// redis:// URL; when set, the per-minute limits are shared by all instances
+	RateLimitRedisURL string
+	// "name:algorithm,..." per limiter (ws, http, batch, check); see middleware.Algorithm
+	RateLimitAlgorithms string
+	// Circuit breaker around Redis: consecutive failures to open it, and how
+	// long to count locally before probing again
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// While the breaker is open: "local" keeps /readyz at 200 (reporting the
+	// dependency as degraded), "unready" makes it 503
+	FailsafeMode string
+
+	// Histogram bucket overrides (nil keeps the built-in defaults)
+	BucketsTTF          []float64
+	BucketsRTT          []float64
+	BucketsRelayLatency []float64
+	BucketsFrameSize    []float64
+	// Metric groups not collected, for privacy: "signal", "rtt", "geo"
+	MetricsDisable []string
+
+	// Prefix the variables were looked up with, and the bare names that were
+	// used as a fallback (logged as deprecated at startup)
+	EnvPrefix     string
+	DeprecatedEnv []string
 }
 
 func (c Config) BindAddr() string { return fmt.Sprintf("%s:%d", c.Host, c.Port) }
 
+// Load reads the configuration from the environment. Every variable is looked
+// up with the prefix first (NT_PORT, then PORT); see DefaultEnvPrefix.
 func Load() Config {
-	return Config{
-		Host:              getenv("HOST", "0.0.0.0"),
-		Port:              getenvInt("PORT", 8080),
-		RoomTTL:           getenvDur("ROOM_TTL", 10*time.Minute),
-		Heartbeat:         getenvDur("WS_HEARTBEAT", 60*time.Second),
-		Handshake:         getenvDur("WS_HANDSHAKE", 10*time.Second),
-		MetricsRoute:      getenv("METRICS_ROUTE", "/metrics"),
-		DevMode:           strings.EqualFold(getenv("DEV", "false"), "true"),
-		CORSOrigins:       splitCSV(getenv("CORS_ORIGINS", "")),
-		WSReadBuf:         getenvInt("WS_READ_BUFFER", 64<<10),
-		WSWriteBuf:        getenvInt("WS_WRITE_BUFFER", 64<<10),
-		WSMaxMsg:          int64(getenvInt("WS_MAX_MSG", 1<<20)),
-		ReadHeaderTimeout: getenvDur("READ_HEADER_TIMEOUT", 5*time.Second),
-		WriteTimeout:      getenvDur("WRITE_TIMEOUT", 0),
-		IdleTimeout:       getenvDur("IDLE_TIMEOUT", 0),
-		TLSCertFile:       getenv("TLS_CERT_FILE", ""),
-		TLSKeyFile:        getenv("TLS_KEY_FILE", ""),
-		WSRatePerMin:      getenvInt("WS_RATE_PER_MIN", 0),
-		HTTPRatePerMin:    getenvInt("HTTP_RATE_PER_MIN", 0),
+	e := newEnv()
+	c := Config{
+		Host:                     e.getenv("HOST", "0.0.0.0"),
+		Port:                     e.getenvInt("PORT", 8080),
+		RoomTTL:                  e.getenvDur("ROOM_TTL", 10*time.Minute),
+		Heartbeat:                e.getenvDur("WS_HEARTBEAT", 60*time.Second),
+		Handshake:                e.getenvDur("WS_HANDSHAKE", 10*time.Second),
+		MetricsRoute:             e.getenv("METRICS_ROUTE", "/metrics"),
+		DevMode:                  strings.EqualFold(e.getenv("DEV", "false"), "true"),
+		CORSOrigins:              splitCSV(e.getenv("CORS_ORIGINS", "")),
+		OriginCallbackURL:        e.getenv("ORIGIN_CALLBACK_URL", ""),
+		OriginCallbackTTL:        e.getenvDur("ORIGIN_CALLBACK_TTL", 5*time.Minute),
+		WSReadBuf:                e.getenvInt("WS_READ_BUFFER", 64<<10),
+		WSWriteBuf:               e.getenvInt("WS_WRITE_BUFFER", 64<<10),
+		WSBuffersAuto:            strings.EqualFold(e.getenv("WS_BUFFERS_AUTO", "false"), "true"),
+		WSWriteBufferPool:        strings.EqualFold(e.getenv("WS_WRITE_BUFFER_POOL", "false"), "true"),
+		WSMaxMsg:                 int64(e.getenvInt("WS_MAX_MSG", 1<<20)),
+		HeartbeatMin:             e.getenvDur("WS_HEARTBEAT_MIN", 0),
+		HeartbeatMax:             e.getenvDur("WS_HEARTBEAT_MAX", 0),
+		HeartbeatWidenAfter:      e.getenvInt("WS_HEARTBEAT_WIDEN_AFTER", 5),
+		GlareWindow:              e.getenvDur("GLARE_WINDOW", 0),
+		MinClientVersions:        e.getenv("MIN_CLIENT_VERSIONS", ""),
+		FeatureFlags:             e.getenv("FEATURE_FLAGS", ""),
+		FeatureFlagsURL:          e.getenv("FEATURE_FLAGS_URL", ""),
+		FeatureFlagsInterval:     e.getenvDur("FEATURE_FLAGS_INTERVAL", 30*time.Second),
+		WSSelfPair:               e.getenv("WS_SELF_PAIR", "warn"),
+		WSTraceFrames:            e.getenvInt("WS_TRACE_FRAMES", 32),
+		RoomMetaMaxBytes:         e.getenvInt("ROOM_META_MAX_BYTES", 4096),
+		RoomResumeGrace:          e.getenvDur("ROOM_RESUME_GRACE", 30*time.Second),
+		MailboxOfferMaxAge:       e.getenvDur("MAILBOX_OFFER_MAX_AGE", 0),
+		ChaosLatency:             e.getenvDur("CHAOS_LATENCY", 0),
+		ChaosJitter:              e.getenvDur("CHAOS_JITTER", 0),
+		ChaosDrop:                e.getenvFloat("CHAOS_DROP", 0),
+		ChaosSeed:                e.getenvInt("CHAOS_SEED", 1),
+		LogLevel:                 e.getenv("LOG_LEVEL", "info"),
+		LogFormat:                e.getenv("LOG_FORMAT", "json"),
+		LogOutput:                e.getenv("LOG_OUTPUT", "stderr"),
+		LogMaxSizeMB:             e.getenvInt("LOG_MAX_SIZE_MB", 100),
+		LogMaxBackups:            e.getenvInt("LOG_MAX_BACKUPS", 5),
+		LogSample:                e.getenv("LOG_SAMPLE", "100/100"),
+		LogWSSample:              e.getenv("LOG_WS_SAMPLE", "0"),
+		LogRedactFields:          e.getenv("LOG_REDACT_FIELDS", ""),
+		LogRedactPattern:         e.getenv("LOG_REDACT_PATTERN", ""),
+		Region:                   e.getenv("REGION", ""),
+		RegionURLs:               e.getenv("REGION_URLS", ""),
+		AltEndpoints:             e.getenv("ALT_ENDPOINTS", ""),
+		MaxCodesPerOwner:         e.getenvInt("RENDEZVOUS_MAX_CODES_PER_OWNER", 0),
+		MaxSessionDuration:       e.getenvDur("MAX_SESSION_DURATION", 0),
+		MaxSessionWarn:           e.getenvDur("MAX_SESSION_WARN", time.Minute),
+		MaxSessionExemptKeys:     e.getenv("MAX_SESSION_EXEMPT_KEYS", ""),
+		RendezvousMultiRedeem:    strings.EqualFold(e.getenv("RENDEZVOUS_MULTI_REDEEM", "false"), "true"),
+		RendezvousIdempotencyTTL: e.getenvDur("RENDEZVOUS_IDEMPOTENCY_TTL", 10*time.Minute),
+		MaxRoomsPerOwner:         e.getenvInt("WS_MAX_ROOMS_PER_OWNER", 0),
+		MaxUnpairedRooms:         e.getenvInt("MAX_UNPAIRED_ROOMS", 0),
+		FanoutMaxViewers:         e.getenvInt("FANOUT_MAX_VIEWERS", 100),
+		TenantKeys:               e.getenv("TENANT_KEYS", ""),
+		WSLabelMetrics:           splitCSV(e.getenv("WS_LABEL_METRICS", "platform")),
+		AppIDFormats:             e.getenv("APPID_FORMATS", "uuidv4"),
+		ClientBranding:           e.getenv("CLIENT_BRANDING", ""),
+		WSAuthSecret:             e.getenv("WS_AUTH_SECRET", ""),
+		WSAuthTimeout:            e.getenvDur("WS_AUTH_TIMEOUT", 5*time.Second),
+		WSTicketSecret:           e.getenv("WS_TICKET_SECRET", ""),
+		WSTicketTTL:              e.getenvDur("WS_TICKET_TTL", time.Minute),
+		WebhookURL:               e.getenv("WEBHOOK_URL", ""),
+		WebhookSecret:            e.getenv("WEBHOOK_SECRET", ""),
+		WebhookMaxAttempts:       e.getenvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		PushVAPIDPublicKey:       e.getenv("PUSH_VAPID_PUBLIC_KEY", ""),
+		PushVAPIDPrivateKey:      e.getenv("PUSH_VAPID_PRIVATE_KEY", ""),
+		PushVAPIDSubject:         e.getenv("PUSH_VAPID_SUBJECT", ""),
+		PushFCMCredentialsFile:   e.getenv("PUSH_FCM_CREDENTIALS_FILE", ""),
+		PushTitle:                e.getenv("PUSH_TITLE", "Your peer is waiting"),
+		PushBody:                 e.getenv("PUSH_BODY", "Open the app to connect."),
+		PushSubscriptionTTL:      e.getenvDur("PUSH_SUBSCRIPTION_TTL", time.Hour),
+		WSMsgRate:                e.getenvInt("WS_MSG_RATE", 0),
+		WSMsgBurst:               e.getenvInt("WS_MSG_BURST", 0),
+		RoomMsgRate:              e.getenvInt("ROOM_MSG_RATE", 0),
+		RoomMsgBurst:             e.getenvInt("ROOM_MSG_BURST", 0),
+		RoomMaxFrames:            e.getenvInt("ROOM_MAX_FRAMES", 0),
+		RoomMaxFramesPerMin:      e.getenvInt("ROOM_MAX_FRAMES_PER_MIN", 0),
+		TelemetryMaxPerConn:      e.getenvInt("TELEMETRY_MAX_PER_CONN", 64),
+		TelemetryRequireSeq:      strings.EqualFold(e.getenv("TELEMETRY_REQUIRE_SEQ", "false"), "true"),
+		ReadHeaderTimeout:        e.getenvDur("READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:             e.getenvDur("WRITE_TIMEOUT", 0),
+		IdleTimeout:              e.getenvDur("IDLE_TIMEOUT", 0),
+		DrainDelay:               e.getenvDur("DRAIN_DELAY", 0),
+		TCPKeepAlive:             e.getenvDur("TCP_KEEPALIVE", 0),
+		TCPNoDelay:               !strings.EqualFold(e.getenv("TCP_NODELAY", "true"), "false"),
+		ReusePort:                strings.EqualFold(e.getenv("SO_REUSEPORT", "false"), "true"),
+		H2C:                      strings.EqualFold(e.getenv("H2C", "false"), "true"),
+		WSRequireTLS:             strings.EqualFold(e.getenv("WS_REQUIRE_TLS", "false"), "true"),
+		TLSCertFile:              e.getenv("TLS_CERT_FILE", ""),
+		TLSKeyFile:               e.getenv("TLS_KEY_FILE", ""),
+		TLSCerts:                 splitCSV(e.getenv("TLS_CERTS", "")),
+		SecurityHeaders:          strings.EqualFold(e.getenv("SECURITY_HEADERS", "true"), "true"),
+		HSTSMaxAge:               e.getenvDur("HSTS_MAX_AGE", 365*24*time.Hour),
+		AdminCSP:                 e.getenv("ADMIN_CSP", ""),
+		PersistDir:               e.getenv("PERSIST_DIR", ""),
+		HubSnapshot:              strings.EqualFold(e.getenv("HUB_SNAPSHOT", "false"), "true"),
+		PersistKeys:              e.getenv("PERSIST_KEYS", ""),
+		PersistKeysFile:          e.getenv("PERSIST_KEYS_FILE", ""),
+		AdminToken:               e.getenv("ADMIN_TOKEN", ""),
+		WSRatePerMin:             e.getenvInt("WS_RATE_PER_MIN", 0),
+		HTTPRatePerMin:           e.getenvInt("HTTP_RATE_PER_MIN", 0),
+		RendezvousReadyMaxUtil:   e.getenvFloat("RENDEZVOUS_READY_MAX_UTIL", 90),
+		BatchRatePerMin:          e.getenvInt("BATCH_RATE_PER_MIN", 0),
+		CheckRatePerMin:          e.getenvInt("CHECK_RATE_PER_MIN", 10),
+		RendezvousCheckLimit:     e.getenvInt("RENDEZVOUS_CHECK_LIMIT", 5),
+		RateLimitRedisURL:        e.getenv("RATE_LIMIT_REDIS_URL", ""),
+		RateLimitAlgorithms:      e.getenv("RATE_LIMIT_ALGORITHMS", ""),
+		BreakerFailures:          e.getenvInt("BREAKER_FAILURES", 5),
+		BreakerCooldown:          e.getenvDur("BREAKER_COOLDOWN", 10*time.Second),
+		FailsafeMode:             e.getenv("FAILSAFE_MODE", "local"),
+		STUNAddr:                 e.getenv("STUN_ADDR", ""),
+		ICEServers:               splitCSV(e.getenv("ICE_SERVERS", "")),
+		WhoamiUDPAddr:            e.getenv("WHOAMI_UDP_ADDR", ""),
+		K8sLeaderElection:        strings.EqualFold(e.getenv("K8S_LEADER_ELECTION", "false"), "true"),
+		K8sLeaseName:             e.getenv("K8S_LEASE_NAME", "nt-backend-janitor"),
+		K8sLeaseDuration:         e.getenvDur("K8S_LEASE_DURATION", 15*time.Second),
+		TrustedProxies:           splitCSV(e.getenv("TRUSTED_PROXIES", "")),
+		AllowCIDRs:               splitCSV(e.getenv("ALLOW_CIDRS", "")),
+		AuditLog:                 e.getenv("AUDIT_LOG", ""),
+		GeoIPDB:                  e.getenv("GEOIP_DB", ""),
+		GeoIPCacheSize:           e.getenvInt("GEOIP_CACHE_SIZE", 10000),
+
+		BucketsTTF:          e.getenvFloats("METRICS_BUCKETS_TTF"),
+		BucketsRTT:          e.getenvFloats("METRICS_BUCKETS_RTT"),
+		BucketsRelayLatency: e.getenvFloats("METRICS_BUCKETS_RELAY_LATENCY"),
+		BucketsFrameSize:    e.getenvFloats("METRICS_BUCKETS_FRAME_SIZE"),
+		MetricsDisable:      splitCSV(e.getenv("METRICS_DISABLE", "")),
 	}
+	c.MailboxTTL = e.getenvDur("MAILBOX_TTL", c.RoomTTL)
+	c.DropBoxTTL = e.getenvDur("DROPBOX_TTL", c.RoomTTL)
+	// parked peers never ping more often than paired ones
+	c.WSParkedHeartbeat = e.getenvDur("WS_PARKED_HEARTBEAT", max(5*time.Minute, c.Heartbeat, c.HeartbeatMax))
+	c.EnvPrefix, c.DeprecatedEnv = e.prefix, e.deprecated
+	return c
 }
 
 // internal/config/config.go
@@ -71,9 +407,186 @@ func (c Config) Validate() error {
 	if c.Heartbeat <= 0 {
 		return fmt.Errorf("WS_HEARTBEAT must be >0")
 	}
+	if (c.HeartbeatMin > 0 || c.HeartbeatMax > 0) && (c.HeartbeatMin <= 0 || c.HeartbeatMin > c.HeartbeatMax) {
+		return fmt.Errorf("WS_HEARTBEAT_MIN/MAX must both be >0 with MIN <= MAX")
+	}
+	if c.WSParkedHeartbeat < max(c.Heartbeat, c.HeartbeatMax) {
+		return fmt.Errorf("WS_PARKED_HEARTBEAT must be >= WS_HEARTBEAT and WS_HEARTBEAT_MAX")
+	}
+	if c.WSAuthSecret != "" && c.WSAuthTimeout <= 0 {
+		return fmt.Errorf("WS_AUTH_TIMEOUT must be >0")
+	}
+	if c.WSTicketSecret != "" && c.WSTicketTTL <= 0 {
+		return fmt.Errorf("WS_TICKET_TTL must be >0")
+	}
+	if c.OriginCallbackURL != "" && c.OriginCallbackTTL <= 0 {
+		return fmt.Errorf("ORIGIN_CALLBACK_TTL must be >0")
+	}
+	if c.MaxCodesPerOwner < 0 || c.MaxRoomsPerOwner < 0 {
+		return fmt.Errorf("RENDEZVOUS_MAX_CODES_PER_OWNER and WS_MAX_ROOMS_PER_OWNER must be >=0")
+	}
+	if c.FanoutMaxViewers <= 0 {
+		return fmt.Errorf("FANOUT_MAX_VIEWERS must be >0")
+	}
+	if c.MaxUnpairedRooms < 0 {
+		return fmt.Errorf("MAX_UNPAIRED_ROOMS must be >=0")
+	}
+	if c.GeoIPDB != "" && c.GeoIPCacheSize <= 0 {
+		return fmt.Errorf("GEOIP_CACHE_SIZE must be >0")
+	}
+	if c.RoomMaxFrames < 0 || c.RoomMaxFramesPerMin < 0 {
+		return fmt.Errorf("ROOM_MAX_FRAMES and ROOM_MAX_FRAMES_PER_MIN must be >=0")
+	}
+	if c.BreakerFailures <= 0 || c.BreakerCooldown <= 0 {
+		return fmt.Errorf("BREAKER_FAILURES and BREAKER_COOLDOWN must be >0")
+	}
+	if c.FailsafeMode != "local" && c.FailsafeMode != "unready" {
+		return fmt.Errorf("invalid FAILSAFE_MODE %q (want local or unready)", c.FailsafeMode)
+	}
+	if c.RendezvousCheckLimit <= 0 {
+		return fmt.Errorf("RENDEZVOUS_CHECK_LIMIT must be >0")
+	}
+	if b := strings.TrimSpace(c.ClientBranding); b != "" && (!json.Valid([]byte(b)) || b[0] != '{') {
+		return fmt.Errorf("CLIENT_BRANDING must be a JSON object")
+	}
+	if c.GlareWindow < 0 {
+		return fmt.Errorf("GLARE_WINDOW must be >=0")
+	}
+	if c.RendezvousReadyMaxUtil < 0 || c.RendezvousReadyMaxUtil > 100 {
+		return fmt.Errorf("RENDEZVOUS_READY_MAX_UTIL must be 0..100")
+	}
+	if c.K8sLeaderElection && c.K8sLeaseDuration < 3*time.Second {
+		return fmt.Errorf("K8S_LEASE_DURATION must be >=3s")
+	}
+	if c.PersistKeys != "" && c.PersistKeysFile != "" {
+		return fmt.Errorf("set at most one of PERSIST_KEYS and PERSIST_KEYS_FILE")
+	}
+	if c.MaxSessionDuration < 0 || c.MaxSessionWarn < 0 {
+		return fmt.Errorf("MAX_SESSION_DURATION and MAX_SESSION_WARN must be >= 0")
+	}
+	if c.HSTSMaxAge < 0 {
+		return fmt.Errorf("HSTS_MAX_AGE must be >= 0")
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+	if c.LogFormat != "json" && c.LogFormat != "console" {
+		return fmt.Errorf("LOG_FORMAT must be json or console")
+	}
+	if c.LogMaxSizeMB < 0 || c.LogMaxBackups < 0 {
+		return fmt.Errorf("LOG_MAX_SIZE_MB and LOG_MAX_BACKUPS must be >= 0")
+	}
+	if c.WSTraceFrames < 0 {
+		return fmt.Errorf("WS_TRACE_FRAMES must be >= 0")
+	}
+	if c.RoomMetaMaxBytes < 0 {
+		return fmt.Errorf("ROOM_META_MAX_BYTES must be >= 0")
+	}
+	if c.MailboxOfferMaxAge < 0 {
+		return fmt.Errorf("MAILBOX_OFFER_MAX_AGE must be >=0")
+	}
+	if c.FeatureFlagsURL != "" && c.FeatureFlagsInterval <= 0 {
+		return fmt.Errorf("FEATURE_FLAGS_INTERVAL must be >0")
+	}
+	if c.MailboxTTL < 0 {
+		return fmt.Errorf("MAILBOX_TTL must be >=0")
+	}
+	if c.DropBoxTTL < 0 || (c.MailboxTTL > 0 && c.DropBoxTTL > c.MailboxTTL) {
+		return fmt.Errorf("DROPBOX_TTL must be >=0 and at most MAILBOX_TTL")
+	}
+	if c.RoomResumeGrace < 0 {
+		return fmt.Errorf("ROOM_RESUME_GRACE must be >= 0")
+	}
+	if c.ChaosLatency < 0 || c.ChaosJitter < 0 || c.ChaosDrop < 0 || c.ChaosDrop > 1 {
+		return fmt.Errorf("CHAOS_LATENCY and CHAOS_JITTER must be >= 0, CHAOS_DROP within [0,1]")
+	}
+	if (c.ChaosLatency > 0 || c.ChaosJitter > 0 || c.ChaosDrop > 0) && !c.DevMode {
+		return fmt.Errorf("CHAOS_* network conditions require DEV=true")
+	}
+	if (c.PushVAPIDPublicKey == "") != (c.PushVAPIDPrivateKey == "") {
+		return fmt.Errorf("set both or neither of PUSH_VAPID_PUBLIC_KEY and PUSH_VAPID_PRIVATE_KEY")
+	}
+	if c.PushVAPIDPrivateKey != "" && c.PushVAPIDSubject == "" {
+		return fmt.Errorf("PUSH_VAPID_SUBJECT (mailto: or https: contact) is required for WebPush")
+	}
+	if c.PushSubscriptionTTL <= 0 {
+		return fmt.Errorf("PUSH_SUBSCRIPTION_TTL must be > 0")
+	}
+	if c.WebhookMaxAttempts < 1 {
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be >= 1")
+	}
+	if c.RegionURLs != "" && c.Region == "" {
+		return fmt.Errorf("REGION_URLS requires REGION")
+	}
+	if c.HubSnapshot && c.PersistDir == "" {
+		return fmt.Errorf("HUB_SNAPSHOT requires PERSIST_DIR")
+	}
 	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
 		return fmt.Errorf("both TLS_CERT_FILE and TLS_KEY_FILE must be set, or none")
 	}
+	for _, p := range c.TLSCerts {
+		if cert, key, ok := strings.Cut(p, ":"); !ok || cert == "" || key == "" {
+			return fmt.Errorf("TLS_CERTS entries must be cert:key, got %q", p)
+		}
+	}
+	for k, b := range map[string][]float64{
+		"METRICS_BUCKETS_TTF":           c.BucketsTTF,
+		"METRICS_BUCKETS_RTT":           c.BucketsRTT,
+		"METRICS_BUCKETS_RELAY_LATENCY": c.BucketsRelayLatency,
+		"METRICS_BUCKETS_FRAME_SIZE":    c.BucketsFrameSize,
+	} {
+		if b == nil {
+			continue
+		}
+		if err := validateBuckets(b); err != nil {
+			return fmt.Errorf("invalid %s: %w", k, err)
+		}
+	}
+	for _, k := range c.WSLabelMetrics {
+		if !validLabelKey(k) {
+			return fmt.Errorf("invalid WS_LABEL_METRICS: key %q (want [a-z0-9_.-], at most 32 bytes)", k)
+		}
+	}
+	for _, g := range c.MetricsDisable {
+		if !slices.Contains(metricGroups, g) {
+			return fmt.Errorf("invalid METRICS_DISABLE: unknown group %q (want one of %v)", g, metricGroups)
+		}
+	}
+	return nil
+}
+
+// metricGroups are the groups METRICS_DISABLE accepts (metrics.Groups).
+var metricGroups = []string{"signal", "rtt", "geo"}
+
+// validLabelKey mirrors the hub's rule for connection label keys.
+func validLabelKey(k string) bool {
+	if k == "" || len(k) > 32 {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateBuckets requires a non-empty, positive, strictly increasing list.
+func validateBuckets(b []float64) error {
+	if len(b) == 0 {
+		return fmt.Errorf("empty or unparsable bucket list")
+	}
+	for i, v := range b {
+		if v <= 0 {
+			return fmt.Errorf("bucket %v must be >0", v)
+		}
+		if i > 0 && v <= b[i-1] {
+			return fmt.Errorf("buckets must be strictly increasing")
+		}
+	}
 	return nil
 }
 
@@ -92,25 +605,89 @@ func splitCSV(v string) []string {
 	return out
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
+// DefaultEnvPrefix is prepended to every variable name unless ENV_PREFIX
+// (itself never prefixed) says otherwise; ENV_PREFIX= turns prefixing off.
+// The bare names still work, as a deprecated fallback for the prefixed ones.
+const DefaultEnvPrefix = "NT_"
+
+// env looks up prefixed variables and records the bare names it fell back to.
+type env struct {
+	prefix     string
+	deprecated []string
+}
+
+func newEnv() *env {
+	p, ok := os.LookupEnv("ENV_PREFIX")
+	if !ok {
+		p = DefaultEnvPrefix
+	}
+	return &env{prefix: p}
+}
+
+// lookup returns the value of prefix+k, else of k (recording k as deprecated).
+func (e *env) lookup(k string) string {
+	if e.prefix == "" {
+		return os.Getenv(k)
+	}
+	if v := os.Getenv(e.prefix + k); v != "" {
+		return v
+	}
+	v := os.Getenv(k)
+	if v != "" && !slices.Contains(e.deprecated, k) {
+		e.deprecated = append(e.deprecated, k)
+	}
+	return v
+}
+
+func (e *env) getenv(k, def string) string {
+	if v := e.lookup(k); v != "" {
 		return v
 	}
 	return def
 }
-func getenvInt(k string, def int) int {
-	if v := os.Getenv(k); v != "" {
+func (e *env) getenvInt(k string, def int) int {
+	if v := e.lookup(k); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			return n
 		}
 	}
 	return def
 }
-func getenvDur(k string, def time.Duration) time.Duration {
-	if v := os.Getenv(k); v != "" {
+func (e *env) getenvFloat(k string, def float64) float64 {
+	if v := e.lookup(k); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+func (e *env) getenvDur(k string, def time.Duration) time.Duration {
+	if v := e.lookup(k); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
 			return d
 		}
 	}
 	return def
 }
+
+// getenvFloats parses a comma-separated list of floats. Unset returns nil;
+// a set but unparsable value returns an empty (non-nil) slice so Validate rejects it.
+func (e *env) getenvFloats(k string) []float64 {
+	v := e.lookup(k)
+	if v == "" {
+		return nil
+	}
+	out := []float64{}
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return []float64{}
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package config_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+)
+
+func TestLoadEnvPrefix(t *testing.T) {
+	t.Setenv("NT_PORT", "9001")
+	t.Setenv("PORT", "9002")
+	t.Setenv("ROOM_TTL", "3m")
+	c := config.Load()
+	if c.Port != 9001 {
+		t.Fatalf("prefixed name should win: port %d", c.Port)
+	}
+	if c.RoomTTL != 3*time.Minute {
+		t.Fatalf("bare name fallback: ROOM_TTL %v", c.RoomTTL)
+	}
+	if c.EnvPrefix != config.DefaultEnvPrefix || !slices.Equal(c.DeprecatedEnv, []string{"ROOM_TTL"}) {
+		t.Fatalf("prefix %q, deprecated %v", c.EnvPrefix, c.DeprecatedEnv)
+	}
+
+	t.Setenv("ENV_PREFIX", "SIG_")
+	t.Setenv("SIG_PORT", "9003")
+	if c := config.Load(); c.Port != 9003 {
+		t.Fatalf("custom prefix: port %d", c.Port)
+	}
+
+	// prefixing off: bare names are current, not deprecated
+	t.Setenv("ENV_PREFIX", "")
+	if c := config.Load(); c.Port != 9002 || len(c.DeprecatedEnv) != 0 {
+		t.Fatalf("no prefix: port %d, deprecated %v", c.Port, c.DeprecatedEnv)
+	}
+}
+
+func TestLoadOriginCallback(t *testing.T) {
+	if c := config.Load(); c.OriginCallbackURL != "" || c.OriginCallbackTTL != 5*time.Minute {
+		t.Fatalf("defaults: %q %v", c.OriginCallbackURL, c.OriginCallbackTTL)
+	}
+	t.Setenv("NT_ORIGIN_CALLBACK_URL", "https://auth.example/origin")
+	t.Setenv("NT_ORIGIN_CALLBACK_TTL", "30s")
+	c := config.Load()
+	if c.OriginCallbackURL != "https://auth.example/origin" || c.OriginCallbackTTL != 30*time.Second {
+		t.Fatalf("loaded: %q %v", c.OriginCallbackURL, c.OriginCallbackTTL)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c.OriginCallbackTTL = 0
+	if err := c.Validate(); err == nil {
+		t.Fatal("zero ORIGIN_CALLBACK_TTL accepted with a callback URL")
+	}
+}
+
+func TestLoadSTUNAndICE(t *testing.T) {
+	t.Setenv("NT_STUN_ADDR", ":3478")
+	t.Setenv("NT_ICE_SERVERS", "stun:stun.example:3478, turn:turn.example:3478")
+	c := config.Load()
+	if c.STUNAddr != ":3478" || !slices.Equal(c.ICEServers, []string{"stun:stun.example:3478", "turn:turn.example:3478"}) {
+		t.Fatalf("STUN %q, ICE %v", c.STUNAddr, c.ICEServers)
+	}
+}
+
+func TestLoadK8sLease(t *testing.T) {
+	if c := config.Load(); c.K8sLeaderElection || c.K8sLeaseName != "nt-backend-janitor" || c.K8sLeaseDuration != 15*time.Second {
+		t.Fatalf("defaults: %v %q %v", c.K8sLeaderElection, c.K8sLeaseName, c.K8sLeaseDuration)
+	}
+	t.Setenv("NT_K8S_LEADER_ELECTION", "true")
+	t.Setenv("NT_K8S_LEASE_NAME", "sig-janitor")
+	t.Setenv("NT_K8S_LEASE_DURATION", "2s")
+	c := config.Load()
+	if !c.K8sLeaderElection || c.K8sLeaseName != "sig-janitor" || c.K8sLeaseDuration != 2*time.Second {
+		t.Fatalf("loaded: %v %q %v", c.K8sLeaderElection, c.K8sLeaseName, c.K8sLeaseDuration)
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatal("K8S_LEASE_DURATION below 3s accepted")
+	}
+}
+
+func TestLoadRendezvousReadyMaxUtil(t *testing.T) {
+	if c := config.Load(); c.RendezvousReadyMaxUtil != 90 {
+		t.Fatalf("default: %v", c.RendezvousReadyMaxUtil)
+	}
+	t.Setenv("NT_RENDEZVOUS_READY_MAX_UTIL", "0")
+	if c := config.Load(); c.RendezvousReadyMaxUtil != 0 {
+		t.Fatalf("disabled: %v", c.RendezvousReadyMaxUtil)
+	}
+	t.Setenv("NT_RENDEZVOUS_READY_MAX_UTIL", "120")
+	if err := config.Load().Validate(); err == nil {
+		t.Fatal("RENDEZVOUS_READY_MAX_UTIL above 100 accepted")
+	}
+}
+
+func TestLoadMetricsBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		name, env string
+		want      []float64
+		ok        bool
+	}{
+		{"unset", "", nil, true},
+		{"list", "0.01, 0.1,1", []float64{0.01, 0.1, 1}, true},
+		{"empty entries", "1,,2,", []float64{1, 2}, true},
+		{"unparsable", "1,fast,3", []float64{}, false},
+		{"only commas", ",,", []float64{}, false},
+		{"equal", "1,1,2", []float64{1, 1, 2}, false},
+		{"decreasing", "2,1", []float64{2, 1}, false},
+		{"zero", "0,1", []float64{0, 1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NT_METRICS_BUCKETS_RTT", tc.env)
+			c := config.Load()
+			if !slices.Equal(c.BucketsRTT, tc.want) || (c.BucketsRTT == nil) != (tc.want == nil) {
+				t.Fatalf("BucketsRTT = %#v, want %#v", c.BucketsRTT, tc.want)
+			}
+			if err := c.Validate(); (err == nil) != tc.ok {
+				t.Fatalf("Validate() = %v, want ok=%v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestLoadParkedHeartbeat(t *testing.T) {
+	if c := config.Load(); c.WSParkedHeartbeat != 5*time.Minute {
+		t.Fatalf("default: %v", c.WSParkedHeartbeat)
+	}
+	// a long heartbeat set before parking existed still starts
+	t.Setenv("NT_WS_HEARTBEAT", "10m")
+	c := config.Load()
+	if c.WSParkedHeartbeat != 10*time.Minute {
+		t.Fatalf("default follows WS_HEARTBEAT: %v", c.WSParkedHeartbeat)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NT_WS_HEARTBEAT", "30s")
+	t.Setenv("NT_WS_HEARTBEAT_MIN", "10s")
+	t.Setenv("NT_WS_HEARTBEAT_MAX", "20m")
+	if c := config.Load(); c.WSParkedHeartbeat != 20*time.Minute {
+		t.Fatalf("default follows WS_HEARTBEAT_MAX: %v", c.WSParkedHeartbeat)
+	}
+	t.Setenv("NT_WS_PARKED_HEARTBEAT", "10m")
+	if err := config.Load().Validate(); err == nil {
+		t.Fatal("WS_PARKED_HEARTBEAT below WS_HEARTBEAT_MAX accepted")
+	}
+}
@@ -0,0 +1,287 @@
+// Package flags holds protocol feature flags that can be flipped at runtime
+// across a fleet: each instance starts from its local settings and, if
+// given a config service URL, polls it and applies the flags it serves.
+// While the service is unreachable the last flags fetched stay in force;
+// after staleAfter missed polls the instance falls back to its local
+// settings, so a dead config service can't pin a fleet to a bad toggle
+// forever, nor does one failed poll flip everything back.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Known flags. Features negotiated in hello (ice_batch, binary) are left
+// out of the negotiated set while their flag is off; strict_admission off
+// makes the client version policy report violations instead of refusing
+// the connection.
+const (
+	ICEBatch        = "ice_batch"
+	Binary          = "binary"
+	StrictAdmission = "strict_admission"
+)
+
+// Known lists every flag name, each on by default.
+var Known = []string{ICEBatch, Binary, StrictAdmission}
+
+// Defaults for Poll.
+const (
+	DefaultInterval = 30 * time.Second
+	// staleAfter is how many poll intervals the last fetched flags outlive
+	// a failing config service.
+	staleAfter = 3
+	// maxDocument bounds the config service's response body.
+	maxDocument = 64 << 10
+)
+
+// ErrUnknownFlag is returned by Parse for names not in Known.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Parse parses "name=bool[,name=bool...]", e.g. "binary=false,ice_batch=true".
+func Parse(spec string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("%q: want name=true|false", part)
+		}
+		if !slices.Contains(Known, name) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownFlag, name)
+		}
+		on, err := strconv.ParseBool(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%q: want name=true|false", part)
+		}
+		out[name] = on
+	}
+	return out, nil
+}
+
+// Document is what the config service serves: flags missing from it keep
+// their local setting, unknown ones are ignored.
+type Document struct {
+	Version string          `json:"version"`
+	Flags   map[string]bool `json:"flags"`
+}
+
+// Status reports the flags in force and where they came from, for /statusz.
+type Status struct {
+	Flags     map[string]bool `json:"flags"`
+	Source    string          `json:"source"` // local|remote
+	Version   string          `json:"version,omitempty"`
+	AppliedAt time.Time       `json:"appliedAt"`
+	URL       string          `json:"url,omitempty"`
+	LastPoll  time.Time       `json:"lastPoll,omitzero"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// Set is the flags of one instance. A nil *Set has every flag on.
+type Set struct {
+	local    map[string]bool
+	url      string
+	interval time.Duration
+	client   *http.Client
+	lg       *slog.Logger
+	m        *metrics.Metrics
+
+	mu     sync.RWMutex
+	cur    map[string]bool
+	st     Status
+	etag   string
+	lastOK time.Time // last successful poll
+}
+
+// New returns a Set with the local settings applied; flags missing from
+// local are on.
+func New(local map[string]bool) *Set {
+	s := &Set{local: make(map[string]bool, len(Known)), m: metrics.Default}
+	for _, name := range Known {
+		s.local[name] = true
+	}
+	maps.Copy(s.local, local)
+	s.applyLocked(s.local, "local", "")
+	return s
+}
+
+// Poll makes Start fetch url every interval (<= 0: DefaultInterval).
+func (s *Set) Poll(url string, interval time.Duration) *Set {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	s.url, s.interval = url, interval
+	s.client = &http.Client{Timeout: min(interval, 5*time.Second)}
+	s.st.URL = url
+	return s
+}
+
+// Logger reports flag changes and poll failures to lg.
+func (s *Set) Logger(lg *slog.Logger) *Set {
+	s.lg = lg
+	return s
+}
+
+// WithMetrics reports to m instead of metrics.Default.
+func (s *Set) WithMetrics(m *metrics.Metrics) *Set {
+	s.m = m
+	s.report()
+	return s
+}
+
+// Enabled reports whether the flag name is on. Names that aren't flags are
+// always on.
+func (s *Set) Enabled(name string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	on, ok := s.cur[name]
+	return on || !ok
+}
+
+// Status returns the flags in force.
+func (s *Set) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.st
+	st.Flags = maps.Clone(s.cur)
+	return st
+}
+
+// Start polls the config service until ctx is done; without Poll it
+// returns at once.
+func (s *Set) Start(ctx context.Context) {
+	if s.url == "" {
+		return
+	}
+	go func() {
+		t := time.NewTicker(s.interval)
+		defer t.Stop()
+		for {
+			_ = s.Refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// Refresh polls the config service once. On failure the flags fetched last
+// stay in force until they are staleAfter intervals old, then the local
+// settings do.
+func (s *Set) Refresh(ctx context.Context) error {
+	doc, etag, err := s.fetch(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.st.LastPoll = now
+	switch {
+	case err != nil:
+		s.m.FeatureFlagPolls.WithLabelValues("error").Inc()
+		s.st.LastError = err.Error()
+		if s.st.Source == "remote" && now.Sub(s.lastOK) > staleAfter*s.interval {
+			s.etag = ""
+			s.applyLocked(s.local, "local", "")
+			s.logf("feature flags fell back to local settings", "err", err)
+		}
+		return err
+	case doc == nil:
+		s.m.FeatureFlagPolls.WithLabelValues("not_modified").Inc()
+	default:
+		s.m.FeatureFlagPolls.WithLabelValues("ok").Inc()
+		merged := maps.Clone(s.local)
+		for name, on := range doc.Flags {
+			if _, ok := merged[name]; ok {
+				merged[name] = on
+			}
+		}
+		s.etag = etag
+		if s.st.Source != "remote" || s.st.Version != doc.Version || !maps.Equal(merged, s.cur) {
+			s.applyLocked(merged, "remote", doc.Version)
+			s.logf("feature flags applied", "version", doc.Version, "flags", merged)
+		}
+	}
+	s.lastOK, s.st.LastError = now, ""
+	return nil
+}
+
+// fetch returns the config service's document, or nil if it is unchanged
+// since the ETag seen last.
+func (s *Set) fetch(ctx context.Context) (*Document, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	s.mu.RLock()
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.RUnlock()
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return nil, "", nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("config service: %s", res.Status)
+	}
+	var doc Document
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxDocument)).Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("config service: %w", err)
+	}
+	return &doc, res.Header.Get("ETag"), nil
+}
+
+// applyLocked puts flags in force. s.mu must be held for writing.
+func (s *Set) applyLocked(flags map[string]bool, source, version string) {
+	s.cur = maps.Clone(flags)
+	s.st.Source, s.st.Version, s.st.AppliedAt = source, version, time.Now().UTC()
+	s.reportLocked()
+}
+
+func (s *Set) report() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.reportLocked()
+}
+
+func (s *Set) reportLocked() {
+	for name, on := range s.cur {
+		v := 0.0
+		if on {
+			v = 1
+		}
+		s.m.FeatureFlags.WithLabelValues(name).Set(v)
+	}
+}
+
+func (s *Set) logf(msg string, args ...any) {
+	if s.lg != nil {
+		s.lg.Info(msg, args...)
+	}
+}
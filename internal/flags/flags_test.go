@@ -0,0 +1,96 @@
+package flags_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/flags"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestParse(t *testing.T) {
+	got, err := flags.Parse(" binary=false, ice_batch=1 ")
+	if err != nil || got[flags.Binary] || !got[flags.ICEBatch] || len(got) != 2 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := flags.Parse("turbo=true"); !errors.Is(err, flags.ErrUnknownFlag) {
+		t.Fatalf("unknown flag: %v", err)
+	}
+	if _, err := flags.Parse("binary"); err == nil {
+		t.Fatal("missing value accepted")
+	}
+}
+
+func TestPoll(t *testing.T) {
+	var down atomic.Bool
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v7"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v7"`)
+		_, _ = w.Write([]byte(`{"version":"7","flags":{"binary":false,"turbo":true}}`))
+	}))
+	defer srv.Close()
+
+	m := metrics.New()
+	const every = 20 * time.Millisecond
+	fs := flags.New(map[string]bool{flags.ICEBatch: false}).Poll(srv.URL, every).WithMetrics(m)
+	if fs.Enabled(flags.ICEBatch) || !fs.Enabled(flags.Binary) || !fs.Enabled("unflagged") {
+		t.Fatalf("local: %+v", fs.Status())
+	}
+	ctx := context.Background()
+	if err := fs.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	st := fs.Status()
+	if st.Source != "remote" || st.Version != "7" || fs.Enabled(flags.Binary) || fs.Enabled(flags.ICEBatch) || !fs.Enabled(flags.StrictAdmission) {
+		t.Fatalf("remote: %+v", st)
+	}
+	if _, ok := st.Flags["turbo"]; ok {
+		t.Fatal("unknown remote flag applied")
+	}
+	if err := fs.Refresh(ctx); err != nil || notModified.Load() != 1 {
+		t.Fatalf("second poll: %v, 304s: %d", err, notModified.Load())
+	}
+	if got := testutil.ToFloat64(m.FeatureFlags.WithLabelValues(flags.Binary)); got != 0 {
+		t.Fatalf("nt_feature_flag{binary} = %v", got)
+	}
+
+	// a failed poll keeps the remote flags until they go stale
+	down.Store(true)
+	if err := fs.Refresh(ctx); err == nil || fs.Status().Source != "remote" || fs.Enabled(flags.Binary) {
+		t.Fatalf("first failure: %v %+v", err, fs.Status())
+	}
+	time.Sleep(4 * every)
+	_ = fs.Refresh(ctx)
+	if st := fs.Status(); st.Source != "local" || !fs.Enabled(flags.Binary) || st.LastError == "" {
+		t.Fatalf("stale: %+v", st)
+	}
+	if got := testutil.ToFloat64(m.FeatureFlagPolls.WithLabelValues("error")); got != 2 {
+		t.Fatalf("error polls = %v", got)
+	}
+
+	// back up: applied again, without a stale ETag
+	down.Store(false)
+	if err := fs.Refresh(ctx); err != nil || fs.Status().Source != "remote" {
+		t.Fatalf("recovered: %v %+v", err, fs.Status())
+	}
+	if requests.Load() != 5 {
+		t.Fatalf("requests = %d", requests.Load())
+	}
+}
@@ -0,0 +1,145 @@
+// Package geo enriches client addresses with country and ASN from MaxMind DB
+// (mmdb) files, e.g. GeoLite2-Country and GeoLite2-ASN, or DB-IP's lite
+// databases in the same layout. Lookups are cached, since one client usually
+// opens several connections.
+package geo
+
+import (
+	"container/list"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// DefaultCacheSize is the number of addresses kept by Open's cache.
+const DefaultCacheSize = 10000
+
+// Info is what the databases know about an address. Zero fields are unknown.
+type Info struct {
+	Country string // ISO 3166-1 alpha-2, e.g. "DE"
+	ASN     uint64
+	ASOrg   string
+}
+
+// CountryLabel returns Country for use as a metric label: a two-letter code,
+// or "unknown", so a malformed database can't add arbitrary label values.
+func (i Info) CountryLabel() string {
+	c := i.Country
+	if len(c) != 2 || c[0] < 'A' || c[0] > 'Z' || c[1] < 'A' || c[1] > 'Z' {
+		return "unknown"
+	}
+	return c
+}
+
+// Resolver looks addresses up in one or more databases; later databases fill
+// in fields the earlier ones lack. A nil *Resolver is valid and knows nothing.
+type Resolver struct {
+	dbs []*mmdb
+
+	mu    sync.Mutex
+	max   int
+	cache map[netip.Addr]*list.Element
+	lru   *list.List // of cacheEntry, most recent first
+}
+
+type cacheEntry struct {
+	ip   netip.Addr
+	info Info
+}
+
+// Open loads the comma-separated mmdb paths into memory. cacheSize bounds the
+// lookup cache (<= 0: DefaultCacheSize).
+func Open(paths string, cacheSize int) (*Resolver, error) {
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	r := &Resolver{max: cacheSize, cache: make(map[netip.Addr]*list.Element), lru: list.New()}
+	for _, p := range strings.Split(paths, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		db, err := openMMDB(p)
+		if err != nil {
+			return nil, err
+		}
+		r.dbs = append(r.dbs, db)
+	}
+	if len(r.dbs) == 0 {
+		return nil, fmt.Errorf("%w: no database given", ErrFormat)
+	}
+	return r, nil
+}
+
+// Lookup returns what is known about ip (a bare address, as returned by
+// middleware.TrustedProxies.ClientIP). Unparseable addresses are unknown.
+func (r *Resolver) Lookup(ip string) Info {
+	if r == nil {
+		return Info{}
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Info{}
+	}
+	addr = addr.Unmap()
+	r.mu.Lock()
+	if e, ok := r.cache[addr]; ok {
+		r.lru.MoveToFront(e)
+		info := e.Value.(cacheEntry).info
+		r.mu.Unlock()
+		return info
+	}
+	r.mu.Unlock()
+
+	var info Info
+	for _, db := range r.dbs {
+		v, err := db.lookup(addr)
+		if err != nil {
+			continue // a corrupt record is as good as none
+		}
+		m, _ := v.(map[string]any)
+		if info.Country == "" {
+			info.Country = countryOf(m)
+		}
+		if info.ASN == 0 {
+			info.ASN, _ = m["autonomous_system_number"].(uint64)
+		}
+		if info.ASOrg == "" {
+			info.ASOrg, _ = m["autonomous_system_organization"].(string)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cache[addr]; !ok {
+		r.cache[addr] = r.lru.PushFront(cacheEntry{addr, info})
+		if r.lru.Len() > r.max {
+			old := r.lru.Remove(r.lru.Back()).(cacheEntry)
+			delete(r.cache, old.ip)
+		}
+	}
+	return info
+}
+
+// countryOf reads country.iso_code, falling back to registered_country for
+// addresses (e.g. anycast) without a located country.
+func countryOf(m map[string]any) string {
+	for _, k := range []string{"country", "registered_country"} {
+		if c, ok := m[k].(map[string]any); ok {
+			if iso, ok := c["iso_code"].(string); ok && iso != "" {
+				return iso
+			}
+		}
+	}
+	return ""
+}
+
+// CacheLen returns the number of cached addresses.
+func (r *Resolver) CacheLen() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lru.Len()
+}
@@ -0,0 +1,123 @@
+package geo_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo/geotest"
+)
+
+func TestLookup(t *testing.T) {
+	de := geotest.Shared{"iso_code": "DE"}
+	for _, v := range []int{4, 6} {
+		for _, rs := range []int{24, 28, 32} {
+			t.Run(fmt.Sprintf("v%d/%d", v, rs), func(t *testing.T) {
+				records := map[string]map[string]any{
+					"81.2.69.0/24":   {"country": de, "autonomous_system_number": 3320, "autonomous_system_organization": "Deutsche Telekom AG"},
+					"81.2.70.0/23":   {"country": de},
+					"203.0.113.0/24": {"registered_country": geotest.Shared{"iso_code": "AU"}},
+				}
+				if v == 6 {
+					records["2001:db8::/32"] = map[string]any{"country": geotest.Shared{"iso_code": "US"}, "autonomous_system_number": uint64(1) << 33}
+				}
+				r, err := geo.Open(geotest.WriteDB(t, v, rs, records), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cases := map[string]geo.Info{
+					"81.2.69.160":      {Country: "DE", ASN: 3320, ASOrg: "Deutsche Telekom AG"},
+					"::ffff:81.2.71.1": {Country: "DE"},
+					"203.0.113.9":      {Country: "AU"},
+					"8.8.8.8":          {},
+					"nope":             {},
+				}
+				if v == 6 {
+					cases["2001:db8::1"] = geo.Info{Country: "US", ASN: 1 << 33}
+					cases["2001:db9::1"] = geo.Info{}
+				}
+				for ip, want := range cases {
+					if got := r.Lookup(ip); got != want {
+						t.Errorf("%s: got %+v, want %+v", ip, got, want)
+					}
+					if got := r.Lookup(ip); got != want { // cached
+						t.Errorf("%s cached: got %+v, want %+v", ip, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestOpenMerges(t *testing.T) {
+	country := geotest.WriteDB(t, 6, 24, map[string]map[string]any{"81.2.69.0/24": {"country": geotest.Shared{"iso_code": "DE"}}})
+	asn := geotest.WriteDB(t, 4, 28, map[string]map[string]any{"81.2.0.0/16": {"autonomous_system_number": 3320}})
+	r, err := geo.Open(country+", "+asn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Lookup("81.2.69.1"); got != (geo.Info{Country: "DE", ASN: 3320}) {
+		t.Fatalf("got %+v", got)
+	}
+	for _, ip := range []string{"81.2.1.1", "81.2.1.2", "81.2.1.3"} {
+		r.Lookup(ip)
+	}
+	if n := r.CacheLen(); n != 2 {
+		t.Fatalf("cache len %d, want 2", n)
+	}
+
+	var none *geo.Resolver
+	if got := none.Lookup("81.2.69.1"); got != (geo.Info{}) {
+		t.Fatalf("nil resolver: %+v", got)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	junk := filepath.Join(t.TempDir(), "junk.mmdb")
+	if err := os.WriteFile(junk, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range []string{"", junk} {
+		if _, err := geo.Open(paths, 0); !errors.Is(err, geo.ErrFormat) {
+			t.Errorf("%q: want ErrFormat, got %v", paths, err)
+		}
+	}
+	if _, err := geo.Open(filepath.Join(t.TempDir(), "missing.mmdb"), 0); err == nil {
+		t.Error("missing file: want error")
+	}
+}
+
+func TestOpenCorruptSize(t *testing.T) {
+	// Metadata claiming a ~16M entry map or array in a few bytes of data must
+	// be rejected before anything is allocated for it.
+	for name, body := range map[string]string{"map": "\xFF\xFF\xFF\xFF", "array": "\x1F\x04\xFF\xFF\xFF"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name+".mmdb")
+			if err := os.WriteFile(path, []byte("\xAB\xCD\xEFMaxMind.com"+body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := geo.Open(path, 0)
+			runtime.ReadMemStats(&after)
+			if !errors.Is(err, geo.ErrFormat) {
+				t.Errorf("want ErrFormat, got %v", err)
+			}
+			if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+				t.Errorf("allocated %d bytes for a corrupt size", n)
+			}
+		})
+	}
+}
+
+func TestCountryLabel(t *testing.T) {
+	for c, want := range map[string]string{"DE": "DE", "": "unknown", "de": "unknown", "DEU": "unknown"} {
+		if got := (geo.Info{Country: c}).CountryLabel(); got != want {
+			t.Errorf("%q: got %q, want %q", c, got, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package geotest writes small mmdb files for tests of code using geo.
+package geotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// Shared is a map stored once in the data section and referenced by a
+// pointer from every record that contains it, like MaxMind's country maps.
+type Shared map[string]any
+
+// WriteDB writes an mmdb file with the given records (prefix -> map of
+// string, uint32/uint64/int and map values) and returns its path. IPv4
+// prefixes in an IPv6 database live under ::/96, as in MaxMind's files.
+func WriteDB(t testing.TB, ipVersion, recordSize int, records map[string]map[string]any) string {
+	t.Helper()
+	type rec struct {
+		addr [16]byte
+		bits int
+		data int
+	}
+	var data bytes.Buffer
+	shared := map[string]int{} // encoded Shared map -> offset
+	var recs []rec
+	prefixes := make([]string, 0, len(records))
+	for p := range records {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	for _, p := range prefixes {
+		pfx, err := netip.ParsePrefix(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rec{bits: pfx.Bits(), data: data.Len()}
+		a := pfx.Addr()
+		switch {
+		case a.Is4() && ipVersion == 6:
+			v4 := a.As4()
+			copy(r.addr[12:], v4[:])
+			r.bits += 96
+		case a.Is4():
+			v4 := a.As4()
+			copy(r.addr[:], v4[:])
+		default:
+			if ipVersion == 4 {
+				t.Fatalf("IPv6 prefix %s in an IPv4 database", p)
+			}
+			r.addr = a.As16()
+		}
+		// shared maps first, so records can point back at them
+		for _, v := range records[p] {
+			if s, ok := v.(Shared); ok {
+				var b bytes.Buffer
+				encode(&b, map[string]any(s), nil)
+				if _, ok := shared[b.String()]; !ok {
+					shared[b.String()] = data.Len()
+					data.Write(b.Bytes())
+				}
+			}
+		}
+		r.data = data.Len()
+		encode(&data, records[p], shared)
+		recs = append(recs, r)
+	}
+
+	// search tree: >= 0 node, -1 empty, <= -2 data offset -(x+2)
+	nodes := [][2]int{{-1, -1}}
+	for _, r := range recs {
+		n := 0
+		for i := 0; i < r.bits; i++ {
+			bit := r.addr[i/8] >> (7 - i%8) & 1
+			if i == r.bits-1 {
+				nodes[n][bit] = -(r.data + 2)
+				break
+			}
+			if nodes[n][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[n][bit] = len(nodes) - 1
+			}
+			n = nodes[n][bit]
+		}
+	}
+	count := len(nodes)
+	value := func(v int) uint32 {
+		switch {
+		case v >= 0:
+			return uint32(v)
+		case v == -1:
+			return uint32(count)
+		default:
+			return uint32(count + 16 + (-v - 2))
+		}
+	}
+	var out bytes.Buffer
+	for _, n := range nodes {
+		l, r := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0x0F, byte(r >> 16), byte(r >> 8), byte(r)})
+		case 32:
+			_ = binary.Write(&out, binary.BigEndian, [2]uint32{l, r})
+		default:
+			t.Fatalf("record size %d", recordSize)
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&out, map[string]any{
+		"node_count":    uint32(count),
+		"record_size":   uint32(recordSize),
+		"ip_version":    uint32(ipVersion),
+		"database_type": "geotest",
+	}, nil)
+
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("test-v%d-%d.mmdb", ipVersion, recordSize))
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encode(b *bytes.Buffer, v any, shared map[string]int) {
+	switch v := v.(type) {
+	case string:
+		header(b, 2, len(v))
+		b.WriteString(v)
+	case int:
+		encodeUint(b, uint64(v))
+	case uint32:
+		encodeUint(b, uint64(v))
+	case uint64:
+		encodeUint(b, v)
+	case Shared:
+		var enc bytes.Buffer
+		encode(&enc, map[string]any(v), nil)
+		off, ok := shared[enc.String()]
+		if !ok || off >= 2048 {
+			b.Write(enc.Bytes())
+			return
+		}
+		b.Write([]byte{0x20 | byte(off>>8), byte(off)})
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		header(b, 7, len(v))
+		for _, k := range keys {
+			encode(b, k, shared)
+			encode(b, v[k], shared)
+		}
+	default:
+		panic(fmt.Sprintf("geotest: unsupported value %T", v))
+	}
+}
+
+// encodeUint writes v as uint64 (extended type 9) in as few bytes as needed.
+func encodeUint(b *bytes.Buffer, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	i := 0
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	b.WriteByte(byte(8 - i))
+	b.WriteByte(9 - 7)
+	b.Write(buf[i:])
+}
+
+func header(b *bytes.Buffer, typ, size int) {
+	switch {
+	case size < 29:
+		b.WriteByte(byte(typ<<5 | size))
+	case size < 285:
+		b.Write([]byte{byte(typ<<5 | 29), byte(size - 29)})
+	default:
+		size -= 285
+		b.Write([]byte{byte(typ<<5 | 30), byte(size >> 8), byte(size)})
+	}
+}
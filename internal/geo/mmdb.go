@@ -0,0 +1,287 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metaMarker precedes the metadata map at the end of an mmdb file.
+var metaMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// ErrFormat is returned for files that are not valid mmdb databases.
+var ErrFormat = errors.New("invalid mmdb file")
+
+// mmdb is a minimal reader for the MaxMind DB format: enough to walk the
+// search tree and decode the data section, without pulling in a driver.
+type mmdb struct {
+	buf        []byte
+	nodes      uint32 // node_count
+	recordSize uint16 // bits per record: 24, 28 or 32
+	ipVersion  uint16
+	dataStart  int
+	ipv4Start  uint32 // node after the ::/96 prefix in IPv6 trees
+}
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, metaMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s: no metadata", ErrFormat, path)
+	}
+	meta, _, err := (&mmdb{buf: buf[i+len(metaMarker):]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: metadata: %v", ErrFormat, path, err)
+	}
+	m, _ := meta.(map[string]any)
+	nodes, _ := m["node_count"].(uint64)
+	rs, _ := m["record_size"].(uint64)
+	ipv, _ := m["ip_version"].(uint64)
+	if nodes == 0 || nodes > math.MaxUint32 || (rs != 24 && rs != 28 && rs != 32) || (ipv != 4 && ipv != 6) {
+		return nil, fmt.Errorf("%w: %s: node_count %d, record_size %d, ip_version %d", ErrFormat, path, nodes, rs, ipv)
+	}
+	db := &mmdb{buf: buf[:i], nodes: uint32(nodes), recordSize: uint16(rs), ipVersion: uint16(ipv)}
+	db.dataStart = int(nodes) * int(rs) / 4
+	if db.dataStart+16 > len(db.buf) {
+		return nil, fmt.Errorf("%w: %s: truncated search tree", ErrFormat, path)
+	}
+	db.dataStart += 16 // data section separator
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodes; i++ {
+			if db.ipv4Start, err = db.record(db.ipv4Start, 0); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrFormat, path, err)
+			}
+		}
+	}
+	return db, nil
+}
+
+// lookup returns the record for ip, or nil if the database has none.
+func (db *mmdb) lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	node, bits := uint32(0), 128
+	if ip.Is4() {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+		bits = 32
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	addr := ip.AsSlice()
+	for i := 0; i < bits && node < db.nodes; i++ {
+		bit := addr[i/8] >> (7 - i%8) & 1
+		var err error
+		if node, err = db.record(node, bit); err != nil {
+			return nil, err
+		}
+	}
+	if node == db.nodes {
+		return nil, nil // no data
+	}
+	if node < db.nodes {
+		return nil, errors.New("search tree deeper than the address")
+	}
+	off := int(node-db.nodes) - 16
+	v, _, err := db.decode(db.dataStart + off)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *mmdb) record(node uint32, bit byte) (uint32, error) {
+	size := int(db.recordSize) / 4 // bytes per node
+	off := int(node) * size
+	if off+size > db.dataStart {
+		return 0, errors.New("node out of range")
+	}
+	b := db.buf[off : off+size]
+	switch db.recordSize {
+	case 24:
+		b = b[3*int(bit):]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xF0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]), nil
+		}
+		return uint32(b[3]&0x0F)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6]), nil
+	default:
+		return binary.BigEndian.Uint32(b[4*int(bit):]), nil
+	}
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEnd
+	typeBool
+	typeFloat
+)
+
+// decode decodes the value at off (absolute in buf; pointers are relative to
+// the data section) and returns it with the offset after it. Maps decode to
+// map[string]any, arrays to []any, unsigned integers to uint64, int32 to
+// int64, double and float to float64, uint128 to []byte.
+func (db *mmdb) decode(off int) (any, int, error) {
+	return db.decodeDepth(off, 0)
+}
+
+func (db *mmdb) decodeDepth(off, depth int) (any, int, error) {
+	if depth > 32 {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	next := func(n int) ([]byte, error) {
+		if n < 0 || off+n > len(db.buf) {
+			return nil, errors.New("data out of range")
+		}
+		b := db.buf[off : off+n]
+		off += n
+		return b, nil
+	}
+	c, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := c[0]
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		n := int(ctrl>>3&3) + 1
+		b, err := next(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		var p int
+		v := int(ctrl & 7)
+		switch n {
+		case 1:
+			p = v<<8 | int(b[0])
+		case 2:
+			p = (v<<16 | int(b[0])<<8 | int(b[1])) + 2048
+		case 3:
+			p = (v<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+		default:
+			p = int(binary.BigEndian.Uint32(b))
+		}
+		val, _, err := db.decodeDepth(db.dataStart+p, depth+1)
+		return val, off, err
+	}
+	if typ == typeExtended {
+		b, err := next(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + int(b[0])
+	}
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := next(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch n {
+		case 1:
+			size = 29 + int(b[0])
+		case 2:
+			size = 285 + (int(b[0])<<8 | int(b[1]))
+		default:
+			size = 65821 + (int(b[0])<<16 | int(b[1])<<8 | int(b[2]))
+		}
+	}
+	// Every map entry and array element takes at least one byte, so a size
+	// beyond the remaining buffer is corrupt and must not size an allocation.
+	if (typ == typeMap || typ == typeArray) && size > len(db.buf)-off {
+		return nil, 0, errors.New("container size out of range")
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			k, o, err := db.decodeDepth(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, o, err := db.decodeDepth(o, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[ks], off = v, o
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			v, o, err := db.decodeDepth(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, off = append(a, v), o
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeContainer, typeEnd:
+		return nil, off, nil
+	}
+	b, err := next(size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(b), off, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), b...), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("bad double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("bad float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("bad integer size")
+		}
+		var u uint64
+		for _, x := range b {
+			u = u<<8 | uint64(x)
+		}
+		return u, off, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("bad integer size")
+		}
+		var u uint32
+		for _, x := range b {
+			u = u<<8 | uint32(x)
+		}
+		return int64(int32(u)), off, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
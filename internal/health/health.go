@@ -1,16 +1,201 @@
 package health
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-func Healthz() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"ok":true}`))
+// Component reports the state of a subsystem for the verbose health view.
+type Component struct {
+	OK     bool           `json:"ok"`
+	Detail map[string]any `json:"detail,omitempty"`
+}
+
+// Checker holds process-wide liveness/readiness state.
+type Checker struct {
+	start    time.Time
+	draining atomic.Bool
+
+	mu       sync.RWMutex
+	comps    map[string]func() Component
+	checks   map[string]func() error
+	degraded map[string]func() error
+	statuses map[string]func() any
+}
+
+func New() *Checker {
+	return &Checker{start: time.Now(), comps: make(map[string]func() Component), checks: make(map[string]func() error), degraded: make(map[string]func() error), statuses: make(map[string]func() any)}
+}
+
+// RegisterReadiness adds a named readiness check; a non-nil error makes /readyz report 503.
+func (c *Checker) RegisterReadiness(name string, check func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// notReady returns the first failing readiness check as "name: err", or "".
+func (c *Checker) notReady() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.checks))
+	for n := range c.checks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := c.checks[n](); err != nil {
+			return n + ": " + err.Error()
+		}
+	}
+	return ""
+}
+
+// RegisterDegraded adds a named check for a dependency the instance can do
+// without; a non-nil error is listed under "degraded" in /readyz, which stays 200.
+func (c *Checker) RegisterDegraded(name string, check func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.degraded[name] = check
+}
+
+// degradations returns the failing RegisterDegraded checks by name, or nil.
+func (c *Checker) degradations() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out map[string]string
+	for n, check := range c.degraded {
+		if err := check(); err != nil {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[n] = err.Error()
+		}
+	}
+	return out
+}
+
+// Register adds a named component probe, evaluated on every verbose request.
+func (c *Checker) Register(name string, probe func() Component) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.comps[name] = probe
+}
+
+// RegisterStatus adds a named section to /statusz; status is called on every
+// request and must return a JSON-encodable value.
+func (c *Checker) RegisterStatus(name string, status func() any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statuses[name] = status
+}
+
+// SetDraining flips readiness to false so load balancers stop routing new traffic.
+func (c *Checker) SetDraining() { c.draining.Store(true) }
+
+func (c *Checker) Draining() bool { return c.draining.Load() }
+
+func (c *Checker) components() (map[string]Component, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.comps))
+	for n := range c.comps {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	out := make(map[string]Component, len(names))
+	ok := true
+	for _, n := range names {
+		st := c.comps[n]()
+		out[n] = st
+		ok = ok && st.OK
+	}
+	return out, ok
+}
+
+// Healthz is the liveness probe. GET and HEAD are supported;
+// ?verbose=1 adds uptime, drain state and component states.
+func (c *Checker) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowProbe(w, r) {
+			return
+		}
+		if r.URL.Query().Get("verbose") != "1" {
+			writeJSON(w, r, http.StatusOK, map[string]any{"ok": true})
+			return
+		}
+		comps, ok := c.components()
+		up := time.Since(c.start)
+		writeJSON(w, r, http.StatusOK, map[string]any{
+			"ok":            ok,
+			"uptime":        up.Truncate(time.Second).String(),
+			"uptimeSeconds": int64(up.Seconds()),
+			"draining":      c.Draining(),
+			"components":    comps,
+		})
 	})
 }
-func Readyz() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"ready":true}`))
+
+// Statusz serves the RegisterStatus sections for debugging: how this
+// instance is configured (e.g. rate-limit algorithms), not whether it is healthy.
+func (c *Checker) Statusz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowProbe(w, r) {
+			return
+		}
+		c.mu.RLock()
+		out := make(map[string]any, len(c.statuses))
+		for n, st := range c.statuses {
+			out[n] = st()
+		}
+		c.mu.RUnlock()
+		writeJSON(w, r, http.StatusOK, out)
 	})
 }
+
+// Readyz is the readiness probe; it reports 503 once draining has started
+// or while any registered readiness check fails. Failing RegisterDegraded
+// checks are listed but keep it at 200.
+func (c *Checker) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowProbe(w, r) {
+			return
+		}
+		if c.Draining() {
+			writeJSON(w, r, http.StatusServiceUnavailable, map[string]any{"ready": false, "reason": "draining"})
+			return
+		}
+		if why := c.notReady(); why != "" {
+			writeJSON(w, r, http.StatusServiceUnavailable, map[string]any{"ready": false, "reason": why})
+			return
+		}
+		body := map[string]any{"ready": true}
+		if d := c.degradations(); d != nil {
+			body["degraded"] = d
+		}
+		writeJSON(w, r, http.StatusOK, body)
+	})
+}
+
+func allowProbe(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("cache-control", "no-store")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,128 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/health"
+)
+
+func TestHealthzVerboseAndHead(t *testing.T) {
+	hc := health.New()
+	hc.Register("store", func() health.Component {
+		return health.Component{OK: true, Detail: map[string]any{"n": 1}}
+	})
+
+	rr := httptest.NewRecorder()
+	hc.Healthz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz?verbose=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d", rr.Code)
+	}
+	var body struct {
+		OK         bool                        `json:"ok"`
+		Components map[string]health.Component `json:"components"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.OK || !body.Components["store"].OK {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	hc.Healthz().ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/healthz", nil))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Fatalf("HEAD: code=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	hc.Healthz().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST should be 405, got %d", rr.Code)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	hc := health.New()
+	rr := httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want 200 before drain, got %d", rr.Code)
+	}
+	hc.SetDraining()
+	rr = httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 while draining, got %d", rr.Code)
+	}
+}
+
+func TestReadyzFailingCheck(t *testing.T) {
+	hc := health.New()
+	full := true
+	hc.RegisterReadiness("store", func() error {
+		if full {
+			return errors.New("keyspace 95% utilized")
+		}
+		return nil
+	})
+	rr := httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 while check fails, got %d", rr.Code)
+	}
+	full = false
+	rr = httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want 200 once check recovers, got %d", rr.Code)
+	}
+}
+
+func TestReadyzDegraded(t *testing.T) {
+	hc := health.New()
+	down := true
+	hc.RegisterDegraded("redis", func() error {
+		if down {
+			return errors.New("circuit open")
+		}
+		return nil
+	})
+	rr := httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body struct {
+		Ready    bool              `json:"ready"`
+		Degraded map[string]string `json:"degraded"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("%d %s", rr.Code, rr.Body.String())
+	}
+	if !body.Ready || body.Degraded["redis"] != "circuit open" {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+	down = false
+	rr = httptest.NewRecorder()
+	hc.Readyz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "degraded") {
+		t.Fatalf("after recovery: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStatusz(t *testing.T) {
+	hc := health.New()
+	hc.RegisterStatus("rateLimits", func() any { return map[string]string{"ws": "token-bucket"} })
+
+	rr := httptest.NewRecorder()
+	hc.Statusz().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/statusz", nil))
+	var body map[string]map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("%d %s", rr.Code, rr.Body.String())
+	}
+	if body["rateLimits"]["ws"] != "token-bucket" {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+}
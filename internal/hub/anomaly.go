@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseFrameLimit is the close code for rooms that exceeded a frame limit
+// (private-use range).
+const CloseFrameLimit = 4010
+
+// FrameLimits are per-room anomaly thresholds for relayed frames; a real
+// signaling session needs a few hundred, a client looping renegotiation
+// never stops. Past half a limit both peers are warned, past three quarters
+// the room is throttled to one frame per second, and past the limit it is
+// closed with CloseFrameLimit. Zero disables a limit.
+type FrameLimits struct {
+	Total  int // frames over the room's lifetime
+	PerMin int // frames per minute (fixed windows from the first frame)
+}
+
+// Escalation levels of a frame count against a limit.
+const (
+	frameOK = iota
+	frameWarn
+	frameThrottle
+	frameClose
+)
+
+var frameActions = [...]string{frameWarn: "warned", frameThrottle: "throttled", frameClose: "closed"}
+
+// frameCount is a room's tally against FrameLimits.
+type frameCount struct {
+	total        int
+	win          time.Time // start of the current minute
+	inWin        int
+	lvlTotal     int // highest level announced per scope
+	lvlMin       int
+	lastThrottle time.Time // last frame let through while throttled
+	closed       bool
+}
+
+// SetFrameLimits sets the per-room frame anomaly thresholds. Call before
+// serving.
+func (h *Hub) SetFrameLimits(l FrameLimits) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.frameLimits = l
+}
+
+func frameLevel(n, limit int) int {
+	switch {
+	case limit <= 0 || n*2 <= limit:
+		return frameOK
+	case n > limit:
+		return frameClose
+	case n*4 > limit*3:
+		return frameThrottle
+	}
+	return frameWarn
+}
+
+// CountFrame counts one relay frame of appID against the frame limits. It
+// returns false if the frame must be dropped: with how long until the
+// throttled room takes the next one, or 0 once the room is being closed.
+func (h *Hub) CountFrame(appID string) (bool, time.Duration) {
+	type notice struct {
+		scope       string
+		lvl         int
+		frames, lim int
+		conns       []*connWrap
+	}
+	var todo []notice
+	ok, retry := true, time.Duration(0)
+
+	h.mu.Lock()
+	l := h.frameLimits
+	r := h.rooms[appID]
+	if r == nil || (l.Total <= 0 && l.PerMin <= 0) {
+		h.mu.Unlock()
+		return true, 0
+	}
+	fc := &r.frames
+	if fc.closed {
+		h.mu.Unlock()
+		return false, 0
+	}
+	now := time.Now()
+	fc.total++
+	if now.Sub(fc.win) >= time.Minute {
+		fc.win, fc.inWin, fc.lvlMin = now, 0, frameOK
+	}
+	fc.inWin++
+	lt, lm := frameLevel(fc.total, l.Total), frameLevel(fc.inWin, l.PerMin)
+	announce := func(scope string, lvl int, seen *int, frames, lim int) {
+		if lvl <= *seen {
+			return
+		}
+		*seen = lvl
+		n := notice{scope: scope, lvl: lvl, frames: frames, lim: lim}
+		for _, c := range r.conns {
+			n.conns = append(n.conns, c)
+		}
+		todo = append(todo, n)
+		h.m.FrameAnomalies.WithLabelValues(scope, frameActions[lvl]).Inc()
+		h.debugf(appID, "hub frame limit", "scope", scope, "action", frameActions[lvl], "frames", frames, "limit", lim)
+	}
+	announce("total", lt, &fc.lvlTotal, fc.total, l.Total)
+	announce("minute", lm, &fc.lvlMin, fc.inWin, l.PerMin)
+	switch max(lt, lm) {
+	case frameClose:
+		ok, fc.closed = false, true
+	case frameThrottle:
+		if wait := time.Second - now.Sub(fc.lastThrottle); wait > 0 {
+			ok, retry = false, wait
+		} else {
+			fc.lastThrottle = now
+		}
+	}
+	h.mu.Unlock()
+
+	// writes happen outside h.mu, like every other hub write
+	for _, n := range todo {
+		msg := map[string]any{"type": "frame_limit", "action": frameActions[n.lvl], "scope": n.scope, "frames": n.frames, "limit": n.lim}
+		for _, c := range n.conns {
+			_ = c.WriteJSON(msg)
+			if n.lvl == frameClose {
+				_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseFrameLimit, "frame limit exceeded"), time.Now().Add(time.Second))
+			}
+		}
+		if n.lvl == frameClose && h.lg != nil {
+			h.lg.Warn("room closed: frame limit exceeded", "appID", appID, "scope", n.scope, "frames", n.frames, "limit", n.lim)
+		}
+	}
+	return ok, retry
+}
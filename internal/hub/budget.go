@@ -0,0 +1,52 @@
+package hub
+
+import "time"
+
+// roomBudget is a token bucket shared by both sides of a room, so one chatty
+// room is throttled at its own boundary instead of competing with every other
+// room for writer time.
+type roomBudget struct {
+	tokens float64
+	last   time.Time
+}
+
+// SetRoomRate sets each room's relay budget in frames per second (perSec <= 0
+// disables it); burst defaults to 2*perSec.
+func (h *Hub) SetRoomRate(perSec, burst int) {
+	if burst <= 0 {
+		burst = 2 * perSec
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roomRate, h.roomBurst = float64(perSec), float64(burst)
+}
+
+// AllowRoom spends one unit of appID's relay budget. When the room is over
+// budget it returns false and how long until a unit is available.
+func (h *Hub) AllowRoom(appID string) (bool, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.roomRate <= 0 {
+		return true, 0
+	}
+	r := h.rooms[appID]
+	if r == nil {
+		return true, 0
+	}
+	now := time.Now()
+	b := &r.budget
+	if b.last.IsZero() {
+		b.tokens = h.roomBurst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * h.roomRate
+		if b.tokens > h.roomBurst {
+			b.tokens = h.roomBurst
+		}
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / h.roomRate * float64(time.Second))
+}
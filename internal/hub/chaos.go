@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Chaos degrades the relay path on purpose, for end-to-end tests and drills.
+// The zero value is off.
+type Chaos struct {
+	Latency time.Duration // added before every relayed frame
+	Jitter  time.Duration // plus a uniform 0..Jitter
+	Drop    float64       // probability that a relayed frame is dropped
+	// Seed makes jitter and drops reproducible: the same seed and frame
+	// sequence give the same outcome.
+	Seed uint64
+}
+
+// Enabled reports whether c changes anything.
+func (c Chaos) Enabled() bool { return c.Latency > 0 || c.Jitter > 0 || c.Drop > 0 }
+
+type chaosState struct {
+	Chaos
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// SetChaos applies c to every frame relayed by Broadcast from now on. The
+// delay is paid by the sender's read loop, so frames from one side keep
+// their order. A zero Chaos turns it off.
+func (h *Hub) SetChaos(c Chaos) {
+	if !c.Enabled() {
+		h.chaos.Store(nil)
+		return
+	}
+	h.chaos.Store(&chaosState{Chaos: c, rng: rand.New(rand.NewPCG(c.Seed, c.Seed))})
+}
+
+// pass delays the caller as configured and reports whether the frame survives.
+func (c *chaosState) pass() bool {
+	c.mu.Lock()
+	drop := c.Drop > 0 && c.rng.Float64() < c.Drop
+	d := c.Latency
+	if c.Jitter > 0 {
+		d += time.Duration(c.rng.Int64N(int64(c.Jitter) + 1))
+	}
+	c.mu.Unlock()
+	if drop {
+		return false
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+	return true
+}
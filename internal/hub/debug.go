@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"log/slog"
+	"time"
+)
+
+// roomDebug is a per-room log-level override set through the admin API.
+type roomDebug struct {
+	until  time.Time
+	sample uint64 // log 1 in sample events
+	n      uint64
+}
+
+// DebugState describes an active per-room debug override.
+type DebugState struct {
+	Until  time.Time `json:"until"`
+	Sample uint64    `json:"sample"`
+}
+
+// SetLogger sets the logger used for per-room debug output (nil disables it).
+func (h *Hub) SetLogger(lg *slog.Logger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lg = lg
+}
+
+// SetDebug enables verbose frame-level logging for appID until ttl elapses,
+// logging one in every sample events (sample < 1 means every event).
+// The override is independent of the room's lifetime so it can be armed
+// before the peers connect.
+func (h *Hub) SetDebug(appID string, ttl time.Duration, sample uint64) DebugState {
+	if sample < 1 {
+		sample = 1
+	}
+	h.debugMu.Lock()
+	defer h.debugMu.Unlock()
+	if h.debug == nil {
+		h.debug = make(map[string]*roomDebug)
+	}
+	d := &roomDebug{until: time.Now().Add(ttl), sample: sample}
+	h.debug[appID] = d
+	h.debugOn.Store(true)
+	return DebugState{Until: d.until, Sample: d.sample}
+}
+
+// ClearDebug removes the override for appID; it reports whether one was set.
+func (h *Hub) ClearDebug(appID string) bool {
+	h.debugMu.Lock()
+	defer h.debugMu.Unlock()
+	_, ok := h.debug[appID]
+	delete(h.debug, appID)
+	h.debugOn.Store(len(h.debug) > 0)
+	return ok
+}
+
+// DebugStates lists the unexpired overrides by appID.
+func (h *Hub) DebugStates() map[string]DebugState {
+	h.debugMu.Lock()
+	defer h.debugMu.Unlock()
+	now := time.Now()
+	out := make(map[string]DebugState, len(h.debug))
+	for id, d := range h.debug {
+		if now.After(d.until) {
+			delete(h.debug, id)
+			continue
+		}
+		out[id] = DebugState{Until: d.until, Sample: d.sample}
+	}
+	h.debugOn.Store(len(h.debug) > 0)
+	return out
+}
+
+// Debug reports whether the next debug event for appID should be logged,
+// and advances the sampling counter. It is called for every frame, so it
+// returns without locking unless some override is set.
+func (h *Hub) Debug(appID string) bool {
+	if !h.debugOn.Load() {
+		return false
+	}
+	h.debugMu.Lock()
+	defer h.debugMu.Unlock()
+	return h.debugLocked(appID)
+}
+
+// debugLocked is Debug with h.debugMu held.
+func (h *Hub) debugLocked(appID string) bool {
+	d := h.debug[appID]
+	if d == nil {
+		return false
+	}
+	if time.Now().After(d.until) {
+		delete(h.debug, appID)
+		h.debugOn.Store(len(h.debug) > 0)
+		return false
+	}
+	d.n++
+	return (d.n-1)%d.sample == 0
+}
+
+// debugf logs a hub event for appID if its debug override samples it.
+// Callers hold h.mu for writing (it guards h.lg).
+func (h *Hub) debugf(appID, msg string, args ...any) {
+	if h.lg == nil || !h.Debug(appID) {
+		return
+	}
+	h.lg.Info(msg, append([]any{"appID", appID}, args...)...)
+}
@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDropBoxDisabled is returned by SetDropBox when SetDropBoxTTL is unset.
+var ErrDropBoxDisabled = errors.New("drop box rooms disabled")
+
+// SetDropBoxTTL enables drop box rooms (see SetDropBox), each kept for at
+// most d after it was made one. d <= 0 disables them. Call before serving.
+func (h *Hub) SetDropBoxTTL(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropBoxTTL = d
+}
+
+// SetDropBox makes appID a drop box: once its last peer leaves, the room
+// stays open (state created) while mail is queued, until the returned time,
+// so a peer can leave items and disconnect and the other drain them later.
+// It is closed like any room once empty with nothing queued, so a drop box
+// is one-shot. side must be connected. Setting it again doesn't extend it.
+func (h *Hub) SetDropBox(appID, side string) (time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dropBoxTTL <= 0 {
+		return time.Time{}, ErrDropBoxDisabled
+	}
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return time.Time{}, ErrNotConnected
+	}
+	if r.dropUntil.IsZero() {
+		r.dropUntil = time.Now().Add(h.dropBoxTTL)
+		h.debugf(appID, "hub drop box", "side", side, "until", r.dropUntil)
+	}
+	return r.dropUntil, nil
+}
+
+// keepDropBoxLocked reports whether the peerless room r stays open as a
+// drop box at now. h.mu must be held.
+func (h *Hub) keepDropBoxLocked(r *room, now time.Time) bool {
+	if r.dropUntil.IsZero() || !now.Before(r.dropUntil) {
+		return false
+	}
+	for _, box := range r.box {
+		if len(box) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// closeDropBoxesLocked closes the peerless drop boxes that expired or were
+// emptied (e.g. by expiring mail) by now, and returns how many.
+// h.mu must be held for writing.
+func (h *Hub) closeDropBoxesLocked(now time.Time) int {
+	n := 0
+	for appID, r := range h.rooms {
+		if r.dropUntil.IsZero() || len(r.conns) > 0 {
+			continue
+		}
+		if h.keepDropBoxLocked(r, now) {
+			continue
+		}
+		h.debugf(appID, "hub drop box closed", "expired", !now.Before(r.dropUntil))
+		h.closeLocked(appID, r)
+		n++
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package hub
+
+import "time"
+
+// dupJoinNotifyEvery spaces the duplicate join notices to one occupant, so a
+// client hammering an occupied side can't flood the legitimate peer.
+const dupJoinNotifyEvery = 10 * time.Second
+
+// DuplicateJoin counts an attempt to join side of appID while that side is
+// occupied. It returns the room's attempts so far and whether the occupant
+// should be told now: at most once per dupJoinNotifyEvery. Repeated attempts
+// on a room can mean its appID leaked; the count shows in RoomState.
+func (h *Hub) DuplicateJoin(appID, side string) (attempts int, notify bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return 0, false
+	}
+	r.dupJoins++
+	now := time.Now()
+	if now.Sub(r.dupNotified[side]) < dupJoinNotifyEvery {
+		h.m.WSDuplicateJoins.WithLabelValues("throttled").Inc()
+		return r.dupJoins, false
+	}
+	if r.dupNotified == nil {
+		r.dupNotified = make(map[string]time.Time)
+	}
+	r.dupNotified[side] = now
+	h.m.WSDuplicateJoins.WithLabelValues("notified").Inc()
+	h.debugf(appID, "duplicate join attempt", "side", side, "attempts", r.dupJoins)
+	return r.dupJoins, true
+}
@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SetEnvelope makes appID deliver relayed frames in a relay envelope:
+// {"from":"A","relayedAt":<unix ms>,"seq":N,"payload":<frame as sent>},
+// where seq counts the frames relayed from that side. from, relayedAt and
+// seq are set by the server, so receivers can trust origin and order
+// without the payload changing. Once on it stays on. Connections with an
+// outbound translation (an older protocol, see Translate) keep getting the
+// bare frame.
+func (h *Hub) SetEnvelope(appID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return ErrRoomNotFound
+	}
+	if !r.envelope {
+		r.envelope = true
+		h.debugf(appID, "hub relay envelope on")
+	}
+	return nil
+}
+
+// Relay is Broadcast for raw, a frame side sent, wrapped in a relay
+// envelope if appID uses them (see SetEnvelope). raw must be valid JSON.
+func (h *Hub) Relay(appID, side string, sender *websocket.Conn, raw []byte) {
+	h.relay(appID, side, sender, raw, false)
+}
+
+// RelayEcho is Relay that also writes the canonical frame back to the
+// sender, wrapped as {"echo":true,"seq":N,"ts":<unix ms>,"payload":raw},
+// so it can tell its echo from its peer's frames. seq and ts match the
+// peer's envelope, if the room uses them.
+func (h *Hub) RelayEcho(appID, side string, sender *websocket.Conn, raw []byte) {
+	h.relay(appID, side, sender, raw, true)
+}
+
+func (h *Hub) relay(appID, side string, sender *websocket.Conn, raw []byte, echo bool) {
+	h.mu.RLock()
+	r := h.rooms[appID]
+	if r == nil {
+		h.mu.RUnlock()
+		return
+	}
+	var seq uint64
+	if n := r.relaySeq[side]; n != nil {
+		seq = n.Add(1) - 1
+	}
+	envelope := r.envelope
+	peers := make([]*connWrap, 0, len(r.conns))
+	var self *connWrap
+	for _, cw := range r.conns {
+		if cw.c == sender && sender != nil {
+			self = cw
+		} else {
+			peers = append(peers, cw)
+		}
+	}
+	h.mu.RUnlock()
+
+	if c := h.chaos.Load(); c != nil && !c.pass() {
+		h.m.ChaosDropped.Inc()
+		return
+	}
+	now := time.Now()
+	var env []byte
+	if envelope {
+		env = appendEnvelope(make([]byte, 0, len(raw)+80), side, now, seq, raw)
+	}
+	for _, cw := range peers {
+		if env != nil && cw.out.Load() == nil {
+			_ = cw.WriteMessage(websocket.TextMessage, env)
+		} else {
+			_ = cw.WriteMessage(websocket.TextMessage, raw)
+		}
+	}
+	if echo && self != nil {
+		if self.out.Load() != nil {
+			_ = self.WriteMessage(websocket.TextMessage, raw)
+		} else {
+			_ = self.WriteMessage(websocket.TextMessage, appendEcho(make([]byte, 0, len(raw)+64), now, seq, raw))
+		}
+	}
+}
+
+// appendEnvelope appends the relay envelope of raw to b.
+func appendEnvelope(b []byte, from string, at time.Time, seq uint64, raw []byte) []byte {
+	b = append(b, `{"from":`...)
+	b = strconv.AppendQuote(b, from)
+	b = append(b, `,"relayedAt":`...)
+	b = strconv.AppendInt(b, at.UnixMilli(), 10)
+	b = append(b, `,"seq":`...)
+	b = strconv.AppendUint(b, seq, 10)
+	b = append(b, `,"payload":`...)
+	b = append(b, raw...)
+	return append(b, '}')
+}
+
+// appendEcho appends the sender's echo of raw to b (see RelayEcho).
+func appendEcho(b []byte, at time.Time, seq uint64, raw []byte) []byte {
+	b = append(b, `{"echo":true,"seq":`...)
+	b = strconv.AppendUint(b, seq, 10)
+	b = append(b, `,"ts":`...)
+	b = strconv.AppendInt(b, at.UnixMilli(), 10)
+	b = append(b, `,"payload":`...)
+	b = append(b, raw...)
+	return append(b, '}')
+}
@@ -0,0 +1,255 @@
+package hub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Fan-out rooms have one host and up to a cap of viewers instead of sides A
+// and B: host frames go to every viewer (or the one named in "to"), viewer
+// frames only to the host, tagged with the viewer's id in "from". They share
+// the appID space with pair rooms but not their mailbox, state machine or
+// limits.
+
+// Fan-out roles.
+const (
+	RoleHost   = "host"
+	RoleViewer = "viewer"
+)
+
+// DefaultMaxViewers is the viewer cap of a fan-out room.
+const DefaultMaxViewers = 100
+
+// Errors returned by JoinFanout; match with errors.Is.
+var (
+	// ErrHostBusy is returned when a fan-out room already has a host.
+	ErrHostBusy = errors.New("host busy")
+	// ErrViewerCap is returned when a fan-out room has its maximum of viewers.
+	ErrViewerCap = errors.New("viewer cap reached")
+	// ErrRoomType is returned when appID is open as the other kind of room.
+	ErrRoomType = errors.New("appID in use by another room type")
+	// ErrInvalidRole is returned for roles other than host and viewer.
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+type fanRoom struct {
+	host    *connWrap
+	viewers map[string]*connWrap // by viewer id
+	next    uint64               // last viewer id issued
+}
+
+// SetMaxViewers caps the viewers per fan-out room (n <= 0: DefaultMaxViewers).
+// Call before serving.
+func (h *Hub) SetMaxViewers(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxViewers = n
+}
+
+// JoinFanout adds c to the fan-out room appID as role and returns its id:
+// "host", or "v1", "v2", ... for viewers. Everyone in the room then gets a
+// viewers frame with the new count.
+func (h *Hub) JoinFanout(appID, role string, c *websocket.Conn) (string, error) {
+	h.mu.Lock()
+	if role != RoleHost && role != RoleViewer {
+		h.mu.Unlock()
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	if r := h.rooms[appID]; r != nil && len(r.conns) > 0 {
+		h.mu.Unlock()
+		h.m.FanoutRejected.WithLabelValues("room_type").Inc()
+		return "", ErrRoomType
+	}
+	f := h.fanout[appID]
+	if f == nil {
+		if h.fanout == nil {
+			h.fanout = make(map[string]*fanRoom)
+		}
+		f = &fanRoom{viewers: make(map[string]*connWrap)}
+		h.fanout[appID] = f
+		h.m.FanoutRooms.Inc()
+	}
+	var id string
+	switch {
+	case role == RoleHost && f.host != nil:
+		h.mu.Unlock()
+		h.m.FanoutRejected.WithLabelValues("host_busy").Inc()
+		return "", ErrHostBusy
+	case role == RoleHost:
+		id = RoleHost
+		f.host = &connWrap{c: c, h: h, appID: appID, side: id}
+	case len(f.viewers) >= h.maxViewersLocked():
+		h.mu.Unlock()
+		h.m.FanoutRejected.WithLabelValues("viewer_cap").Inc()
+		return "", fmt.Errorf("%w: %d", ErrViewerCap, len(f.viewers))
+	default:
+		f.next++
+		id = "v" + strconv.FormatUint(f.next, 10)
+		f.viewers[id] = &connWrap{c: c, h: h, appID: appID, side: id}
+		h.m.FanoutViewers.Inc()
+	}
+	h.debugf(appID, "hub fanout join", "id", id, "viewers", len(f.viewers))
+	to, count := f.all(), len(f.viewers)
+	h.mu.Unlock()
+
+	h.sendViewers(to, count, id, "")
+	return id, nil
+}
+
+// LeaveFanout removes id from the fan-out room appID; the room goes away with
+// its last connection. The others get a viewers frame with the new count.
+func (h *Hub) LeaveFanout(appID, id string) {
+	h.mu.Lock()
+	f := h.fanout[appID]
+	if f == nil {
+		h.mu.Unlock()
+		return
+	}
+	if id == RoleHost {
+		f.host = nil
+	} else if _, ok := f.viewers[id]; ok {
+		delete(f.viewers, id)
+		h.m.FanoutViewers.Dec()
+	}
+	if f.host == nil && len(f.viewers) == 0 {
+		delete(h.fanout, appID)
+		h.m.FanoutRooms.Dec()
+	}
+	h.debugf(appID, "hub fanout leave", "id", id, "viewers", len(f.viewers))
+	to, count := f.all(), len(f.viewers)
+	h.mu.Unlock()
+
+	h.sendViewers(to, count, "", id)
+}
+
+// FanoutRelay forwards a frame from id: a host frame to every viewer, or
+// only to viewer to if set; a viewer frame to the host with "from" added.
+// It returns the number of connections written to.
+func (h *Hub) FanoutRelay(appID, id, to string, raw []byte) int {
+	h.mu.RLock()
+	f := h.fanout[appID]
+	if f == nil {
+		h.mu.RUnlock()
+		return 0
+	}
+	var dst []*connWrap
+	switch {
+	case id != RoleHost:
+		if f.host != nil {
+			dst = append(dst, f.host)
+		}
+		raw = withFrom(raw, id)
+	case to != "":
+		if v := f.viewers[to]; v != nil {
+			dst = append(dst, v)
+		}
+	default:
+		for _, v := range f.viewers {
+			dst = append(dst, v)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range dst {
+		_ = c.WriteMessage(websocket.TextMessage, raw)
+	}
+	return len(dst)
+}
+
+// SendFanout writes a JSON payload to id in the fan-out room appID.
+func (h *Hub) SendFanout(appID, id string, payload any) error {
+	c := h.fanConn(appID, id)
+	if c == nil {
+		return ErrNotConnected
+	}
+	return c.WriteJSON(payload)
+}
+
+// PingFanout sends a ping control frame to id in the fan-out room appID.
+func (h *Hub) PingFanout(appID, id string, payload []byte) error {
+	c := h.fanConn(appID, id)
+	if c == nil {
+		return ErrNotConnected
+	}
+	return c.WriteControl(websocket.PingMessage, payload, time.Now().Add(writeWait))
+}
+
+func (h *Hub) fanConn(appID, id string) *connWrap {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	f := h.fanout[appID]
+	switch {
+	case f == nil:
+		return nil
+	case id == RoleHost:
+		return f.host
+	}
+	return f.viewers[id]
+}
+
+// Viewers returns the number of viewers in the fan-out room appID and
+// whether it has a host; ok is false if there is no such room.
+func (h *Hub) Viewers(appID string) (n int, host, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	f := h.fanout[appID]
+	if f == nil {
+		return 0, false, false
+	}
+	return len(f.viewers), f.host != nil, true
+}
+
+func (h *Hub) maxViewersLocked() int {
+	if h.maxViewers <= 0 {
+		return DefaultMaxViewers
+	}
+	return h.maxViewers
+}
+
+// all returns the room's connections; h.mu must be held.
+func (f *fanRoom) all() []*connWrap {
+	out := make([]*connWrap, 0, len(f.viewers)+1)
+	if f.host != nil {
+		out = append(out, f.host)
+	}
+	for _, v := range f.viewers {
+		out = append(out, v)
+	}
+	return out
+}
+
+func (h *Hub) sendViewers(to []*connWrap, count int, joined, left string) {
+	ev := map[string]any{"type": "viewers", "count": count}
+	if joined != "" {
+		ev["joined"] = joined
+	}
+	if left != "" {
+		ev["left"] = left
+	}
+	for _, c := range to {
+		_ = c.WriteJSON(ev)
+	}
+}
+
+// withFrom adds "from":id as the last member of the JSON object raw, so it
+// wins over any "from" the client set; other frames are returned unchanged.
+func withFrom(raw []byte, id string) []byte {
+	b := bytes.TrimRight(raw, " \t\r\n")
+	if len(b) < 2 || b[len(b)-1] != '}' {
+		return raw
+	}
+	inner := bytes.TrimSpace(b[1 : len(b)-1])
+	out := make([]byte, 0, len(b)+len(id)+12)
+	out = append(out, b[:len(b)-1]...)
+	if len(inner) > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, `"from":`...)
+	out = strconv.AppendQuote(out, id)
+	return append(out, '}')
+}
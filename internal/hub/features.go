@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Limits on a side's advertised feature list.
+const (
+	MaxFeatures    = 32
+	MaxFeatureName = 32
+)
+
+// ErrFeaturesInvalid is returned by SetFeatures for overlong lists or names
+// outside [a-z0-9_.-].
+var ErrFeaturesInvalid = errors.New("invalid feature list")
+
+// SetFeatures records the features side advertised in appID (its hello) and,
+// once both connected sides have advertised, returns the sorted intersection
+// with ready=true. A side's list is forgotten when it disconnects, so a
+// reconnecting client negotiates again.
+func (h *Hub) SetFeatures(appID, side string, features []string) (common []string, ready bool, err error) {
+	if len(features) > MaxFeatures {
+		return nil, false, fmt.Errorf("%w: %d > %d features", ErrFeaturesInvalid, len(features), MaxFeatures)
+	}
+	set := make([]string, 0, len(features))
+	for _, f := range features {
+		if !validFeature(f) {
+			return nil, false, fmt.Errorf("%w: %q", ErrFeaturesInvalid, f)
+		}
+		set = append(set, f)
+	}
+	slices.Sort(set)
+	set = slices.Compact(set)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return nil, false, ErrRoomNotFound
+	}
+	if r.features == nil {
+		r.features = make(map[string][]string)
+	}
+	r.features[side] = set
+	other, ok := r.features[peerSide(side)]
+	if !ok {
+		return nil, false, nil
+	}
+	common = []string{}
+	for _, f := range set {
+		if _, found := slices.BinarySearch(other, f); found {
+			common = append(common, f)
+		}
+	}
+	return common, true, nil
+}
+
+func peerSide(side string) string {
+	if side == "A" {
+		return "B"
+	}
+	return "A"
+}
+
+func validFeature(f string) bool {
+	if f == "" || len(f) > MaxFeatureName {
+		return false
+	}
+	for i := 0; i < len(f); i++ {
+		c := f[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// errInvalidPayload means a mailbox payload isn't valid JSON, so it can't be
+// spliced into a frame. Payloads decoded by the WS handler always are.
+var errInvalidPayload = errors.New("mailbox payload is not valid JSON")
+
+// appendSendFrame appends the "send" frame delivering it to b. The payload
+// is copied in as is rather than re-marshaled. echo encodes the copy for the
+// sender instead, addressed to and with the TTL granted (see EnqueueEcho).
+func appendSendFrame(b []byte, it mailItem, echo bool, to string) ([]byte, error) {
+	payload := it.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	} else if !json.Valid(payload) {
+		return b, errInvalidPayload
+	}
+	b = append(b, `{"type":"send",`...)
+	if echo {
+		q, _ := json.Marshal(to)
+		b = append(b, `"echo":true,"to":`...)
+		b = append(b, q...)
+		b = append(b, `,"ts":`...)
+		b = strconv.AppendInt(b, it.At.UnixMilli(), 10)
+		if !it.Expires.IsZero() {
+			b = append(b, `,"ttlMs":`...)
+			b = strconv.AppendInt(b, it.Expires.Sub(it.At).Milliseconds(), 10)
+		}
+		b = append(b, ',')
+	}
+	b = append(b, `"seq":`...)
+	b = strconv.AppendUint(b, it.Seq, 10)
+	b = append(b, `,"payload":`...)
+	b = append(b, payload...)
+	return append(b, '}'), nil
+}
+
+// writeSend delivers it to w as a "send" frame; see appendSendFrame.
+func (w *connWrap) writeSend(it mailItem, echo bool, to string) error {
+	b, err := appendSendFrame(make([]byte, 0, len(it.Payload)+64), it, echo, to)
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(websocket.TextMessage, b)
+}
@@ -1,35 +1,76 @@
 package hub
 
 import (
+	"container/list"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
 )
 
+// writeWait bounds a single write so a stalled peer can't hold up its room's writers.
+const writeWait = 10 * time.Second
+
 // wrap a websocket.Conn to serialize all writes
 type connWrap struct {
-	c  *websocket.Conn
-	mu sync.Mutex
+	c     *websocket.Conn
+	mu    sync.Mutex
+	trace *frameRing // nil when tracing is off
+	// for write failure accounting (see writeFailed)
+	h           *Hub
+	appID, side string
+	// notified is set once room_full went out on this connection (see
+	// NotifyPaired); guarded by h.mu
+	notified bool
+	// out rewrites outgoing text frames (see Translate)
+	out atomic.Pointer[func([]byte) []byte]
+	// mailMu orders mailbox writes: items go out in seq order, each once,
+	// from mailNext on (see deliverMail)
+	mailMu   sync.Mutex
+	mailNext uint64
 }
 
 func (w *connWrap) WriteJSON(v any) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.c.WriteJSON(v)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(websocket.TextMessage, b)
 }
 func (w *connWrap) WriteMessage(mt int, p []byte) error {
+	p = w.translate(mt, p)
+	if w.trace != nil {
+		w.trace.add("out", peekType(p), len(p))
+	}
+	if w.h != nil && w.h.watch.n.Load() > 0 {
+		w.h.watch.publish(w.appID, WatchEvent{Kind: WatchFrame, Side: w.side, Dir: "out", Type: peekType(p), Size: len(p)})
+	}
 	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.c.WriteMessage(mt, p)
+	_ = w.c.SetWriteDeadline(time.Now().Add(writeWait))
+	err := w.c.WriteMessage(mt, p)
+	w.mu.Unlock()
+	return w.failed(err)
 }
 
 func (w *connWrap) WriteControl(mt int, data []byte, deadline time.Time) error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.c.WriteControl(mt, data, deadline)
+	err := w.c.WriteControl(mt, data, deadline)
+	w.mu.Unlock()
+	return w.failed(err)
+}
+
+func (w *connWrap) failed(err error) error {
+	if err != nil && w.h != nil {
+		w.h.writeFailed(w.appID, w.side, err)
+	}
+	return err
 }
 
 type room struct {
@@ -39,19 +80,148 @@ type room struct {
 	box   map[string][]mailItem
 	start time.Time
 	estd  time.Time
+	fail  bool
+	// parked sides -> wake callback, fired when the partner joins
+	parked map[string]func()
+	// oneWay, if set, is the only side allowed to relay/send
+	oneWay string
+	// pin is the key fingerprint registered by the first peer to pin
+	pin *Pin
+	// meta is the shared metadata object (compacted JSON, see SetMeta)
+	meta json.RawMessage
+	// offer is the outstanding offer used for glare arbitration (nil once answered)
+	offer *pendingOffer
+	// owner opened the room and is charged for it under room quotas
+	owner string
+	// budget is the room's shared relay allowance (see SetRoomRate)
+	budget roomBudget
+	// frames tallies relay frames against the anomaly limits (see SetFrameLimits)
+	frames frameCount
+	// origins holds each connected side's origin fingerprint (IP+UA hash)
+	origins map[string]string
+	// left holds why each side last left (see SetLeft); kept across rejoins
+	left map[string]string
+	// features holds each connected side's advertised features (see SetFeatures)
+	features map[string][]string
+	// exempt rooms ignore the max session duration; warned/expired track
+	// how far enforcement has got
+	exempt, warned, expired bool
+	// unpaired is the room's element in Hub.unpaired while half-joined;
+	// evicted rooms were pushed out of it and can't be joined anymore
+	unpaired *list.Element
+	evicted  bool
+	// state is the lifecycle state (see state.go), entered at stateAt
+	state   State
+	stateAt time.Time
+	// pairings counts how often both sides got connected (room_full epoch)
+	pairings uint64
+	// paused holds the sides that asked their peer to stop sending (see SetPaused)
+	paused map[string]bool
+	// labels holds each connected side's labels (see SetLabels)
+	labels map[string]*peerLabels
+	// dupJoins counts attempts to join an occupied side; dupNotified is when
+	// each side's occupant was last told (see DuplicateJoin)
+	dupJoins    int
+	dupNotified map[string]time.Time
+	// dropUntil, if set, keeps the room open without peers until then while
+	// mail is queued (see SetDropBox)
+	dropUntil time.Time
+	// envelope wraps relayed frames (see SetEnvelope); relaySeq counts the
+	// frames relayed from each side, for envelopes and echoes (see Relay)
+	envelope bool
+	relaySeq map[string]*atomic.Uint64
+}
+
+type pendingOffer struct {
+	side string
+	at   time.Time
+}
+
+// Pin is a key fingerprint registered for a room by one side.
+type Pin struct {
+	Side string `json:"side"`
+	Fpr  string `json:"fpr"`
 }
 
 type mailItem struct {
 	Seq     uint64
 	Payload json.RawMessage
+	At      time.Time
+	From    string
+	Expires time.Time `json:",omitzero"` // zero: held until acked (see SetMailboxTTL)
+}
+
+// MailboxItem is the metadata view of a queued mailbox entry (no payload).
+type MailboxItem struct {
+	Seq        uint64    `json:"seq"`
+	Size       int       `json:"size"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
 }
 
 type Hub struct {
 	mu    sync.RWMutex
 	rooms map[string]*room
+
+	lg *slog.Logger
+
+	// Per-room debug overrides have their own lock, so the per-frame check
+	// (Debug) never takes mu; debugOn is set while any override exists.
+	debugMu sync.Mutex
+	debug   map[string]*roomDebug
+	debugOn atomic.Bool
+
+	owned    map[string]int // open rooms per owner
+	ownedMax int            // last quota seen, for the at_limit gauge
+
+	roomRate, roomBurst float64 // per-room relay budget (0 = unlimited)
+	frameLimits         FrameLimits
+
+	onTransition []func(appID string, from, to State)
+
+	maxSession, sessionWarn time.Duration // see SetMaxSession
+
+	traceN int // frames traced per connection (see SetTraceFrames)
+
+	metaMax int // room metadata size limit (see SetMetaLimit)
+
+	offerMaxAge time.Duration // see SetOfferMaxAge
+	mailTTL     time.Duration // see SetMailboxTTL
+	dropBoxTTL  time.Duration // see SetDropBoxTTL
+
+	chaos atomic.Pointer[chaosState] // nil unless SetChaos enabled it
+
+	resumeGrace time.Duration          // see SetResumeGrace
+	resume      map[string]resumeState // recently closed rooms by appID
+	resumeSwept time.Time
+
+	restored      map[string]RoomSnapshot // rooms of a restored snapshot (see Restore)
+	restoredUntil time.Time
+
+	maxUnpaired int        // see SetMaxUnpaired
+	unpaired    *list.List // appIDs of half-joined rooms, oldest first
+
+	fanout     map[string]*fanRoom // fan-out rooms by appID (see fanout.go)
+	maxViewers int                 // see SetMaxViewers
+
+	watch watchers // see Watch
+
+	labelKeys   []string                   // label keys reported as metrics (see SetLabelMetrics)
+	labelValues map[string]map[string]bool // metric values seen per key
+
+	m *metrics.Metrics
+}
+
+func New() *Hub {
+	return &Hub{rooms: make(map[string]*room), traceN: DefaultTraceFrames, metaMax: DefaultMetaBytes, resumeGrace: DefaultResumeGrace, m: metrics.Default}
 }
 
-func New() *Hub { return &Hub{rooms: make(map[string]*room)} }
+// SetMetrics reports to m instead of metrics.Default. Call before serving.
+func (h *Hub) SetMetrics(m *metrics.Metrics) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.m = m
+}
 
 func (h *Hub) get(appID string) *room {
 	r := h.rooms[appID]
@@ -62,21 +232,117 @@ func (h *Hub) get(appID string) *room {
 			deliv: map[string]uint64{"A": 0, "B": 0},
 			box:   map[string][]mailItem{"A": nil, "B": nil},
 			start: time.Now(),
+			state: StateCreated,
+
+			relaySeq: map[string]*atomic.Uint64{"A": new(atomic.Uint64), "B": new(atomic.Uint64)},
 		}
+		r.stateAt = r.start
+		h.resumeLocked(appID, r)
+		h.restoreLocked(appID, r)
 		h.rooms[appID] = r
 	}
 	return r
 }
 
-func (h *Hub) Register(appID, side, _sid string, c *websocket.Conn) error {
+func (h *Hub) Register(appID, side, sid string, c *websocket.Conn) error {
+	return h.RegisterOwned(appID, side, sid, "", 0, c)
+}
+
+// Errors returned by the hub; match with errors.Is. Messages may carry
+// detail (e.g. the side) wrapped around these.
+var (
+	// ErrRoomQuota is returned by RegisterOwned when owner already has max rooms open.
+	ErrRoomQuota = errors.New("room quota exceeded")
+	// ErrSideBusy is returned by Register when the side is already connected.
+	ErrSideBusy = errors.New("side busy")
+	// ErrNotConnected is returned when an operation needs a connected side.
+	ErrNotConnected = errors.New("side not connected")
+	// ErrInvalidSide is returned for sides other than "A" and "B".
+	ErrInvalidSide = errors.New("invalid side")
+	// ErrRoomNotFound is returned for operations on a room that doesn't exist.
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrInvalidFingerprint is returned by SetPin for empty or oversized fingerprints.
+	ErrInvalidFingerprint = errors.New("invalid fingerprint")
+	// ErrPairingTimeout is returned by Register for a room evicted while waiting (see SetMaxUnpaired).
+	ErrPairingTimeout = errors.New("pairing timeout")
+)
+
+// RegisterOwned is Register that charges a newly opened room to owner and
+// refuses it if owner already holds max rooms (max <= 0 or owner "" = unlimited).
+// Joining a room someone else opened is never limited.
+func (h *Hub) RegisterOwned(appID, side, sid, owner string, max int, c *websocket.Conn) error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	r := h.get(appID)
+	evicted, err := h.registerLocked(appID, side, sid, owner, max, c)
+	h.mu.Unlock()
+	notifyEvicted(evicted)
+	return err
+}
+
+// registerLocked is RegisterOwned; it returns the peers of unpaired rooms
+// evicted to make space. h.mu must be held for writing.
+func (h *Hub) registerLocked(appID, side, _sid, owner string, max int, c *websocket.Conn) ([]*connWrap, error) {
+	r := h.rooms[appID]
+	opening := r == nil || (len(r.conns) == 0 && r.owner == "")
+	if opening && owner != "" && max > 0 && h.owned[owner] >= max {
+		h.m.QuotaRejected.WithLabelValues("rooms").Inc()
+		return nil, ErrRoomQuota
+	}
+	if r != nil && r.evicted {
+		return nil, ErrPairingTimeout
+	}
+	if h.fanout[appID] != nil {
+		return nil, ErrRoomType
+	}
+	r = h.get(appID)
 	if _, ok := r.conns[side]; ok {
-		return fmt.Errorf("side %s busy", side)
+		return nil, fmt.Errorf("%w: %s", ErrSideBusy, side)
 	}
-	r.conns[side] = &connWrap{c: c}
-	return nil
+	var evicted []*connWrap
+	if len(r.conns) == 0 {
+		evicted = h.evictUnpairedLocked()
+	}
+	// items queued before the connection wait for hello
+	r.conns[side] = &connWrap{c: c, trace: newFrameRing(h.traceN), h: h, appID: appID, side: side, mailNext: r.seq[side]}
+	h.watch.publish(appID, WatchEvent{Kind: WatchJoin, Side: side})
+	if len(r.conns) == 1 {
+		h.transitionLocked(appID, r, StateHalfJoined)
+	} else {
+		r.pairings++
+		h.transitionLocked(appID, r, StatePaired)
+	}
+	if opening && owner != "" {
+		if h.owned == nil {
+			h.owned = make(map[string]int)
+		}
+		r.owner = owner
+		h.owned[owner]++
+		h.ownedMax = max
+		h.observeOwnersLocked()
+	}
+	return evicted, nil
+}
+
+// CanOpen reports whether owner may open appID under a max-rooms quota
+// (always true when the room is already open). Used to fail before the upgrade.
+func (h *Hub) CanOpen(appID, owner string, max int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if r := h.rooms[appID]; r != nil && (len(r.conns) > 0 || r.owner != "") {
+		return true // already charged, e.g. a drop box waiting for its reader
+	}
+	return owner == "" || max <= 0 || h.owned[owner] < max
+}
+
+// observeOwnersLocked refreshes the bounded room quota gauges; h.mu must be held for writing.
+func (h *Hub) observeOwnersLocked() {
+	atLimit := 0
+	for _, n := range h.owned {
+		if h.ownedMax > 0 && n >= h.ownedMax {
+			atLimit++
+		}
+	}
+	h.m.QuotaOwners.WithLabelValues("rooms", "active").Set(float64(len(h.owned)))
+	h.m.QuotaOwners.WithLabelValues("rooms", "at_limit").Set(float64(atLimit))
 }
 
 func (h *Hub) Unregister(appID string, conn *websocket.Conn) {
@@ -85,15 +351,46 @@ func (h *Hub) Unregister(appID string, conn *websocket.Conn) {
 	if r := h.rooms[appID]; r != nil {
 		for s, cw := range r.conns {
 			if cw.c == conn {
+				h.watch.publish(appID, WatchEvent{Kind: WatchLeave, Side: s, Reason: r.left[s]})
 				delete(r.conns, s)
+				delete(r.origins, s)
+				delete(r.features, s)
+				delete(r.paused, s)
+				h.dropLabelsLocked(r, s)
+				if _, ok := r.parked[s]; ok {
+					delete(r.parked, s)
+					h.m.ParkedPeers.Dec()
+				}
 			}
 		}
+		if len(r.conns) == 1 && (r.state == StatePaired || r.state == StateEstablished) {
+			h.transitionLocked(appID, r, StateHalfJoined)
+		}
 		if len(r.conns) == 0 {
-			delete(h.rooms, appID)
+			if h.keepDropBoxLocked(r, time.Now()) {
+				h.transitionLocked(appID, r, StateCreated)
+				h.debugf(appID, "hub drop box kept", "until", r.dropUntil, "pendingA", len(r.box["A"]), "pendingB", len(r.box["B"]))
+				return
+			}
+			h.closeLocked(appID, r)
 		}
 	}
 }
 
+// closeLocked removes the empty room r. h.mu must be held for writing.
+func (h *Hub) closeLocked(appID string, r *room) {
+	h.transitionLocked(appID, r, StateClosing)
+	delete(h.rooms, appID)
+	h.rememberLocked(appID, r)
+	h.transitionLocked(appID, r, StateClosed)
+	if r.owner != "" {
+		if h.owned[r.owner]--; h.owned[r.owner] <= 0 {
+			delete(h.owned, r.owner)
+		}
+		h.observeOwnersLocked()
+	}
+}
+
 func (h *Hub) RoomSize(appID string) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -103,59 +400,392 @@ func (h *Hub) RoomSize(appID string) int {
 	return 0
 }
 
-func (h *Hub) BroadcastEvent(appID string, payload any) {
+// Connected reports whether side currently has a connection in appID.
+func (h *Hub) Connected(appID, side string) bool { return h.conn(appID, side) != nil }
+
+// ErrNotSolo is returned by Park when the partner is already connected.
+var ErrNotSolo = errors.New("peer already present")
+
+// Park marks side as a solo peer waiting for its partner. wake is invoked
+// (under the hub lock; it must not call back into the hub) when the partner joins.
+func (h *Hub) Park(appID, side string, wake func()) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return fmt.Errorf("%w: %s", ErrNotConnected, side)
+	}
+	if len(r.conns) > 1 {
+		return ErrNotSolo
+	}
+	if r.parked == nil {
+		r.parked = make(map[string]func())
+	}
+	if _, ok := r.parked[side]; !ok {
+		h.m.ParkedPeers.Inc()
+	}
+	r.parked[side] = wake
+	return nil
+}
+
+// Unpark wakes every parked peer in the room and returns their sides.
+func (h *Hub) Unpark(appID string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || len(r.parked) == 0 {
+		return nil
+	}
+	sides := make([]string, 0, len(r.parked))
+	for s, wake := range r.parked {
+		sides = append(sides, s)
+		if wake != nil {
+			wake()
+		}
+		h.m.ParkedPeers.Dec()
+	}
+	r.parked = nil
+	return sides
+}
+
+// ErrModeConflict is returned when a room's direction is already set differently.
+var ErrModeConflict = errors.New("room mode already set")
+
+// SetOneWay restricts relaying in appID to frames sent by side from.
+// Setting the same value again is a no-op; a different value fails.
+func (h *Hub) SetOneWay(appID, from string) error {
+	if from != "A" && from != "B" {
+		return fmt.Errorf("%w: %q", ErrInvalidSide, from)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.get(appID)
+	if r.oneWay != "" && r.oneWay != from {
+		return ErrModeConflict
+	}
+	r.oneWay = from
+	return nil
+}
+
+// AllowedFrom reports whether side may relay/send in appID.
+func (h *Hub) AllowedFrom(appID, side string) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	if r := h.rooms[appID]; r != nil {
-		for _, c := range r.conns {
-			_ = c.WriteJSON(payload)
+	if r := h.rooms[appID]; r != nil && r.oneWay != "" {
+		return r.oneWay == side
+	}
+	return true
+}
+
+// ErrPinConflict is returned when a room already has a different pinned fingerprint.
+var ErrPinConflict = errors.New("conflicting fingerprint pin")
+
+// SetPin registers a key fingerprint for the room. Re-pinning the identical
+// side+fingerprint is a no-op; anything else once pinned fails with ErrPinConflict.
+func (h *Hub) SetPin(appID, side, fpr string) error {
+	if fpr == "" || len(fpr) > 256 {
+		return ErrInvalidFingerprint
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return ErrRoomNotFound
+	}
+	if r.pin != nil {
+		if r.pin.Side == side && r.pin.Fpr == fpr {
+			return nil
 		}
+		return ErrPinConflict
 	}
+	r.pin = &Pin{Side: side, Fpr: fpr}
+	return nil
 }
 
-func (h *Hub) Broadcast(appID string, sender *websocket.Conn, raw []byte) {
+// GetPin returns the room's pinned fingerprint, if any.
+func (h *Hub) GetPin(appID string) (Pin, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	if r := h.rooms[appID]; r != nil && r.pin != nil {
+		return *r.pin, true
+	}
+	return Pin{}, false
+}
+
+// ClaimOffer arbitrates glare: an offer from side loses if the other side's
+// offer is still unanswered and was relayed less than window ago. The first
+// offer wins; ok=false means side must roll back and accept the winner's.
+func (h *Hub) ClaimOffer(appID, side string, window time.Duration) (ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return true
+	}
+	now := time.Now()
+	if o := r.offer; o != nil && o.side != side && now.Sub(o.at) < window {
+		return false
+	}
+	r.offer = &pendingOffer{side: side, at: now}
+	return true
+}
+
+// ClearOffer ends the glare window once an answer is seen.
+func (h *Hub) ClearOffer(appID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	if r := h.rooms[appID]; r != nil {
-		for _, cw := range r.conns {
-			if cw.c != sender {
-				_ = cw.WriteMessage(websocket.TextMessage, raw)
-			}
-		}
+		r.offer = nil
 	}
 }
 
-func (h *Hub) Hello(appID, side, _sid string, deliveredUpTo uint64) {
+// SetOrigin records side's origin fingerprint for appID.
+func (h *Hub) SetOrigin(appID, side, fpr string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return
+	}
+	if r.origins == nil {
+		r.origins = make(map[string]string)
+	}
+	r.origins[side] = fpr
+}
+
+// SetLeft records why side is leaving appID (a goodbye reason or how it
+// disconnected). Call before Unregister; it shows in RoomState while the
+// room lives.
+func (h *Hub) SetLeft(appID, side, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return
+	}
+	if r.left == nil {
+		r.left = make(map[string]string)
+	}
+	r.left[side] = reason
+}
+
+// SameOrigin reports whether the other side of appID is connected from fpr.
+func (h *Hub) SameOrigin(appID, side, fpr string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return false
+	}
+	other := "A"
+	if side == "A" {
+		other = "B"
+	}
+	o, ok := r.origins[other]
+	return ok && o == fpr
+}
+
+// Rooms returns the number of rooms currently tracked.
+func (h *Hub) Rooms() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms)
+}
+
+// Stats returns the number of rooms, connected peers and queued mailbox
+// items across the hub.
+func (h *Hub) Stats() (rooms, conns, mailbox int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, r := range h.rooms {
+		conns += len(r.conns)
+		for _, box := range r.box {
+			mailbox += len(box)
+		}
+	}
+	return len(h.rooms), conns, mailbox
+}
+
+// OldestMailboxItem returns how long the oldest queued mailbox item across
+// the hub has waited, or 0 if nothing is queued.
+func (h *Hub) OldestMailboxItem() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var oldest time.Time
+	for _, r := range h.rooms {
+		for _, box := range r.box {
+			// boxes are in enqueue order
+			if len(box) > 0 && (oldest.IsZero() || box[0].At.Before(oldest)) {
+				oldest = box[0].At
+			}
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// Writes happen outside h.mu: the lock only guards room state, so a slow
+// peer in one room never delays lookups or writes in another.
+
+// conn returns the writer for one side of a room, or nil.
+func (h *Hub) conn(appID, side string) *connWrap {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if r := h.rooms[appID]; r != nil {
-		if deliveredUpTo > r.deliv[side] {
-			r.deliv[side] = deliveredUpTo
+		return r.conns[side]
+	}
+	return nil
+}
+
+// peers returns the room's writers except the one for sender (nil: all).
+func (h *Hub) peers(appID string, sender *websocket.Conn) []*connWrap {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return nil
+	}
+	out := make([]*connWrap, 0, len(r.conns))
+	for _, cw := range r.conns {
+		if cw.c != sender || sender == nil {
+			out = append(out, cw)
 		}
-		box := r.box[side]
-		i := 0
-		for i < len(box) && box[i].Seq <= r.deliv[side] {
-			i++
+	}
+	return out
+}
+
+func (h *Hub) BroadcastEvent(appID string, payload any) {
+	for _, c := range h.peers(appID, nil) {
+		_ = c.WriteJSON(payload)
+	}
+}
+
+// Send writes a JSON payload to one side of a room (serialized with other writers).
+func (h *Hub) Send(appID, side string, payload any) error {
+	if c := h.conn(appID, side); c != nil {
+		return c.WriteJSON(payload)
+	}
+	return nil
+}
+
+// CloseConn sends a close frame with code/reason to one side (the read loop then ends).
+func (h *Hub) CloseConn(appID, side string, code int, reason string) error {
+	if c := h.conn(appID, side); c != nil {
+		return c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	return nil
+}
+
+// Broadcast writes raw to every conn in the room except sender (nil: to all).
+func (h *Hub) Broadcast(appID string, sender *websocket.Conn, raw []byte) {
+	if c := h.chaos.Load(); c != nil && !c.pass() {
+		h.m.ChaosDropped.Inc()
+		return
+	}
+	for _, cw := range h.peers(appID, sender) {
+		_ = cw.WriteMessage(websocket.TextMessage, raw)
+	}
+}
+
+// Hello trims side's mailbox up to deliveredUpTo and replays the rest.
+func (h *Hub) Hello(appID, side, _sid string, deliveredUpTo uint64) {
+	h.mu.Lock()
+	r := h.rooms[appID]
+	if r == nil {
+		h.mu.Unlock()
+		return
+	}
+	if deliveredUpTo > r.deliv[side] {
+		r.deliv[side] = deliveredUpTo
+	}
+	box := r.box[side]
+	i := 0
+	for i < len(box) && box[i].Seq <= r.deliv[side] {
+		i++
+	}
+	r.box[side] = box[i:]
+	now := time.Now()
+	h.expireMailLocked(appID, r, side, now)
+	expired := h.expireOffersLocked(appID, r, side, now)
+	h.debugf(appID, "mailbox replay", "side", side, "deliveredUpTo", r.deliv[side], "pending", len(r.box[side]))
+	c := r.conns[side]
+	h.mu.Unlock()
+
+	h.notifyExpired(appID, expired)
+	if c != nil {
+		h.deliverMail(appID, side, c, true)
+	}
+}
+
+// deliverMail writes side's pending mailbox items to c, in seq order: with
+// replay all of them, else those not yet written to c. Writes happen outside
+// h.mu but under c.mailMu, so a replay and live sends can't interleave or
+// reorder, and each item goes out once per replay.
+func (h *Hub) deliverMail(appID, side string, c *connWrap, replay bool) {
+	c.mailMu.Lock()
+	defer c.mailMu.Unlock()
+	h.mu.RLock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] != c || (!replay && r.paused[side]) {
+		h.mu.RUnlock()
+		return
+	}
+	if replay {
+		c.mailNext = 0
+	}
+	var pending []mailItem
+	for _, it := range r.box[side] {
+		if it.Seq >= c.mailNext {
+			pending = append(pending, it)
 		}
-		r.box[side] = box[i:]
-		if c := r.conns[side]; c != nil {
-			for _, it := range r.box[side] {
-				_ = c.WriteJSON(map[string]any{"type": "send", "seq": it.Seq, "payload": it.Payload})
-			}
+	}
+	h.mu.RUnlock()
+
+	how := "immediate"
+	if replay {
+		how = "replay"
+	}
+	for _, it := range pending {
+		if c.writeSend(it, false, "") != nil {
+			return // left for the next hello
 		}
+		c.mailNext = it.Seq + 1
+		h.m.MailboxLatency.WithLabelValues(how).Observe(time.Since(it.At).Seconds())
 	}
 }
 
-func (h *Hub) Enqueue(appID, _from, to string, payload json.RawMessage) error {
+func (h *Hub) Enqueue(appID, from, to string, payload json.RawMessage) error {
+	return h.enqueue(appID, from, to, payload, 0, false)
+}
+
+// EnqueueEcho is Enqueue that also writes the canonical frame (seq plus
+// server timestamp) back to the sender, marked "echo":true.
+func (h *Hub) EnqueueEcho(appID, from, to string, payload json.RawMessage) error {
+	return h.enqueue(appID, from, to, payload, 0, true)
+}
+
+func (h *Hub) enqueue(appID, from, to string, payload json.RawMessage, ttl time.Duration, echo bool) error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	r := h.get(appID)
 	seq := r.seq[to]
 	r.seq[to] = seq + 1
-	it := mailItem{Seq: seq, Payload: payload}
+	it := mailItem{Seq: seq, Payload: payload, At: time.Now(), From: from}
+	if ttl = h.itemTTL(ttl); ttl > 0 {
+		it.Expires = it.At.Add(ttl)
+	}
 	r.box[to] = append(r.box[to], it)
-	if c := r.conns[to]; c != nil {
-		_ = c.WriteJSON(map[string]any{"type": "send", "seq": it.Seq, "payload": it.Payload})
+	h.debugf(appID, "mailbox enqueue", "to", to, "seq", it.Seq, "size", len(payload), "online", r.conns[to] != nil, "paused", r.paused[to])
+	// held in the mailbox while the recipient is paused (see deliverMail)
+	dst, src := r.conns[to], r.conns[from]
+	h.mu.Unlock()
+
+	if dst != nil {
+		h.deliverMail(appID, to, dst, false)
+	}
+	if echo && src != nil {
+		_ = src.writeSend(it, true, to)
 	}
 	return nil
 }
@@ -173,28 +803,92 @@ func (h *Hub) AckUpTo(appID, side string, upTo uint64) {
 			i++
 		}
 		r.box[side] = box[i:]
+		h.debugf(appID, "mailbox ack", "side", side, "upTo", upTo, "dropped", i)
 	}
 }
 
-func (h *Hub) MarkEstablished(appID string) (time.Duration, bool) {
+// MailboxItems lists metadata of the items queued for side in appID.
+// ok is false if the room does not exist.
+func (h *Hub) MailboxItems(appID, side string) (items []MailboxItem, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return nil, false
+	}
+	items = make([]MailboxItem, 0, len(r.box[side]))
+	for _, it := range r.box[side] {
+		items = append(items, MailboxItem{Seq: it.Seq, Size: len(it.Payload), EnqueuedAt: it.At.UTC(), ExpiresAt: it.Expires.UTC()})
+	}
+	return items, true
+}
+
+// DeleteMailboxItem removes a single queued item by seq. It reports whether the item existed.
+func (h *Hub) DeleteMailboxItem(appID, side string, seq uint64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return false
+	}
+	box := r.box[side]
+	for i, it := range box {
+		if it.Seq == seq {
+			r.box[side] = append(box[:i:i], box[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeMailbox drops every queued item for side and returns how many were removed.
+func (h *Hub) PurgeMailbox(appID, side string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return 0
+	}
+	n := len(r.box[side])
+	r.box[side] = nil
+	return n
+}
+
+// MarkEstablished records that the room's peers connected and returns the
+// time to first connection; first is true only once per session, including
+// sessions resumed within the resume grace period (see SetResumeGrace).
+func (h *Hub) MarkEstablished(appID string) (ttf time.Duration, first bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if r := h.rooms[appID]; r != nil {
 		if r.estd.IsZero() {
 			r.estd = time.Now()
+			h.transitionLocked(appID, r, StateEstablished)
 			return r.estd.Sub(r.start), true
 		}
+		// re-established after a reconnect: the state follows, the metrics don't
+		if r.state == StatePaired {
+			h.transitionLocked(appID, r, StateEstablished)
+		}
 	}
 	return 0, false
 }
 
+// MarkFailed records an ICE failure for the room; it returns true only the first time
+// so a single client can't inflate failure counts.
+func (h *Hub) MarkFailed(appID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r := h.rooms[appID]; r != nil && !r.fail {
+		r.fail = true
+		return true
+	}
+	return false
+}
+
 func (h *Hub) Ping(appID, side string, data []byte) error {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	if r := h.rooms[appID]; r != nil {
-		if cw := r.conns[side]; cw != nil {
-			return cw.WriteControl(websocket.PingMessage, data, time.Now().Add(10*time.Second))
-		}
+	if cw := h.conn(appID, side); cw != nil {
+		return cw.WriteControl(websocket.PingMessage, data, time.Now().Add(writeWait))
 	}
 	return nil
 }
@@ -203,10 +897,14 @@ func (h *Hub) Ping(appID, side string, data []byte) error {
 // Best-effort; ignores write errors.
 func (h *Hub) BroadcastEventAll(payload any) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	all := make([]*connWrap, 0, len(h.rooms)*2)
 	for _, r := range h.rooms {
 		for _, c := range r.conns {
-			_ = c.WriteJSON(payload)
+			all = append(all, c)
 		}
 	}
+	h.mu.RUnlock()
+	for _, c := range all {
+		_ = c.WriteJSON(payload)
+	}
 }
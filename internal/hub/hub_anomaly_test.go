@@ -0,0 +1,66 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestFrameLimitEscalation(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	h.SetFrameLimits(hub.FrameLimits{Total: 8})
+	_ = h.Enqueue("loop", "A", "B", json.RawMessage(`{}`)) // create the room
+
+	// frames 1-6 pass (warned past 4); 7 opens throttling, 8 comes too soon
+	for i := 1; i <= 7; i++ {
+		if ok, _ := h.CountFrame("loop"); !ok {
+			t.Fatalf("frame %d dropped", i)
+		}
+	}
+	if ok, retry := h.CountFrame("loop"); ok || retry <= 0 {
+		t.Fatalf("throttled frame: ok=%v retry=%v", ok, retry)
+	}
+	if ok, retry := h.CountFrame("loop"); ok || retry != 0 {
+		t.Fatalf("frame over the limit: ok=%v retry=%v", ok, retry)
+	}
+	if ok, _ := h.CountFrame("loop"); ok {
+		t.Fatal("closed room relayed a frame")
+	}
+	for _, action := range []string{"warned", "throttled", "closed"} {
+		if n := testutil.ToFloat64(m.FrameAnomalies.WithLabelValues("total", action)); n != 1 {
+			t.Fatalf("%s: %v", action, n)
+		}
+	}
+
+	// other rooms and disabled limits are unaffected
+	_ = h.Enqueue("calm", "A", "B", json.RawMessage(`{}`))
+	if ok, _ := h.CountFrame("calm"); !ok {
+		t.Fatal("calm room throttled")
+	}
+	h.SetFrameLimits(hub.FrameLimits{})
+	if ok, _ := h.CountFrame("loop"); !ok {
+		t.Fatal("disabled limits still apply")
+	}
+}
+
+func TestFrameLimitPerMinute(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	h.SetFrameLimits(hub.FrameLimits{PerMin: 2})
+	_ = h.Enqueue("burst", "A", "B", json.RawMessage(`{}`))
+	h.CountFrame("burst")
+	h.CountFrame("burst")
+	if ok, _ := h.CountFrame("burst"); ok {
+		t.Fatal("third frame in a minute relayed")
+	}
+	if n := testutil.ToFloat64(m.FrameAnomalies.WithLabelValues("minute", "closed")); n != 1 {
+		t.Fatalf("closed: %v", n)
+	}
+}
@@ -0,0 +1,28 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestRoomBudgetIsPerRoom(t *testing.T) {
+	h := hub.New()
+	h.SetRoomRate(1, 3)
+	_ = h.Enqueue("noisy", "A", "B", json.RawMessage(`{}`)) // create rooms
+	_ = h.Enqueue("quiet", "A", "B", json.RawMessage(`{}`))
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := h.AllowRoom("noisy"); !ok {
+			t.Fatalf("frame %d within burst rejected", i)
+		}
+	}
+	ok, retry := h.AllowRoom("noisy")
+	if ok || retry <= 0 {
+		t.Fatalf("over budget: ok=%v retry=%v", ok, retry)
+	}
+	if ok, _ := h.AllowRoom("quiet"); !ok {
+		t.Fatal("noisy room drained another room's budget")
+	}
+}
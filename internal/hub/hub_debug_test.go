@@ -0,0 +1,28 @@
+package hub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestDebugOverride(t *testing.T) {
+	h := hub.New()
+	if h.Debug("r1") {
+		t.Fatal("debug without an override")
+	}
+	h.SetDebug("r1", time.Minute, 2)
+	got := []bool{h.Debug("r1"), h.Debug("r1"), h.Debug("r1"), h.Debug("r2")}
+	if !got[0] || got[1] || !got[2] || got[3] {
+		t.Fatalf("sampling 1 in 2: %v", got)
+	}
+	if !h.ClearDebug("r1") || h.Debug("r1") {
+		t.Fatal("override not cleared")
+	}
+
+	h.SetDebug("r3", -time.Second, 1)
+	if h.Debug("r3") || len(h.DebugStates()) != 0 {
+		t.Fatal("expired override still active")
+	}
+}
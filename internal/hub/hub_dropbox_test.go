@@ -0,0 +1,66 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestDropBox(t *testing.T) {
+	h := hub.New()
+	_ = h.Register("r1", "A", "", nil)
+	if _, err := h.SetDropBox("r1", "A"); !errors.Is(err, hub.ErrDropBoxDisabled) {
+		t.Fatalf("disabled: %v", err)
+	}
+	h.SetDropBoxTTL(time.Minute)
+	if _, err := h.SetDropBox("r1", "B"); !errors.Is(err, hub.ErrNotConnected) {
+		t.Fatalf("B not connected: %v", err)
+	}
+	until, err := h.SetDropBox("r1", "A")
+	if err != nil || time.Until(until) <= 0 {
+		t.Fatalf("SetDropBox: %v %v", until, err)
+	}
+
+	// A leaves an item and disconnects: the room stays
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{"blob":"..."}`))
+	h.Unregister("r1", nil)
+	st, ok := h.RoomState("r1")
+	if !ok || st.State != hub.StateCreated || st.Peers != 0 || !st.DropBoxUntil.Equal(until.UTC()) {
+		t.Fatalf("after A left: %+v %v", st, ok)
+	}
+	if h.ExpireMailbox(time.Now()); h.Rooms() != 1 {
+		t.Fatal("janitor closed a pending drop box")
+	}
+
+	// B drains it and leaves: one-shot, the room is gone
+	_ = h.Register("r1", "B", "", nil)
+	if items, _ := h.MailboxItems("r1", "B"); len(items) != 1 {
+		t.Fatalf("B's mailbox: %+v", items)
+	}
+	h.AckUpTo("r1", "B", 0)
+	h.Unregister("r1", nil)
+	if _, ok := h.RoomState("r1"); ok {
+		t.Fatal("drained drop box still open")
+	}
+
+	// an undrained drop box closes when it expires
+	_ = h.Register("r2", "A", "", nil)
+	_, _ = h.SetDropBox("r2", "A")
+	_ = h.Enqueue("r2", "A", "B", json.RawMessage(`{}`))
+	h.Unregister("r2", nil)
+	h.ExpireMailbox(time.Now().Add(2 * time.Minute))
+	if _, ok := h.RoomState("r2"); ok {
+		t.Fatal("expired drop box still open")
+	}
+
+	// ordinary rooms still close when empty, mail or not
+	_ = h.Register("r3", "A", "", nil)
+	_ = h.Enqueue("r3", "A", "B", json.RawMessage(`{}`))
+	h.Unregister("r3", nil)
+	if h.Rooms() != 0 {
+		t.Fatalf("rooms = %d", h.Rooms())
+	}
+}
@@ -0,0 +1,47 @@
+package hub_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestFeatureNegotiation(t *testing.T) {
+	h := hub.New()
+	a, b := new(websocket.Conn), new(websocket.Conn)
+	_ = h.Register("r", "A", "", a)
+	_ = h.Register("r", "B", "", b)
+
+	if _, ready, err := h.SetFeatures("r", "A", []string{"ice_batch", "binary", "ice_batch"}); ready || err != nil {
+		t.Fatalf("one side: ready=%v err=%v", ready, err)
+	}
+	common, ready, err := h.SetFeatures("r", "B", []string{"binary", "resume"})
+	if !ready || err != nil || !slices.Equal(common, []string{"binary"}) {
+		t.Fatalf("got %v ready=%v err=%v", common, ready, err)
+	}
+
+	// B reconnects as an older client: it has to advertise again
+	h.Unregister("r", b)
+	b = new(websocket.Conn)
+	_ = h.Register("r", "B", "", b)
+	if common, ready, _ = h.SetFeatures("r", "A", []string{"binary"}); ready {
+		t.Fatalf("stale features of the old B used: %v", common)
+	}
+	if common, ready, _ = h.SetFeatures("r", "B", []string{}); !ready || len(common) != 0 {
+		t.Fatalf("empty advertisement: %v ready=%v", common, ready)
+	}
+
+	for _, bad := range [][]string{{"Binary"}, {""}, {strings.Repeat("x", hub.MaxFeatureName+1)}, make([]string, hub.MaxFeatures+1)} {
+		if _, _, err := h.SetFeatures("r", "A", bad); !errors.Is(err, hub.ErrFeaturesInvalid) {
+			t.Errorf("%q: err = %v", bad, err)
+		}
+	}
+	if _, _, err := h.SetFeatures("nope", "A", nil); !errors.Is(err, hub.ErrRoomNotFound) {
+		t.Fatalf("unknown room: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+// connect registers side of appID on h over a loopback WebSocket and returns
+// the client end.
+func connect(tb testing.TB, h *hub.Hub, appID, side string) *websocket.Conn {
+	tb.Helper()
+	registered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := h.Register(appID, side, "", c); err != nil {
+			tb.Error(err)
+		}
+		close(registered)
+	}))
+	tb.Cleanup(srv.Close)
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = c.Close() })
+	<-registered
+	return c
+}
+
+func TestSendFrames(t *testing.T) {
+	h := hub.New()
+	a, b := connect(t, h, "r1", "A"), connect(t, h, "r1", "B")
+	_ = a.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_ = b.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := h.EnqueueEcho("r1", "A", "B", json.RawMessage(`{"name": "a.txt"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var got, echo struct {
+		Type, To string
+		Echo     bool
+		Seq      uint64
+		TS       int64
+		Payload  map[string]string
+	}
+	for _, c := range []struct {
+		conn *websocket.Conn
+		into any
+	}{{b, &got}, {a, &echo}} {
+		for {
+			_, p, err := c.conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid(p) {
+				t.Fatalf("invalid frame %s", p)
+			}
+			if strings.Contains(string(p), `"type":"send"`) {
+				_ = json.Unmarshal(p, c.into)
+				break
+			}
+		}
+	}
+	if got.Type != "send" || got.Echo || got.Seq != 0 || got.Payload["name"] != "a.txt" {
+		t.Fatalf("delivered: %+v", got)
+	}
+	if !echo.Echo || echo.To != "B" || echo.TS == 0 || echo.Payload["name"] != "a.txt" {
+		t.Fatalf("echo: %+v", echo)
+	}
+}
+
+// BenchmarkMailboxDelivery enqueues 16 KiB payloads for a connected peer.
+func BenchmarkMailboxDelivery(b *testing.B) {
+	h := hub.New()
+	c := connect(b, h, "r1", "B")
+	go func() {
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	payload := json.RawMessage(`{"chunk":"` + strings.Repeat("x", 16<<10) + `"}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = h.Enqueue("r1", "A", "B", payload)
+		h.AckUpTo("r1", "B", uint64(i))
+	}
+}
+
+func TestMailboxReplayKeepsOrder(t *testing.T) {
+	h := hub.New()
+	b := connect(t, h, "r1", "B")
+	const n = 400
+	payload := json.RawMessage(`"` + strings.Repeat("x", 32<<10) + `"`)
+	var seqs []uint64
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for {
+			_ = b.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			var f struct{ Seq uint64 }
+			if b.ReadJSON(&f) != nil {
+				return
+			}
+			seqs = append(seqs, f.Seq)
+		}
+	}()
+	started, sent := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := range n {
+			if i == n/4 {
+				close(started)
+			}
+			_ = h.Enqueue("r1", "A", "B", payload)
+			time.Sleep(20 * time.Microsecond)
+		}
+	}()
+	<-started
+	for range 3 {
+		h.Hello("r1", "B", "", 0) // replays while sends continue
+	}
+	<-sent
+	<-read
+
+	// every run of frames is in seq order without gaps; only replays restart it
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] > seqs[i-1]+1 {
+			t.Fatalf("seq %d after %d", seqs[i], seqs[i-1])
+		}
+	}
+	if len(seqs) == 0 || seqs[len(seqs)-1] != n-1 {
+		t.Fatalf("%d frames, last %v", len(seqs), seqs[max(len(seqs)-1, 0):])
+	}
+}
@@ -0,0 +1,32 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestClaimOfferFirstWins(t *testing.T) {
+	h := hub.New()
+	_ = h.Enqueue("app", "A", "B", json.RawMessage(`{}`)) // create room
+
+	if !h.ClaimOffer("app", "B", time.Minute) {
+		t.Fatal("first offer must win")
+	}
+	if h.ClaimOffer("app", "A", time.Minute) {
+		t.Fatal("colliding offer must lose")
+	}
+	if !h.ClaimOffer("app", "B", time.Minute) {
+		t.Fatal("re-offer from the winner is not glare")
+	}
+
+	h.ClearOffer("app")
+	if !h.ClaimOffer("app", "A", time.Minute) {
+		t.Fatal("offer after an answer is not glare")
+	}
+	if !h.ClaimOffer("app", "B", 0) {
+		t.Fatal("offer outside the window is not glare")
+	}
+}
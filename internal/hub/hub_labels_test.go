@@ -0,0 +1,85 @@
+package hub_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestParseSelector(t *testing.T) {
+	ios := map[string]string{"platform": "ios", "app_version": "1.9.3"}
+	web := map[string]string{"platform": "web", "app_version": "1.10.0", "tenant": "acme"}
+	for _, tc := range []struct {
+		sel      string
+		ios, web bool
+	}{
+		{"", true, true},
+		{"platform=ios", true, false},
+		{"platform!=ios", false, true},
+		{"tenant!=acme", true, false},
+		{"app_version<1.10", true, false},
+		{"app_version>=1.10.0", false, true},
+		{" platform = web , app_version > 1.9 ", false, true},
+		{"tenant<b", false, true},
+	} {
+		sel, err := hub.ParseSelector(tc.sel)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.sel, err)
+		}
+		if got := sel.Matches(ios); got != tc.ios {
+			t.Errorf("%q matches ios = %v, want %v", tc.sel, got, tc.ios)
+		}
+		if got := sel.Matches(web); got != tc.web {
+			t.Errorf("%q matches web = %v, want %v", tc.sel, got, tc.web)
+		}
+	}
+	for _, bad := range []string{"platform", "=ios", "Platform=ios", "platform="} {
+		if _, err := hub.ParseSelector(bad); !errors.Is(err, hub.ErrSelectorInvalid) {
+			t.Errorf("%q: want ErrSelectorInvalid, got %v", bad, err)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	h := hub.New()
+	m := metrics.New()
+	h.SetMetrics(m)
+	h.SetLabelMetrics([]string{"platform"})
+	a, b := connect(t, h, "r1", "A"), connect(t, h, "r1", "B")
+
+	if err := h.SetLabels("r1", "A", map[string]string{"Bad Key": "x"}); !errors.Is(err, hub.ErrLabelsInvalid) {
+		t.Fatalf("bad key: want ErrLabelsInvalid, got %v", err)
+	}
+	if err := h.SetLabels("r1", "A", map[string]string{"platform": "ios", "app_version": "1.3.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetLabels("r1", "B", map[string]string{"platform": "android"}); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := h.RoomState("r1"); st.Labels["A"]["platform"] != "ios" || st.Labels["B"]["platform"] != "android" {
+		t.Fatalf("room labels: %v", st.Labels)
+	}
+	if got := testutil.ToFloat64(m.WSLabeledConns.WithLabelValues("platform", "ios")); got != 1 {
+		t.Fatalf("ios connections = %v, want 1", got)
+	}
+
+	sel, _ := hub.ParseSelector("platform=ios,app_version<1.4")
+	if n := h.CloseMatching(sel, websocket.ClosePolicyViolation, "please update"); n != 1 {
+		t.Fatalf("closed %d, want 1", n)
+	}
+	_ = a.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := a.ReadMessage()
+	if ce := (*websocket.CloseError)(nil); !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation || ce.Text != "please update" {
+		t.Fatalf("A: want close 1008, got %v", err)
+	}
+	_ = b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := b.ReadMessage(); websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatal("B was closed too")
+	}
+}
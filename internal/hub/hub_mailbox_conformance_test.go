@@ -0,0 +1,12 @@
+package hub_test
+
+import (
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub/hubtest"
+)
+
+func TestMailboxConformance(t *testing.T) {
+	hubtest.Run(t, func() hubtest.MailboxStore { return hub.New() })
+}
@@ -0,0 +1,72 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestMailboxDeliveryLatency(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	m.ObserveMailboxAge(h.OldestMailboxItem)
+
+	if err := h.Register("r1", "A", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{}`)) // B is offline: queued
+	}
+	time.Sleep(20 * time.Millisecond)
+	if age := h.OldestMailboxItem(); age < 20*time.Millisecond {
+		t.Fatalf("oldest age %v, want >= 20ms", age)
+	}
+	if n, err := testutil.GatherAndCount(m.Registry(), "nt_mailbox_oldest_undelivered_seconds"); err != nil || n != 1 {
+		t.Fatalf("oldest gauge series = %d, err %v", n, err)
+	}
+
+	registered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := h.Register("r1", "B", "", c); err != nil {
+			t.Error(err)
+		}
+		close(registered)
+	}))
+	defer srv.Close()
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-registered
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	h.Hello("r1", "B", "", 0) // trims seq 0, replays seq 1
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{}`))
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := testutil.CollectAndCount(m.MailboxLatency); n != 2 {
+		t.Fatalf("latency series = %d, want immediate and replay", n)
+	}
+	h.AckUpTo("r1", "B", 2)
+	if age := h.OldestMailboxItem(); age != 0 {
+		t.Fatalf("oldest age %v after ack, want 0", age)
+	}
+}
@@ -0,0 +1,59 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestMailboxTTL(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	h.SetMailboxTTL(time.Minute)
+	a := connect(t, h, "r1", "A")
+	_ = a.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// the echo tells the sender how long the item is held, capped by the hub
+	_ = h.EnqueueTTL("r1", "A", "B", json.RawMessage(`{"n":0}`), time.Hour, true)
+	var f struct {
+		Type  string
+		Seq   uint64
+		TTLMs int64
+	}
+	if err := a.ReadJSON(&f); err != nil || f.Type != "send" || f.TTLMs != time.Minute.Milliseconds() {
+		t.Fatalf("echo: %+v (%v)", f, err)
+	}
+	_ = h.EnqueueTTL("r1", "A", "B", json.RawMessage(`{"n":1}`), 10*time.Second, false)
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{"n":2}`))
+	items, _ := h.MailboxItems("r1", "B")
+	if len(items) != 3 || items[1].ExpiresAt.Sub(items[1].EnqueuedAt) != 10*time.Second {
+		t.Fatalf("items: %+v", items)
+	}
+
+	now := time.Now()
+	if n := h.ExpireMailbox(now.Add(30 * time.Second)); n != 1 {
+		t.Fatalf("expired %d after 30s, want 1", n)
+	}
+	if n := h.ExpireMailbox(now.Add(2 * time.Minute)); n != 2 {
+		t.Fatalf("expired %d after 2m, want 2", n)
+	}
+	if items, _ := h.MailboxItems("r1", "B"); len(items) != 0 {
+		t.Fatalf("left: %+v", items)
+	}
+	if got := testutil.ToFloat64(m.MailboxTTLExpired); got != 3 {
+		t.Fatalf("nt_mailbox_expired_items_total = %v, want 3", got)
+	}
+
+	// without a hub limit only items with their own TTL expire
+	h.SetMailboxTTL(0)
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{}`))
+	if n := h.ExpireMailbox(time.Now().Add(24 * time.Hour)); n != 0 {
+		t.Fatalf("expired %d without a TTL", n)
+	}
+}
@@ -0,0 +1,35 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestRoomMeta(t *testing.T) {
+	h := hub.New()
+	h.SetMetaLimit(32)
+	if err := h.SetMeta("r", json.RawMessage(`{"name":"x"}`)); !errors.Is(err, hub.ErrRoomNotFound) {
+		t.Fatalf("no room: %v", err)
+	}
+	_ = h.Register("r", "A", "", new(websocket.Conn))
+
+	if err := h.SetMeta("r", json.RawMessage(`["not","an","object"]`)); !errors.Is(err, hub.ErrMetaInvalid) {
+		t.Fatalf("array: %v", err)
+	}
+	big := `{"name":"` + strings.Repeat("x", 32) + `"}`
+	if err := h.SetMeta("r", json.RawMessage(big)); !errors.Is(err, hub.ErrMetaTooLarge) {
+		t.Fatalf("oversized: %v", err)
+	}
+	if err := h.SetMeta("r", json.RawMessage(`{ "name": "x" }`)); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := h.Meta("r"); !ok || string(m) != `{"name":"x"}` {
+		t.Fatalf("meta = %s %v", m, ok)
+	}
+}
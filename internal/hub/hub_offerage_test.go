@@ -0,0 +1,69 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestStaleOfferExpires(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	h.SetOfferMaxAge(20 * time.Millisecond)
+
+	// the sender is connected; the receiver joins late
+	registered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := h.Register("r1", "A", "", c); err != nil {
+			t.Error(err)
+		}
+		close(registered)
+	}))
+	defer srv.Close()
+	a, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	<-registered
+	_ = a.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{}`)) // seq 0, trimmed by Hello(0)
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{"type":"offer","sdp":"v=0"}`))
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{"type":"file-meta"}`))
+	time.Sleep(30 * time.Millisecond)
+	h.Hello("r1", "B", "", 0)
+
+	var f struct {
+		Type, Kind, To string
+		Seq            uint64
+		AgeMs          int64
+	}
+	if err := a.ReadJSON(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != "offer_expired" || f.Kind != "offer" || f.To != "B" || f.Seq != 1 || f.AgeMs < 20 {
+		t.Fatalf("got %+v", f)
+	}
+	items, _ := h.MailboxItems("r1", "B")
+	if len(items) != 1 || items[0].Seq != 2 {
+		t.Fatalf("mailbox after expiry: %+v", items)
+	}
+	if n := testutil.ToFloat64(m.MailboxExpired.WithLabelValues("offer")); n != 1 {
+		t.Fatalf("expired counter %v", n)
+	}
+}
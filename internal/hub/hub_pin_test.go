@@ -0,0 +1,27 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestPinFirstWins(t *testing.T) {
+	h := hub.New()
+	_ = h.Enqueue("app", "A", "B", json.RawMessage(`{}`)) // create room
+
+	if err := h.SetPin("app", "A", "fpr-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetPin("app", "A", "fpr-1"); err != nil {
+		t.Fatalf("identical re-pin should be a no-op: %v", err)
+	}
+	if err := h.SetPin("app", "B", "fpr-2"); !errors.Is(err, hub.ErrPinConflict) {
+		t.Fatalf("want ErrPinConflict, got %v", err)
+	}
+	if p, ok := h.GetPin("app"); !ok || p.Side != "A" || p.Fpr != "fpr-1" {
+		t.Fatalf("unexpected pin: %+v %v", p, ok)
+	}
+}
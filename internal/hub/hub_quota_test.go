@@ -0,0 +1,50 @@
+package hub_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestRoomQuota(t *testing.T) {
+	h := hub.New()
+	// conns are only compared by identity in the hub; nil is fine for bookkeeping
+	if err := h.RegisterOwned("r1", "A", "", "ip", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if h.CanOpen("r2", "ip", 1) {
+		t.Fatal("second room should be over quota")
+	}
+	if err := h.RegisterOwned("r2", "A", "", "ip", 1, nil); !errors.Is(err, hub.ErrRoomQuota) {
+		t.Fatalf("want ErrRoomQuota, got %v", err)
+	}
+	if err := h.RegisterOwned("r1", "B", "", "ip", 1, nil); err != nil {
+		t.Fatalf("joining an open room is not limited: %v", err)
+	}
+
+	h.Unregister("r1", nil) // drops every nil conn, closing the room
+	if !h.CanOpen("r2", "ip", 1) {
+		t.Fatal("quota not released when the room closed")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	h := hub.New()
+	_ = h.Register("r", "A", "", nil)
+	if err := h.Register("r", "A", "", nil); !errors.Is(err, hub.ErrSideBusy) {
+		t.Fatalf("want ErrSideBusy, got %v", err)
+	}
+	if err := h.Park("r", "B", nil); !errors.Is(err, hub.ErrNotConnected) {
+		t.Fatalf("want ErrNotConnected, got %v", err)
+	}
+	if err := h.SetOneWay("r", "C"); !errors.Is(err, hub.ErrInvalidSide) {
+		t.Fatalf("want ErrInvalidSide, got %v", err)
+	}
+	if err := h.SetPin("nope", "A", "fpr"); !errors.Is(err, hub.ErrRoomNotFound) {
+		t.Fatalf("want ErrRoomNotFound, got %v", err)
+	}
+	if err := h.SetPin("r", "A", ""); !errors.Is(err, hub.ErrInvalidFingerprint) {
+		t.Fatalf("want ErrInvalidFingerprint, got %v", err)
+	}
+}
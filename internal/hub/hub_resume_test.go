@@ -0,0 +1,49 @@
+package hub_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestEstablishedSurvivesReconnect(t *testing.T) {
+	h := hub.New()
+	join := func() (a, b *websocket.Conn) {
+		a, b = new(websocket.Conn), new(websocket.Conn)
+		_ = h.Register("r", "A", "", a)
+		_ = h.Register("r", "B", "", b)
+		return a, b
+	}
+	a, b := join()
+	if _, first := h.MarkEstablished("r"); !first {
+		t.Fatal("first establishment not reported")
+	}
+	h.Unregister("r", a)
+	h.Unregister("r", b) // room closes
+
+	join()
+	if _, first := h.MarkEstablished("r"); first {
+		t.Fatal("resumed session counted as established again")
+	}
+	if st, _ := h.RoomState("r"); st.State != hub.StateEstablished {
+		t.Fatalf("resumed room state = %s", st.State)
+	}
+}
+
+func TestResumeGraceExpires(t *testing.T) {
+	h := hub.New()
+	h.SetResumeGrace(time.Millisecond)
+	a := new(websocket.Conn)
+	_ = h.Register("r", "A", "", a)
+	h.MarkEstablished("r")
+	h.Unregister("r", a)
+	time.Sleep(5 * time.Millisecond)
+
+	_ = h.Register("r", "A", "", new(websocket.Conn))
+	if _, first := h.MarkEstablished("r"); !first {
+		t.Fatal("session after the grace period not counted")
+	}
+}
@@ -0,0 +1,52 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	old := hub.New()
+	_ = old.Register("r1", "A", "", nil)
+	_ = old.Enqueue("r1", "A", "B", json.RawMessage(`{"n":1}`))
+	_ = old.Enqueue("r1", "A", "B", json.RawMessage(`{"n":2}`))
+	_ = old.SetPin("r1", "A", "fpr")
+	_ = old.Register("r2", "A", "", nil) // nothing queued: not saved
+
+	b, err := json.Marshal(old.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap hub.Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Rooms) != 1 {
+		t.Fatalf("saved %d rooms, want 1", len(snap.Rooms))
+	}
+
+	h := hub.New()
+	if n := h.Restore(snap, time.Minute); n != 1 {
+		t.Fatalf("restored %d rooms, want 1", n)
+	}
+	if _, ok := h.RoomState("r1"); ok {
+		t.Fatal("restored rooms should open lazily")
+	}
+	// opening the room applies it; sequence numbers carry on where the old
+	// process stopped
+	_ = h.Enqueue("r1", "A", "B", json.RawMessage(`{"n":3}`))
+	if items, _ := h.MailboxItems("r1", "B"); len(items) != 3 || items[0].Seq != 0 || items[2].Seq != 2 {
+		t.Fatalf("mailbox: %+v", items)
+	}
+	if p, ok := h.GetPin("r1"); !ok || p.Fpr != "fpr" {
+		t.Fatalf("pin: %+v", p)
+	}
+
+	snap.At = time.Now().Add(-2 * time.Minute)
+	if n := hub.New().Restore(snap, time.Minute); n != 0 {
+		t.Fatalf("stale snapshot restored %d rooms", n)
+	}
+}
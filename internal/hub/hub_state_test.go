@@ -0,0 +1,49 @@
+package hub_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestRoomLifecycle(t *testing.T) {
+	h := hub.New()
+	var got []hub.State
+	h.OnTransition(func(appID string, from, to hub.State) { got = append(got, to) })
+
+	// conns are only compared by identity; zero values are fine for bookkeeping
+	a, b := new(websocket.Conn), new(websocket.Conn)
+	_ = h.Register("r", "A", "", a)
+	if st, ok := h.RoomState("r"); !ok || st.State != hub.StateHalfJoined || st.Peers != 1 {
+		t.Fatalf("after A joined: %+v %v", st, ok)
+	}
+	_ = h.Register("r", "B", "", b)
+	h.MarkEstablished("r")
+	h.Unregister("r", b)
+	h.MarkEstablished("r") // already established once: no-op
+	h.Unregister("r", a)
+
+	want := []hub.State{
+		hub.StateHalfJoined, hub.StatePaired, hub.StateEstablished,
+		hub.StateHalfJoined, hub.StateClosing, hub.StateClosed,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("transitions = %v, want %v", got, want)
+	}
+	if _, ok := h.RoomState("r"); ok {
+		t.Fatal("closed room still reported")
+	}
+}
+
+func TestRoomInvalidTransitionIgnored(t *testing.T) {
+	h := hub.New()
+	_ = h.Register("r", "A", "", new(websocket.Conn))
+	// a lone peer can't be established: state stays half_joined
+	h.MarkEstablished("r")
+	if st, _ := h.RoomState("r"); st.State != hub.StateHalfJoined {
+		t.Fatalf("state = %s", st.State)
+	}
+}
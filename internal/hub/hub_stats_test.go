@@ -0,0 +1,26 @@
+package hub_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestStats(t *testing.T) {
+	h := hub.New()
+	if err := h.Register("r1", "A", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("r2", "A", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := h.Enqueue("r1", "A", "B", json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rooms, conns, mailbox := h.Stats(); rooms != 2 || conns != 2 || mailbox != 3 {
+		t.Fatalf("Stats() = %d, %d, %d; want 2, 2, 3", rooms, conns, mailbox)
+	}
+}
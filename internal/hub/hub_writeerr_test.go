@@ -0,0 +1,71 @@
+package hub_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestWriteCause(t *testing.T) {
+	for err, want := range map[error]string{
+		fmt.Errorf("write: %w", os.ErrDeadlineExceeded):                           hub.WriteTimeout,
+		&net.OpError{Op: "write", Err: &os.SyscallError{Err: syscall.EPIPE}}:      hub.WriteBrokenPipe,
+		&net.OpError{Op: "write", Err: &os.SyscallError{Err: syscall.ECONNRESET}}: hub.WriteBrokenPipe,
+		websocket.ErrCloseSent: hub.WritePolicy,
+		net.ErrClosed:          hub.WriteClosed,
+		fmt.Errorf("boom"):     hub.WriteOther,
+	} {
+		if got := hub.WriteCause(err); got != want {
+			t.Errorf("WriteCause(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+func TestWriteErrorsCounted(t *testing.T) {
+	m := metrics.New()
+	h := hub.New()
+	h.SetMetrics(m)
+	registered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := h.Register("r1", "A", "", c); err != nil {
+			t.Error(err)
+		}
+		close(registered)
+	}))
+	defer srv.Close()
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-registered
+
+	if err := h.Send("r1", "A", map[string]any{"type": "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CloseConn("r1", "A", websocket.CloseNormalClosure, ""); err != nil {
+		t.Fatal(err)
+	}
+	// gorilla refuses data frames once the close frame is out
+	if err := h.Send("r1", "A", map[string]any{"type": "lost"}); err == nil {
+		t.Fatal("write after close succeeded")
+	}
+	if n := testutil.ToFloat64(m.WSWriteErrors.WithLabelValues(hub.WritePolicy)); n != 1 {
+		t.Fatalf("policy write errors = %v, want 1", n)
+	}
+}
@@ -0,0 +1,89 @@
+// Package hubtest is a conformance suite for mailbox backends.
+package hubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+// MailboxStore is the contract shared by mailbox backends: per-side sequence
+// numbers start at 0 and increase by one, and AckUpTo drops every item <= upTo.
+type MailboxStore interface {
+	Enqueue(appID, from, to string, payload json.RawMessage) error
+	AckUpTo(appID, side string, upTo uint64)
+	MailboxItems(appID, side string) ([]hub.MailboxItem, bool)
+}
+
+// Run checks ordering and ack semantics against stores built by newStore.
+func Run(t *testing.T, newStore func() MailboxStore) {
+	t.Run("ConcurrentEnqueue", func(t *testing.T) { testConcurrentEnqueue(t, newStore()) })
+	t.Run("Model", func(t *testing.T) { testModel(t, newStore()) })
+}
+
+func testConcurrentEnqueue(t *testing.T, s MailboxStore) {
+	const n = 200
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.Enqueue("app", "A", "B", json.RawMessage(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+				t.Errorf("enqueue: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	items, _ := s.MailboxItems("app", "B")
+	if len(items) != n {
+		t.Fatalf("got %d items, want %d", len(items), n)
+	}
+	for i, it := range items {
+		if it.Seq != uint64(i) {
+			t.Fatalf("item %d has seq %d; want contiguous seqs from 0", i, it.Seq)
+		}
+	}
+}
+
+// testModel interleaves random enqueues and acks on both sides and compares
+// the queued seqs with a model after every step. The seed is logged.
+func testModel(t *testing.T, s MailboxStore) {
+	seed := rand.Uint64()
+	t.Logf("seed %d", seed)
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	next := map[string]uint64{}
+	queued := map[string][]uint64{}
+	for i := 0; i < 1000; i++ {
+		to := []string{"A", "B"}[rng.IntN(2)]
+		if rng.IntN(3) > 0 {
+			from := map[string]string{"A": "B", "B": "A"}[to]
+			if err := s.Enqueue("app", from, to, json.RawMessage(`{}`)); err != nil {
+				t.Fatalf("op %d: enqueue: %v", i, err)
+			}
+			queued[to] = append(queued[to], next[to])
+			next[to]++
+		} else if next[to] > 0 {
+			upTo := rng.Uint64N(next[to])
+			s.AckUpTo("app", to, upTo)
+			q := queued[to]
+			for len(q) > 0 && q[0] <= upTo {
+				q = q[1:]
+			}
+			queued[to] = q
+		}
+		items, _ := s.MailboxItems("app", to)
+		if len(items) != len(queued[to]) {
+			t.Fatalf("op %d: side %s has %d items, model %d", i, to, len(items), len(queued[to]))
+		}
+		for j, it := range items {
+			if it.Seq != queued[to][j] {
+				t.Fatalf("op %d: side %s item %d seq %d, model %d", i, to, j, it.Seq, queued[to][j])
+			}
+		}
+	}
+}
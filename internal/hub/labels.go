@@ -0,0 +1,299 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Limits on a connection's labels.
+const (
+	MaxLabels      = 8
+	MaxLabelKey    = 32
+	MaxLabelValue  = 64
+	maxLabelValues = 20 // distinct metric values per key; later ones count as "other"
+)
+
+var (
+	// ErrLabelsInvalid is returned by SetLabels for too many labels, keys
+	// outside [a-z0-9_.-] or overlong values.
+	ErrLabelsInvalid = errors.New("invalid labels")
+	// ErrSelectorInvalid is returned by ParseSelector.
+	ErrSelectorInvalid = errors.New("invalid label selector")
+)
+
+// peerLabels are one side's labels and the metric series they were counted
+// under, so leaving decrements exactly what joining incremented.
+type peerLabels struct {
+	set     map[string]string
+	counted [][2]string // (key, value) pairs of nt_ws_connections_by_label
+}
+
+// SetLabelMetrics reports connections per value of each of keys in
+// nt_ws_connections_by_label. Values are capped per key; later ones are
+// reported as "other". Call before serving.
+func (h *Hub) SetLabelMetrics(keys []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.labelKeys = slices.Clone(keys)
+	h.labelValues = make(map[string]map[string]bool)
+}
+
+// SetLabels replaces the labels (e.g. platform=ios, app_version=1.4.2,
+// tenant=acme) of side's connection in appID. Labels are kept until the side
+// disconnects; they show in RoomState and select connections for
+// BroadcastEventMatching and CloseMatching.
+func (h *Hub) SetLabels(appID, side string, labels map[string]string) error {
+	if err := ValidLabels(labels); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.rooms[appID]
+	if r == nil || r.conns[side] == nil {
+		return ErrRoomNotFound
+	}
+	h.dropLabelsLocked(r, side)
+	if len(labels) == 0 {
+		return nil
+	}
+	pl := &peerLabels{set: maps.Clone(labels)}
+	for _, k := range h.labelKeys {
+		if v, ok := labels[k]; ok {
+			v = h.labelValueLocked(k, v)
+			h.m.WSLabeledConns.WithLabelValues(k, v).Inc()
+			pl.counted = append(pl.counted, [2]string{k, v})
+		}
+	}
+	if r.labels == nil {
+		r.labels = make(map[string]*peerLabels)
+	}
+	r.labels[side] = pl
+	return nil
+}
+
+// dropLabelsLocked forgets side's labels; h.mu must be held for writing.
+func (h *Hub) dropLabelsLocked(r *room, side string) {
+	pl := r.labels[side]
+	if pl == nil {
+		return
+	}
+	for _, kv := range pl.counted {
+		h.m.WSLabeledConns.WithLabelValues(kv[0], kv[1]).Dec()
+	}
+	delete(r.labels, side)
+}
+
+// labelValueLocked returns the metric value for v under key k.
+func (h *Hub) labelValueLocked(k, v string) string {
+	seen := h.labelValues[k]
+	if seen == nil {
+		seen = make(map[string]bool)
+		h.labelValues[k] = seen
+	}
+	if !seen[v] {
+		if len(seen) >= maxLabelValues {
+			return "other"
+		}
+		seen[v] = true
+	}
+	return v
+}
+
+// ValidLabels reports whether labels are acceptable to SetLabels.
+func ValidLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("%w: %d > %d labels", ErrLabelsInvalid, len(labels), MaxLabels)
+	}
+	for k, v := range labels {
+		if !validLabelKey(k) {
+			return fmt.Errorf("%w: key %q", ErrLabelsInvalid, k)
+		}
+		if v == "" || len(v) > MaxLabelValue || strings.ContainsAny(v, ",<>=!") {
+			return fmt.Errorf("%w: value %q of %s", ErrLabelsInvalid, v, k)
+		}
+	}
+	return nil
+}
+
+func validLabelKey(k string) bool {
+	return len(k) <= MaxLabelKey && validFeature(k)
+}
+
+// Selector matches connections by their labels; see ParseSelector. The zero
+// Selector matches every connection.
+type Selector []labelReq
+
+type labelReq struct {
+	key, op, value string
+}
+
+// selectorOps are the accepted operators, two-character ones first so that
+// "<=" isn't read as "<".
+var selectorOps = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// ParseSelector parses a comma-separated list of requirements, all of which
+// must hold: key=value, key!=value, and key<value, key<=value, key>value,
+// key>=value. The ordering operators compare dotted versions numerically
+// ("1.10" > "1.9") when both sides parse as versions, strings otherwise; a
+// connection without the key never matches them. key!=value matches
+// connections without the key. "" selects everything.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var req labelReq
+		for i := 0; i < len(part) && req.op == ""; i++ {
+			for _, op := range selectorOps {
+				if strings.HasPrefix(part[i:], op) {
+					req = labelReq{key: strings.TrimSpace(part[:i]), op: op, value: strings.TrimSpace(part[i+len(op):])}
+					break
+				}
+			}
+		}
+		if req.op == "" || !validLabelKey(req.key) || req.value == "" {
+			return nil, fmt.Errorf("%w: %q", ErrSelectorInvalid, part)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// String returns sel in ParseSelector syntax.
+func (sel Selector) String() string {
+	parts := make([]string, len(sel))
+	for i, req := range sel {
+		parts[i] = req.key + req.op + req.value
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches reports whether labels satisfy every requirement of sel.
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		v, ok := labels[req.key]
+		switch req.op {
+		case "=":
+			if !ok || v != req.value {
+				return false
+			}
+		case "!=":
+			if ok && v == req.value {
+				return false
+			}
+		default:
+			if !ok {
+				return false
+			}
+			c := compareLabel(v, req.value)
+			if !(req.op == "<" && c < 0 || req.op == "<=" && c <= 0 || req.op == ">" && c > 0 || req.op == ">=" && c >= 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareLabel orders a and b as versions when both parse as one.
+func compareLabel(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses the leading dotted numeric part of v ("v1.4.2-beta" -> [1 4 2]).
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	parts := strings.Split(v, ".")
+	out := make([]int, len(parts))
+	for i, s := range parts {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+// matchingLocked returns the connections of pair rooms whose labels match
+// sel; h.mu must be held.
+func (h *Hub) matchingLocked(sel Selector) []*connWrap {
+	var out []*connWrap
+	for _, r := range h.rooms {
+		for s, c := range r.conns {
+			var set map[string]string
+			if pl := r.labels[s]; pl != nil {
+				set = pl.set
+			}
+			if sel.Matches(set) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// CountMatching returns how many connections sel matches.
+func (h *Hub) CountMatching(sel Selector) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.matchingLocked(sel))
+}
+
+// BroadcastEventMatching sends a JSON payload to every connection sel
+// matches and returns how many that were. Best-effort; ignores write errors.
+func (h *Hub) BroadcastEventMatching(sel Selector, payload any) int {
+	h.mu.RLock()
+	conns := h.matchingLocked(sel)
+	h.mu.RUnlock()
+	for _, c := range conns {
+		_ = c.WriteJSON(payload)
+	}
+	return len(conns)
+}
+
+// CloseMatching sends a close frame with code/reason to every connection sel
+// matches (their read loops then end) and returns how many that were.
+func (h *Hub) CloseMatching(sel Selector, code int, reason string) int {
+	h.mu.RLock()
+	conns := h.matchingLocked(sel)
+	h.mu.RUnlock()
+	for _, c := range conns {
+		_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	return len(conns)
+}
@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// mailboxSweepEvery is how often StartJanitor drops expired mailbox items.
+// Replays check expiry themselves, so the sweep only bounds memory.
+const mailboxSweepEvery = 10 * time.Second
+
+// SetMailboxTTL caps how long a mailbox item is held: after d it is dropped
+// undelivered, even if the room stays open. Senders may ask for less (see
+// EnqueueTTL). d <= 0 keeps items until acked or the room closes, unless
+// their sender set a TTL. Call before serving.
+func (h *Hub) SetMailboxTTL(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mailTTL = d
+}
+
+// EnqueueTTL is Enqueue (EnqueueEcho with echo set) for an item held at
+// most ttl; ttl <= 0 or above the hub's limit gets the limit. The echo
+// carries the TTL granted ("ttlMs"), so the sender knows how long the
+// server will hold the item.
+func (h *Hub) EnqueueTTL(appID, from, to string, payload json.RawMessage, ttl time.Duration, echo bool) error {
+	return h.enqueue(appID, from, to, payload, ttl, echo)
+}
+
+// itemTTL returns the TTL granted for a requested one (0: none).
+// h.mu must be held.
+func (h *Hub) itemTTL(req time.Duration) time.Duration {
+	if req <= 0 || (h.mailTTL > 0 && req > h.mailTTL) {
+		return max(h.mailTTL, 0)
+	}
+	return req
+}
+
+// StartJanitor drops expired mailbox items, and closes the drop boxes left
+// expired or empty, until ctx is done.
+func (h *Hub) StartJanitor(ctx context.Context) {
+	t := time.NewTicker(mailboxSweepEvery)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				h.ExpireMailbox(now)
+			}
+		}
+	}()
+}
+
+// ExpireMailbox drops the mailbox items that expired by now and returns how
+// many. Drop boxes left empty or expired are closed.
+func (h *Hub) ExpireMailbox(now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for appID, r := range h.rooms {
+		for side := range r.box {
+			n += h.expireMailLocked(appID, r, side, now)
+		}
+	}
+	h.closeDropBoxesLocked(now)
+	return n
+}
+
+// expireMailLocked drops side's expired items and returns how many.
+// h.mu must be held for writing.
+func (h *Hub) expireMailLocked(appID string, r *room, side string, now time.Time) int {
+	box := r.box[side][:0]
+	for _, it := range r.box[side] {
+		if !it.Expires.IsZero() && !now.Before(it.Expires) {
+			continue
+		}
+		box = append(box, it)
+	}
+	n := len(r.box[side]) - len(box)
+	if n > 0 {
+		clear(r.box[side][len(box):]) // release the payloads
+		r.box[side] = box
+		h.m.MailboxTTLExpired.Add(float64(n))
+		h.debugf(appID, "mailbox items expired", "to", side, "dropped", n)
+	}
+	return n
+}
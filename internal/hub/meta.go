@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultMetaBytes is the default size limit of a room's metadata object.
+const DefaultMetaBytes = 4096
+
+var (
+	// ErrMetaInvalid is returned by SetMeta for anything but a JSON object.
+	ErrMetaInvalid = errors.New("room metadata must be a JSON object")
+	// ErrMetaTooLarge is returned by SetMeta for objects over the size limit.
+	ErrMetaTooLarge = errors.New("room metadata too large")
+)
+
+// SetMetaLimit sets the maximum size of a room's metadata in bytes
+// (compacted JSON; <= 0 disables metadata). Call before serving.
+func (h *Hub) SetMetaLimit(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.metaMax = n
+}
+
+// SetMeta replaces the metadata object of appID, shared by both peers and
+// kept until the room closes.
+func (h *Hub) SetMeta(appID string, meta json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, meta); err != nil || buf.Len() == 0 || buf.Bytes()[0] != '{' {
+		return ErrMetaInvalid
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if buf.Len() > h.metaMax {
+		return fmt.Errorf("%w: %d > %d bytes", ErrMetaTooLarge, buf.Len(), h.metaMax)
+	}
+	r := h.rooms[appID]
+	if r == nil {
+		return ErrRoomNotFound
+	}
+	r.meta = buf.Bytes()
+	return nil
+}
+
+// Meta returns the metadata object of appID, if any was set.
+func (h *Hub) Meta(appID string) (json.RawMessage, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if r := h.rooms[appID]; r != nil && r.meta != nil {
+		return r.meta, true
+	}
+	return nil, false
+}
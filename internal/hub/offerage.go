@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"strings"
+	"time"
+)
+
+// SetOfferMaxAge makes mailboxed offer and answer items (payloads whose
+// "type" is offer or answer) expire d after they were enqueued: a stale item
+// is dropped instead of replayed, and its sender gets an offer_expired frame
+// so it can create a fresh one. d <= 0 disables expiry. Call before serving.
+func (h *Hub) SetOfferMaxAge(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.offerMaxAge = d
+}
+
+// expiredOffer is a dropped item, reported to its sender.
+type expiredOffer struct {
+	from, to, kind string
+	seq            uint64
+	age            time.Duration
+}
+
+// expireOffersLocked drops side's stale offer/answer items and returns them.
+// h.mu must be held for writing.
+func (h *Hub) expireOffersLocked(appID string, r *room, side string, now time.Time) []expiredOffer {
+	if h.offerMaxAge <= 0 {
+		return nil
+	}
+	var out []expiredOffer
+	box := r.box[side][:0]
+	for _, it := range r.box[side] {
+		kind := strings.ToLower(peekType(it.Payload))
+		if age := now.Sub(it.At); (kind == "offer" || kind == "answer") && age > h.offerMaxAge {
+			out = append(out, expiredOffer{from: it.From, to: side, kind: kind, seq: it.Seq, age: age})
+			h.m.MailboxExpired.WithLabelValues(kind).Inc()
+			h.debugf(appID, "mailbox offer expired", "to", side, "seq", it.Seq, "kind", kind, "age", age)
+			continue
+		}
+		box = append(box, it)
+	}
+	r.box[side] = box
+	return out
+}
+
+// notifyExpired tells each expired item's sender, if connected.
+func (h *Hub) notifyExpired(appID string, expired []expiredOffer) {
+	for _, e := range expired {
+		_ = h.Send(appID, e.from, map[string]any{"type": "offer_expired", "kind": e.kind, "to": e.to, "seq": e.seq, "ageMs": e.age.Milliseconds()})
+	}
+}
@@ -0,0 +1,46 @@
+package hub
+
+import "sort"
+
+// NotifyPaired sends room_full to the connections of the paired room appID
+// that haven't had it yet, so a peer whose partner flaps doesn't get it (and
+// restart its offer logic) on every reconnect; the rejoining side gets it on
+// its new connection. The frame carries the room state, which makes a
+// duplicate harmless:
+//
+//	{"type":"room_full","sides":["A","B"],"established":false,"epoch":1}
+//
+// epoch counts the pairings of the room (2 after the first rejoin) and
+// established is set once the peers reported a working connection, also
+// before a reconnect within the resume grace. extra is merged in (pin,
+// meta). It returns the number of connections notified.
+func (h *Hub) NotifyPaired(appID string, extra map[string]any) int {
+	h.mu.Lock()
+	r := h.rooms[appID]
+	if r == nil || len(r.conns) < 2 {
+		h.mu.Unlock()
+		return 0
+	}
+	var to []*connWrap
+	sides := make([]string, 0, len(r.conns))
+	for s, c := range r.conns {
+		sides = append(sides, s)
+		if !c.notified {
+			c.notified = true
+			to = append(to, c)
+		}
+	}
+	sort.Strings(sides)
+	ev := make(map[string]any, len(extra)+4)
+	for k, v := range extra {
+		ev[k] = v
+	}
+	ev["type"], ev["sides"], ev["established"], ev["epoch"] = "room_full", sides, !r.estd.IsZero(), r.pairings
+	h.debugf(appID, "hub room_full", "epoch", r.pairings, "notified", len(to))
+	h.mu.Unlock()
+
+	for _, c := range to {
+		_ = c.WriteJSON(ev)
+	}
+	return len(to)
+}
@@ -0,0 +1,50 @@
+package hub
+
+import "sort"
+
+// SetPaused records that side asked its peer to stop sending (paused) or to
+// carry on. While side is paused, mailbox items for it are queued but not
+// delivered right away; resuming replays what is still pending, as Hello
+// does. Relay frames are not held back: the peer is expected to honour the
+// relayed pause itself. A side's pause ends when it disconnects.
+func (h *Hub) SetPaused(appID, side string, paused bool) error {
+	h.mu.Lock()
+	r := h.rooms[appID]
+	if r == nil {
+		h.mu.Unlock()
+		return ErrRoomNotFound
+	}
+	if r.paused[side] == paused {
+		h.mu.Unlock()
+		return nil
+	}
+	if paused {
+		if r.paused == nil {
+			r.paused = make(map[string]bool)
+		}
+		r.paused[side] = true
+		h.debugf(appID, "delivery paused", "side", side)
+		h.mu.Unlock()
+		return nil
+	}
+	delete(r.paused, side)
+	h.debugf(appID, "delivery resumed", "side", side, "pending", len(r.box[side]))
+	c := r.conns[side]
+	h.mu.Unlock()
+
+	if c != nil {
+		h.deliverMail(appID, side, c, true)
+	}
+	return nil
+}
+
+// pausedLocked lists the sides of r that have paused delivery, sorted.
+// h.mu must be held.
+func pausedLocked(r *room) []string {
+	var out []string
+	for s := range r.paused {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,60 @@
+package hub
+
+import "time"
+
+// DefaultResumeGrace is how long an emptied room's established state is kept.
+const DefaultResumeGrace = 30 * time.Second
+
+// resumeState is what survives a room emptying out within the grace period.
+type resumeState struct {
+	estd  time.Time
+	fail  bool
+	until time.Time
+}
+
+// SetResumeGrace keeps the established/failed flags of a room for d after its
+// last peer leaves, so peers that reconnect in time resume the same session:
+// MarkEstablished and MarkFailed don't report a first time again. d <= 0
+// forgets rooms as soon as they close. Call before serving.
+func (h *Hub) SetResumeGrace(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resumeGrace = d
+}
+
+// rememberLocked records r's session flags as it closes. h.mu must be held
+// for writing.
+func (h *Hub) rememberLocked(appID string, r *room) {
+	if h.resumeGrace <= 0 || (r.estd.IsZero() && !r.fail) {
+		return
+	}
+	now := time.Now()
+	if h.resume == nil {
+		h.resume = make(map[string]resumeState)
+	}
+	// sweep at most once per grace period; entries are tiny
+	if now.Sub(h.resumeSwept) >= h.resumeGrace {
+		for id, s := range h.resume {
+			if now.After(s.until) {
+				delete(h.resume, id)
+			}
+		}
+		h.resumeSwept = now
+	}
+	h.resume[appID] = resumeState{estd: r.estd, fail: r.fail, until: now.Add(h.resumeGrace)}
+}
+
+// resumeLocked restores the flags of a room reopened within the grace
+// period. h.mu must be held for writing.
+func (h *Hub) resumeLocked(appID string, r *room) {
+	s, ok := h.resume[appID]
+	if !ok {
+		return
+	}
+	delete(h.resume, appID)
+	if time.Now().After(s.until) {
+		return
+	}
+	r.estd, r.fail = s.estd, s.fail
+	h.debugf(appID, "hub session resumed", "established", !s.estd.IsZero())
+}
@@ -0,0 +1,99 @@
+package hub
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseSessionExpired is the close code for rooms that outlived the maximum
+// session duration (private-use range).
+const CloseSessionExpired = 4008
+
+// SetMaxSession bounds how long a room may stay open. Peers get a
+// session_expiring frame warn before the deadline, then a CloseSessionExpired
+// close. max <= 0 disables the limit. Call before serving.
+func (h *Hub) SetMaxSession(max, warn time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxSession, h.sessionWarn = max, warn
+}
+
+// ExemptSession exempts appID from the maximum session duration.
+func (h *Hub) ExemptSession(appID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r := h.rooms[appID]; r != nil {
+		r.exempt = true
+	}
+}
+
+// StartSessionLimits enforces SetMaxSession once a second until ctx is done.
+func (h *Hub) StartSessionLimits(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				h.ExpireSessions(now)
+			}
+		}
+	}()
+}
+
+// ExpireSessions warns and closes rooms past the limit as of now.
+func (h *Hub) ExpireSessions(now time.Time) {
+	type action struct {
+		conns []*connWrap
+		left  time.Duration
+		close bool
+	}
+	var todo []action
+	h.mu.Lock()
+	if h.maxSession <= 0 {
+		h.mu.Unlock()
+		return
+	}
+	for appID, r := range h.rooms {
+		if r.exempt || len(r.conns) == 0 {
+			continue
+		}
+		left := h.maxSession - now.Sub(r.start)
+		var a action
+		switch {
+		case left <= 0 && !r.expired:
+			r.expired = true
+			a = action{left: 0, close: true}
+			h.debugf(appID, "hub session expired")
+		case left <= h.sessionWarn && !r.warned:
+			r.warned = true
+			a = action{left: left}
+		default:
+			continue
+		}
+		for _, c := range r.conns {
+			a.conns = append(a.conns, c)
+		}
+		todo = append(todo, a)
+	}
+	h.mu.Unlock()
+
+	// writes happen outside h.mu, like every other hub write
+	for _, a := range todo {
+		if a.close {
+			h.m.SessionsExpired.Inc()
+			for _, c := range a.conns {
+				_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(CloseSessionExpired, "max session duration reached"), time.Now().Add(time.Second))
+			}
+			continue
+		}
+		msg := map[string]any{"type": "session_expiring", "in": int(a.left.Round(time.Second).Seconds()), "closeAt": now.Add(a.left).UTC()}
+		for _, c := range a.conns {
+			_ = c.WriteJSON(msg)
+		}
+	}
+}
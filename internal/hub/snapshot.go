@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"encoding/json"
+	"maps"
+	"time"
+)
+
+// Snapshot is the room state worth carrying over a restart: queued mailbox
+// items (e.g. key-exchange payloads) and the settings they depend on.
+// Connections, pauses, labels and other per-connection state are not kept;
+// peers reconnect and Hello as after any disconnect.
+type Snapshot struct {
+	At    time.Time      `json:"at"`
+	Rooms []RoomSnapshot `json:"rooms"`
+}
+
+// RoomSnapshot is one room of a Snapshot.
+type RoomSnapshot struct {
+	AppID       string                `json:"appID"`
+	Seq         map[string]uint64     `json:"seq"`
+	Deliv       map[string]uint64     `json:"deliv"`
+	Box         map[string][]mailItem `json:"box,omitempty"`
+	Pin         *Pin                  `json:"pin,omitempty"`
+	Meta        json.RawMessage       `json:"meta,omitempty"`
+	OneWay      string                `json:"oneWay,omitempty"`
+	Established time.Time             `json:"established,omitzero"`
+	DropUntil   time.Time             `json:"dropUntil,omitzero"`
+	Envelope    bool                  `json:"envelope,omitempty"`
+}
+
+// Snapshot returns the rooms with queued mailbox items or a pinned key.
+// Take it before closing the sessions: a room is gone once its last peer
+// has left.
+func (h *Hub) Snapshot() Snapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := Snapshot{At: time.Now().UTC()}
+	for appID, r := range h.rooms {
+		box := make(map[string][]mailItem)
+		for side, items := range r.box {
+			if len(items) > 0 {
+				box[side] = append([]mailItem(nil), items...)
+			}
+		}
+		if len(box) == 0 && r.pin == nil {
+			continue
+		}
+		rs := RoomSnapshot{AppID: appID, Seq: maps.Clone(r.seq), Deliv: maps.Clone(r.deliv), Box: box, Meta: r.meta, OneWay: r.oneWay, Established: r.estd, DropUntil: r.dropUntil, Envelope: r.envelope}
+		if r.pin != nil {
+			p := *r.pin
+			rs.Pin = &p
+		}
+		s.Rooms = append(s.Rooms, rs)
+	}
+	return s
+}
+
+// Restore loads s, taken by a previous process, and returns how many rooms
+// it kept. Nothing older than ttl is restored: not a snapshot taken more
+// than ttl ago, nor mailbox items queued more than ttl ago. The rooms are
+// not reopened; each is applied when a peer first opens it again within ttl
+// of the snapshot, and forgotten after that. Call before serving.
+func (h *Hub) Restore(s Snapshot, ttl time.Duration) int {
+	now := time.Now()
+	until := s.At.Add(ttl)
+	if ttl <= 0 || !now.Before(until) {
+		return 0
+	}
+	cutoff := now.Add(-ttl)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.restored = make(map[string]RoomSnapshot, len(s.Rooms))
+	h.restoredUntil = until
+	for _, rs := range s.Rooms {
+		for side, items := range rs.Box {
+			i := 0
+			for i < len(items) && items[i].At.Before(cutoff) {
+				i++
+			}
+			rs.Box[side] = items[i:]
+		}
+		h.restored[rs.AppID] = rs
+	}
+	return len(h.restored)
+}
+
+// restoreLocked applies appID's restored state to the room r just opened.
+// h.mu must be held for writing.
+func (h *Hub) restoreLocked(appID string, r *room) {
+	if h.restored == nil {
+		return
+	}
+	if !time.Now().Before(h.restoredUntil) {
+		h.restored = nil
+		return
+	}
+	rs, ok := h.restored[appID]
+	if !ok {
+		return
+	}
+	delete(h.restored, appID)
+	maps.Copy(r.seq, rs.Seq)
+	maps.Copy(r.deliv, rs.Deliv)
+	maps.Copy(r.box, rs.Box)
+	r.pin, r.meta, r.oneWay, r.dropUntil, r.envelope = rs.Pin, rs.Meta, rs.OneWay, rs.DropUntil, rs.Envelope
+	if r.estd.IsZero() {
+		r.estd = rs.Established
+	}
+	h.debugf(appID, "hub room restored", "pendingA", len(r.box["A"]), "pendingB", len(r.box["B"]))
+}
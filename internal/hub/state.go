@@ -0,0 +1,132 @@
+package hub
+
+import (
+	"maps"
+	"time"
+)
+
+// State is a room's lifecycle state.
+type State string
+
+const (
+	StateCreated     State = "created"     // exists (e.g. mode set, or a drop box) but nobody is connected
+	StateHalfJoined  State = "half_joined" // one side connected
+	StatePaired      State = "paired"      // both sides connected
+	StateEstablished State = "established" // peers reported a working connection
+	StateClosing     State = "closing"     // last peer left; room is being torn down
+	StateClosed      State = "closed"      // removed from the hub
+)
+
+// transitions lists the allowed next states. A peer leaving a paired or
+// established room drops it back to half_joined; it can pair again. A drop
+// box its last peer left goes back to created.
+var transitions = map[State][]State{
+	StateCreated:     {StateHalfJoined, StateClosing},
+	StateHalfJoined:  {StatePaired, StateCreated, StateClosing},
+	StatePaired:      {StateEstablished, StateHalfJoined, StateClosing},
+	StateEstablished: {StateHalfJoined, StateClosing},
+	StateClosing:     {StateClosed},
+}
+
+// RoomStatus is a room's current state and when it was entered.
+type RoomStatus struct {
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+	Peers int       `json:"peers"`
+	// Origins maps side to its origin fingerprint (see ws.WithSelfPair).
+	Origins map[string]string `json:"origins,omitempty"`
+	// Left maps side to why it last left (see SetLeft).
+	Left map[string]string `json:"left,omitempty"`
+	// Paused lists the sides that paused delivery to themselves (see SetPaused).
+	Paused []string `json:"paused,omitempty"`
+	// Labels maps side to its connection labels (see SetLabels).
+	Labels map[string]map[string]string `json:"labels,omitempty"`
+	// DuplicateJoins counts attempts to join an occupied side (see DuplicateJoin).
+	DuplicateJoins int `json:"duplicateJoins,omitempty"`
+	// DropBoxUntil is how long a drop box outlives its peers (see SetDropBox).
+	DropBoxUntil time.Time `json:"dropBoxUntil,omitzero"`
+	// Envelope is set once relayed frames are wrapped (see SetEnvelope).
+	Envelope bool `json:"envelope,omitempty"`
+}
+
+// OnTransition registers fn to be called on every room state change. fn runs
+// under the hub lock; it must not call back into the hub. Call before serving.
+func (h *Hub) OnTransition(fn func(appID string, from, to State)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onTransition = append(h.onTransition, fn)
+}
+
+// transitionLocked moves r to state to if that is a valid transition and
+// reports whether it did. Invalid transitions are counted and ignored.
+// h.mu must be held for writing.
+func (h *Hub) transitionLocked(appID string, r *room, to State) bool {
+	from := r.state
+	if from == to {
+		return true
+	}
+	ok := false
+	for _, s := range transitions[from] {
+		if s == to {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		h.m.RoomTransitions.WithLabelValues(string(from), string(to), "invalid").Inc()
+		h.debugf(appID, "hub invalid transition", "from", from, "to", to)
+		return false
+	}
+	r.state, r.stateAt = to, time.Now()
+	h.trackUnpairedLocked(appID, r, from, to)
+	h.m.RoomTransitions.WithLabelValues(string(from), string(to), "ok").Inc()
+	h.debugf(appID, "hub transition", "from", from, "to", to)
+	h.watch.publish(appID, WatchEvent{Kind: WatchState, State: to, From: from})
+	for _, fn := range h.onTransition {
+		fn(appID, from, to)
+	}
+	return true
+}
+
+// RoomState returns appID's lifecycle status; ok is false for unknown (or
+// already closed) rooms.
+func (h *Hub) RoomState(appID string) (RoomStatus, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := h.rooms[appID]
+	if r == nil {
+		return RoomStatus{}, false
+	}
+	st := RoomStatus{State: r.state, Since: r.stateAt.UTC(), Peers: len(r.conns), DuplicateJoins: r.dupJoins, DropBoxUntil: r.dropUntil.UTC(), Envelope: r.envelope}
+	if len(r.origins) > 0 {
+		st.Origins = make(map[string]string, len(r.origins))
+		for s, o := range r.origins {
+			st.Origins[s] = o
+		}
+	}
+	if len(r.left) > 0 {
+		st.Left = make(map[string]string, len(r.left))
+		for s, why := range r.left {
+			st.Left[s] = why
+		}
+	}
+	st.Paused = pausedLocked(r)
+	if len(r.labels) > 0 {
+		st.Labels = make(map[string]map[string]string, len(r.labels))
+		for s, pl := range r.labels {
+			st.Labels[s] = maps.Clone(pl.set)
+		}
+	}
+	return st, true
+}
+
+// StateCounts returns the number of rooms in each state.
+func (h *Hub) StateCounts() map[State]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make(map[State]int)
+	for _, r := range h.rooms {
+		out[r.state]++
+	}
+	return out
+}
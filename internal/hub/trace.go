@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// DefaultTraceFrames is the per-connection frame trace length.
+const DefaultTraceFrames = 32
+
+// FrameMeta is one traced frame: metadata only, never the payload.
+type FrameMeta struct {
+	Dir  string    `json:"dir"` // "in" or "out"
+	Type string    `json:"type"`
+	Size int       `json:"size"`
+	At   time.Time `json:"at"`
+}
+
+// frameRing keeps the last len(buf) frames of a connection. It has its own
+// lock so tracing never waits behind a slow write.
+type frameRing struct {
+	mu   sync.Mutex
+	buf  []FrameMeta
+	next int
+	full bool
+}
+
+func newFrameRing(n int) *frameRing {
+	if n <= 0 {
+		return nil
+	}
+	return &frameRing{buf: make([]FrameMeta, n)}
+}
+
+func (r *frameRing) add(dir, typ string, size int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = FrameMeta{Dir: dir, Type: typ, Size: size, At: time.Now().UTC()}
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// frames returns the trace oldest first.
+func (r *frameRing) frames() []FrameMeta {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]FrameMeta(nil), r.buf[:r.next]...)
+	}
+	return append(append([]FrameMeta(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// SetTraceFrames sets how many frames are traced per connection (0 disables).
+// It applies to connections registered afterwards.
+func (h *Hub) SetTraceFrames(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.traceN = n
+}
+
+// TraceIn records an inbound frame of side in appID.
+func (h *Hub) TraceIn(appID, side, typ string, size int) {
+	if cw := h.conn(appID, side); cw != nil {
+		cw.trace.add("in", typ, size)
+	}
+	h.watch.publish(appID, WatchEvent{Kind: WatchFrame, Side: side, Dir: "in", Type: typ, Size: size})
+}
+
+// Frames returns side's recent frames in appID, oldest first; ok is false if
+// the side isn't connected.
+func (h *Hub) Frames(appID, side string) (frames []FrameMeta, ok bool) {
+	cw := h.conn(appID, side)
+	if cw == nil {
+		return nil, false
+	}
+	return cw.trace.frames(), true
+}
+
+// peekType extracts the "type" string of a JSON frame without decoding it
+// all (relayed frames can be large). Returns "" if not found.
+func peekType(b []byte) string {
+	i := bytes.Index(b, []byte(`"type"`))
+	if i < 0 {
+		return ""
+	}
+	b = bytes.TrimLeft(b[i+len(`"type"`):], " \t\r\n")
+	if len(b) == 0 || b[0] != ':' {
+		return ""
+	}
+	b = bytes.TrimLeft(b[1:], " \t\r\n")
+	if len(b) == 0 || b[0] != '"' {
+		return ""
+	}
+	b = b[1:]
+	end := bytes.IndexByte(b, '"')
+	if end < 0 || end > 32 {
+		return ""
+	}
+	return string(b[:end])
+}
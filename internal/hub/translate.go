@@ -0,0 +1,31 @@
+package hub
+
+import "github.com/gorilla/websocket"
+
+// Translate makes every later text frame the hub writes to side in appID
+// pass through fn first, e.g. to downgrade it for a client that speaks an
+// older protocol; nil removes the translation. Call it right after Register.
+// It reports false if side isn't connected.
+func (h *Hub) Translate(appID, side string, fn func([]byte) []byte) bool {
+	cw := h.conn(appID, side)
+	if cw == nil {
+		return false
+	}
+	if fn == nil {
+		cw.out.Store(nil)
+	} else {
+		cw.out.Store(&fn)
+	}
+	return true
+}
+
+// translate applies w's outbound translation, if any, to a frame of type mt.
+func (w *connWrap) translate(mt int, p []byte) []byte {
+	if mt != websocket.TextMessage {
+		return p
+	}
+	if fn := w.out.Load(); fn != nil {
+		return (*fn)(p)
+	}
+	return p
+}
@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ClosePairingTimeout is the close code for a waiting peer evicted to make
+// room for newer unpaired rooms (private-use range).
+const ClosePairingTimeout = 4009
+
+// SetMaxUnpaired caps the number of single-sided rooms on this instance. When
+// a new room would exceed it, the oldest unpaired room (by creation time) is
+// evicted: its peer gets a pairing_timeout frame and a ClosePairingTimeout
+// close. n <= 0 means no cap. Call before serving.
+func (h *Hub) SetMaxUnpaired(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxUnpaired = n
+}
+
+// trackUnpairedLocked keeps h.unpaired (rooms in StateHalfJoined, oldest
+// first) in step with a transition. h.mu must be held for writing.
+func (h *Hub) trackUnpairedLocked(appID string, r *room, from, to State) {
+	if from == StateHalfJoined && r.unpaired != nil {
+		h.unpaired.Remove(r.unpaired)
+		r.unpaired = nil
+	}
+	if to != StateHalfJoined {
+		return
+	}
+	if h.unpaired == nil {
+		h.unpaired = list.New()
+	}
+	// new rooms go last; a room whose partner left is placed by its age
+	e := h.unpaired.Back()
+	for e != nil && h.rooms[e.Value.(string)] != nil && h.rooms[e.Value.(string)].start.After(r.start) {
+		e = e.Prev()
+	}
+	if e == nil {
+		r.unpaired = h.unpaired.PushFront(appID)
+	} else {
+		r.unpaired = h.unpaired.InsertAfter(appID, e)
+	}
+}
+
+// evictUnpairedLocked makes room for one more unpaired room and returns the
+// connections to notify once h.mu is released. h.mu must be held for writing.
+func (h *Hub) evictUnpairedLocked() []*connWrap {
+	if h.maxUnpaired <= 0 || h.unpaired == nil {
+		return nil
+	}
+	var out []*connWrap
+	for h.unpaired.Len() >= h.maxUnpaired {
+		e := h.unpaired.Front()
+		appID := e.Value.(string)
+		h.unpaired.Remove(e)
+		r := h.rooms[appID]
+		if r == nil {
+			continue
+		}
+		r.unpaired = nil
+		// the room stays until its peer's read loop unregisters; it can't be
+		// joined meanwhile
+		r.evicted = true
+		for _, c := range r.conns {
+			out = append(out, c)
+		}
+		h.m.UnpairedEvicted.Inc()
+		h.debugf(appID, "hub unpaired room evicted")
+	}
+	return out
+}
+
+// notifyEvicted tells evicted peers why they are being closed.
+func notifyEvicted(conns []*connWrap) {
+	for _, c := range conns {
+		_ = c.WriteJSON(map[string]any{"type": "pairing_timeout"})
+		_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(ClosePairingTimeout, "pairing timeout"), time.Now().Add(time.Second))
+	}
+}
@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchBuffer is how many events a watcher may fall behind before events are
+// dropped for it.
+const watchBuffer = 256
+
+// Watch event kinds.
+const (
+	WatchJoin  = "join"
+	WatchLeave = "leave"
+	WatchFrame = "frame"
+	WatchState = "state"
+)
+
+// WatchEvent is one thing that happened in a room, as seen by the hub:
+// metadata only, never a payload.
+type WatchEvent struct {
+	At   time.Time `json:"at"`
+	Kind string    `json:"kind"` // WatchJoin, WatchLeave, WatchFrame or WatchState
+	Side string    `json:"side,omitempty"`
+	// frames: "in" (from Side) or "out" (to Side), the frame type and size
+	Dir  string `json:"dir,omitempty"`
+	Type string `json:"type,omitempty"`
+	Size int    `json:"size,omitempty"`
+	// leave: why Side left (see SetLeft); state: the new and previous state
+	Reason string `json:"reason,omitempty"`
+	State  State  `json:"state,omitempty"`
+	From   State  `json:"from,omitempty"`
+}
+
+// watchers fans room events out to Watch subscribers. It has its own lock,
+// taken after h.mu where both are held, so frame writes outside h.mu can
+// publish without waiting for the hub.
+type watchers struct {
+	n    atomic.Int32 // subscribers, for a lock-free fast path
+	mu   sync.Mutex
+	subs map[string]map[chan WatchEvent]*atomic.Uint64 // by appID; value counts drops
+}
+
+// Watch subscribes to appID's events (the room need not exist yet) until
+// stop is called. Events are delivered best-effort: a subscriber that falls
+// behind by more than watchBuffer events misses some, and dropped reports how
+// many. It is meant for development tools, not for protocol decisions.
+func (h *Hub) Watch(appID string) (events <-chan WatchEvent, dropped func() uint64, stop func()) {
+	w := &h.watch
+	ch := make(chan WatchEvent, watchBuffer)
+	var lost atomic.Uint64
+	w.mu.Lock()
+	if w.subs == nil {
+		w.subs = make(map[string]map[chan WatchEvent]*atomic.Uint64)
+	}
+	if w.subs[appID] == nil {
+		w.subs[appID] = make(map[chan WatchEvent]*atomic.Uint64)
+	}
+	w.subs[appID][ch] = &lost
+	w.n.Add(1)
+	w.mu.Unlock()
+
+	var once sync.Once
+	return ch, lost.Load, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.subs[appID], ch)
+			if len(w.subs[appID]) == 0 {
+				delete(w.subs, appID)
+			}
+			w.n.Add(-1)
+			w.mu.Unlock()
+		})
+	}
+}
+
+// publish hands ev to appID's watchers without blocking.
+func (w *watchers) publish(appID string, ev WatchEvent) {
+	if w.n.Load() == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.subs[appID]) == 0 {
+		return
+	}
+	ev.At = time.Now().UTC()
+	for ch, lost := range w.subs[appID] {
+		select {
+		case ch <- ev:
+		default:
+			lost.Add(1)
+		}
+	}
+}
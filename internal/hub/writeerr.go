@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+)
+
+// Write failure causes, the cause label of nt_ws_write_errors_total.
+const (
+	WriteTimeout    = "timeout"     // write deadline hit: the peer stopped reading
+	WriteBrokenPipe = "broken_pipe" // peer reset or closed the TCP connection
+	WritePolicy     = "policy"      // refused locally: a close frame was already sent
+	WriteClosed     = "closed"      // our side of the connection is already closed
+	WriteOther      = "other"
+)
+
+// WriteCause classifies a websocket write error.
+func WriteCause(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return WriteTimeout
+	case errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED):
+		return WriteBrokenPipe
+	case errors.Is(err, websocket.ErrCloseSent):
+		return WritePolicy
+	case errors.Is(err, net.ErrClosed):
+		return WriteClosed
+	}
+	return WriteOther
+}
+
+// writeFailed counts and logs a failed write to side of appID. Hub writes are
+// best-effort (the read loop notices dead peers), so this is the only trace
+// a lost frame leaves.
+func (h *Hub) writeFailed(appID, side string, err error) {
+	cause := WriteCause(err)
+	h.m.WSWriteErrors.WithLabelValues(cause).Inc()
+	if h.lg != nil {
+		h.lg.Debug("ws write failed", "appID", appID, "side", side, "cause", cause, "err", err)
+	}
+}
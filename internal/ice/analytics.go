@@ -0,0 +1,127 @@
+package ice
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Windows are the summary windows reported by Analytics.Summary.
+var Windows = []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// retention is the number of one-minute buckets kept (the largest window).
+const retention = 24 * 60
+
+// candidateTypes are the RTCIceCandidateType values a client may report.
+var candidateTypes = map[string]bool{"host": true, "srflx": true, "prflx": true, "relay": true}
+
+// Analytics aggregates the candidate pair types of selected ICE pairs, as
+// reported by clients through telemetry, into per-minute buckets. It answers
+// "how many sessions need TURN" without an external analytics stack.
+type Analytics struct {
+	mu      sync.Mutex
+	buckets [retention]pairBucket
+	m       *metrics.Metrics
+}
+
+type pairBucket struct {
+	minute int64          // unix minute this bucket holds; stale buckets are reused
+	pairs  map[string]int // "local/remote" -> count
+}
+
+// WindowSummary is the relay vs direct split over one window.
+type WindowSummary struct {
+	Window    string         `json:"window"`
+	Total     int            `json:"total"`
+	Direct    int            `json:"direct"`
+	Relay     int            `json:"relay"`
+	DirectPct float64        `json:"directPct"`
+	RelayPct  float64        `json:"relayPct"`
+	Pairs     map[string]int `json:"pairs"` // "local/remote" candidate types -> count
+}
+
+func NewAnalytics() *Analytics { return &Analytics{m: metrics.Default} }
+
+// WithMetrics reports to m instead of metrics.Default.
+func (a *Analytics) WithMetrics(m *metrics.Metrics) *Analytics {
+	a.m = m
+	return a
+}
+
+// Record counts one selected pair. local and remote are candidate types
+// (host, srflx, prflx, relay); it reports false and counts nothing if either
+// is unknown. A nil Analytics records nothing.
+func (a *Analytics) Record(local, remote string) bool {
+	return a.record(time.Now(), local, remote)
+}
+
+func (a *Analytics) record(at time.Time, local, remote string) bool {
+	if a == nil || !candidateTypes[local] || !candidateTypes[remote] {
+		return false
+	}
+	a.m.ICEPairs.WithLabelValues(pathOf(local, remote)).Inc()
+	minute := at.Unix() / 60
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := &a.buckets[minute%retention]
+	if b.minute != minute || b.pairs == nil {
+		b.minute, b.pairs = minute, make(map[string]int)
+	}
+	b.pairs[local+"/"+remote]++
+	return true
+}
+
+// Summary returns one WindowSummary per entry of Windows, ending at now.
+func (a *Analytics) Summary(now time.Time) []WindowSummary {
+	out := make([]WindowSummary, len(Windows))
+	for i, w := range Windows {
+		out[i] = WindowSummary{Window: w.String(), Pairs: map[string]int{}}
+	}
+	cur := now.Unix() / 60
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, b := range a.buckets {
+		age := cur - b.minute
+		if b.pairs == nil || age < 0 || age >= retention {
+			continue
+		}
+		for i, w := range Windows {
+			if age >= int64(w/time.Minute) {
+				continue
+			}
+			s := &out[i]
+			for pair, n := range b.pairs {
+				s.Pairs[pair] += n
+				s.Total += n
+				local, remote, _ := strings.Cut(pair, "/")
+				if pathOf(local, remote) == "relay" {
+					s.Relay += n
+				} else {
+					s.Direct += n
+				}
+			}
+		}
+	}
+	for i := range out {
+		if t := out[i].Total; t > 0 {
+			out[i].DirectPct = pct(out[i].Direct, t)
+			out[i].RelayPct = pct(out[i].Relay, t)
+		}
+	}
+	return out
+}
+
+// pathOf is "relay" if either end goes through TURN, else "direct".
+func pathOf(local, remote string) string {
+	if local == "relay" || remote == "relay" {
+		return "relay"
+	}
+	return "direct"
+}
+
+func pct(n, total int) float64 {
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
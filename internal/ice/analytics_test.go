@@ -0,0 +1,34 @@
+package ice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyticsWindows(t *testing.T) {
+	a := NewAnalytics()
+	now := time.Now()
+	a.record(now, "host", "srflx")
+	a.record(now.Add(-time.Minute), "srflx", "relay")
+	a.record(now.Add(-30*time.Minute), "relay", "host")
+	a.record(now.Add(-2*time.Hour), "srflx", "srflx")
+	a.record(now.Add(-25*time.Hour), "relay", "relay") // beyond retention
+	if a.record(now, "bogus", "host") {
+		t.Fatal("unknown candidate type accepted")
+	}
+
+	got := a.Summary(now)
+	want := []struct{ total, direct, relay int }{{2, 1, 1}, {3, 1, 2}, {4, 2, 2}}
+	for i, w := range want {
+		s := got[i]
+		if s.Total != w.total || s.Direct != w.direct || s.Relay != w.relay {
+			t.Fatalf("%s: got %+v, want %+v", s.Window, s, w)
+		}
+	}
+	if got[0].RelayPct != 50 || got[1].RelayPct != 66.7 {
+		t.Fatalf("pct: %v %v", got[0].RelayPct, got[1].RelayPct)
+	}
+	if got[2].Pairs["srflx/relay"] != 1 {
+		t.Fatalf("pairs: %v", got[2].Pairs)
+	}
+}
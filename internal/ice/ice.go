@@ -0,0 +1,41 @@
+package ice
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Server is one RTCIceServer entry as understood by browsers.
+type Server struct {
+	URLs []string `json:"urls"`
+}
+
+// Handler serves GET /ice-servers -> {"iceServers":[{"urls":[...]}]}.
+// static lists configured URLs; if stunPort > 0 the embedded STUN listener is
+// advertised as stun:<request host>:<stunPort>.
+func Handler(static []string, stunPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var servers []Server
+		if stunPort > 0 {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			servers = append(servers, Server{URLs: []string{"stun:" + net.JoinHostPort(host, strconv.Itoa(stunPort))}})
+		}
+		if len(static) > 0 {
+			servers = append(servers, Server{URLs: static})
+		}
+		if servers == nil {
+			servers = []Server{}
+		}
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"iceServers": servers})
+	})
+}
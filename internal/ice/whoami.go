@@ -0,0 +1,62 @@
+package ice
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Reflexive is a client's address as this server observes it.
+type Reflexive struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port,omitempty"` // omitted when a proxy hides it
+	Family   string `json:"family"`         // "ipv4" or "ipv6"
+	Protocol string `json:"protocol"`       // "tcp" (the HTTP connection)
+	// UDPEcho is the UDP echo port (see stun.Echo) as host:port, if enabled.
+	UDPEcho string `json:"udpEcho,omitempty"`
+}
+
+// WhoAmI serves GET /whoami -> Reflexive. clientIP resolves the client behind
+// trusted proxies (see middleware.TrustedProxies.ClientIP); the port is only
+// reported when the client connected directly. If echoPort > 0 the UDP echo
+// listener is advertised as <request host>:<echoPort>.
+func WhoAmI(clientIP func(*http.Request) string, echoPort int, m *metrics.Metrics) http.Handler {
+	if m == nil {
+		m = metrics.Default
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ip, err := netip.ParseAddr(clientIP(r))
+		if err != nil {
+			m.WhoamiRequests.WithLabelValues("http", "unknown").Inc()
+			http.Error(w, "client address unknown", http.StatusInternalServerError)
+			return
+		}
+		ip = ip.Unmap()
+		out := Reflexive{IP: ip.String(), Family: "ipv6", Protocol: "tcp"}
+		if ip.Is4() {
+			out.Family = "ipv4"
+		}
+		if peer, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && peer.Addr().Unmap() == ip {
+			out.Port = int(peer.Port())
+		}
+		if echoPort > 0 {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			out.UDPEcho = net.JoinHostPort(host, strconv.Itoa(echoPort))
+		}
+		m.WhoamiRequests.WithLabelValues("http", "ok").Inc()
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("cache-control", "no-store")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+}
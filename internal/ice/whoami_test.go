@@ -0,0 +1,49 @@
+package ice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+)
+
+func TestWhoAmI(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := WhoAmI(proxies.ClientIP, 3479, metrics.New())
+	for _, tc := range []struct {
+		name, remote, xff string
+		want              Reflexive
+	}{
+		{"direct v4", "203.0.113.7:51000", "", Reflexive{IP: "203.0.113.7", Port: 51000, Family: "ipv4", Protocol: "tcp", UDPEcho: "example.com:3479"}},
+		{"direct v6", "[2001:db8::1]:443", "", Reflexive{IP: "2001:db8::1", Port: 443, Family: "ipv6", Protocol: "tcp", UDPEcho: "example.com:3479"}},
+		{"mapped v4", "[::ffff:198.51.100.2]:8080", "", Reflexive{IP: "198.51.100.2", Port: 8080, Family: "ipv4", Protocol: "tcp", UDPEcho: "example.com:3479"}},
+		{"via proxy", "10.1.2.3:40000", "198.51.100.9", Reflexive{IP: "198.51.100.9", Family: "ipv4", Protocol: "tcp", UDPEcho: "example.com:3479"}},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com:8080/whoami", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var got Reflexive
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", tc.name, w.Code, w.Body)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/whoami", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: %d", w.Code)
+	}
+}
@@ -0,0 +1,142 @@
+// Package idgen mints and validates room ids (appIDs). The format is
+// configurable: random UUIDs (the default), time-ordered UUIDv7s, or ULIDs,
+// which are time-ordered too and shorter in URLs and logs.
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Format is an appID format.
+type Format string
+
+const (
+	UUIDv4 Format = "uuidv4" // random UUID, e.g. 3f2b8c1e-...
+	UUIDv7 Format = "uuidv7" // time-ordered UUID
+	ULID   Format = "ulid"   // 26 Crockford base32 characters, time-ordered
+)
+
+// ParseFormat parses "uuidv4", "uuidv7" or "ulid" (case-insensitive).
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case UUIDv4, UUIDv7, ULID:
+		return f, nil
+	}
+	return "", fmt.Errorf("id format must be uuidv4, uuidv7 or ulid, got %q", s)
+}
+
+// New mints an id. It panics if the system random source fails, like
+// uuid.New.
+func (f Format) New() string {
+	switch f {
+	case UUIDv7:
+		return uuid.Must(uuid.NewV7()).String()
+	case ULID:
+		return newULID(time.Now())
+	}
+	return uuid.NewString()
+}
+
+// Valid reports whether id is a well-formed id of format f. Both UUID
+// formats accept any UUID in canonical form, so rooms created before a
+// switch between them keep working; ULIDs must be upper case.
+func (f Format) Valid(id string) bool {
+	if f == ULID {
+		return validULID(id)
+	}
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// Set is the configured list of formats: the first mints new ids, all of
+// them are accepted.
+type Set []Format
+
+// Default mints and accepts UUIDs only.
+var Default = Set{UUIDv4}
+
+// ParseSet parses a comma-separated list of formats; empty means Default.
+func ParseSet(list string) (Set, error) {
+	var out Set
+	for _, p := range strings.Split(list, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		f, err := ParseFormat(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	if len(out) == 0 {
+		return Default, nil
+	}
+	return out, nil
+}
+
+// New mints an id in the set's first format.
+func (s Set) New() string {
+	if len(s) == 0 {
+		return Default.New()
+	}
+	return s[0].New()
+}
+
+// Valid reports whether id matches any format of the set (an empty set is
+// Default).
+func (s Set) Valid(id string) bool {
+	if len(s) == 0 {
+		s = Default
+	}
+	for _, f := range s {
+		if f.Valid(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// crockford is the ULID alphabet (no I, L, O, U).
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID encodes a 48-bit millisecond timestamp and 80 random bits.
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+	// 128 bits as 26 base32 digits, the first carrying only 3 bits
+	var out [26]byte
+	hi := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	lo := uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 |
+		uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+func validULID(id string) bool {
+	if len(id) != 26 || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if strings.IndexByte(crockford, id[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
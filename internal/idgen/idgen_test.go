@@ -0,0 +1,58 @@
+package idgen_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+)
+
+func TestFormats(t *testing.T) {
+	for _, f := range []idgen.Format{idgen.UUIDv4, idgen.UUIDv7, idgen.ULID} {
+		id := f.New()
+		if !f.Valid(id) {
+			t.Fatalf("%s: minted invalid id %q", f, id)
+		}
+		if f == idgen.ULID && len(id) != 26 {
+			t.Fatalf("ulid length %d", len(id))
+		}
+	}
+	if idgen.ULID.Valid("01ARZ3NDEKTSV4RRFFQ69G5FA") || idgen.ULID.Valid("81ARZ3NDEKTSV4RRFFQ69G5FAV") ||
+		idgen.ULID.Valid("01arz3ndektsv4rrffq69g5fav") || !idgen.ULID.Valid("01ARZ3NDEKTSV4RRFFQ69G5FAV") {
+		t.Fatal("ulid validation")
+	}
+	if idgen.UUIDv4.Valid("01ARZ3NDEKTSV4RRFFQ69G5FAV") {
+		t.Fatal("uuid format accepted a ulid")
+	}
+}
+
+func TestULIDSortsByTime(t *testing.T) {
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, idgen.ULID.New())
+		time.Sleep(2 * time.Millisecond)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("not time-ordered: %v", ids)
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, err := idgen.ParseSet("ulid, uuidv4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := s.New(); !idgen.ULID.Valid(id) {
+		t.Fatalf("first format should mint: %q", id)
+	}
+	if !s.Valid(idgen.UUIDv4.New()) || !s.Valid(idgen.ULID.New()) || s.Valid("nope") {
+		t.Fatal("set validation")
+	}
+	if d, _ := idgen.ParseSet(""); len(d) != 1 || d[0] != idgen.UUIDv4 {
+		t.Fatalf("empty set = %v", d)
+	}
+	if _, err := idgen.ParseSet("ulid,snowflake"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
@@ -0,0 +1,38 @@
+// Package k8s holds optional Kubernetes integration: downward-API instance
+// metadata and Lease-based leader election, talking to the API server directly
+// with the pod's service account (no client-go dependency).
+package k8s
+
+import (
+	"os"
+	"strings"
+)
+
+// Instance describes where this replica runs (populated via the downward API).
+type Instance struct {
+	Pod       string
+	Namespace string
+	Zone      string
+}
+
+// InstanceFromEnv reads POD_NAME, POD_NAMESPACE and POD_ZONE. Missing values
+// fall back to the hostname / the service account's namespace, else
+// "default" / "".
+func InstanceFromEnv() Instance {
+	in := Instance{
+		Pod:       os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Zone:      os.Getenv("POD_ZONE"),
+	}
+	if in.Pod == "" {
+		in.Pod, _ = os.Hostname()
+	}
+	if in.Namespace == "" {
+		b, _ := os.ReadFile(saDir + "/namespace")
+		in.Namespace = strings.TrimSpace(string(b))
+	}
+	if in.Namespace == "" {
+		in.Namespace = "default"
+	}
+	return in
+}
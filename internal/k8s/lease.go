@@ -0,0 +1,187 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const saDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Elector runs Lease-based leader election against the coordination.k8s.io API.
+type Elector struct {
+	base      string // https://host:port/apis/coordination.k8s.io/v1/namespaces/<ns>/leases
+	name      string
+	identity  string
+	duration  time.Duration
+	client    *http.Client
+	token     string
+	tokenFile string // re-read on every request; set by TokenFile
+
+	leader   atomic.Bool
+	OnChange func(leader bool) // optional, called from the Run goroutine
+}
+
+// NewInClusterElector builds an elector using the pod's service account.
+func NewInClusterElector(in Instance, leaseName string, duration time.Duration) (*Elector, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster (KUBERNETES_SERVICE_HOST unset)")
+	}
+	if _, err := os.Stat(saDir + "/token"); err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(saDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+	}
+	base := fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", net.JoinHostPort(host, port), in.Namespace)
+	return NewElector(base, "", client, leaseName, in.Pod, duration).TokenFile(saDir + "/token"), nil
+}
+
+// NewElector is the transport-agnostic constructor (used by tests).
+func NewElector(baseURL, token string, client *http.Client, leaseName, identity string, duration time.Duration) *Elector {
+	return &Elector{base: baseURL, token: token, client: client, name: leaseName, identity: identity, duration: duration}
+}
+
+// TokenFile makes the elector read its bearer token from path on every
+// request instead of using a fixed one: the kubelet rotates projected
+// service-account tokens, and a token read once stops working.
+func (e *Elector) TokenFile(path string) *Elector {
+	e.tokenFile = path
+	return e
+}
+
+// IsLeader reports whether this replica currently holds the lease.
+func (e *Elector) IsLeader() bool { return e.leader.Load() }
+
+// Run tries to acquire/renew the lease every duration/3 until ctx is done.
+func (e *Elector) Run(ctx context.Context) {
+	t := time.NewTicker(e.duration / 3)
+	defer t.Stop()
+	for {
+		ok, err := e.tryAcquire(ctx)
+		if err != nil {
+			ok = false // can't prove we still hold it
+		}
+		if was := e.leader.Swap(ok); was != ok && e.OnChange != nil {
+			e.OnChange(ok)
+		}
+		select {
+		case <-ctx.Done():
+			e.leader.Store(false)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+type lease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   map[string]any `json:"metadata"`
+	Spec       leaseSpec      `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+func (e *Elector) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	cur, status, err := e.do(ctx, http.MethodGet, e.base+"/"+e.name, nil)
+	if err != nil {
+		return false, err
+	}
+	spec := leaseSpec{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: int(e.duration / time.Second),
+		AcquireTime:          now.Format(microTime),
+		RenewTime:            now.Format(microTime),
+	}
+	if status == http.StatusNotFound {
+		l := lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease", Metadata: map[string]any{"name": e.name}, Spec: spec}
+		_, status, err = e.do(ctx, http.MethodPost, e.base, l)
+		return err == nil && status == http.StatusCreated, err
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("get lease: status %d", status)
+	}
+	held := cur.Spec.HolderIdentity
+	if held != "" && held != e.identity {
+		renew, _ := time.Parse(microTime, cur.Spec.RenewTime)
+		d := time.Duration(cur.Spec.LeaseDurationSeconds) * time.Second
+		if now.Before(renew.Add(d)) {
+			return false, nil // someone else holds a live lease
+		}
+	}
+	if held == e.identity && cur.Spec.AcquireTime != "" {
+		spec.AcquireTime = cur.Spec.AcquireTime
+	}
+	// optimistic concurrency: resourceVersion in metadata makes a lost race fail with 409
+	cur.Spec = spec
+	_, status, err = e.do(ctx, http.MethodPut, e.base+"/"+e.name, cur)
+	return err == nil && status == http.StatusOK, err
+}
+
+func (e *Elector) do(ctx context.Context, method, url string, body any) (lease, int, error) {
+	var rd *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return lease{}, 0, err
+		}
+		rd = bytes.NewReader(b)
+	} else {
+		rd = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, rd)
+	if err != nil {
+		return lease{}, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token := e.token
+	if e.tokenFile != "" {
+		b, err := os.ReadFile(e.tokenFile)
+		if err != nil {
+			return lease{}, 0, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return lease{}, 0, err
+	}
+	defer res.Body.Close()
+	var l lease
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(res.Body).Decode(&l); err != nil {
+			return lease{}, res.StatusCode, err
+		}
+	}
+	return l, res.StatusCode, nil
+}
@@ -0,0 +1,123 @@
+package k8s_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/k8s"
+)
+
+// fakeLeases is a tiny stand-in for the coordination API with resourceVersion checks.
+type fakeLeases struct {
+	mu  sync.Mutex
+	obj map[string]any
+	rv  int
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.obj == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.obj)
+	case http.MethodPost, http.MethodPut:
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		md, _ := in["metadata"].(map[string]any)
+		if r.Method == http.MethodPost && f.obj != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPut && md["resourceVersion"] != strconv.Itoa(f.rv) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.rv++
+		md["resourceVersion"] = strconv.Itoa(f.rv)
+		f.obj = in
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		_ = json.NewEncoder(w).Encode(f.obj)
+	}
+}
+
+func TestSingleLeader(t *testing.T) {
+	srv := httptest.NewServer(&fakeLeases{})
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := k8s.NewElector(srv.URL, "", srv.Client(), "janitor", "pod-a", 3*time.Second)
+	b := k8s.NewElector(srv.URL, "", srv.Client(), "janitor", "pod-b", 3*time.Second)
+	go a.Run(ctx)
+	go b.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !a.IsLeader() && !b.IsLeader() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if a.IsLeader() == b.IsLeader() {
+		t.Fatalf("expected exactly one leader: a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+}
+
+func TestTokenFileRotation(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	fake := &fakeLeases{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		mu.Unlock()
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := k8s.NewElector(srv.URL, "", srv.Client(), "janitor", "pod-a", 3*time.Second).TokenFile(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	waitAuth := func(want string) {
+		t.Helper()
+		for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			mu.Lock()
+			last := ""
+			if len(seen) > 0 {
+				last = seen[len(seen)-1]
+			}
+			mu.Unlock()
+			if last == want {
+				return
+			}
+		}
+		t.Fatalf("never sent %q", want)
+	}
+	waitAuth("Bearer first")
+	// the kubelet rotates the projected token: renewals pick up the new one
+	if err := os.WriteFile(path, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitAuth("Bearer second")
+	if !e.IsLeader() {
+		t.Fatal("lost the lease across a token rotation")
+	}
+}
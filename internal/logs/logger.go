@@ -1,7 +1,10 @@
 package logs
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,13 +14,94 @@ import (
 
 type Logger = *zap.Logger
 
+// Options configure Build. The zero value is production JSON at info level
+// on stderr, like New.
+type Options struct {
+	Level  string // debug, info (default), warn or error
+	Format string // json (default) or console
+	// Output is "stderr" (default), "stdout" or a file path. Files are rotated
+	// at MaxSizeMB (0 = never), keeping MaxBackups old files (path.1 newest).
+	Output     string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// New is Build with default Options and zap's production sampling, tagged
+// with sys=system.
 func New(system string) Logger {
-	cfg := zap.NewProductionConfig()
-	cfg.Encoding = "json"
-	cfg.EncoderConfig.TimeKey = "ts"
-	cfg.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339Nano)
-	l, _ := cfg.Build(zap.Fields(zap.String("sys", system)))
-	return l
+	l, _ := Build(Options{})
+	return Sampled(l, 100, 100).With(zap.String("sys", system))
+}
+
+// Build returns an untagged logger; derive per-system loggers from it with
+// With(zap.String("sys", ...)) so they share one output (and one rotating file).
+func Build(o Options) (Logger, error) {
+	lvl := zapcore.InfoLevel
+	if o.Level != "" {
+		var err error
+		if lvl, err = zapcore.ParseLevel(o.Level); err != nil {
+			return nil, err
+		}
+	}
+	ec := zap.NewProductionEncoderConfig()
+	ec.TimeKey = "ts"
+	ec.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339Nano)
+	var enc zapcore.Encoder
+	switch o.Format {
+	case "", "json":
+		enc = zapcore.NewJSONEncoder(ec)
+	case "console":
+		ec.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(ec)
+	default:
+		return nil, fmt.Errorf("log format must be json or console, got %q", o.Format)
+	}
+	var out zapcore.WriteSyncer
+	switch o.Output {
+	case "", "stderr":
+		out = zapcore.Lock(os.Stderr)
+	case "stdout":
+		out = zapcore.Lock(os.Stdout)
+	default:
+		f, err := openRotating(o.Output, int64(o.MaxSizeMB)<<20, o.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	core := zapcore.NewCore(enc, out, lvl)
+	return zap.New(core, zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))), nil
+}
+
+// ParseSample parses "initial/thereafter" (e.g. "100/100"); "" or "0"
+// disables sampling.
+func ParseSample(s string) (initial, thereafter int, err error) {
+	if s == "" || s == "0" {
+		return 0, 0, nil
+	}
+	a, b, ok := strings.Cut(s, "/")
+	if ok {
+		initial, err = strconv.Atoi(a)
+		if err == nil {
+			thereafter, err = strconv.Atoi(b)
+		}
+	}
+	if !ok || err != nil || initial < 0 || thereafter < 0 {
+		return 0, 0, fmt.Errorf("sampling must be initial/thereafter, got %q", s)
+	}
+	return initial, thereafter, nil
+}
+
+// Sampled returns l keeping, per message and second, the first initial
+// entries and every thereafter-th one after that. For high-volume streams
+// (per-frame WS logs); initial <= 0 returns l unchanged.
+func Sampled(l Logger, initial, thereafter int) Logger {
+	if initial <= 0 {
+		return l
+	}
+	return l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewSamplerWithOptions(c, time.Second, initial, thereafter)
+	}))
 }
 
 func Middleware(l Logger) func(http.Handler) http.Handler {
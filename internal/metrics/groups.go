@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric groups that privacy-sensitive deployments may switch off (see Disable).
+const (
+	// GroupSignal: inbound frames, signaling messages and bytes by frame type, and frame sizes.
+	GroupSignal = "signal"
+	// GroupRTT: WebSocket round-trip times from ping/pong.
+	GroupRTT = "rtt"
+	// GroupGeo: WS connections by client country.
+	GroupGeo = "geo"
+)
+
+// Groups lists the metric groups Disable accepts.
+var Groups = []string{GroupSignal, GroupRTT, GroupGeo}
+
+// ErrUnknownGroup is returned by Disable for a name not in Groups.
+var ErrUnknownGroup = errors.New("unknown metric group")
+
+// Disable switches off the given metric groups. Their exported collectors
+// stay registered, so dashboards see empty (or zero) series rather than
+// missing ones, but are never written to again: the fields are swapped for
+// unregistered stand-ins that callers record into as before.
+// nt_metrics_group_enabled{group} is set to 0 for each disabled group.
+// Call it once at startup, after ConfigureBuckets.
+func (m *Metrics) Disable(groups ...string) error {
+	for _, g := range groups {
+		switch g {
+		case GroupSignal:
+			m.WSMessages = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "nt_ws_messages_total"}, []string{"type"})
+			m.SignalMsg = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "nt_signal_messages_total"}, []string{"type"})
+			m.SignalBytes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "nt_signal_bytes_total"}, []string{"dir", "type"})
+			m.WSFrameSize = newFrameSize(DefaultBuckets.FrameSize)
+		case GroupRTT:
+			m.WSRTTSeconds = newRTT(DefaultBuckets.RTT)
+		case GroupGeo:
+			m.WSCountry = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "nt_ws_connections_by_country_total"}, []string{"country"})
+		default:
+			return fmt.Errorf("%w %q (want one of %v)", ErrUnknownGroup, g, Groups)
+		}
+		m.GroupEnabled.WithLabelValues(g).Set(0)
+	}
+	return nil
+}
+
+// Disable disables groups on Default; see Metrics.Disable.
+func Disable(groups ...string) error { return Default.Disable(groups...) }
@@ -2,71 +2,524 @@ package metrics
 
 import (
 	"net/http"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	reg = prometheus.NewRegistry()
+// Metrics is a set of collectors on its own registry. cmd/server uses
+// Default; embedders that run several hubs or stores in one process (tests,
+// multi-tenant binaries) give each a New() to keep their series apart and
+// avoid duplicate registration.
+type Metrics struct {
+	reg *prometheus.Registry
 
-	WSConnections = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "nt_ws_connections_total", Help: "Total WS connections",
-	})
-	WSMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "nt_ws_messages_total", Help: "Total WS messages",
-	}, []string{"type"})
-	RoomsActive = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "nt_rooms_active", Help: "Active rooms",
-	})
-	PeersActive = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "nt_peers_active", Help: "Active peers",
-	})
-	totalPeers int64
+	mu         sync.Mutex             // guards hubFuncs and mailboxAge
+	hubFuncs   []prometheus.Collector // registered by ObserveHub
+	mailboxAge prometheus.Collector   // registered by ObserveMailboxAge
+
+	WSConnections         prometheus.Counter
+	WSMessages            *prometheus.CounterVec
+	SessionsExpired       prometheus.Counter
+	PushNotifications     *prometheus.CounterVec
+	RendezvousIdempotency *prometheus.CounterVec
+	ChaosDropped          prometheus.Counter
+	UnpairedEvicted       prometheus.Counter
+	WSInsecure            prometheus.Counter
+	WSShutdownClosed      prometheus.Counter
+	WSLegacyConns         *prometheus.CounterVec
+	WSUpgradeFailed       *prometheus.CounterVec
+	WSLegacyFrames        *prometheus.CounterVec
+	WSLabeledConns        *prometheus.GaugeVec
+	WSDuplicateJoins      *prometheus.CounterVec
+	TenantMessages        *prometheus.CounterVec
+	TenantBytes           *prometheus.CounterVec
+	WSSelfPair            *prometheus.CounterVec
+	RoomTransitions       *prometheus.CounterVec
+	WSRedirects           *prometheus.CounterVec
+	RateLimitFallback     prometheus.Counter
+	RateLimitDecisions    *prometheus.CounterVec
+	RateLimitKeys         *prometheus.GaugeVec
+	RateLimitMemory       *prometheus.GaugeVec
+	RateLimitPruned       *prometheus.CounterVec
+	IPDenied              prometheus.Counter
+	RoomsActive           prometheus.Gauge
+	PeersActive           prometheus.Gauge
+	WSFrameSize           *prometheus.HistogramVec
+	WSRTTSeconds          prometheus.Histogram
+	RelayLatency          prometheus.Histogram
+	SignalMsg             *prometheus.CounterVec
+	SignalBytes           *prometheus.CounterVec
+	SessionEstablished    *prometheus.CounterVec
+	SessionFailed         *prometheus.CounterVec
+	SessionTTF            prometheus.Histogram
+	TelemetryDropped      *prometheus.CounterVec
+	TransferThroughput    *prometheus.HistogramVec
+	TransferBytes         *prometheus.HistogramVec
+	ICEPairs              *prometheus.CounterVec
+	STUNRequests          *prometheus.CounterVec
+	WhoamiRequests        *prometheus.CounterVec
+	WSBackpressure        *prometheus.CounterVec
+	WSWriteErrors         *prometheus.CounterVec
+	PeersLeft             *prometheus.CounterVec
+	WSCountry             *prometheus.CounterVec
+	RoomFullRejects       *prometheus.CounterVec
+	MailboxLatency        *prometheus.HistogramVec
+	MailboxExpired        *prometheus.CounterVec
+	MailboxTTLExpired     prometheus.Counter
+	FeatureFlags          *prometheus.GaugeVec
+	FeatureFlagPolls      *prometheus.CounterVec
+	HTTPRequests          *prometheus.CounterVec
+	HTTPDuration          *prometheus.HistogramVec
+	FanoutRooms           prometheus.Gauge
+	FanoutViewers         prometheus.Gauge
+	FanoutRejected        *prometheus.CounterVec
+	BreakerState          *prometheus.GaugeVec
+	FrameAnomalies        *prometheus.CounterVec
+	BreakerTransitions    *prometheus.CounterVec
+	WebhookDeliveries     *prometheus.CounterVec
+	WebhookOutbox         *prometheus.GaugeVec
+	ParkedPeers           prometheus.Gauge
+	RendezvousActiveCodes *prometheus.GaugeVec
+	RendezvousUtilization prometheus.Gauge
+	RendezvousReclaimed   *prometheus.CounterVec
+	RendezvousExhausted   *prometheus.CounterVec
+	RendezvousRoomActive  prometheus.Counter
+	RendezvousChecks      *prometheus.CounterVec
+	PinConflicts          prometheus.Counter
+	WSAuth                *prometheus.CounterVec
+	WSAuthSeconds         prometheus.Histogram
+	// Per-owner quotas are summarized (owners are IPs/keys: unbounded as labels).
+	QuotaOwners         *prometheus.GaugeVec
+	QuotaRejected       *prometheus.CounterVec
+	WSClients           *prometheus.CounterVec
+	GlareResolved       prometheus.Counter
+	InstanceInfo        *prometheus.GaugeVec
+	JanitorLeader       prometheus.Gauge
+	RendezvousBatchSize prometheus.Histogram
+	GroupEnabled        *prometheus.GaugeVec
+}
+
+// Default is the process-wide set used by cmd/server and by every component
+// that isn't given its own.
+var Default = New()
 
-	WSFrameSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+// New returns a Metrics with all collectors registered on a fresh registry,
+// including the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		WSConnections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_ws_connections_total", Help: "Total WS connections",
+		}),
+		WSMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_messages_total", Help: "Inbound WS frames by type (or ignored|malformed_json|unknown_type)",
+		}, []string{"type"}),
+		RendezvousIdempotency: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_rendezvous_idempotency_total", Help: "Idempotency-Key handling on code creation (stored|replayed|mismatch|in_progress)",
+		}, []string{"result"}),
+		PushNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_push_notifications_total", Help: "Push notifications by kind (webpush|fcm) and result (sent|failed|gone|dropped)",
+		}, []string{"kind", "result"}),
+		WSInsecure: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_ws_insecure_rejected_total", Help: "WS upgrades rejected for not arriving over TLS (WS_REQUIRE_TLS)",
+		}),
+		WSShutdownClosed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_ws_shutdown_closed_total", Help: "WS sessions closed with 1001 because the server shut down",
+		}),
+		WSUpgradeFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_upgrade_failures_total", Help: "Failed WS upgrades by likely cause (method|connection|upgrade|proxy_stripped|version|key|not_hijackable|other)",
+		}, []string{"cause"}),
+		WSLegacyConns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_legacy_connections_total", Help: "WS connections speaking the legacy protocol, by how it was recognised (subprotocol|shape)",
+		}, []string{"via"}),
+		WSLegacyFrames: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_legacy_frames_total", Help: "Frames of legacy-protocol connections passed through the translation shim, by dir (in|out)",
+		}, []string{"dir"}),
+		WSLabeledConns: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_ws_connections_by_label", Help: "Connected pair-room peers by label key (WS_LABEL_METRICS) and value (capped; later values are other)",
+		}, []string{"key", "value"}),
+		WSDuplicateJoins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_duplicate_join_attempts_total", Help: "Attempts to join an occupied side, by whether the occupant was told (notified|throttled)",
+		}, []string{"action"}),
+		TenantMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_tenant_messages_total", Help: "Signaling frames per tenant (API key name, anonymous or unknown) and dir (in|out)",
+		}, []string{"tenant", "dir"}),
+		TenantBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_tenant_bytes_total", Help: "Signaling bytes per tenant (API key name, anonymous or unknown) and dir (in|out)",
+		}, []string{"tenant", "dir"}),
+		UnpairedEvicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_unpaired_evicted_total", Help: "Waiting single-sided rooms evicted to admit new ones (MAX_UNPAIRED_ROOMS)",
+		}),
+		ChaosDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_chaos_dropped_total", Help: "Relayed frames dropped by injected network conditions (CHAOS_DROP)",
+		}),
+		SessionsExpired: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_sessions_expired_total", Help: "Rooms closed for exceeding the maximum session duration",
+		}),
+		WSSelfPair: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_self_pair_total", Help: "Joins whose origin fingerprint matched the other side's (action=warned|denied)",
+		}, []string{"action"}),
+		RoomTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_room_transitions_total", Help: "Room lifecycle state transitions (result=ok|invalid)",
+		}, []string{"from", "to", "result"}),
+		WSRedirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_redirects_total", Help: "WS connections redirected to another region",
+		}, []string{"region"}),
+		RateLimitFallback: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_ratelimit_fallback_total", Help: "Shared rate-limit counter errors that switched limiters to local counting",
+		}),
+		IPDenied: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_ip_denied_total", Help: "Requests refused because the client is outside ALLOW_CIDRS",
+		}),
+		RateLimitDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ratelimit_decisions_total", Help: "Rate-limit checks by limiter and result (allowed|denied)",
+		}, []string{"limiter", "result"}),
+		RateLimitKeys: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_ratelimit_keys", Help: "Client keys counted locally per limiter, as of the last janitor run",
+		}, []string{"limiter"}),
+		RateLimitMemory: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_ratelimit_memory_bytes", Help: "Estimated size of a limiter's local buckets, as of the last janitor run",
+		}, []string{"limiter"}),
+		RateLimitPruned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ratelimit_pruned_total", Help: "Expired local buckets removed by the limiter janitor",
+		}, []string{"limiter"}),
+		RoomsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_rooms_active", Help: "Active rooms",
+		}),
+		PeersActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_peers_active", Help: "Active peers",
+		}),
+		WSFrameSize:  newFrameSize(DefaultBuckets.FrameSize),
+		WSRTTSeconds: newRTT(DefaultBuckets.RTT),
+		RelayLatency: newRelayLatency(DefaultBuckets.RelayLatency),
+		SignalMsg: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_signal_messages_total", Help: "Signaling messages by type",
+		}, []string{"type"}),
+		SignalBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_signal_bytes_total", Help: "Signaling payload bytes",
+		}, []string{"dir", "type"}),
+		SessionEstablished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_session_established_total", Help: "Sessions established (ICE connected)",
+		}, []string{"mode"}),
+		SessionFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_session_failed_total", Help: "Sessions failed",
+		}, []string{"reason"}),
+		SessionTTF: newTTF(DefaultBuckets.TTF),
+		TelemetryDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_telemetry_dropped_total", Help: "Telemetry events dropped (cap, replay, missing_seq, invalid)",
+		}, []string{"reason"}),
+		TransferThroughput: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nt_transfer_throughput_bytes_per_second",
+			Help:    "Client-reported data-channel throughput by mode (p2p|relay|other|unspecified)",
+			Buckets: prometheus.ExponentialBuckets(16<<10, 4, 10), // 16 KiB/s .. 4 GiB/s
+		}, []string{"mode"}),
+		TransferBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nt_transfer_bytes",
+			Help:    "Client-reported data-channel transfer sizes by mode",
+			Buckets: prometheus.ExponentialBuckets(64<<10, 4, 10), // 64 KiB .. 16 GiB
+		}, []string{"mode"}),
+		ICEPairs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ice_selected_pairs_total", Help: "Selected ICE candidate pairs reported via telemetry (path=direct|relay)",
+		}, []string{"path"}),
+		STUNRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_stun_binding_requests_total", Help: "Embedded STUN binding requests by result",
+		}, []string{"result"}),
+		WhoamiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_whoami_requests_total", Help: "Reflexive address lookups by protocol (http|udp) and result",
+		}, []string{"proto", "result"}),
+		WSWriteErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_write_errors_total", Help: "Failed hub writes to WS peers by cause (timeout|broken_pipe|policy|closed|other)",
+		}, []string{"cause"}),
+		PeersLeft: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_peers_left_total", Help: "Peers leaving a room by reason: a goodbye reason, or closed|dropped|shutdown without one",
+		}, []string{"reason"}),
+		WSCountry: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_connections_by_country_total", Help: "Accepted WS connections by client country (ISO code or unknown; needs GEOIP_DB)",
+		}, []string{"country"}),
+		MailboxLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nt_mailbox_delivery_latency_seconds", Help: "Time from enqueue to each write of a mailbox item to its recipient, by path (immediate|replay)",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 12),
+		}, []string{"path"}),
+		FrameAnomalies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_room_frame_anomalies_total", Help: "Rooms escalated for exceeding a frame limit, by scope (total|minute) and action (warned|throttled|closed)",
+		}, []string{"scope", "action"}),
+		BreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_breaker_state", Help: "Circuit breaker state per external dependency (0 closed, 1 half-open, 2 open)",
+		}, []string{"dep"}),
+		BreakerTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_breaker_transitions_total", Help: "Circuit breaker state changes per external dependency, by new state",
+		}, []string{"dep", "to"}),
+		FanoutRooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_fanout_rooms", Help: "Open fan-out (one host, many viewers) rooms",
+		}),
+		FanoutViewers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_fanout_viewers", Help: "Viewers connected to fan-out rooms",
+		}),
+		FanoutRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_fanout_rejected_total", Help: "Fan-out joins refused, by reason (host_busy|viewer_cap|room_type)",
+		}, []string{"reason"}),
+		MailboxExpired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_mailbox_offers_expired_total", Help: "Mailboxed offer/answer items dropped as stale instead of replayed, by kind",
+		}, []string{"kind"}),
+		MailboxTTLExpired: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_mailbox_expired_items_total", Help: "Mailbox items dropped undelivered because their TTL ran out",
+		}),
+		FeatureFlags: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_feature_flag", Help: "Protocol feature flags in force (1 on, 0 off), by flag",
+		}, []string{"flag"}),
+		FeatureFlagPolls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_feature_flag_polls_total", Help: "Polls of the feature flag config service, by result (ok|not_modified|error)",
+		}, []string{"result"}),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_http_requests_total", Help: "HTTP requests by route template, method and status class (1xx..5xx; unmatched routes share route=unmatched)",
+		}, []string{"route", "method", "code"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nt_http_request_duration_seconds", Help: "HTTP request handling time by route template and method (WebSocket sessions excluded)",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		RoomFullRejects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_room_full_rejects_total", Help: "WS joins refused because the side was taken, by room state",
+		}, []string{"state"}),
+		WSBackpressure: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_backpressure_total", Help: "Rate limit actions: per-connection warn, drop, close; per-room room",
+		}, []string{"action"}),
+		WebhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_webhook_deliveries_total", Help: "Webhook deliveries by result (ok, failed, dropped, retried, dead)",
+		}, []string{"result"}),
+		WebhookOutbox: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_webhook_outbox", Help: "Webhook outbox entries by state (pending, dead)",
+		}, []string{"state"}),
+		ParkedPeers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_parked_peers", Help: "Solo peers currently parked waiting for their partner",
+		}),
+		RendezvousActiveCodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_rendezvous_active_codes", Help: "Codes currently held (including not-yet-swept expired ones)",
+		}, []string{"format"}),
+		RendezvousUtilization: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_rendezvous_keyspace_utilization_percent", Help: "Share of the numeric code keyspace in use",
+		}),
+		RendezvousReclaimed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_rendezvous_reclaimed_total", Help: "Expired codes reclaimed, by path (janitor, inline, redeem)",
+		}, []string{"via"}),
+		RendezvousExhausted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_rendezvous_exhausted_total", Help: "Code creations that failed because the keyspace was exhausted",
+		}, []string{"format"}),
+		RendezvousRoomActive: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_rendezvous_redeem_room_active_total", Help: "Redeems of a used/expired code whose room was still open (409 already_joined)",
+		}),
+		RendezvousChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_rendezvous_checks_total", Help: "Code checks (GET /rendezvous/check) by result (valid|gone|limited)",
+		}, []string{"result"}),
+		PinConflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_pin_conflicts_total", Help: "Rejected fingerprint pins (invalid or conflicting)",
+		}),
+		WSAuth: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_auth_total", Help: "WS authentication attempts by method (query|frame|ticket) and result (ok|failed|timeout|expired|used)",
+		}, []string{"method", "result"}),
+		WSAuthSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "nt_ws_auth_seconds", Help: "Time from upgrade to a verified first-frame auth",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}),
+		QuotaOwners: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_quota_owners", Help: "Owners holding resources (state=active) and owners at their cap (state=at_limit)",
+		}, []string{"resource", "state"}),
+		QuotaRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_quota_rejected_total", Help: "Requests rejected by a per-owner quota",
+		}, []string{"resource"}),
+		WSClients: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nt_ws_clients_total", Help: "WS clients by reported name, major.minor version and result (label pairs capped; excess is client=other)",
+		}, []string{"client", "version", "result"}),
+		GlareResolved: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nt_glare_resolved_total", Help: "Colliding offers dropped by server-side glare arbitration",
+		}),
+		InstanceInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_instance_info", Help: "Instance metadata (always 1)",
+		}, []string{"pod", "zone"}),
+		JanitorLeader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nt_janitor_leader", Help: "1 if this replica currently runs the janitor",
+		}),
+		RendezvousBatchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nt_rendezvous_batch_size",
+			Help:    "Number of codes minted per batch request",
+			Buckets: []float64{1, 5, 10, 25, 50, 100},
+		}),
+		GroupEnabled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nt_metrics_group_enabled", Help: "1 if the metric group is collected, 0 if switched off by METRICS_DISABLE",
+		}, []string{"group"}),
+	}
+	for _, g := range Groups {
+		m.GroupEnabled.WithLabelValues(g).Set(1)
+	}
+	m.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.WSConnections, m.WSMessages, m.RoomsActive, m.PeersActive,
+		m.WSFrameSize, m.WSRTTSeconds, m.RelayLatency,
+		m.SignalMsg, m.SignalBytes,
+		m.SessionEstablished, m.SessionFailed, m.SessionTTF, m.TelemetryDropped, m.ICEPairs,
+		m.TransferThroughput, m.TransferBytes,
+		m.RendezvousBatchSize, m.STUNRequests, m.WhoamiRequests,
+		m.InstanceInfo, m.JanitorLeader, m.WSBackpressure, m.WSWriteErrors, m.PeersLeft, m.WSCountry, m.RoomFullRejects, m.MailboxLatency,
+		m.MailboxExpired, m.MailboxTTLExpired, m.FeatureFlags, m.FeatureFlagPolls, m.HTTPRequests, m.HTTPDuration, m.FanoutRooms, m.FanoutViewers, m.FanoutRejected,
+		m.BreakerState, m.BreakerTransitions, m.FrameAnomalies,
+		m.WebhookDeliveries, m.WebhookOutbox, m.ParkedPeers,
+		m.RendezvousActiveCodes, m.RendezvousUtilization, m.RendezvousReclaimed, m.RendezvousExhausted, m.RendezvousRoomActive, m.RendezvousChecks,
+		m.PinConflicts,
+		m.GlareResolved,
+		m.QuotaOwners, m.QuotaRejected,
+		m.WSClients,
+		m.WSAuth,
+		m.RateLimitFallback, m.RateLimitDecisions, m.RateLimitKeys, m.RateLimitMemory, m.RateLimitPruned,
+		m.IPDenied,
+		m.WSRedirects,
+		m.RoomTransitions,
+		m.WSSelfPair,
+		m.SessionsExpired,
+		m.PushNotifications,
+		m.RendezvousIdempotency,
+		m.ChaosDropped,
+		m.UnpairedEvicted,
+		m.TenantMessages, m.TenantBytes,
+		m.WSInsecure, m.WSShutdownClosed,
+		m.WSLegacyConns, m.WSLegacyFrames, m.WSUpgradeFailed,
+		m.WSLabeledConns, m.WSDuplicateJoins,
+		m.WSAuthSeconds,
+		m.GroupEnabled,
+	)
+	return m
+}
+
+// Registry exposes m's registry, e.g. to add application collectors.
+func (m *Metrics) Registry() *prometheus.Registry { return m.reg }
+
+// Buckets holds the histogram bucket boundaries that may be overridden via config.
+// A nil slice keeps the default for that histogram.
+type Buckets struct {
+	TTF          []float64
+	RTT          []float64
+	RelayLatency []float64
+	FrameSize    []float64
+}
+
+// DefaultBuckets are the boundaries used when nothing is configured.
+var DefaultBuckets = Buckets{
+	TTF:          prometheus.ExponentialBuckets(0.05, 1.6, 12),
+	RTT:          prometheus.ExponentialBuckets(0.001, 2, 12),
+	RelayLatency: prometheus.ExponentialBuckets(0.0001, 2, 14),
+	FrameSize:    []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576},
+}
+
+func newFrameSize(b []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "nt_ws_frame_bytes",
 		Help:    "WebSocket frame sizes",
-		Buckets: []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576},
+		Buckets: b,
 	}, []string{"dir"})
+}
 
-	WSRTTSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+func newRTT(b []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "nt_ws_rtt_seconds",
 		Help:    "WebSocket RTT (derived from ping/pong timestamps)",
-		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		Buckets: b,
 	})
+}
+
+func newRelayLatency(b []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "nt_relay_latency_seconds",
+		Help:    "Time spent relaying a signaling frame to the peer",
+		Buckets: b,
+	})
+}
 
-	SignalMsg = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "nt_signal_messages_total", Help: "Signaling messages by type",
-	}, []string{"type"})
-	SignalBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "nt_signal_bytes_total", Help: "Signaling payload bytes",
-	}, []string{"dir", "type"})
-
-	SessionEstablished = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "nt_session_established_total", Help: "Sessions established (ICE connected)",
-	}, []string{"mode"})
-	SessionFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "nt_session_failed_total", Help: "Sessions failed",
-	}, []string{"reason"})
-	SessionTTF = prometheus.NewHistogram(prometheus.HistogramOpts{
+func newTTF(b []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "nt_session_time_to_first_flow_seconds",
 		Help:    "Time to first media/data flow from join to established",
-		Buckets: prometheus.ExponentialBuckets(0.05, 1.6, 12),
+		Buckets: b,
 	})
-)
+}
 
-func init() {
-	reg.MustRegister(
-		WSConnections, WSMessages, RoomsActive, PeersActive,
-		WSFrameSize, WSRTTSeconds,
-		SignalMsg, SignalBytes,
-		SessionEstablished, SessionFailed, SessionTTF,
-	)
+// ConfigureBuckets replaces the configurable histograms with ones using the given
+// boundaries. Call it once at startup, before any observation is made.
+// Boundaries are expected to be validated already (see config.Validate).
+func (m *Metrics) ConfigureBuckets(b Buckets) {
+	if b.TTF != nil {
+		m.reg.Unregister(m.SessionTTF)
+		m.SessionTTF = newTTF(b.TTF)
+		m.reg.MustRegister(m.SessionTTF)
+	}
+	if b.RTT != nil {
+		m.reg.Unregister(m.WSRTTSeconds)
+		m.WSRTTSeconds = newRTT(b.RTT)
+		m.reg.MustRegister(m.WSRTTSeconds)
+	}
+	if b.RelayLatency != nil {
+		m.reg.Unregister(m.RelayLatency)
+		m.RelayLatency = newRelayLatency(b.RelayLatency)
+		m.reg.MustRegister(m.RelayLatency)
+	}
+	if b.FrameSize != nil {
+		m.reg.Unregister(m.WSFrameSize)
+		m.WSFrameSize = newFrameSize(b.FrameSize)
+		m.reg.MustRegister(m.WSFrameSize)
+	}
 }
 
-func Handler() http.Handler { return promhttp.HandlerFor(reg, promhttp.HandlerOpts{}) }
+func (m *Metrics) Handler() http.Handler { return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{}) }
+
+// ObserveHub replaces the push-style room/peer gauges with ones read from
+// stats at scrape time, and adds nt_mailbox_items. Calling it again swaps
+// the stats source instead of registering duplicates.
+func (m *Metrics) ObserveHub(stats func() (rooms, conns, mailbox int)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reg.Unregister(m.RoomsActive)
+	m.reg.Unregister(m.PeersActive)
+	for _, c := range m.hubFuncs {
+		m.reg.Unregister(c)
+	}
+	pick := func(i int) func() float64 {
+		return func() float64 {
+			r, c, mb := stats()
+			return float64([]int{r, c, mb}[i])
+		}
+	}
+	m.hubFuncs = []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "nt_rooms_active", Help: "Active rooms"}, pick(0)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "nt_peers_active", Help: "Active peers"}, pick(1)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "nt_mailbox_items", Help: "Queued mailbox items across all rooms"}, pick(2)),
+	}
+	m.reg.MustRegister(m.hubFuncs...)
+}
+
+// ObserveMailboxAge adds nt_mailbox_oldest_undelivered_seconds, read from
+// oldest at scrape time. Calling it again swaps the source.
+func (m *Metrics) ObserveMailboxAge(oldest func() time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mailboxAge != nil {
+		m.reg.Unregister(m.mailboxAge)
+	}
+	m.mailboxAge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "nt_mailbox_oldest_undelivered_seconds", Help: "Age of the oldest queued mailbox item on this instance (0 if none)",
+	}, func() float64 { return oldest().Seconds() })
+	m.reg.MustRegister(m.mailboxAge)
+}
+
+// ConfigureBuckets configures Default; see Metrics.ConfigureBuckets.
+func ConfigureBuckets(b Buckets) { Default.ConfigureBuckets(b) }
+
+// Handler serves Default.
+func Handler() http.Handler { return Default.Handler() }
+
+// ObserveHub observes stats on Default; see Metrics.ObserveHub.
+func ObserveHub(stats func() (rooms, conns, mailbox int)) { Default.ObserveHub(stats) }
 
-func SetRooms(n int) { RoomsActive.Set(float64(n)) }
-func SetPeers(n int) { PeersActive.Set(float64(n)); atomic.StoreInt64(&totalPeers, int64(n)) }
+// ObserveMailboxAge observes oldest on Default; see Metrics.ObserveMailboxAge.
+func ObserveMailboxAge(oldest func() time.Duration) { Default.ObserveMailboxAge(oldest) }
@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestIsolatedRegistries(t *testing.T) {
+	a, b := metrics.New(), metrics.New()
+	ha, hb := hub.New(), hub.New()
+	ha.SetMetrics(a)
+	hb.SetMetrics(b)
+
+	// observing twice (and on two sets) must not panic on duplicate registration
+	a.ObserveHub(ha.Stats)
+	a.ObserveHub(ha.Stats)
+	b.ObserveHub(hb.Stats)
+
+	_ = ha.Register("app", "A", "", nil)
+	if n := testutil.ToFloat64(a.RoomTransitions.WithLabelValues("created", "half_joined", "ok")); n != 1 {
+		t.Fatalf("a transitions = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(b.RoomTransitions.WithLabelValues("created", "half_joined", "ok")); n != 0 {
+		t.Fatalf("b transitions = %v, want 0", n)
+	}
+	if n, err := testutil.GatherAndCount(a.Registry(), "nt_rooms_active"); err != nil || n != 1 {
+		t.Fatalf("nt_rooms_active series = %d, err %v", n, err)
+	}
+}
+
+func TestDisableGroups(t *testing.T) {
+	m := metrics.New()
+	if err := m.Disable(metrics.GroupRTT, metrics.GroupSignal); err != nil {
+		t.Fatal(err)
+	}
+	m.WSRTTSeconds.Observe(0.02)
+	m.SignalMsg.WithLabelValues("offer").Inc()
+	m.WSCountry.WithLabelValues("DE").Inc()
+
+	// the registered histogram is still there, just never observed
+	if n, err := testutil.GatherAndCount(m.Registry(), "nt_ws_rtt_seconds"); err != nil || n != 1 {
+		t.Fatalf("nt_ws_rtt_seconds series = %d, err %v", n, err)
+	}
+	if n, err := testutil.GatherAndCount(m.Registry(), "nt_signal_messages_total"); err != nil || n != 0 {
+		t.Fatalf("nt_signal_messages_total series = %d, err %v", n, err)
+	}
+	if n, err := testutil.GatherAndCount(m.Registry(), "nt_ws_connections_by_country_total"); err != nil || n != 1 {
+		t.Fatalf("geo is still enabled, got %d series (err %v)", n, err)
+	}
+	for g, want := range map[string]float64{metrics.GroupRTT: 0, metrics.GroupSignal: 0, metrics.GroupGeo: 1} {
+		if v := testutil.ToFloat64(m.GroupEnabled.WithLabelValues(g)); v != want {
+			t.Fatalf("nt_metrics_group_enabled{group=%q} = %v, want %v", g, v, want)
+		}
+	}
+	if err := m.Disable("payloads"); !errors.Is(err, metrics.ErrUnknownGroup) {
+		t.Fatalf("unknown group: %v", err)
+	}
+}
+
+func TestConfigureBuckets(t *testing.T) {
+	m := metrics.New()
+	m.ConfigureBuckets(metrics.Buckets{RTT: []float64{0.01, 0.1, 1}})
+	m.WSRTTSeconds.Observe(0.05)
+	m.SessionTTF.Observe(0.05)
+
+	bounds := func(name string) []float64 {
+		t.Helper()
+		mfs, err := m.Registry().Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() != name {
+				continue
+			}
+			var out []float64
+			for _, b := range mf.GetMetric()[0].GetHistogram().GetBucket() {
+				out = append(out, b.GetUpperBound())
+			}
+			return out
+		}
+		t.Fatalf("%s not registered", name)
+		return nil
+	}
+	if got := bounds("nt_ws_rtt_seconds"); !slices.Equal(got, []float64{0.01, 0.1, 1}) {
+		t.Fatalf("configured RTT buckets = %v", got)
+	}
+	if got := bounds("nt_session_time_to_first_flow_seconds"); !slices.Equal(got, metrics.DefaultBuckets.TTF) {
+		t.Fatalf("unconfigured TTF buckets = %v, want defaults", got)
+	}
+}
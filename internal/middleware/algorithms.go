@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Algorithm selects how a Limiter counts hits.
+type Algorithm string
+
+const (
+	// FixedWindow keeps one counter per key per minute: cheapest, but allows
+	// up to twice the limit across a window edge.
+	FixedWindow Algorithm = "fixed-window"
+	// SlidingLog keeps the timestamps of each key's hits in the last minute:
+	// exact, at up to perMin timestamps per key.
+	SlidingLog Algorithm = "sliding-log"
+	// TokenBucket refills perMin tokens per minute continuously and allows
+	// bursts of up to perMin.
+	TokenBucket Algorithm = "token-bucket"
+	// Distributed counts fixed windows in the shared Counter (see Shared),
+	// falling back to a local fixed window while it fails.
+	Distributed Algorithm = "distributed"
+)
+
+// ParseAlgorithm parses one of the Algorithm names.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch a := Algorithm(strings.TrimSpace(s)); a {
+	case FixedWindow, SlidingLog, TokenBucket, Distributed:
+		return a, nil
+	}
+	return "", fmt.Errorf("rate-limit algorithm must be fixed-window, sliding-log, token-bucket or distributed, got %q", s)
+}
+
+// ParseAlgorithms parses "name:algorithm,..." (limiter name to algorithm).
+func ParseAlgorithms(spec string) (map[string]Algorithm, error) {
+	out := make(map[string]Algorithm)
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, alg, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("want name:algorithm, got %q", entry)
+		}
+		a, err := ParseAlgorithm(alg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("duplicate limiter %q", name)
+		}
+		out[name] = a
+	}
+	return out, nil
+}
+
+// window is a per-instance hit counter; calls are serialized by Limiter.mu.
+type window interface {
+	allow(key string, now time.Time, perMin int) bool
+	keys() int
+	// sweep drops the keys whose state has run out by now (they would start
+	// from scratch on their next hit) and returns how many it dropped.
+	sweep(now time.Time, perMin int) int
+	// size estimates the memory held by the keys, in bytes.
+	size() int
+}
+
+// entryOverhead approximates a map entry's cost besides the key bytes and
+// the value: the string header, the pointer or slice header and the map's
+// own bookkeeping.
+const entryOverhead = 64
+
+func newWindow(a Algorithm) window {
+	switch a {
+	case SlidingLog:
+		return slidingLog{}
+	case TokenBucket:
+		return tokenBuckets{}
+	}
+	return fixedWindow{}
+}
+
+type bucket struct {
+	count int
+	reset time.Time
+}
+
+type fixedWindow map[string]*bucket
+
+func (w fixedWindow) allow(key string, now time.Time, perMin int) bool {
+	b := w[key]
+	if b == nil || now.After(b.reset) {
+		b = &bucket{count: 0, reset: now.Add(time.Minute)}
+		w[key] = b
+	}
+	if b.count >= perMin {
+		return false
+	}
+	b.count++
+	return true
+}
+
+func (w fixedWindow) keys() int { return len(w) }
+
+func (w fixedWindow) sweep(now time.Time, _ int) int {
+	n := 0
+	for k, b := range w {
+		if now.After(b.reset) {
+			delete(w, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (w fixedWindow) size() int {
+	n := 0
+	for k := range w {
+		n += entryOverhead + len(k) + int(unsafe.Sizeof(bucket{}))
+	}
+	return n
+}
+
+type slidingLog map[string][]time.Time
+
+func (w slidingLog) allow(key string, now time.Time, perMin int) bool {
+	hits := w[key]
+	cut := 0
+	for cut < len(hits) && !hits[cut].After(now.Add(-time.Minute)) {
+		cut++
+	}
+	hits = hits[cut:]
+	if len(hits) >= perMin {
+		w[key] = hits
+		return false
+	}
+	w[key] = append(hits, now)
+	return true
+}
+
+func (w slidingLog) keys() int { return len(w) }
+
+func (w slidingLog) sweep(now time.Time, _ int) int {
+	n := 0
+	for k, hits := range w {
+		if len(hits) == 0 || !hits[len(hits)-1].After(now.Add(-time.Minute)) {
+			delete(w, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (w slidingLog) size() int {
+	n := 0
+	for k, hits := range w {
+		n += entryOverhead + len(k) + cap(hits)*int(unsafe.Sizeof(time.Time{}))
+	}
+	return n
+}
+
+type tokens struct {
+	left float64
+	at   time.Time
+}
+
+type tokenBuckets map[string]*tokens
+
+func (w tokenBuckets) allow(key string, now time.Time, perMin int) bool {
+	t := w[key]
+	if t == nil {
+		t = &tokens{left: float64(perMin), at: now}
+		w[key] = t
+	}
+	t.left = min(float64(perMin), t.left+now.Sub(t.at).Minutes()*float64(perMin))
+	t.at = now
+	if t.left < 1 {
+		return false
+	}
+	t.left--
+	return true
+}
+
+func (w tokenBuckets) keys() int { return len(w) }
+
+// sweep drops buckets that have refilled completely.
+func (w tokenBuckets) sweep(now time.Time, perMin int) int {
+	n := 0
+	for k, t := range w {
+		if t.left+now.Sub(t.at).Minutes()*float64(perMin) >= float64(perMin) {
+			delete(w, k)
+			n++
+		}
+	}
+	return n
+}
+
+func (w tokenBuckets) size() int {
+	n := 0
+	for k := range w {
+		n += entryOverhead + len(k) + int(unsafe.Sizeof(tokens{}))
+	}
+	return n
+}
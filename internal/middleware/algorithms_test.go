@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindows(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+	hits := func(w window, at time.Time, n int) (allowed int) {
+		for i := 0; i < n; i++ {
+			if w.allow("k", at, 10) {
+				allowed++
+			}
+		}
+		return allowed
+	}
+	cases := []struct {
+		algo Algorithm
+		// 1 hit at t0, 9 at t0+50s, then 10 at t0+61s (past the fixed window)
+		want [3]int
+	}{
+		{FixedWindow, [3]int{1, 9, 10}}, // a fresh window: 19 hits within 11s
+		{SlidingLog, [3]int{1, 9, 1}},   // only the t0 hit has left the last minute
+		{TokenBucket, [3]int{1, 9, 2}},  // 1 token left + 11s of refill
+	}
+	for _, c := range cases {
+		w := newWindow(c.algo)
+		got := [3]int{
+			hits(w, t0, 1),
+			hits(w, t0.Add(50*time.Second), 9),
+			hits(w, t0.Add(61*time.Second), 10),
+		}
+		if got != c.want {
+			t.Errorf("%s: allowed %v, want %v", c.algo, got, c.want)
+		}
+		if w.keys() != 1 {
+			t.Errorf("%s: keys = %d", c.algo, w.keys())
+		}
+	}
+}
+
+func TestParseAlgorithms(t *testing.T) {
+	got, err := ParseAlgorithms("ws:token-bucket, http:sliding-log")
+	if err != nil || got["ws"] != TokenBucket || got["http"] != SlidingLog || len(got) != 2 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	for _, bad := range []string{"ws", "ws:leaky", ":fixed-window", "ws:fixed-window,ws:sliding-log"} {
+		if _, err := ParseAlgorithms(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestWindowSweep(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+	for _, a := range []Algorithm{FixedWindow, SlidingLog, TokenBucket} {
+		w := newWindow(a)
+		w.allow("old", t0, 10)
+		for i := 0; i < 10; i++ {
+			w.allow("new", t0.Add(50*time.Second), 10) // drains the bucket
+		}
+		if w.size() <= 2*entryOverhead {
+			t.Errorf("%s: size %d", a, w.size())
+		}
+		// at t0+61s only "old" has run out
+		if n := w.sweep(t0.Add(61*time.Second), 10); n != 1 || w.keys() != 1 {
+			t.Errorf("%s: swept %d, %d keys left", a, n, w.keys())
+		}
+		if n := w.sweep(t0.Add(2*time.Minute), 10); n != 1 || w.keys() != 0 || w.size() != 0 {
+			t.Errorf("%s: second sweep %d, %d keys left", a, n, w.keys())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// IPAllowlist admits only clients inside a set of CIDRs, for deployments
+// reachable from a VPN or private network only.
+type IPAllowlist struct {
+	nets    []netip.Prefix
+	proxies TrustedProxies
+}
+
+// NewIPAllowlist parses cidrs (CIDRs or bare IPs). The client address is
+// taken from tp.ClientIP when trusted proxies are configured; without them it
+// is the direct peer, since an allowlist that believed any X-Forwarded-For
+// could be walked around with a header.
+func NewIPAllowlist(cidrs []string, tp TrustedProxies) (*IPAllowlist, error) {
+	nets, err := ParseTrustedProxies(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &IPAllowlist{nets: nets, proxies: tp}, nil
+}
+
+// Allow returns the client address of r and whether it is inside the list.
+// Unparsable addresses are refused.
+func (a *IPAllowlist) Allow(r *http.Request) (string, bool) {
+	var ip string
+	if len(a.proxies) > 0 {
+		ip = a.proxies.ClientIP(r)
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	} else {
+		ip = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip, false
+	}
+	return ip, TrustedProxies(a.nets).trusted(addr)
+}
+
+// Middleware answers 403 to clients outside the list, after calling denied
+// (may be nil) with the request and the refused address.
+func (a *IPAllowlist) Middleware(denied func(r *http.Request, ip string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := a.Allow(r); !ok {
+				if denied != nil {
+					denied(r, ip)
+				}
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
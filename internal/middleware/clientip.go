@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies lists the CIDRs whose X-Forwarded-For headers are believed.
+// A nil/empty list keeps the legacy behavior of KeyFromRequest (trust XFF as-is).
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses CIDRs or bare IPs.
+func ParseTrustedProxies(items []string) (TrustedProxies, error) {
+	out := make(TrustedProxies, 0, len(items))
+	for _, it := range items {
+		if !strings.Contains(it, "/") {
+			a, err := netip.ParseAddr(it)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(it)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func (tp TrustedProxies) trusted(a netip.Addr) bool {
+	a = a.Unmap()
+	for _, p := range tp {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Secure reports whether the client reached us over TLS: directly, or through
+// proxies that all say X-Forwarded-Proto: https. The header is only believed
+// from a trusted direct peer (or from anyone with no trusted proxies
+// configured, like X-Forwarded-For).
+func (tp TrustedProxies) Secure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if len(tp) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		peer, err := netip.ParseAddr(host)
+		if err != nil || !tp.trusted(peer) {
+			return false
+		}
+	}
+	protos := strings.Split(strings.Join(r.Header.Values("X-Forwarded-Proto"), ","), ",")
+	for _, p := range protos {
+		if p = strings.TrimSpace(p); !strings.EqualFold(p, "https") && !strings.EqualFold(p, "wss") {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientIP returns the client address. With trusted proxies configured, the
+// X-Forwarded-For chain is walked right-to-left, skipping trusted hops, and only
+// consulted at all when the direct peer is itself trusted.
+func (tp TrustedProxies) ClientIP(r *http.Request) string {
+	if len(tp) == 0 {
+		return KeyFromRequest(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !tp.trusted(peer) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := strings.TrimSpace(hops[i])
+		a, err := netip.ParseAddr(h)
+		if err != nil {
+			break
+		}
+		if !tp.trusted(a) {
+			return a.Unmap().String()
+		}
+	}
+	return host
+}
@@ -0,0 +1,40 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+	base := middleware.DefaultSecurityHeaders()
+	// admin group overrides the outer set with a CSP
+	h := base.Middleware()(base.WithCSP(middleware.AdminCSP).Middleware()(ok))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/debug", nil))
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" || rr.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Fatalf("missing base headers: %v", rr.Header())
+	}
+	if rr.Header().Get("Content-Security-Policy") != middleware.AdminCSP {
+		t.Fatalf("csp = %q", rr.Header().Get("Content-Security-Policy"))
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatal("HSTS sent over plain HTTP")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rr = httptest.NewRecorder()
+	base.Middleware()(ok).ServeHTTP(rr, req)
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Fatalf("hsts = %q", got)
+	}
+	if rr.Header().Get("Content-Security-Policy") != "" {
+		t.Fatal("CSP leaked into the base group")
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// unmatchedRoute labels requests no route pattern matched (404s, 405s), so
+// scanners can't mint series.
+const unmatchedRoute = "unmatched"
+
+// Routes names the route serving a request after its mux pattern, e.g.
+// "/rooms/{appID}" rather than the path, so metric series stay bounded.
+type Routes struct {
+	mux    *http.ServeMux
+	mounts map[string]func(*http.Request) string
+}
+
+// NewRoutes names requests after the patterns registered on mux.
+func NewRoutes(mux *http.ServeMux) *Routes {
+	return &Routes{mux: mux, mounts: make(map[string]func(*http.Request) string)}
+}
+
+// Mount names requests served by the prefix pattern (e.g. "/admin/") after
+// the patterns of the handler mounted there with http.StripPrefix: pattern
+// gets the request with the prefix stripped and returns its route ("" if
+// none), which is then put back under the prefix.
+func (rt *Routes) Mount(prefix string, pattern func(*http.Request) string) *Routes {
+	rt.mounts[prefix] = pattern
+	return rt
+}
+
+// Name returns the route template serving r, without its method.
+func (rt *Routes) Name(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	pattern = trimMethod(pattern)
+	sub, ok := rt.mounts[pattern]
+	if !ok {
+		if pattern == "" {
+			return unmatchedRoute
+		}
+		return pattern
+	}
+	prefix := strings.TrimSuffix(pattern, "/")
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path, u.RawPath = strings.TrimPrefix(r.URL.Path, prefix), ""
+	r2.URL = &u
+	if inner := trimMethod(sub(r2)); inner != "" {
+		return prefix + inner
+	}
+	return unmatchedRoute
+}
+
+// trimMethod drops the "GET " of a method pattern; the method is labelled
+// separately.
+func trimMethod(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return strings.TrimSpace(path)
+	}
+	return pattern
+}
+
+// HTTPMetrics counts requests in nt_http_requests_total{route,method,code}
+// (code is the status class, e.g. "2xx") and times them in
+// nt_http_request_duration_seconds{route,method}, with routes named by
+// route. WebSocket sessions are counted but not timed: their handler runs
+// for the life of the connection.
+func HTTPMetrics(m *metrics.Metrics, route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, method := route(r), methodLabel(r.Method)
+			rec := &statusRecorder{ResponseWriter: w}
+			start := time.Now()
+			next.ServeHTTP(rec, r)
+			code := rec.code
+			if code == 0 {
+				code = http.StatusOK
+			}
+			m.HTTPRequests.WithLabelValues(name, method, strconv.Itoa(code/100)+"xx").Inc()
+			if !rec.hijacked && r.Method != http.MethodConnect {
+				m.HTTPDuration.WithLabelValues(name, method).Observe(time.Since(start).Seconds())
+			}
+		})
+	}
+}
+
+// methodLabel keeps the method label to the standard methods.
+func methodLabel(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect:
+		return m
+	}
+	return "other"
+}
+
+// statusRecorder captures the status written. It passes hijacking (WS
+// upgrades, counted as 101) and flushing (event streams) through.
+type statusRecorder struct {
+	http.ResponseWriter
+	code     int
+	hijacked bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	c, rw, err := h.Hijack()
+	if err == nil {
+		w.code, w.hijacked = http.StatusSwitchingProtocols, true
+	}
+	return c, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
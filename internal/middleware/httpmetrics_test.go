@@ -0,0 +1,58 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET /rooms/{appID}", ok)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rendezvous/redeem", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	mux.HandleFunc("/healthz", ok)
+	mux.Handle("/admin/", http.StripPrefix("/admin", admin))
+	routes := middleware.NewRoutes(mux).Mount("/admin/", func(r *http.Request) string {
+		_, p := admin.Handler(r)
+		return p
+	})
+	m := metrics.New()
+	h := middleware.HTTPMetrics(m, routes.Name)(mux)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPost, "/rendezvous/redeem"},
+		{http.MethodGet, "/admin/rooms/abc"},
+		{http.MethodGet, "/admin/rooms/def"},
+		{http.MethodGet, "/admin/nope"},
+		{http.MethodGet, "/random/123"},
+		{"BREW", "/healthz"},
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	for _, c := range []struct {
+		route, method, code string
+		want                float64
+	}{
+		{"/rendezvous/redeem", "POST", "4xx", 1},
+		{"/admin/rooms/{appID}", "GET", "2xx", 2},
+		{"unmatched", "GET", "4xx", 2},
+		{"/healthz", "other", "2xx", 1},
+	} {
+		if got := testutil.ToFloat64(m.HTTPRequests.WithLabelValues(c.route, c.method, c.code)); got != c.want {
+			t.Errorf("requests{%s,%s,%s} = %v, want %v", c.route, c.method, c.code, got, c.want)
+		}
+	}
+	if n := testutil.CollectAndCount(m.HTTPDuration); n != 4 {
+		t.Fatalf("duration series = %d, want 4", n)
+	}
+}
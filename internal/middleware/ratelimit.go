@@ -1,32 +1,140 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/breaker"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
 )
 
-// Limiter implements a fixed-window per-minute limit per client key (usually IP).
+// Limiter implements a per-minute limit per client key (usually IP), counted
+// with a configurable Algorithm (fixed window by default).
 type Limiter struct {
-	perMin int
+	name    string // metrics label
+	perMin  int
+	proxies TrustedProxies
+	algo    Algorithm // "" => FixedWindow, or Distributed once Shared
+
+	shared Counter
+	brk    *breaker.Breaker // guards shared
+	met    *metrics.Metrics
 
 	mu sync.Mutex
-	m  map[string]*bucket
+	w  window
 }
 
-type bucket struct {
-	count int
-	reset time.Time
+// Counter is a hit counter shared by all instances (e.g. Redis), so a limit
+// holds for the whole deployment rather than per process.
+type Counter interface {
+	// Incr adds a hit for key and returns the count in the current window,
+	// which starts with the first hit and lasts window.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
 }
 
+const (
+	sharedTimeout = 250 * time.Millisecond
+	// after a shared-counter error, count locally for this long before retrying
+	sharedRetry = 5 * time.Second
+)
+
+// JanitorInterval is how often StartJanitor prunes expired local buckets.
+const JanitorInterval = time.Minute
+
 // New returns a limiter allowing at most perMin requests per key per minute.
 // perMin <= 0 disables limiting (always allow).
 func New(perMin int) *Limiter {
 	return &Limiter{
+		name:   "default",
 		perMin: perMin,
-		m:      make(map[string]*bucket),
+		w:      fixedWindow{},
+		met:    metrics.Default,
+	}
+}
+
+// WithMetrics reports to m instead of metrics.Default.
+func (l *Limiter) WithMetrics(m *metrics.Metrics) *Limiter {
+	l.met = m
+	return l
+}
+
+// Named sets the limiter label of its metrics (default "default").
+func (l *Limiter) Named(name string) *Limiter {
+	l.name = name
+	return l
+}
+
+// TrustProxies makes the limiter key requests by TrustedProxies.ClientIP.
+func (l *Limiter) TrustProxies(tp TrustedProxies) *Limiter {
+	l.proxies = tp
+	return l
+}
+
+// Shared makes the limiter count hits in c. While c is failing the limiter
+// falls back to its per-instance buckets. It implies Distributed unless
+// another algorithm was chosen with UseAlgorithm.
+func (l *Limiter) Shared(c Counter) *Limiter {
+	l.shared = c
+	if l.brk == nil {
+		l.brk = breaker.New("ratelimit", 1, sharedRetry).WithMetrics(nil)
+	}
+	return l
+}
+
+// Breaker guards the shared counter with b instead of the limiter's own
+// breaker (open after one error, retry after 5s). Limiters sharing one
+// Redis share its breaker, so an outage seen by one makes all count locally.
+func (l *Limiter) Breaker(b *breaker.Breaker) *Limiter {
+	l.brk = b
+	return l
+}
+
+// UseAlgorithm selects how hits are counted. Distributed needs Shared;
+// without it the limiter counts in a local fixed window.
+func (l *Limiter) UseAlgorithm(a Algorithm) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.algo = a
+	l.w = newWindow(a)
+	return l
+}
+
+// Algorithm returns the algorithm in effect.
+func (l *Limiter) Algorithm() Algorithm {
+	switch {
+	case l.algo != "":
+		return l.algo
+	case l.shared != nil:
+		return Distributed
+	}
+	return FixedWindow
+}
+
+// LimiterStatus describes a limiter for /statusz.
+type LimiterStatus struct {
+	Algorithm Algorithm `json:"algorithm"`
+	PerMin    int       `json:"perMin"` // 0: disabled
+	Keys      int       `json:"keys"`   // client keys counted locally
+	// Fallback is set while a Distributed limiter counts locally because its
+	// shared counter failed (or none is configured).
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// Status reports the limiter's configuration and local state.
+func (l *Limiter) Status() LimiterStatus {
+	a := l.Algorithm()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStatus{
+		Algorithm: a,
+		PerMin:    max(l.perMin, 0),
+		Keys:      l.w.keys(),
+		Fallback:  a == Distributed && (l.shared == nil || l.brk.State() != breaker.Closed),
 	}
 }
 
@@ -35,21 +143,75 @@ func (l *Limiter) Allow(key string) bool {
 	if l == nil || l.perMin <= 0 {
 		return true
 	}
+	if l.shared != nil && l.Algorithm() == Distributed {
+		if ok, err := l.allowShared(key); err == nil {
+			return l.record(ok)
+		}
+	}
 	now := time.Now()
 
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	ok := l.w.allow(key, now, l.perMin)
+	l.mu.Unlock()
+	return l.record(ok)
+}
 
-	b := l.m[key]
-	if b == nil || now.After(b.reset) {
-		b = &bucket{count: 0, reset: now.Add(time.Minute)}
-		l.m[key] = b
+func (l *Limiter) record(ok bool) bool {
+	result := "allowed"
+	if !ok {
+		result = "denied"
 	}
-	if b.count >= l.perMin {
-		return false
+	l.met.RateLimitDecisions.WithLabelValues(l.name, result).Inc()
+	return ok
+}
+
+// StartJanitor prunes the local buckets every JanitorInterval until ctx is
+// done; without it every client key ever seen stays in memory. Each run
+// also refreshes the limiter's key count and memory estimate gauges.
+func (l *Limiter) StartJanitor(ctx context.Context) {
+	t := time.NewTicker(JanitorInterval)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				l.Sweep(now)
+			}
+		}
+	}()
+}
+
+// Sweep drops the local buckets that have expired by now, updates the
+// limiter's gauges and returns how many buckets it dropped.
+func (l *Limiter) Sweep(now time.Time) int {
+	l.mu.Lock()
+	n := l.w.sweep(now, l.perMin)
+	keys, size := l.w.keys(), l.w.size()
+	l.mu.Unlock()
+	l.met.RateLimitPruned.WithLabelValues(l.name).Add(float64(n))
+	l.met.RateLimitKeys.WithLabelValues(l.name).Set(float64(keys))
+	l.met.RateLimitMemory.WithLabelValues(l.name).Set(float64(size))
+	return n
+}
+
+func (l *Limiter) allowShared(key string) (bool, error) {
+	var n int64
+	err := l.brk.Do(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedTimeout)
+		defer cancel()
+		var err error
+		n, err = l.shared.Incr(ctx, key, time.Minute)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, breaker.ErrOpen) {
+			l.met.RateLimitFallback.Inc()
+		}
+		return false, err
 	}
-	b.count++
-	return true
+	return n <= int64(l.perMin), nil
 }
 
 // Middleware wraps an http.Handler with this limiter.
@@ -57,7 +219,7 @@ func (l *Limiter) Allow(key string) bool {
 func (l *Limiter) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !l.Allow(KeyFromRequest(r)) {
+			if !l.Allow(l.proxies.ClientIP(r)) {
 				w.WriteHeader(http.StatusTooManyRequests)
 				_, _ = w.Write([]byte("rate limit"))
 				return
@@ -69,7 +231,7 @@ func (l *Limiter) Middleware() func(http.Handler) http.Handler {
 
 // AllowWS checks allowance for a WebSocket upgrade request (use before Upgrader.Upgrade).
 func (l *Limiter) AllowWS(r *http.Request) bool {
-	return l.Allow(KeyFromRequest(r))
+	return l.Allow(l.proxies.ClientIP(r))
 }
 
 // KeyFromRequest extracts a best-effort client key from the request.
@@ -2,10 +2,17 @@
 package middleware_test
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/breaker"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
 )
 
@@ -78,3 +85,189 @@ func TestAllowWS(t *testing.T) {
 		t.Fatalf("second WS attempt should be rate-limited")
 	}
 }
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	tp, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// direct, untrusted peer: XFF is ignored
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "198.51.100.2:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if got := tp.ClientIP(r); got != "198.51.100.2" {
+		t.Fatalf("untrusted peer: got %s", got)
+	}
+
+	// via trusted proxies: right-most untrusted hop wins (spoofed left entry ignored)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.2.3:443"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.9, 10.9.9.9")
+	if got := tp.ClientIP(r); got != "203.0.113.9" {
+		t.Fatalf("trusted chain: got %s", got)
+	}
+}
+
+func TestTrustedProxiesSecure(t *testing.T) {
+	tp, _ := middleware.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	req := func(remote string, proto ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.RemoteAddr = remote
+		for _, p := range proto {
+			r.Header.Add("X-Forwarded-Proto", p)
+		}
+		return r
+	}
+	for _, c := range []struct {
+		name string
+		r    *http.Request
+		want bool
+	}{
+		{"plain, no proxy", req("198.51.100.2:1"), false},
+		{"trusted proxy says https", req("10.1.2.3:1", "https"), true},
+		{"trusted proxy says http", req("10.1.2.3:1", "http"), false},
+		{"one hop was plain", req("10.1.2.3:1", "https, http"), false},
+		{"untrusted peer claims https", req("198.51.100.2:1", "https"), false},
+	} {
+		if got := tp.Secure(c.r); got != c.want {
+			t.Errorf("%s: got %v", c.name, got)
+		}
+	}
+}
+
+type flakyCounter struct {
+	n   int64
+	err error
+}
+
+func (c *flakyCounter) Incr(context.Context, string, time.Duration) (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.n++
+	return c.n, nil
+}
+
+func TestRateLimitSharedFallback(t *testing.T) {
+	shared := &flakyCounter{n: 5} // other instances already used the budget
+	rl := middleware.New(5).Shared(shared)
+	if rl.Allow("k") {
+		t.Fatal("shared count over limit should deny")
+	}
+
+	// Redis outage: fall back to the local bucket, which is still fresh
+	shared.err = errors.New("connection refused")
+	if !rl.Allow("k") {
+		t.Fatal("local fallback should allow")
+	}
+	// and stay local without retrying the failing counter
+	shared.err = nil
+	if !rl.Allow("k") {
+		t.Fatal("should keep counting locally during the retry window")
+	}
+	if shared.n != 6 {
+		t.Fatalf("shared counter touched during fallback: %d", shared.n)
+	}
+}
+
+func TestRateLimitSharedBreakerRecovers(t *testing.T) {
+	shared := &flakyCounter{err: errors.New("connection refused")}
+	b := breaker.New("redis", 1, 20*time.Millisecond).WithMetrics(nil)
+	rl := middleware.New(5).Shared(shared).Breaker(b)
+	rl.Allow("k")
+	if st := rl.Status(); !st.Fallback || b.State() != breaker.Open {
+		t.Fatalf("during outage: %+v, %v", st, b.State())
+	}
+	shared.err = nil
+	time.Sleep(30 * time.Millisecond)
+	rl.Allow("k") // probe
+	if st := rl.Status(); st.Fallback || shared.n != 1 {
+		t.Fatalf("after recovery: %+v, shared hits %d", st, shared.n)
+	}
+}
+
+func TestLimiterStatus(t *testing.T) {
+	shared := &flakyCounter{err: errors.New("connection refused")}
+	rl := middleware.New(5).Shared(shared)
+	if st := rl.Status(); st.Algorithm != middleware.Distributed || st.Fallback {
+		t.Fatalf("before outage: %+v", st)
+	}
+	rl.Allow("k")
+	if st := rl.Status(); !st.Fallback || st.Keys != 1 || st.PerMin != 5 {
+		t.Fatalf("during outage: %+v", st)
+	}
+
+	// an explicit local algorithm ignores the shared counter
+	rl = middleware.New(5).Shared(shared).UseAlgorithm(middleware.TokenBucket)
+	shared.err = nil
+	rl.Allow("k")
+	if st := rl.Status(); st.Algorithm != middleware.TokenBucket || st.Fallback || shared.n != 0 {
+		t.Fatalf("token bucket: %+v, shared hits %d", st, shared.n)
+	}
+	if st := middleware.New(0).Status(); st.Algorithm != middleware.FixedWindow || st.PerMin != 0 {
+		t.Fatalf("default: %+v", st)
+	}
+}
+
+func TestLimiterMetricsAndSweep(t *testing.T) {
+	m := metrics.New()
+	rl := middleware.New(1).Named("http").WithMetrics(m)
+	rl.Allow("198.51.100.1")
+	rl.Allow("198.51.100.1")
+	rl.Allow("198.51.100.2")
+	if a, d := testutil.ToFloat64(m.RateLimitDecisions.WithLabelValues("http", "allowed")), testutil.ToFloat64(m.RateLimitDecisions.WithLabelValues("http", "denied")); a != 2 || d != 1 {
+		t.Fatalf("allowed %v denied %v", a, d)
+	}
+	if n := rl.Sweep(time.Now()); n != 0 || testutil.ToFloat64(m.RateLimitKeys.WithLabelValues("http")) != 2 || testutil.ToFloat64(m.RateLimitMemory.WithLabelValues("http")) == 0 {
+		t.Fatalf("sweep with live buckets pruned %d", n)
+	}
+	// a minute later both windows have run out
+	if n := rl.Sweep(time.Now().Add(2 * time.Minute)); n != 2 || rl.Status().Keys != 0 {
+		t.Fatalf("pruned %d, keys %d", n, rl.Status().Keys)
+	}
+	if testutil.ToFloat64(m.RateLimitPruned.WithLabelValues("http")) != 2 || testutil.ToFloat64(m.RateLimitKeys.WithLabelValues("http")) != 0 {
+		t.Fatal("gauges not refreshed")
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	tp, _ := middleware.ParseTrustedProxies([]string{"10.0.0.1"})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, c := range []struct {
+		name       string
+		proxies    middleware.TrustedProxies
+		remote     string
+		xff        string
+		want       int
+		wantDenyIP string
+	}{
+		{"inside", nil, "192.168.1.5:1234", "", http.StatusOK, ""},
+		{"bare IP entry", nil, "203.0.113.7:1234", "", http.StatusOK, ""},
+		{"outside", nil, "198.51.100.1:1234", "", http.StatusForbidden, "198.51.100.1"},
+		// without trusted proxies a forged header must not get anyone in
+		{"xff ignored", nil, "198.51.100.1:1234", "192.168.1.5", http.StatusForbidden, "198.51.100.1"},
+		{"via trusted proxy", tp, "10.0.0.1:1234", "192.168.1.5", http.StatusOK, ""},
+		{"outside via proxy", tp, "10.0.0.1:1234", "198.51.100.1", http.StatusForbidden, "198.51.100.1"},
+	} {
+		al, err := middleware.NewIPAllowlist([]string{"192.168.0.0/16", "203.0.113.7"}, c.proxies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var denied string
+		h := al.Middleware(func(_ *http.Request, ip string) { denied = ip })(ok)
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.RemoteAddr = c.remote
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		h.ServeHTTP(rr, req)
+		if rr.Code != c.want || denied != c.wantDenyIP {
+			t.Errorf("%s: %d (denied %q), want %d", c.name, rr.Code, denied, c.want)
+		}
+	}
+	if _, err := middleware.NewIPAllowlist([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Fatal("bad CIDR accepted")
+	}
+}
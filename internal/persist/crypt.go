@@ -0,0 +1,175 @@
+package persist
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownKey = errors.New("persisted entry sealed with an unknown key id")
+	ErrPlaintext  = errors.New("persisted entry is not encrypted")
+)
+
+// Keyring holds AES-256 keys by id. New entries are sealed with Primary;
+// older ids stay readable so keys can be rotated without a flag day.
+type Keyring struct {
+	Primary string
+	keys    map[string][]byte
+}
+
+// ParseKeyring parses "id:base64key[,id:base64key...]"; the first key is primary.
+// Keys must decode to 32 bytes (AES-256).
+func ParseKeyring(spec string) (*Keyring, error) {
+	kr := &Keyring{keys: map[string][]byte{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, b64, ok := strings.Cut(item, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("keyring: want id:base64key, got %q", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("keyring: key %q must be 32 base64-encoded bytes", id)
+		}
+		if _, dup := kr.keys[id]; dup {
+			return nil, fmt.Errorf("keyring: duplicate key id %q", id)
+		}
+		if kr.Primary == "" {
+			kr.Primary = id
+		}
+		kr.keys[id] = key
+	}
+	if kr.Primary == "" {
+		return nil, errors.New("keyring: no keys")
+	}
+	return kr, nil
+}
+
+// LoadKeyringFile reads a keyring spec from a file (e.g. a mounted KMS secret).
+func LoadKeyringFile(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(strings.ReplaceAll(string(b), "\n", ","))
+}
+
+// sealed is the at-rest form of an encrypted entry.
+type sealed struct {
+	Enc   string `json:"enc"` // "aes-256-gcm"
+	KID   string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	CT    []byte `json:"ct"`
+}
+
+const encAESGCM = "aes-256-gcm"
+
+func (kr *Keyring) aead(kid string) (cipher.AEAD, error) {
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypted is a KV that seals values with AES-GCM before they reach the
+// underlying store. The storage key is bound as additional data, so a
+// ciphertext copied to another key fails to open.
+type Encrypted struct {
+	KV
+	kr *Keyring
+	// AllowPlaintext lets Get return entries written before encryption was
+	// enabled; Rekey then seals them.
+	AllowPlaintext bool
+}
+
+func NewEncrypted(kv KV, kr *Keyring) *Encrypted { return &Encrypted{KV: kv, kr: kr} }
+
+func (e *Encrypted) Put(key string, val []byte) error {
+	a, err := e.kr.aead(e.kr.Primary)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	b, err := json.Marshal(sealed{Enc: encAESGCM, KID: e.kr.Primary, Nonce: nonce, CT: a.Seal(nil, nonce, val, []byte(key))})
+	if err != nil {
+		return err
+	}
+	return e.KV.Put(key, b)
+}
+
+func (e *Encrypted) Get(key string) ([]byte, error) {
+	b, err := e.KV.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	val, _, err := e.open(key, b)
+	return val, err
+}
+
+// open returns the plaintext and the id of the key it was sealed with
+// ("" for tolerated plaintext).
+func (e *Encrypted) open(key string, b []byte) ([]byte, string, error) {
+	var s sealed
+	if err := json.Unmarshal(b, &s); err != nil || s.Enc != encAESGCM {
+		if e.AllowPlaintext {
+			return b, "", nil
+		}
+		return nil, "", fmt.Errorf("%w: %s", ErrPlaintext, key)
+	}
+	a, err := e.kr.aead(s.KID)
+	if err != nil {
+		return nil, "", err
+	}
+	val, err := a.Open(nil, s.Nonce, s.CT, []byte(key))
+	if err != nil {
+		return nil, "", fmt.Errorf("open %s: %w", key, err)
+	}
+	return val, s.KID, nil
+}
+
+// Rekey re-seals every entry not already sealed with the primary key
+// (including tolerated plaintext) and returns how many it rewrote.
+// Run it after rotating in a new primary, then retire the old key.
+func (e *Encrypted) Rekey() (int, error) {
+	keys, err := e.KV.Keys("")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, k := range keys {
+		b, err := e.KV.Get(k)
+		if err != nil {
+			return n, err
+		}
+		val, kid, err := e.open(k, b)
+		if err != nil {
+			return n, err
+		}
+		if kid == e.kr.Primary {
+			continue
+		}
+		if err := e.Put(k, val); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
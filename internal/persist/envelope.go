@@ -0,0 +1,98 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CurrentVersion is the schema version written by this binary.
+// Bump it together with a Register'd migration from the previous version.
+const CurrentVersion = 1
+
+var (
+	ErrFutureVersion = errors.New("persisted entry written by a newer schema")
+	ErrKindMismatch  = errors.New("persisted entry has unexpected kind")
+	ErrNoMigration   = errors.New("no migration path for persisted entry")
+)
+
+// Envelope wraps every persisted value so old blobs can be detected and upgraded
+// instead of crashing a newer binary.
+type Envelope struct {
+	V    int             `json:"v"`
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Migration upgrades the data of one kind from version N to N+1.
+type Migration func(json.RawMessage) (json.RawMessage, error)
+
+var (
+	migMu      sync.RWMutex
+	migrations = map[string]map[int]Migration{}
+)
+
+// Register installs the migration for kind from version `from` to `from+1`.
+func Register(kind string, from int, fn Migration) {
+	migMu.Lock()
+	defer migMu.Unlock()
+	if migrations[kind] == nil {
+		migrations[kind] = map[int]Migration{}
+	}
+	migrations[kind][from] = fn
+}
+
+// Wrap encodes v as the current version of kind.
+func Wrap(kind string, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{V: CurrentVersion, Kind: kind, Data: data})
+}
+
+// Unwrap decodes b into out, upgrading older versions through registered migrations.
+// Blobs without an envelope are treated as version 0.
+func Unwrap(b []byte, kind string, out any) error {
+	env, err := Upgrade(b, kind)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(env.Data, out)
+}
+
+// Upgrade parses b and migrates it to CurrentVersion without decoding the payload.
+func Upgrade(b []byte, kind string) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil || env.V == 0 || env.Data == nil {
+		// legacy, un-enveloped blob
+		env = Envelope{V: 0, Kind: kind, Data: json.RawMessage(b)}
+	}
+	if env.Kind != kind {
+		return Envelope{}, fmt.Errorf("%w: got %q want %q", ErrKindMismatch, env.Kind, kind)
+	}
+	if env.V > CurrentVersion {
+		return Envelope{}, fmt.Errorf("%w: v%d > v%d", ErrFutureVersion, env.V, CurrentVersion)
+	}
+	migMu.RLock()
+	defer migMu.RUnlock()
+	for env.V < CurrentVersion {
+		fn := migrations[kind][env.V]
+		if fn == nil {
+			if env.V == 0 {
+				// v0 -> v1 only introduced the envelope itself
+				env.V = 1
+				continue
+			}
+			return Envelope{}, fmt.Errorf("%w: %s v%d", ErrNoMigration, kind, env.V)
+		}
+		data, err := fn(env.Data)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("migrate %s v%d: %w", kind, env.V, err)
+		}
+		env.Data = data
+		env.V++
+	}
+	return env, nil
+}
@@ -0,0 +1,109 @@
+package persist_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+)
+
+func TestWrapUnwrapRoundTrip(t *testing.T) {
+	b, err := persist.Wrap("thing", map[string]int{"n": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int
+	if err := persist.Unwrap(b, "thing", &out); err != nil || out["n"] != 7 {
+		t.Fatalf("roundtrip: %v %v", out, err)
+	}
+	if err := persist.Unwrap(b, "other", &out); !errors.Is(err, persist.ErrKindMismatch) {
+		t.Fatalf("want ErrKindMismatch, got %v", err)
+	}
+}
+
+func TestFutureVersionRejected(t *testing.T) {
+	b, _ := json.Marshal(persist.Envelope{V: persist.CurrentVersion + 1, Kind: "thing", Data: json.RawMessage(`{}`)})
+	var out map[string]any
+	if err := persist.Unwrap(b, "thing", &out); !errors.Is(err, persist.ErrFutureVersion) {
+		t.Fatalf("want ErrFutureVersion, got %v", err)
+	}
+}
+
+func TestMigrateLegacyEntries(t *testing.T) {
+	for name, kv := range map[string]persist.KV{"mem": persist.NewMem(), "dir": mustDir(t)} {
+		t.Run(name, func(t *testing.T) {
+			_ = kv.Put("thing/1", []byte(`{"n":1}`)) // legacy, no envelope
+			cur, _ := persist.Wrap("thing", map[string]int{"n": 2})
+			_ = kv.Put("thing/2", cur)
+
+			n, err := persist.Migrate(kv)
+			if err != nil || n != 1 {
+				t.Fatalf("migrate: n=%d err=%v", n, err)
+			}
+			b, _ := kv.Get("thing/1")
+			var env persist.Envelope
+			if err := json.Unmarshal(b, &env); err != nil || env.V != persist.CurrentVersion {
+				t.Fatalf("not upgraded: %s", b)
+			}
+			if n, _ := persist.Migrate(kv); n != 0 {
+				t.Fatalf("second migrate should be a no-op, rewrote %d", n)
+			}
+		})
+	}
+}
+
+func mustDir(t *testing.T) *persist.Dir {
+	d, err := persist.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestEncryptedRotation(t *testing.T) {
+	k1 := "k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := "k2:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	raw := persist.NewMem()
+	_ = raw.Put("mailbox/legacy", []byte(`{"n":0}`))
+
+	old, _ := persist.ParseKeyring(k1)
+	e1 := persist.NewEncrypted(raw, old)
+	if err := e1.Put("mailbox/a", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := raw.Get("mailbox/a"); bytes.Contains(b, []byte(`"n"`)) {
+		t.Fatalf("payload stored in the clear: %s", b)
+	}
+	if _, err := e1.Get("mailbox/legacy"); !errors.Is(err, persist.ErrPlaintext) {
+		t.Fatalf("want ErrPlaintext, got %v", err)
+	}
+
+	// rotate: k2 primary, k1 still readable
+	kr, _ := persist.ParseKeyring(k2 + "," + k1)
+	e2 := persist.NewEncrypted(raw, kr)
+	e2.AllowPlaintext = true
+	if b, err := e2.Get("mailbox/a"); err != nil || string(b) != `{"n":1}` {
+		t.Fatalf("read old key: %s %v", b, err)
+	}
+	if n, err := e2.Rekey(); err != nil || n != 2 {
+		t.Fatalf("rekey: n=%d err=%v", n, err)
+	}
+	if n, _ := e2.Rekey(); n != 0 {
+		t.Fatalf("second rekey rewrote %d", n)
+	}
+	// k1 retired: everything still opens under k2 alone
+	only2, _ := persist.ParseKeyring(k2)
+	if b, err := persist.NewEncrypted(raw, only2).Get("mailbox/legacy"); err != nil || string(b) != `{"n":0}` {
+		t.Fatalf("after rekey: %s %v", b, err)
+	}
+
+	// a sealed blob moved to another key does not open
+	b, _ := raw.Get("mailbox/a")
+	_ = raw.Put("mailbox/b", b)
+	if _, err := e2.Get("mailbox/b"); err == nil {
+		t.Fatal("ciphertext opened under a different key")
+	}
+}
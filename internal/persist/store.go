@@ -0,0 +1,167 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// KV is the minimal byte-level store persistence adapters build on.
+// Keys are namespaced by kind ("<kind>/<id>").
+type KV interface {
+	Get(key string) ([]byte, error)
+	Put(key string, val []byte) error
+	Delete(key string) error
+	Keys(prefix string) ([]string, error)
+}
+
+// Mem is an in-process KV, useful for tests and as a default.
+type Mem struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+func NewMem() *Mem { return &Mem{m: make(map[string][]byte)} }
+
+func (s *Mem) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (s *Mem) Put(key string, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = append([]byte(nil), val...)
+	return nil
+}
+
+func (s *Mem) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+func (s *Mem) Keys(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []string
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Dir is a file-per-key KV rooted at a directory. Writes are atomic (temp + rename).
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+func (d *Dir) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+func (d *Dir) Get(key string) ([]byte, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (d *Dir) Put(key string, val []byte) error {
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, val, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (d *Dir) Delete(key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *Dir) Keys(prefix string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(d.root, func(p string, e os.DirEntry, err error) error {
+		if err != nil || e.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return err
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		k := filepath.ToSlash(rel)
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+		return nil
+	})
+	sort.Strings(out)
+	return out, err
+}
+
+// Migrate rewrites every entry in kv to CurrentVersion. The kind of each entry
+// is the key segment before the first "/". It returns the number of entries
+// rewritten; entries already current are left alone.
+func Migrate(kv KV) (int, error) {
+	keys, err := kv.Keys("")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, k := range keys {
+		kind, _, _ := strings.Cut(k, "/")
+		b, err := kv.Get(k)
+		if err != nil {
+			return n, err
+		}
+		env, err := Upgrade(b, kind)
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", k, err)
+		}
+		var old Envelope
+		if json.Unmarshal(b, &old) == nil && old.V == env.V {
+			continue
+		}
+		out, err := json.Marshal(env)
+		if err != nil {
+			return n, err
+		}
+		if err := kv.Put(k, out); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmEndpoint = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+)
+
+// FCM sends through the Firebase Cloud Messaging HTTP v1 API with a service
+// account (OAuth2 JWT bearer grant; the access token is cached).
+type FCM struct {
+	project  string
+	email    string
+	key      *rsa.PrivateKey
+	tokenURL string
+	endpoint string // messages:send URL
+	client   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewFCM parses a service account key file (the JSON downloaded from the
+// Firebase console).
+func NewFCM(credentials []byte) (*FCM, error) {
+	var sa struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(credentials, &sa); err != nil {
+		return nil, fmt.Errorf("fcm credentials: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.TokenURI == "" {
+		return nil, errors.New("fcm credentials: missing project_id, client_email or token_uri")
+	}
+	blk, _ := pem.Decode([]byte(sa.PrivateKey))
+	if blk == nil {
+		return nil, errors.New("fcm credentials: private_key is not PEM")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(blk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("fcm credentials: %w", err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("fcm credentials: private_key is not RSA")
+	}
+	return &FCM{
+		project:  sa.ProjectID,
+		email:    sa.ClientEmail,
+		key:      rk,
+		tokenURL: sa.TokenURI,
+		endpoint: fmt.Sprintf(fcmEndpoint, url.PathEscape(sa.ProjectID)),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (f *FCM) Send(ctx context.Context, t Target, m Message) error {
+	tok, err := f.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"message": map[string]any{
+		"token":        t.FCMToken,
+		"notification": map[string]string{"title": m.Title, "body": m.Body},
+		"data":         map[string]string{"appID": m.AppID, "side": m.Side, "event": m.Event},
+		"android":      map[string]string{"priority": "high"},
+		"apns":         map[string]any{"headers": map[string]string{"apns-priority": "10"}},
+	}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound: // UNREGISTERED
+		return ErrGone
+	case res.StatusCode/100 != 2:
+		return fmt.Errorf("fcm status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// accessToken returns a cached OAuth2 token, refreshing it a minute early.
+func (f *FCM) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Now().Before(f.expiry) {
+		return f.token, nil
+	}
+	now := time.Now()
+	assertion, err := signJWT("RS256", map[string]any{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}, func(in []byte) ([]byte, error) {
+		sum := sha256.Sum256(in)
+		return rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if res.StatusCode/100 != 2 || json.NewDecoder(res.Body).Decode(&tr) != nil || tr.AccessToken == "" {
+		return "", fmt.Errorf("fcm token exchange: status %d", res.StatusCode)
+	}
+	f.token = tr.AccessToken
+	f.expiry = now.Add(time.Duration(tr.ExpiresIn)*time.Second - time.Minute)
+	return f.token, nil
+}
@@ -0,0 +1,26 @@
+package push
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signJWT returns header.claims.signature for alg, signing with sign.
+func signJWT(alg string, claims map[string]any, sign func(signingInput []byte) ([]byte, error)) (string, error) {
+	h, err := json.Marshal(map[string]string{"typ": "JWT", "alg": alg})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	in := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	sig, err := sign([]byte(in))
+	if err != nil {
+		return "", err
+	}
+	return in + "." + b64.EncodeToString(sig), nil
+}
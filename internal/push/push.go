@@ -0,0 +1,315 @@
+// Package push wakes peers whose app is backgrounded with a WebPush or FCM
+// notification when their room needs them (e.g. the other side is waiting).
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Target is where a side can be reached: a WebPush subscription (as returned
+// by PushManager.subscribe) or an FCM registration token.
+type Target struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys,omitempty"`
+	FCMToken string `json:"fcmToken,omitempty"`
+}
+
+func (t Target) kind() string {
+	if t.FCMToken != "" {
+		return "fcm"
+	}
+	return "webpush"
+}
+
+// Message is the rendered notification. WebPush delivers it as the JSON
+// payload; FCM as notification title/body plus data fields.
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	AppID string `json:"appID"`
+	Side  string `json:"side"`
+	Event string `json:"event"`
+}
+
+// Sender delivers one message to one target.
+type Sender interface {
+	Send(ctx context.Context, t Target, m Message) error
+}
+
+// ErrGone is returned by senders when the target no longer exists (the
+// subscription expired or the app was uninstalled).
+var ErrGone = errors.New("push target gone")
+
+// ErrUnsupported is returned by Subscribe for a target kind with no sender.
+var ErrUnsupported = errors.New("push target kind not configured")
+
+// ErrEndpoint is returned by Subscribe for a WebPush endpoint that isn't an
+// https URL on an allowed push service host.
+var ErrEndpoint = errors.New("push endpoint not allowed")
+
+// DefaultWebPushHosts are the browser push services (host suffixes) that
+// WebPush endpoints may point at. The server POSTs to client-supplied
+// endpoints, so anything else is refused.
+var DefaultWebPushHosts = []string{
+	"fcm.googleapis.com",        // Chrome, Edge, Opera
+	"push.services.mozilla.com", // Firefox
+	"notify.windows.com",        // legacy Edge
+	"push.apple.com",            // Safari
+}
+
+// Notifier keeps the push targets of room sides and notifies them. Targets
+// are one-shot: a notification consumes the registration.
+type Notifier struct {
+	senders     map[string]Sender // by Target.kind
+	title, body *template.Template
+	ttl         time.Duration
+	connected   func(appID, side string) bool
+	hosts       []string  // allowed WebPush endpoint host suffixes
+	ids         idgen.Set // accepted appID formats (nil => UUIDs)
+
+	mu      sync.Mutex
+	targets map[key]registration
+
+	queue chan job
+	m     *metrics.Metrics
+}
+
+type key struct{ appID, side string }
+
+type registration struct {
+	t   Target
+	exp time.Time
+}
+
+type job struct{ appID, side, event string }
+
+// New parses the title and body templates (text/template over Message's
+// AppID, Side and Event) and keeps registrations for ttl.
+func New(title, body string, ttl time.Duration) (*Notifier, error) {
+	tt, err := template.New("title").Parse(title)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		senders: make(map[string]Sender),
+		hosts:   DefaultWebPushHosts,
+		title:   tt,
+		body:    bt,
+		ttl:     ttl,
+		targets: make(map[key]registration),
+		queue:   make(chan job, 256),
+		m:       metrics.Default,
+	}, nil
+}
+
+// WithWebPush enables WebPush subscriptions.
+func (n *Notifier) WithWebPush(s Sender) *Notifier {
+	n.senders["webpush"] = s
+	return n
+}
+
+// AllowHosts replaces DefaultWebPushHosts.
+func (n *Notifier) AllowHosts(hosts []string) *Notifier {
+	n.hosts = hosts
+	return n
+}
+
+// WithFCM enables FCM tokens.
+func (n *Notifier) WithFCM(s Sender) *Notifier {
+	n.senders["fcm"] = s
+	return n
+}
+
+// SkipConnected makes the notifier skip sides for which connected reports
+// true at send time (they don't need waking).
+func (n *Notifier) SkipConnected(connected func(appID, side string) bool) *Notifier {
+	n.connected = connected
+	return n
+}
+
+// IDFormats sets the appID formats /subscribe accepts (default: UUIDs).
+func (n *Notifier) IDFormats(ids idgen.Set) *Notifier {
+	n.ids = ids
+	return n
+}
+
+// WithMetrics reports to m instead of metrics.Default.
+func (n *Notifier) WithMetrics(m *metrics.Metrics) *Notifier {
+	n.m = m
+	return n
+}
+
+// Subscribe registers t for side of appID, replacing any earlier target.
+func (n *Notifier) Subscribe(appID, side string, t Target) error {
+	if n.senders[t.kind()] == nil {
+		return ErrUnsupported
+	}
+	if t.kind() == "webpush" && !n.allowed(t.Endpoint) {
+		return ErrEndpoint
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.targets[key{appID, side}] = registration{t: t, exp: time.Now().Add(n.ttl)}
+	return nil
+}
+
+func (n *Notifier) allowed(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	host := u.Hostname()
+	for _, h := range n.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues a notification for side of appID if it has a target. It
+// never blocks, so it is safe from hub transition callbacks; if the queue is
+// full the notification is dropped.
+func (n *Notifier) Notify(appID, side, event string) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.queue <- job{appID, side, event}:
+	default:
+		n.m.PushNotifications.WithLabelValues("", "dropped").Inc()
+	}
+}
+
+// Forget drops appID's targets (call when the room closes).
+func (n *Notifier) Forget(appID string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.targets, key{appID, "A"})
+	delete(n.targets, key{appID, "B"})
+}
+
+// Start runs the delivery loop until ctx is done.
+func (n *Notifier) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case j := <-n.queue:
+				n.send(ctx, j)
+			case now := <-t.C:
+				n.expire(now)
+			}
+		}
+	}()
+}
+
+func (n *Notifier) take(k key) (Target, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	r, ok := n.targets[k]
+	if !ok || time.Now().After(r.exp) {
+		return Target{}, false
+	}
+	delete(n.targets, k)
+	return r.t, true
+}
+
+func (n *Notifier) send(ctx context.Context, j job) {
+	if n.connected != nil && n.connected(j.appID, j.side) {
+		return
+	}
+	t, ok := n.take(key{j.appID, j.side})
+	if !ok {
+		return
+	}
+	m := Message{AppID: j.appID, Side: j.side, Event: j.event}
+	var buf bytes.Buffer
+	if n.title.Execute(&buf, m) == nil {
+		m.Title = buf.String()
+	}
+	buf.Reset()
+	if n.body.Execute(&buf, m) == nil {
+		m.Body = buf.String()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err := n.senders[t.kind()].Send(ctx, t, m)
+	switch {
+	case err == nil:
+		n.m.PushNotifications.WithLabelValues(t.kind(), "sent").Inc()
+	case errors.Is(err, ErrGone):
+		n.m.PushNotifications.WithLabelValues(t.kind(), "gone").Inc()
+	default:
+		n.m.PushNotifications.WithLabelValues(t.kind(), "failed").Inc()
+	}
+}
+
+func (n *Notifier) expire(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for k, r := range n.targets {
+		if now.After(r.exp) {
+			delete(n.targets, k)
+		}
+	}
+}
+
+// Routes exposes (relative to the mount point):
+// - POST /subscribe body {"appID","side","target":{...}} -> 204
+func (n *Notifier) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AppID  string `json:"appID"`
+			Side   string `json:"side"`
+			Target Target `json:"target"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		side := strings.ToUpper(req.Side)
+		if !n.ids.Valid(req.AppID) || (side != "A" && side != "B") {
+			http.Error(w, "invalid appID or side", http.StatusBadRequest)
+			return
+		}
+		t := req.Target
+		if (t.FCMToken == "") == (t.Endpoint == "") {
+			http.Error(w, "target needs an endpoint or an fcmToken", http.StatusBadRequest)
+			return
+		}
+		if err := n.Subscribe(req.AppID, side, t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,126 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decrypt is the user agent side of RFC 8291.
+func decrypt(t *testing.T, ua *ecdh.PrivateKey, auth, body []byte) []byte {
+	t.Helper()
+	salt, idlen := body[:16], int(body[20])
+	asPub, ct := body[21:21+idlen], body[21+idlen:]
+	as, err := ecdh.P256().NewPublicKey(asPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := ua.ECDH(as)
+	ikm, _ := hkdf.Key(sha256.New, secret, auth, "WebPush: info\x00"+string(ua.PublicKey().Bytes())+string(asPub), 32)
+	cek, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	pt, err := gcm.Open(nil, nonce, ct, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if pt[len(pt)-1] != 0x02 {
+		t.Fatal("missing last-record delimiter")
+	}
+	return pt[:len(pt)-1]
+}
+
+func TestWebPushSend(t *testing.T) {
+	vapid, _ := ecdh.P256().GenerateKey(rand.Reader)
+	wp, err := NewWebPush(b64.EncodeToString(vapid.PublicKey().Bytes()), b64.EncodeToString(vapid.Bytes()), "mailto:ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	auth := make([]byte, 16)
+	_, _ = rand.Read(auth)
+
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") || r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("headers: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(decrypt(t, ua, auth, body), &got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	var tg Target
+	tg.Endpoint = srv.URL + "/push/abc"
+	tg.Keys.P256dh = b64.EncodeToString(ua.PublicKey().Bytes())
+	tg.Keys.Auth = b64.EncodeToString(auth)
+	if err := wp.Send(context.Background(), tg, Message{Title: "hi", AppID: "app", Side: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "hi" || got.Side != "B" {
+		t.Fatalf("payload = %+v", got)
+	}
+}
+
+type fakeSender chan Message
+
+func (f fakeSender) Send(_ context.Context, _ Target, m Message) error {
+	f <- m
+	return nil
+}
+
+func TestNotifierOneShot(t *testing.T) {
+	sent := make(fakeSender, 4)
+	n, err := New("{{.Side}} wanted", "room {{.AppID}} is {{.Event}}", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connected := map[string]bool{"A": true}
+	n.WithWebPush(sent).SkipConnected(func(_, side string) bool { return connected[side] })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.Start(ctx)
+
+	if err := n.Subscribe("app", "B", Target{Endpoint: "http://169.254.169.254/"}); !errors.Is(err, ErrEndpoint) {
+		t.Fatalf("non-push endpoint: err = %v", err)
+	}
+	if err := n.Subscribe("app", "B", Target{FCMToken: "tok"}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("fcm without sender: err = %v", err)
+	}
+	for _, side := range []string{"A", "B"} {
+		if err := n.Subscribe("app", side, Target{Endpoint: "https://fcm.googleapis.com/fcm/send/x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n.Notify("app", "A", "half_joined") // connected: skipped
+	n.Notify("app", "B", "half_joined")
+	n.Notify("app", "B", "half_joined") // registration already consumed
+
+	select {
+	case m := <-sent:
+		if m.Title != "B wanted" || m.Body != "room app is half_joined" {
+			t.Fatalf("message = %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification sent")
+	}
+	select {
+	case m := <-sent:
+		t.Fatalf("unexpected second notification: %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,170 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebPush sends RFC 8030 push messages with an RFC 8291 (aes128gcm)
+// encrypted payload, authenticated with VAPID (RFC 8292).
+type WebPush struct {
+	key     *ecdsa.PrivateKey
+	pub     string // VAPID public key, base64url uncompressed point
+	subject string // mailto: or https: contact for the push service
+	client  *http.Client
+}
+
+// NewWebPush takes the VAPID key pair as base64url strings (65-byte public
+// point, 32-byte private scalar) and the contact subject.
+func NewWebPush(publicKey, privateKey, subject string) (*WebPush, error) {
+	d, err := b64.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	pub := priv.PublicKey().Bytes()
+	if publicKey != b64.EncodeToString(pub) {
+		return nil, errors.New("vapid public key does not match the private key")
+	}
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(pub[1:33]), Y: new(big.Int).SetBytes(pub[33:])},
+		D:         new(big.Int).SetBytes(d),
+	}
+	return &WebPush{key: key, pub: publicKey, subject: subject, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (w *WebPush) Send(ctx context.Context, t Target, m Message) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	body, err := encrypt(t, payload)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return err
+	}
+	jwt, err := signJWT("ES256", map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.subject,
+	}, w.sign)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+jwt+", k="+w.pub)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "60")
+	req.Header.Set("Urgency", "high")
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return ErrGone
+	case res.StatusCode/100 != 2:
+		return fmt.Errorf("webpush status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// sign is ES256: r||s, each 32 bytes.
+func (w *WebPush) sign(in []byte) ([]byte, error) {
+	sum := sha256.Sum256(in)
+	r, s, err := ecdsa.Sign(rand.Reader, w.key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// encrypt builds a single-record aes128gcm body (RFC 8188) keyed per RFC 8291.
+func encrypt(t Target, payload []byte) ([]byte, error) {
+	uaBytes, err := b64.DecodeString(t.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	authSecret, err := b64.DecodeString(t.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	uaPub, err := ecdh.P256().NewPublicKey(uaBytes)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	asPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asPriv.ECDH(uaPub)
+	if err != nil {
+		return nil, err
+	}
+	asPub := asPriv.PublicKey().Bytes()
+	ikm, err := hkdf.Key(sha256.New, secret, authSecret, "WebPush: info\x00"+string(uaBytes)+string(asPub), 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	const recordSize = 4096
+	if len(payload)+1+gcm.Overhead() > recordSize {
+		return nil, errors.New("webpush payload too large")
+	}
+	// header: salt | rs | idlen | keyid (our public key)
+	out := append([]byte{}, salt...)
+	out = binary.BigEndian.AppendUint32(out, recordSize)
+	out = append(out, byte(len(asPub)))
+	out = append(out, asPub...)
+	// 0x02 marks the last (only) record
+	return gcm.Seal(out, nonce, append(payload, 0x02), nil), nil
+}
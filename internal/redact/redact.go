@@ -0,0 +1,166 @@
+// Package redact strips addresses and other sensitive values from frame
+// payloads before they are written anywhere outside the relay path (logs,
+// debug views). SDP and ICE frames carry the peers' IP addresses; the
+// built-in rules replace them, and deployments can add JSON field paths to
+// blank out and a regular expression of their own.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mask replaces redacted values.
+const Mask = "[redacted]"
+
+// MaxOutput caps the redacted text of one payload; longer output is cut and
+// marked with a trailing "...".
+const MaxOutput = 4096
+
+// rule rewrites matches of re in every string value.
+type rule struct {
+	re   *regexp.Regexp
+	with string // regexp.Expand template
+}
+
+// builtin are always applied: SDP connection and origin addresses
+// ("IN IP4 203.0.113.7"), and the address and related address of ICE
+// candidate strings.
+var builtin = []rule{
+	{regexp.MustCompile(`(IN IP[46] )[^\s"]+`), "${1}" + Mask},
+	{regexp.MustCompile(`(candidate:\S+ \d+ \S+ \d+ )[^\s"]+`), "${1}" + Mask},
+	{regexp.MustCompile(`( raddr )[^\s"]+`), "${1}" + Mask},
+}
+
+// Redactor rewrites payloads. The zero value and nil apply the built-in
+// rules only.
+type Redactor struct {
+	fields [][]string // dot paths, split
+	rules  []rule
+}
+
+// Default returns a Redactor with the built-in rules only.
+func Default() *Redactor { return &Redactor{rules: builtin} }
+
+// New returns a Redactor applying the built-in rules, replacing the values of
+// fields (comma-separated dot paths into JSON objects, e.g. "payload.sdp";
+// arrays on the way are traversed) and every match of pattern (empty: none).
+func New(fields, pattern string) (*Redactor, error) {
+	r := Default()
+	for _, f := range strings.Split(fields, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		path := strings.Split(f, ".")
+		for _, p := range path {
+			if p == "" {
+				return nil, fmt.Errorf("field %q: empty path segment", f)
+			}
+		}
+		r.fields = append(r.fields, path)
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+		r.rules = append(append([]rule(nil), builtin...), rule{re, Mask})
+	}
+	return r, nil
+}
+
+// JSON returns msg with redactions applied, re-encoded, capped at MaxOutput.
+// A payload that isn't valid JSON is redacted as text.
+func (r *Redactor) JSON(msg []byte) string {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(msg))
+	d.UseNumber()
+	if d.Decode(&v) != nil {
+		return r.String(string(msg))
+	}
+	for _, f := range r.fieldPaths() {
+		v = mask(v, f)
+	}
+	v = r.walk(v)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return r.String(string(msg))
+	}
+	return truncate(string(out))
+}
+
+// String returns s with the pattern rules applied, capped at MaxOutput.
+func (r *Redactor) String(s string) string {
+	return truncate(r.apply(s))
+}
+
+func (r *Redactor) fieldPaths() [][]string {
+	if r == nil {
+		return nil
+	}
+	return r.fields
+}
+
+func (r *Redactor) apply(s string) string {
+	rules := builtin
+	if r != nil && r.rules != nil {
+		rules = r.rules
+	}
+	for _, ru := range rules {
+		s = ru.re.ReplaceAllString(s, ru.with)
+	}
+	return s
+}
+
+// walk applies the rules to every string in v.
+func (r *Redactor) walk(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.apply(v)
+	case map[string]any:
+		for k, x := range v {
+			v[k] = r.walk(x)
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = r.walk(x)
+		}
+	}
+	return v
+}
+
+// mask replaces the value at path in v.
+func mask(v any, path []string) any {
+	switch x := v.(type) {
+	case []any:
+		for i := range x {
+			x[i] = mask(x[i], path)
+		}
+	case map[string]any:
+		c, ok := x[path[0]]
+		if !ok {
+			break
+		}
+		if len(path) == 1 {
+			x[path[0]] = Mask
+		} else {
+			x[path[0]] = mask(c, path[1:])
+		}
+	}
+	return v
+}
+
+func truncate(s string) string {
+	if len(s) <= MaxOutput {
+		return s
+	}
+	n := MaxOutput
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
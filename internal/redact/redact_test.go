@@ -0,0 +1,52 @@
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redact"
+)
+
+func TestBuiltinRules(t *testing.T) {
+	offer := `{"type":"offer","sdp":"v=0\r\no=- 46117 2 IN IP4 127.0.0.1\r\nc=IN IP4 203.0.113.7\r\na=candidate:842163049 1 udp 1677729535 198.51.100.4 51000 typ srflx raddr 10.0.0.2 rport 51000\r\n"}`
+	got := redact.Default().JSON([]byte(offer))
+	for _, ip := range []string{"127.0.0.1", "203.0.113.7", "198.51.100.4", "10.0.0.2"} {
+		if strings.Contains(got, ip) {
+			t.Fatalf("%s left in %s", ip, got)
+		}
+	}
+	if !strings.Contains(got, `c=IN IP4 [redacted]`) || !strings.Contains(got, `typ srflx`) || !strings.Contains(got, `"type":"offer"`) {
+		t.Fatalf("unexpected redaction: %s", got)
+	}
+
+	ice := `{"type":"ice","candidate":{"candidate":"candidate:1 1 UDP 2122252543 2001:db8::1 40000 typ host","sdpMid":"0"}}`
+	if got := (*redact.Redactor)(nil).JSON([]byte(ice)); strings.Contains(got, "2001:db8::1") {
+		t.Fatalf("nil redactor left the address: %s", got)
+	}
+}
+
+func TestFieldsAndPattern(t *testing.T) {
+	r, err := redact.New("payload.secret, meta.email", `token-[a-z0-9]+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.JSON([]byte(`{"type":"send","seq":12345678901234567890,"payload":[{"secret":"x","keep":"token-abc1"}],"meta":{"email":"a@b"}}`))
+	want := `{"meta":{"email":"[redacted]"},"payload":[{"keep":"[redacted]","secret":"[redacted]"}],"seq":12345678901234567890,"type":"send"}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	// not JSON: patterns still apply
+	if got := r.JSON([]byte(`oops token-zz IN IP4 192.0.2.1`)); got != `oops [redacted] IN IP4 [redacted]` {
+		t.Fatalf("text: %s", got)
+	}
+	if got := r.String(strings.Repeat("é", redact.MaxOutput)); len(got) > redact.MaxOutput+3 || !strings.HasSuffix(got, "...") {
+		t.Fatalf("not truncated: %d bytes", len(got))
+	}
+
+	if _, err := redact.New("a..b", ""); err == nil {
+		t.Fatal("want error for empty segment")
+	}
+	if _, err := redact.New("", "("); err == nil {
+		t.Fatal("want error for bad pattern")
+	}
+}
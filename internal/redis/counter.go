@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// incrScript counts a hit in a fixed window that starts with the first hit,
+// matching the in-process limiter.
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+var incrSHA = func() string {
+	s := sha1.Sum([]byte(incrScript))
+	return hex.EncodeToString(s[:])
+}()
+
+// Counter implements middleware.Counter on top of a Client.
+type Counter struct {
+	c      *Client
+	prefix string
+}
+
+// NewCounter returns a counter whose keys are namespaced by prefix.
+func NewCounter(c *Client, prefix string) *Counter {
+	return &Counter{c: c, prefix: prefix}
+}
+
+// Incr adds one hit for key and returns the count in the current window.
+func (k *Counter) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	ms := strconv.FormatInt(window.Milliseconds(), 10)
+	v, err := k.c.Do(ctx, "EVALSHA", incrSHA, "1", k.prefix+key, ms)
+	if e, ok := err.(Error); ok && strings.HasPrefix(string(e), "NOSCRIPT") {
+		v, err = k.c.Do(ctx, "EVAL", incrScript, "1", k.prefix+key, ms)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %T", v)
+	}
+	return n, nil
+}
@@ -0,0 +1,225 @@
+// Package redis is a minimal RESP2 client: enough to run scripts against a
+// single Redis endpoint for shared counters, without pulling in a driver.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error reply from the server (e.g. "NOSCRIPT ...").
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Client holds a small pool of connections to one Redis endpoint.
+type Client struct {
+	addr     string
+	tls      *tls.Config
+	user     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	pool chan *conn
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// Parse builds a client from a redis:// or rediss:// URL
+// (redis://[user:password@]host[:port][/db]). No connection is made until
+// the first command.
+func Parse(raw string, poolSize int) (*Client, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{timeout: 2 * time.Second}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("redis: missing host")
+	}
+	c.addr = u.Host
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("redis: bad db %q", db)
+		}
+	}
+	if poolSize <= 0 {
+		poolSize = 4
+	}
+	c.pool = make(chan *conn, poolSize)
+	return c, nil
+}
+
+// Close drops all idle connections.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			_ = cn.nc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends one command and returns its reply: int64, string, nil, []any or
+// an Error. The context bounds the whole round trip.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, err := cn.do(ctx, c.timeout, args)
+	var rerr Error
+	if err != nil && !errors.As(err, &rerr) {
+		// transport error: the stream may be out of sync, don't reuse it
+		_ = cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return v, err
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+	d := net.Dialer{Timeout: c.timeout}
+	var nc net.Conn
+	var err error
+	if c.tls != nil {
+		td := tls.Dialer{NetDialer: &d, Config: c.tls}
+		nc, err = td.DialContext(ctx, "tcp", c.addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.user != "" {
+			args = []string{"AUTH", c.user, c.password}
+		}
+		if _, err := cn.do(ctx, c.timeout, args); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do(ctx, c.timeout, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		_ = cn.nc.Close()
+	}
+}
+
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	dl := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(dl) {
+		dl = d
+	}
+	_ = cn.nc.SetDeadline(dl)
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		out := make([]any, n)
+		for i := range out {
+			// element errors are returned in place, not as the call's error
+			v, err := readReply(r)
+			var rerr Error
+			if errors.As(err, &rerr) {
+				v = rerr
+			} else if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,113 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redis"
+)
+
+// fakeRedis answers EVALSHA with NOSCRIPT and EVAL with a per-key counter,
+// which is all the counter script needs.
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	var mu sync.Mutex
+	counts := map[string]int{}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					args, err := readCmd(r)
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(args[0]) {
+					case "EVALSHA":
+						fmt.Fprint(c, "-NOSCRIPT No matching script\r\n")
+					case "EVAL":
+						mu.Lock()
+						counts[args[3]]++
+						n := counts[args[3]]
+						mu.Unlock()
+						fmt.Fprintf(c, ":%d\r\n", n)
+					default:
+						fmt.Fprint(c, "-ERR unknown command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCmd(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		hdr, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(hdr[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestCounterIncr(t *testing.T) {
+	c, err := redis.Parse("redis://"+fakeRedis(t), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctr := redis.NewCounter(c, "rl:")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for want := int64(1); want <= 3; want++ {
+		n, err := ctr.Incr(ctx, "203.0.113.9", time.Minute)
+		if err != nil || n != want {
+			t.Fatalf("Incr = %d, %v; want %d", n, err, want)
+		}
+	}
+	if n, _ := ctr.Incr(ctx, "other", time.Minute); n != 1 {
+		t.Fatalf("keys not independent: %d", n)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, bad := range []string{"http://x", "redis://", "redis://h/x"} {
+		if _, err := redis.Parse(bad, 1); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+	if _, err := redis.Parse("rediss://u:p@h:6380/2", 1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package rendezvous
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultCheckLimit is how many times one code may be checked per TTL.
+const DefaultCheckLimit = 5
+
+// maxChecks bounds the attempt table. Once it is full, codes not in it are
+// refused until the janitor frees slots, so probing can't grow it unbounded.
+const maxChecks = 4 * numericKeyspace
+
+// ErrCheckLimit is returned by Check once a code used up its checks (HTTP 429).
+var ErrCheckLimit = errors.New("too many checks for this code")
+
+// checkCount is the number of checks of one code within its window.
+type checkCount struct {
+	n     int
+	until time.Time
+}
+
+// CheckLimit sets how many times one code may be checked per TTL (n <= 0
+// means DefaultCheckLimit). Attempts are counted per code, whether or not it
+// exists, so /check never tells an attacker more than /redeem would.
+func (s *Store) CheckLimit(n int) *Store {
+	if n <= 0 {
+		n = DefaultCheckLimit
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkLimit = n
+	return s
+}
+
+// Check reports when code expires if it is currently redeemable, without
+// consuming it. Unknown, used and expired codes return ErrGone; a code
+// checked more than the CheckLimit within one TTL returns ErrCheckLimit.
+func (s *Store) Check(code string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return time.Time{}, ErrMissingCode
+	}
+	m := s.m
+	if !codeRe.MatchString(code) {
+		norm, ok := normalizeWords(code)
+		if !ok {
+			return time.Time{}, ErrGone
+		}
+		code, m = norm, s.w
+	}
+	now := time.Now()
+	c := s.checks[code]
+	if c == nil || now.After(c.until) {
+		if c == nil && len(s.checks) >= maxChecks {
+			s.metrics.RendezvousChecks.WithLabelValues("limited").Inc()
+			return time.Time{}, ErrCheckLimit
+		}
+		c = &checkCount{until: now.Add(s.ttl)}
+		s.checks[code] = c
+	}
+	if c.n >= s.checkLimit {
+		s.metrics.RendezvousChecks.WithLabelValues("limited").Inc()
+		return time.Time{}, ErrCheckLimit
+	}
+	c.n++
+	v, ok := m[code]
+	if !ok || now.After(v.exp) {
+		s.metrics.RendezvousChecks.WithLabelValues("gone").Inc()
+		return time.Time{}, ErrGone
+	}
+	s.metrics.RendezvousChecks.WithLabelValues("valid").Inc()
+	return v.exp, nil
+}
+
+// sweepChecksLocked forgets attempt counts past their window; s.mu must be held.
+func (s *Store) sweepChecksLocked(now time.Time) {
+	for code, c := range s.checks {
+		if now.After(c.until) {
+			delete(s.checks, code)
+		}
+	}
+}
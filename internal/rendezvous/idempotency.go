@@ -0,0 +1,152 @@
+package rendezvous
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"time"
+)
+
+// IdempotencyHeader carries a client-chosen key that makes a create request
+// safe to retry: replays within the TTL get the stored response instead of a
+// new code. Keys are global, so clients must pick unguessable ones (UUIDv4).
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeys bounds the replay cache; when full, requests are served
+// without being recorded.
+const maxIdempotencyKeys = 100_000
+
+type idemEntry struct {
+	sum    [32]byte // request body digest; a reused key with another body is refused
+	exp    time.Time
+	done   bool // false while the first request is still running
+	status int
+	ctype  string
+	body   []byte
+}
+
+// Idempotency enables the Idempotency-Key header on /code and /codes/batch,
+// remembering successful responses for ttl. ttl <= 0 disables it.
+func (s *Store) Idempotency(ttl time.Duration) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idemTTL = ttl
+	if s.idem == nil {
+		s.idem = make(map[string]*idemEntry)
+	}
+	return s
+}
+
+func validIdempotencyKey(k string) bool {
+	if len(k) == 0 || len(k) > 255 {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if k[i] < 0x21 || k[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotent wraps a create handler with Idempotency-Key handling.
+func (s *Store) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		s.mu.Lock()
+		ttl := s.idemTTL
+		s.mu.Unlock()
+		if key == "" || ttl <= 0 || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			http.Error(w, "invalid "+IdempotencyHeader, http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(r.URL.Path+"\x00"), body...))
+		now := time.Now()
+
+		s.mu.Lock()
+		e := s.idem[key]
+		if e != nil && now.After(e.exp) {
+			delete(s.idem, key)
+			e = nil
+		}
+		switch {
+		case e == nil && len(s.idem) >= maxIdempotencyKeys:
+			s.mu.Unlock()
+			next(w, r)
+			return
+		case e == nil:
+			e = &idemEntry{sum: sum, exp: now.Add(ttl)}
+			s.idem[key] = e
+		case e.sum != sum:
+			s.mu.Unlock()
+			s.metrics.RendezvousIdempotency.WithLabelValues("mismatch").Inc()
+			http.Error(w, IdempotencyHeader+" reused with a different request", http.StatusUnprocessableEntity)
+			return
+		case !e.done:
+			s.mu.Unlock()
+			s.metrics.RendezvousIdempotency.WithLabelValues("in_progress").Inc()
+			http.Error(w, "a request with this "+IdempotencyHeader+" is in progress", http.StatusConflict)
+			return
+		default:
+			status, ctype, stored := e.status, e.ctype, e.body
+			s.mu.Unlock()
+			s.metrics.RendezvousIdempotency.WithLabelValues("replayed").Inc()
+			w.Header().Set("content-type", ctype)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(status)
+			_, _ = w.Write(stored)
+			return
+		}
+		s.mu.Unlock()
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if rec.status/100 != 2 {
+			// failures aren't cached: the retry should get a real attempt
+			delete(s.idem, key)
+			return
+		}
+		e.done, e.status, e.ctype, e.body = true, rec.status, rec.Header().Get("content-type"), rec.buf.Bytes()
+		s.metrics.RendezvousIdempotency.WithLabelValues("stored").Inc()
+	}
+}
+
+// sweepIdempotencyLocked drops expired replay entries; s.mu must be held.
+func (s *Store) sweepIdempotencyLocked(now time.Time) {
+	for k, e := range s.idem {
+		if now.After(e.exp) {
+			delete(s.idem, k)
+		}
+	}
+}
+
+// recorder passes the response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.buf.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,38 @@
+package rendezvous
+
+import "time"
+
+// MultiRedeem switches the store between single-redeem (the default: a code
+// is consumed by its first redemption) and multi-redeem mode, where a code
+// keeps resolving to the same appID until it expires or MarkPaired is called
+// for its room. Multi-redeem suits peers that retry the redeem call or rejoin
+// from another device before the pairing completes.
+func (s *Store) MultiRedeem(on bool) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.multi = on
+	return s
+}
+
+// MarkPaired retires the code of appID once both peers have joined. It is a
+// no-op in single-redeem mode (the code is gone already) and reports whether
+// a code was retired.
+func (s *Store) MarkPaired(appID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.multi {
+		return false
+	}
+	defer s.observeLocked()
+	for _, m := range []map[string]entry{s.m, s.w} {
+		for code, e := range m {
+			if e.appID == appID {
+				s.releaseLocked(e)
+				s.retireLocked(code, e, time.Now())
+				delete(m, code)
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrQuota is returned when an owner already holds its maximum of outstanding codes.
+var ErrQuota = errors.New("too many outstanding codes")
+
+type ownerKey struct{}
+
+// WithOwner tags ctx with the owner (client IP or API key) that codes minted
+// under it are charged to. Codes minted without an owner are never limited.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+func ownerFrom(ctx context.Context) string {
+	o, _ := ctx.Value(ownerKey{}).(string)
+	return o
+}
+
+// LimitOwners caps outstanding (unredeemed, unexpired) codes per owner; the HTTP
+// routes derive the owner with ownerOf. max <= 0 disables the cap.
+func (s *Store) LimitOwners(max int, ownerOf func(*http.Request) string) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPerOwner, s.ownerOf = max, ownerOf
+	return s
+}
+
+// reserveLocked checks that owner may mint n more codes; s.mu must be held.
+func (s *Store) reserveLocked(owner string, n int) error {
+	if s.maxPerOwner <= 0 || owner == "" || s.owned[owner]+n <= s.maxPerOwner {
+		return nil
+	}
+	s.metrics.QuotaRejected.WithLabelValues("codes").Inc()
+	return ErrQuota
+}
+
+// chargeLocked / releaseLocked track per-owner counts as entries come and go.
+func (s *Store) chargeLocked(owner string) {
+	if owner != "" {
+		s.owned[owner]++
+	}
+}
+
+func (s *Store) releaseLocked(e entry) {
+	if e.owner == "" {
+		return
+	}
+	if s.owned[e.owner]--; s.owned[e.owner] <= 0 {
+		delete(s.owned, e.owner)
+	}
+}
+
+// observeOwnersLocked refreshes the bounded per-owner gauges; s.mu must be held.
+func (s *Store) observeOwnersLocked() {
+	atLimit := 0
+	for _, n := range s.owned {
+		if s.maxPerOwner > 0 && n >= s.maxPerOwner {
+			atLimit++
+		}
+	}
+	s.metrics.QuotaOwners.WithLabelValues("codes", "active").Set(float64(len(s.owned)))
+	s.metrics.QuotaOwners.WithLabelValues("codes", "at_limit").Set(float64(atLimit))
+}
+
+// ownerContext charges codes minted for r to its owner, if quotas are on.
+func (s *Store) ownerContext(r *http.Request) context.Context {
+	s.mu.Lock()
+	ownerOf := s.ownerOf
+	s.mu.Unlock()
+	if ownerOf == nil {
+		return r.Context()
+	}
+	return WithOwner(r.Context(), ownerOf(r))
+}
@@ -7,131 +7,419 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
 )
 
 type entry struct {
-	appID uuid.UUID
-	exp   time.Time
+	appID  string
+	exp    time.Time
+	owner  string // who minted it, for per-owner quotas ("" = unlimited)
+	region string // region the room lives in ("" = single-region deployment)
 }
 
 type Store struct {
 	mu  sync.Mutex
-	m   map[string]entry
+	m   map[string]entry // numeric codes
+	w   map[string]entry // word codes (normalized)
 	ttl time.Duration
+
+	owned       map[string]int // outstanding codes per owner
+	maxPerOwner int
+	ownerOf     func(*http.Request) string
+
+	region string // tagged onto new entries
+	multi  bool   // codes survive redemption until MarkPaired (see MultiRedeem)
+
+	idem    map[string]*idemEntry // by Idempotency-Key
+	idemTTL time.Duration         // 0 => header ignored
+
+	retired    map[string]retiredEntry // recently consumed/expired codes (see WithRoomLookup)
+	roomActive func(appID string) bool
+
+	checks     map[string]*checkCount // /check attempts per code (see CheckLimit)
+	checkLimit int
+
+	ids idgen.Set // appID formats; the first mints (see IDFormats)
+
+	tickets *ticket.Issuer // nil => responses carry no WS tickets
+
+	lastSweep atomic.Int64 // unix nanos of the last janitor sweep
+
+	metrics *metrics.Metrics
 }
 
-func NewStore(ttl time.Duration) *Store { return &Store{m: make(map[string]entry), ttl: ttl} }
+func NewStore(ttl time.Duration) *Store {
+	return &Store{m: make(map[string]entry), w: make(map[string]entry), owned: make(map[string]int), ttl: ttl, checks: make(map[string]*checkCount), checkLimit: DefaultCheckLimit, ids: idgen.Default, metrics: metrics.Default}
+}
+
+// numericKeyspace is the number of distinct 4-digit codes.
+const numericKeyspace = 10000
 
 // numeric codes (4..8 if you expand later); we currently emit 4 digits
 var codeRe = regexp.MustCompile(`^[0-9]{4,8}$`)
 
+// Errors returned by the store; match with errors.Is.
 var (
-	errMissingCode   = errors.New("missing code")
-	errGone          = errors.New("invalid or expired")
-	errExhausted     = errors.New("code-space exhausted")
-	errBadContentTyp = errors.New("bad content-type")
+	// ErrMissingCode is returned by Redeem for an empty code.
+	ErrMissingCode = errors.New("missing code")
+	// ErrGone is returned by Redeem for used, expired or unknown codes (HTTP 410).
+	ErrGone = errors.New("invalid or expired")
+	// ErrRoomActive accompanies ErrGone when the code's room is still open
+	// (HTTP 409); see WithRoomLookup.
+	ErrRoomActive = errors.New("code gone but room already joined")
+	// ErrExhausted is returned when no free code of the requested format is left.
+	ErrExhausted = errors.New("code-space exhausted")
+	// ErrBadContentType is returned by the HTTP routes for non-JSON bodies.
+	ErrBadContentType = errors.New("bad content-type")
+	// ErrBatchSize is returned by CreateCodes for counts outside 1..MaxBatch.
+	ErrBatchSize = fmt.Errorf("batch count must be 1..%d", MaxBatch)
+	// ErrFormat is returned for unknown code formats or word counts.
+	ErrFormat = errors.New("invalid code format")
 )
 
+// MaxBatch bounds the number of codes minted by a single CreateCodes call.
+const MaxBatch = 100
+
+// Code is one minted code with its appID and expiry.
+type Code struct {
+	Code      string    `json:"code"`
+	AppID     string    `json:"appID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Region    string    `json:"region,omitempty"`
+}
+
 // CreateCode returns a fresh (unused or reclaimed) numeric code, appID, and expiry.
 // It guarantees the returned code is not currently usable by anyone else.
-// If all 10,000 codes are in-use and not expired, it returns errExhausted.
-func (s *Store) CreateCode(ctx context.Context) (code string, appID uuid.UUID, exp time.Time, err error) {
+// If all 10,000 codes are in-use and not expired, it returns ErrExhausted.
+func (s *Store) CreateCode(ctx context.Context) (code string, appID string, exp time.Time, err error) {
+	c, err := s.CreateCodeFormat(ctx, FormatNumeric, 0)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return c.Code, c.AppID, c.ExpiresAt, nil
+}
+
+// CreateCodeFormat mints a code of the given format. For FormatWords, words is
+// the number of words (2 or 3; 0 means 2).
+func (s *Store) CreateCodeFormat(ctx context.Context, f Format, words int) (Code, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.observeLocked()
+	owner := ownerFrom(ctx)
+	if err := s.reserveLocked(owner, 1); err != nil {
+		return Code{}, err
+	}
+	return s.createLocked(time.Now(), f, words, owner)
+}
 
+// CreateCodes mints n codes atomically: either all n are reserved or none are.
+func (s *Store) CreateCodes(ctx context.Context, n int) ([]Code, error) {
+	return s.CreateCodesFormat(ctx, n, FormatNumeric, 0)
+}
+
+// CreateCodesFormat is CreateCodes for a specific format.
+func (s *Store) CreateCodesFormat(ctx context.Context, n int, f Format, words int) ([]Code, error) {
+	if n <= 0 || n > MaxBatch {
+		return nil, ErrBatchSize
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.observeLocked()
+	owner := ownerFrom(ctx)
+	if err := s.reserveLocked(owner, n); err != nil {
+		return nil, err
+	}
 	now := time.Now()
-	appID = uuid.New()
-	exp = now.Add(s.ttl)
+	out := make([]Code, 0, n)
+	for i := 0; i < n; i++ {
+		c, err := s.createLocked(now, f, words, owner)
+		if err != nil {
+			for _, done := range out {
+				for _, m := range []map[string]entry{s.m, s.w} {
+					if e, ok := m[done.Code]; ok {
+						s.releaseLocked(e)
+						delete(m, done.Code)
+					}
+				}
+			}
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// createLocked reserves one code; s.mu must be held.
+func (s *Store) createLocked(now time.Time, f Format, words int, owner string) (Code, error) {
+	appID := s.ids.New()
+	exp := now.Add(s.ttl)
+
+	switch f {
+	case FormatWords:
+		return s.createWordsLocked(now, appID, exp, words, owner)
+	case FormatNumeric, "":
+	default:
+		return Code{}, fmt.Errorf("%w: unknown format %q", ErrFormat, f)
+	}
 
 	// If the space is fully occupied with non-expired entries, fail fast.
-	if len(s.m) >= 10000 {
+	if len(s.m) >= numericKeyspace {
 		// opportunistically reclaim expired entries (in case janitor hasn't yet)
 		for k, v := range s.m {
 			if now.After(v.exp) {
+				s.releaseLocked(v)
+				s.retireLocked(k, v, now)
 				delete(s.m, k)
+				s.metrics.RendezvousReclaimed.WithLabelValues("inline").Inc()
 			}
 		}
-		if len(s.m) >= 10000 {
-			return "", uuid.Nil, time.Time{}, errExhausted
+		if len(s.m) >= numericKeyspace {
+			s.metrics.RendezvousExhausted.WithLabelValues(string(FormatNumeric)).Inc()
+			return Code{}, ErrExhausted
 		}
 	}
 
 	// Try up to the remaining keyspace to find a free (or expired) code.
 	// In practice we’ll hit immediately; this also reclaims expired slots inline.
-	for tries := 0; tries < 10000; tries++ {
+	for tries := 0; tries < numericKeyspace; tries++ {
 		v, e := randUint32()
 		if e != nil {
-			return "", uuid.Nil, time.Time{}, e
+			return Code{}, e
 		}
-		code = fmt.Sprintf("%04d", v%10000)
+		code := fmt.Sprintf("%04d", v%numericKeyspace)
 		if e, exists := s.m[code]; exists {
-			if now.After(e.exp) {
-				// reclaim expired slot
-				s.m[code] = entry{appID: appID, exp: exp}
-				return code, appID, exp, nil
+			if !now.After(e.exp) {
+				continue // still in-use; try another
+			}
+			s.releaseLocked(e)
+			s.metrics.RendezvousReclaimed.WithLabelValues("inline").Inc()
+		}
+		// unused, or reclaim expired slot
+		s.m[code] = entry{appID: appID, exp: exp, owner: owner, region: s.region}
+		delete(s.retired, code)
+		delete(s.checks, code)
+		s.chargeLocked(owner)
+		return Code{Code: code, AppID: appID, ExpiresAt: exp, Region: s.region}, nil
+	}
+	s.metrics.RendezvousExhausted.WithLabelValues(string(FormatNumeric)).Inc()
+	return Code{}, ErrExhausted
+}
+
+// createWordsLocked reserves a word code; collisions with live codes are retried.
+func (s *Store) createWordsLocked(now time.Time, appID string, exp time.Time, words int, owner string) (Code, error) {
+	if words == 0 {
+		words = 2
+	}
+	if words < 2 || words > 3 {
+		return Code{}, fmt.Errorf("%w: words must be 2 or 3", ErrFormat)
+	}
+	for tries := 0; tries < 1000; tries++ {
+		v, err := randUint32()
+		if err != nil {
+			return Code{}, err
+		}
+		code := wordCode(v, words)
+		if e, exists := s.w[code]; exists {
+			if !now.After(e.exp) {
+				continue
 			}
-			continue // still in-use; try another
+			s.releaseLocked(e)
+			s.metrics.RendezvousReclaimed.WithLabelValues("inline").Inc()
 		}
-		// unused
-		s.m[code] = entry{appID: appID, exp: exp}
-		return code, appID, exp, nil
+		s.w[code] = entry{appID: appID, exp: exp, owner: owner, region: s.region}
+		delete(s.retired, code)
+		delete(s.checks, code)
+		s.chargeLocked(owner)
+		return Code{Code: code, AppID: appID, ExpiresAt: exp, Region: s.region}, nil
 	}
-	return "", uuid.Nil, time.Time{}, errExhausted
+	s.metrics.RendezvousExhausted.WithLabelValues(string(FormatWords)).Inc()
+	return Code{}, ErrExhausted
 }
 
 // Redeem consumes a code once. On success, deletes it and returns (appID, exp).
-// On used/expired/unknown it returns errGone (for HTTP 410 mapping).
-func (s *Store) Redeem(ctx context.Context, code string) (uuid.UUID, time.Time, error) {
+// On used/expired/unknown it returns ErrGone (for HTTP 410 mapping), which also
+// matches ErrRoomActive if the code's room is still open (see WithRoomLookup).
+// In multi-redeem mode the code is kept until MarkPaired or expiry.
+func (s *Store) Redeem(ctx context.Context, code string) (string, time.Time, error) {
+	v, err := s.redeem(code)
+	return v.appID, v.exp, s.goneReason(code, err)
+}
+
+// SetMetrics reports to m instead of metrics.Default. Call before serving.
+func (s *Store) SetMetrics(m *metrics.Metrics) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = m
+	return s
+}
+
+// IDFormats sets the appID format of new codes to ids' first format (see
+// idgen.Set). Call before serving.
+func (s *Store) IDFormats(ids idgen.Set) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = ids
+	return s
+}
+
+// Tickets adds a one-time WS ticket to /code (side A) and /redeem (side B)
+// responses, to be passed as /ws?ticket= instead of appID and side. Batch
+// codes carry none: they are minted ahead of time and would outlive it.
+func (s *Store) Tickets(iss *ticket.Issuer) *Store {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.tickets = iss
+	return s
+}
+
+// addTicket sets resp["ticket"] for side of appID, if tickets are enabled.
+func (s *Store) addTicket(resp map[string]any, appID, side string) error {
+	if s.tickets == nil {
+		return nil
+	}
+	t, err := s.tickets.Issue(appID, side)
+	if err != nil {
+		return err
+	}
+	resp["ticket"] = t
+	return nil
+}
+
+// SetRegion tags codes minted from now on with region; it is returned on
+// create and redeem so clients can connect to that region's signaling URL.
+func (s *Store) SetRegion(region string) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.region = region
+	return s
+}
+
+func (s *Store) redeem(code string) (entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.observeLocked()
 
 	code = strings.TrimSpace(code)
 	if code == "" {
-		return uuid.Nil, time.Time{}, errMissingCode
+		return entry{}, ErrMissingCode
+	}
+	m := s.m
+	if !codeRe.MatchString(code) {
+		norm, ok := normalizeWords(code)
+		if !ok {
+			return entry{}, ErrGone
+		}
+		code, m = norm, s.w
 	}
 	now := time.Now()
-	v, ok := s.m[code]
+	v, ok := m[code]
 	if !ok || now.After(v.exp) {
 		// if it’s expired but still present, clean it up
 		if ok {
-			delete(s.m, code)
+			s.releaseLocked(v)
+			s.retireLocked(code, v, now)
+			delete(m, code)
+			s.metrics.RendezvousReclaimed.WithLabelValues("redeem").Inc()
 		}
-		return uuid.Nil, time.Time{}, errGone
+		return entry{}, ErrGone
 	}
-	delete(s.m, code)
-	return v.appID, v.exp, nil
+	if !s.multi {
+		s.releaseLocked(v)
+		s.retireLocked(code, v, now)
+		delete(m, code)
+	}
+	return v, nil
 }
 
-// Routes exposes POST /rendezvous/code and POST /rendezvous/redeem.
-// - /code: returns {"code","appID","expiresAt"} (JSON)
-// - /redeem: body {"code": "NNNN"}; 200 with {"appID","expiresAt"} or 410 Gone if already used/expired/unknown.
+// Routes exposes POST /rendezvous/code, POST /rendezvous/codes/batch, POST /rendezvous/redeem
+// and GET /rendezvous/check.
+//   - /code: optional body {"format":"numeric"|"words","words":2|3}; returns {"code","appID","expiresAt"} (JSON)
+//   - /codes/batch: body {"count": N} (1..MaxBatch, plus optional format/words); returns {"codes":[{"code","appID","expiresAt"}...]}
+//   - /redeem: body {"code": "NNNN"}; 200 with {"appID","expiresAt"} or 410 Gone if already used/expired/unknown.
+//     With WithRoomLookup, a used/expired code whose room is still open gets 409 {"error":"already_joined","hint"}.
+//   - /check?code=NNNN: {"valid":true,"expiresAt"} or {"valid":false} without consuming the code; 429 past CheckLimit.
+//
+// Responses carry "region" when the store is tagged with one (SetRegion), and
+// /code and /redeem carry "ticket" when tickets are enabled (Tickets).
+// /code and /codes/batch honor Idempotency-Key when enabled (Idempotency).
 func (s *Store) Routes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/code", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/code", s.idempotent(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		code, appID, exp, err := s.CreateCode(r.Context())
+		var req struct {
+			Format Format `json:"format"`
+			Words  int    `json:"words"`
+		}
+		// body is optional; an empty POST mints a numeric code
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		c, err := s.CreateCodeFormat(s.ownerContext(r), req.Format, req.Words)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCreateError(w, err, http.StatusInternalServerError)
+			return
+		}
+		resp := map[string]any{
+			"code":      c.Code,
+			"appID":     c.AppID,
+			"expiresAt": c.ExpiresAt.UTC(),
+		}
+		if c.Region != "" {
+			resp["region"] = c.Region
+		}
+		if err := s.addTicket(resp, c.AppID, "A"); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("content-type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"code":      code,
-			"appID":     appID.String(),
-			"expiresAt": exp.UTC(),
-		})
-	})
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+
+	mux.HandleFunc("/codes/batch", s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			http.Error(w, ErrBadContentType.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		var req struct {
+			Count  int    `json:"count"`
+			Format Format `json:"format"`
+			Words  int    `json:"words"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Count < 1 || req.Count > MaxBatch {
+			http.Error(w, ErrBatchSize.Error(), http.StatusBadRequest)
+			return
+		}
+		codes, err := s.CreateCodesFormat(s.ownerContext(r), req.Count, req.Format, req.Words)
+		if err != nil {
+			writeCreateError(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		s.metrics.RendezvousBatchSize.Observe(float64(len(codes)))
+		for i := range codes {
+			codes[i].ExpiresAt = codes[i].ExpiresAt.UTC()
+		}
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"codes": codes})
+	}))
 
 	mux.HandleFunc("/redeem", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -140,21 +428,32 @@ func (s *Store) Routes() http.Handler {
 		}
 		// Enforce JSON body
 		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
-			http.Error(w, errBadContentTyp.Error(), http.StatusUnsupportedMediaType)
+			http.Error(w, ErrBadContentType.Error(), http.StatusUnsupportedMediaType)
 			return
 		}
 		var req struct {
 			Code string `json:"code"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !codeRe.MatchString(req.Code) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validCode(req.Code) {
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
 
-		appID, exp, err := s.Redeem(r.Context(), req.Code)
+		e, err := s.redeem(req.Code)
 		if err != nil {
+			if errors.Is(s.goneReason(req.Code, err), ErrRoomActive) {
+				// lost the race; no appID, the sender has to reissue
+				s.metrics.RendezvousRoomActive.Inc()
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error": "already_joined",
+					"hint":  "this code was already used or has expired; ask the sender to issue a new one",
+				})
+				return
+			}
 			// For used/expired/unknown, map to 410 Gone
-			if errors.Is(err, errGone) {
+			if errors.Is(err, ErrGone) {
 				http.Error(w, "gone", http.StatusGone)
 				return
 			}
@@ -162,16 +461,75 @@ func (s *Store) Routes() http.Handler {
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
+		resp := map[string]any{
+			"appID":     e.appID,
+			"expiresAt": e.exp.UTC(),
+		}
+		if e.region != "" {
+			resp["region"] = e.region
+		}
+		if err := s.addTicket(resp, e.appID, "B"); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("content-type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"appID":     appID.String(),
-			"expiresAt": exp.UTC(),
-		})
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if !validCode(code) {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		exp, err := s.Check(code)
+		resp := map[string]any{"valid": err == nil}
+		switch {
+		case err == nil:
+			resp["expiresAt"] = exp.UTC()
+		case errors.Is(err, ErrCheckLimit):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case !errors.Is(err, ErrGone):
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("cache-control", "no-store")
+		_ = json.NewEncoder(w).Encode(resp)
 	})
 
 	return mux
 }
 
+// writeCreateError maps a minting error to its HTTP status; exhausted is the
+// status for ErrExhausted.
+func writeCreateError(w http.ResponseWriter, err error, exhausted int) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrQuota):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrExhausted):
+		status = exhausted
+	case errors.Is(err, ErrFormat), errors.Is(err, ErrBatchSize):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// validCode accepts numeric codes and (normalizable) word codes.
+func validCode(c string) bool {
+	if codeRe.MatchString(c) {
+		return true
+	}
+	_, ok := normalizeWords(c)
+	return ok
+}
+
 func randUint32() (uint32, error) {
 	var b [4]byte
 	if _, err := rand.Read(b[:]); err != nil {
@@ -182,16 +540,62 @@ func randUint32() (uint32, error) {
 
 func (s *Store) sweep(now time.Time) {
 	s.mu.Lock()
-	for k, v := range s.m {
-		if now.After(v.exp) {
-			delete(s.m, k)
+	for _, m := range []map[string]entry{s.m, s.w} {
+		for k, v := range m {
+			if now.After(v.exp) {
+				s.releaseLocked(v)
+				s.retireLocked(k, v, now)
+				delete(m, k)
+				s.metrics.RendezvousReclaimed.WithLabelValues("janitor").Inc()
+			}
 		}
 	}
+	s.sweepRetiredLocked(now)
+	s.sweepChecksLocked(now)
+	s.sweepIdempotencyLocked(now)
+	s.observeLocked()
 	s.mu.Unlock()
+	s.lastSweep.Store(now.UnixNano())
+}
+
+// LastSweep returns when the janitor last ran (zero if it never has).
+func (s *Store) LastSweep() time.Time {
+	if n := s.lastSweep.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// Utilization returns the fraction (0..1) of the numeric keyspace currently held.
+func (s *Store) Utilization() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return float64(len(s.m)) / numericKeyspace
+}
+
+// observeLocked refreshes the keyspace gauges; s.mu must be held.
+func (s *Store) observeLocked() {
+	s.metrics.RendezvousActiveCodes.WithLabelValues(string(FormatNumeric)).Set(float64(len(s.m)))
+	s.metrics.RendezvousActiveCodes.WithLabelValues(string(FormatWords)).Set(float64(len(s.w)))
+	s.metrics.RendezvousUtilization.Set(100 * float64(len(s.m)) / numericKeyspace)
+	s.observeOwnersLocked()
+}
+
+// Len returns the number of codes currently held (including not-yet-swept expired ones).
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.m) + len(s.w)
 }
 
+// janitorEvery is how often StartJanitor sweeps expired codes.
+var janitorEvery = time.Minute
+
+// StartJanitor sweeps expired codes, retired entries, check counters and the
+// idempotency cache every janitorEvery until ctx is done. The store lives in
+// this replica's memory, so every replica runs it, Lease leader or not.
 func (s *Store) StartJanitor(ctx context.Context) {
-	t := time.NewTicker(time.Minute)
+	t := time.NewTicker(janitorEvery)
 	go func() {
 		defer t.Stop()
 		for {
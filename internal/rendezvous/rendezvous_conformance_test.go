@@ -0,0 +1,49 @@
+package rendezvous_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous/rendezvoustest"
+)
+
+func TestStoreConformance(t *testing.T) {
+	rendezvoustest.Run(t, func(ttl time.Duration) rendezvoustest.Store { return rendezvous.NewStore(ttl) })
+}
+
+// FuzzRedeem: arbitrary input never panics or redeems anything but a live code.
+func FuzzRedeem(f *testing.F) {
+	for _, seed := range []string{"", "0000", "12345678", "apple-river", " APPLE  river ", "ß-é", "\x00"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, code string) {
+		s := rendezvous.NewStore(time.Minute)
+		if _, _, err := s.Redeem(context.Background(), code); err == nil {
+			t.Fatalf("empty store redeemed %q", code)
+		}
+	})
+}
+
+func TestMultiRedeemUntilPaired(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute).MultiRedeem(true)
+	ctx := context.Background()
+	code, app, _, err := s.CreateCode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		got, _, err := s.Redeem(ctx, code)
+		if err != nil || got != app {
+			t.Fatalf("redeem %d: %v %v", i, got, err)
+		}
+	}
+	if !s.MarkPaired(app) {
+		t.Fatal("MarkPaired found no code")
+	}
+	if _, _, err := s.Redeem(ctx, code); !errors.Is(err, rendezvous.ErrGone) {
+		t.Fatalf("after pairing: want ErrGone, got %v", err)
+	}
+}
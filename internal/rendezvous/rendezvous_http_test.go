@@ -3,13 +3,17 @@ package rendezvous_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
 )
 
 func TestRoutesHappyPath(t *testing.T) {
@@ -50,3 +54,204 @@ func TestRoutesHappyPath(t *testing.T) {
 		t.Fatalf("want 410, got %d", res3.StatusCode)
 	}
 }
+
+func TestRoutesBatch(t *testing.T) {
+	s := rendezvous.NewStore(1 * time.Minute)
+	srv := httptest.NewServer(http.StripPrefix("/rendezvous", s.Routes()))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/rendezvous/codes/batch", "application/json", bytes.NewReader([]byte(`{"count":5}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", res.StatusCode)
+	}
+	var out struct {
+		Codes []struct{ Code, AppID string }
+	}
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	seen := map[string]bool{}
+	for _, c := range out.Codes {
+		if c.Code == "" || c.AppID == "" || seen[c.Code] {
+			t.Fatalf("bad or duplicate entry: %+v", c)
+		}
+		seen[c.Code] = true
+	}
+	if len(seen) != 5 {
+		t.Fatalf("want 5 codes, got %d", len(seen))
+	}
+
+	res2, err := http.Post(srv.URL+"/rendezvous/codes/batch", "application/json", bytes.NewReader([]byte(`{"count":1000}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res2.Body.Close()
+	if res2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("oversized batch: want 400, got %d", res2.StatusCode)
+	}
+}
+
+func TestRoutesRegion(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute).SetRegion("eu")
+	srv := httptest.NewServer(http.StripPrefix("/rendezvous", s.Routes()))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/rendezvous/code", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var c struct{ Code, Region string }
+	_ = json.NewDecoder(res.Body).Decode(&c)
+	if c.Region != "eu" {
+		t.Fatalf("create: region %q", c.Region)
+	}
+
+	body, _ := json.Marshal(map[string]string{"code": c.Code})
+	res2, err := http.Post(srv.URL+"/rendezvous/redeem", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res2.Body.Close()
+	var r struct{ AppID, Region string }
+	_ = json.NewDecoder(res2.Body).Decode(&r)
+	if r.AppID == "" || r.Region != "eu" {
+		t.Fatalf("redeem: %+v", r)
+	}
+}
+
+func TestRoutesRedeemRoomActive(t *testing.T) {
+	var open atomic.Bool
+	s := rendezvous.NewStore(1 * time.Minute).WithRoomLookup(func(string) bool { return open.Load() })
+	srv := httptest.NewServer(http.StripPrefix("/rendezvous", s.Routes()))
+	defer srv.Close()
+
+	code, _, _, err := s.CreateCode(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeem := func() *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"code": code})
+		res, err := http.Post(srv.URL+"/rendezvous/redeem", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	if res := redeem(); res.StatusCode != http.StatusOK {
+		t.Fatalf("first redeem: %d", res.StatusCode)
+	}
+
+	// room not (or no longer) open: plain 410
+	if res := redeem(); res.StatusCode != http.StatusGone {
+		t.Fatalf("want 410, got %d", res.StatusCode)
+	}
+
+	open.Store(true)
+	res := redeem()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("want 409, got %d", res.StatusCode)
+	}
+	var got map[string]string
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["error"] != "already_joined" || got["hint"] == "" || got["appID"] != "" {
+		t.Fatalf("bad body: %v", got)
+	}
+
+	if _, _, err := s.Redeem(context.Background(), code); !errors.Is(err, rendezvous.ErrGone) || !errors.Is(err, rendezvous.ErrRoomActive) {
+		t.Fatalf("Redeem: want ErrGone+ErrRoomActive, got %v", err)
+	}
+}
+
+func TestRoutesCheck(t *testing.T) {
+	s := rendezvous.NewStore(1 * time.Minute).CheckLimit(3)
+	srv := httptest.NewServer(http.StripPrefix("/rendezvous", s.Routes()))
+	defer srv.Close()
+
+	code, _, exp, err := s.CreateCode(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(code string) (int, map[string]any) {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/rendezvous/check?code=" + code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var got map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&got)
+		return res.StatusCode, got
+	}
+
+	status, got := check(code)
+	if status != http.StatusOK || got["valid"] != true || got["expiresAt"] != exp.UTC().Format(time.RFC3339Nano) {
+		t.Fatalf("live code: %d %v", status, got)
+	}
+	// not consumed
+	if _, _, err := s.Redeem(context.Background(), code); err != nil {
+		t.Fatalf("redeem after check: %v", err)
+	}
+	if status, got := check(code); status != http.StatusOK || got["valid"] != false {
+		t.Fatalf("redeemed code: %d %v", status, got)
+	}
+	if status, _ := check(code); status != http.StatusOK {
+		t.Fatalf("third check: %d", status)
+	}
+	if status, _ := check(code); status != http.StatusTooManyRequests {
+		t.Fatalf("fourth check: want 429, got %d", status)
+	}
+	if status, _ := check("12ab"); status != http.StatusBadRequest {
+		t.Fatalf("malformed code: want 400, got %d", status)
+	}
+
+	// unknown codes use up their attempts the same way
+	other := "0000"
+	if other == code {
+		other = "0001"
+	}
+	for i := 0; i < 3; i++ {
+		if status, got := check(other); status != http.StatusOK || got["valid"] != false {
+			t.Fatalf("unknown code: %d %v", status, got)
+		}
+	}
+	if _, err := s.Check(other); !errors.Is(err, rendezvous.ErrCheckLimit) {
+		t.Fatalf("Check: want ErrCheckLimit, got %v", err)
+	}
+}
+
+func TestRoutesTickets(t *testing.T) {
+	iss := ticket.New([]byte("k"), time.Minute)
+	s := rendezvous.NewStore(1 * time.Minute).Tickets(iss)
+	srv := httptest.NewServer(http.StripPrefix("/rendezvous", s.Routes()))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/rendezvous/code", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var c struct{ Code, AppID, Ticket string }
+	_ = json.NewDecoder(res.Body).Decode(&c)
+	if cl, err := iss.Verify(c.Ticket); err != nil || cl.AppID != c.AppID || cl.Side != "A" {
+		t.Fatalf("code ticket: %+v %v", cl, err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"code": c.Code})
+	res2, err := http.Post(srv.URL+"/rendezvous/redeem", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res2.Body.Close()
+	var r struct{ AppID, Ticket string }
+	_ = json.NewDecoder(res2.Body).Decode(&r)
+	if cl, err := iss.Verify(r.Ticket); err != nil || cl.AppID != c.AppID || cl.Side != "B" {
+		t.Fatalf("redeem ticket: %+v %v", cl, err)
+	}
+}
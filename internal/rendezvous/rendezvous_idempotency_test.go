@@ -0,0 +1,58 @@
+// internal/rendezvous/rendezvous_idempotency_test.go
+package rendezvous_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+)
+
+func TestIdempotencyKeyReplaysCode(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute).Idempotency(time.Minute)
+	h := http.StripPrefix("/rendezvous", s.Routes())
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/rendezvous/code", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(rendezvous.IdempotencyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	bodyOf := func(rr *httptest.ResponseRecorder) string {
+		b, _ := io.ReadAll(rr.Body)
+		return string(b)
+	}
+
+	first := post("k-1", "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first: %d", first.Code)
+	}
+	firstBody := bodyOf(first)
+	again := post("k-1", "")
+	if again.Code != http.StatusOK || bodyOf(again) != firstBody || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay: %d %q", again.Code, again.Header())
+	}
+	if s.Len() != 1 {
+		t.Fatalf("replay minted a new code: %d held", s.Len())
+	}
+	if rr := post("k-1", `{"format":"words"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with another body: want 422, got %d", rr.Code)
+	}
+	if rr := post("k-2", ""); rr.Code != http.StatusOK || bodyOf(rr) == firstBody {
+		t.Fatalf("new key: %d", rr.Code)
+	}
+	if rr := post("", ""); rr.Code != http.StatusOK || s.Len() != 3 {
+		t.Fatalf("no key: %d, %d held", rr.Code, s.Len())
+	}
+	if rr := post("bad key", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid key: want 400, got %d", rr.Code)
+	}
+}
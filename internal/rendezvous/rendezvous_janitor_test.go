@@ -3,11 +3,13 @@ package rendezvous
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
 
-// Verifies: after TTL passes and the sweep runs, old codes are gone (Redeem => errGone).
+// Verifies: after TTL passes and the sweep runs, old codes are gone (Redeem => ErrGone).
 func TestJanitorSweepRemovesExpired(t *testing.T) {
 	ttl := 30 * time.Millisecond
 	s := NewStore(ttl)
@@ -29,10 +31,10 @@ func TestJanitorSweepRemovesExpired(t *testing.T) {
 	// Run a manual sweep (instead of waiting for the 1-minute janitor tick)
 	s.sweep(time.Now())
 
-	// All codes should now be gone (Redeem returns errGone)
+	// All codes should now be gone (Redeem returns ErrGone)
 	for _, c := range codes {
-		if _, _, err := s.Redeem(context.Background(), c); !errors.Is(err, errGone) {
-			t.Fatalf("expected errGone for code %q after sweep, got %v", c, err)
+		if _, _, err := s.Redeem(context.Background(), c); !errors.Is(err, ErrGone) {
+			t.Fatalf("expected ErrGone for code %q after sweep, got %v", c, err)
 		}
 	}
 }
@@ -59,3 +61,38 @@ func TestCreateCodeReclaimsExpiredSlots(t *testing.T) {
 		}
 	}
 }
+
+// Verifies: the janitor runs without Lease leadership, so a replica that never
+// leads still expires its own codes and gives owners their quota back.
+func TestJanitorFreesOwnerQuota(t *testing.T) {
+	defer func(d time.Duration) { janitorEvery = d }(janitorEvery)
+	janitorEvery = 10 * time.Millisecond
+
+	s := NewStore(20*time.Millisecond).LimitOwners(1, func(*http.Request) string { return "alice" })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartJanitor(ctx)
+
+	h := s.Routes()
+	post := func() int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/code", nil))
+		return rr.Code
+	}
+	if c := post(); c != http.StatusOK {
+		t.Fatalf("first code: %d", c)
+	}
+	if c := post(); c != http.StatusTooManyRequests {
+		t.Fatalf("over quota: want 429, got %d", c)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("janitor left %d codes", n)
+	}
+	if c := post(); c != http.StatusOK {
+		t.Fatalf("after sweep: want 200, got %d", c)
+	}
+}
@@ -0,0 +1,53 @@
+package rendezvous_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+)
+
+func TestOwnerQuota(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute).LimitOwners(2, func(r *http.Request) string { return r.Header.Get("X-Owner") })
+	h := s.Routes()
+	post := func(path, owner, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Owner", owner)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var first struct{ Code string }
+	rr := post("/code", "alice", "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &first)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("code 1: %d", rr.Code)
+	}
+	if rr := post("/codes/batch", "alice", `{"count":2}`); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("batch over quota: want 429, got %d", rr.Code)
+	}
+	if rr := post("/code", "alice", ""); rr.Code != http.StatusOK {
+		t.Fatalf("code 2: %d", rr.Code)
+	}
+	if rr := post("/code", "alice", ""); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("code 3: want 429, got %d", rr.Code)
+	}
+	if rr := post("/code", "bob", ""); rr.Code != http.StatusOK {
+		t.Fatalf("other owner: %d", rr.Code)
+	}
+
+	// redeeming frees a slot
+	if _, _, err := s.Redeem(context.Background(), first.Code); err != nil {
+		t.Fatal(err)
+	}
+	if rr := post("/code", "alice", ""); rr.Code != http.StatusOK {
+		t.Fatalf("after redeem: %d", rr.Code)
+	}
+}
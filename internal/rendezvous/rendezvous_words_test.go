@@ -0,0 +1,62 @@
+package rendezvous_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+)
+
+func TestWordCodeRedeemInsensitive(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute)
+	c, err := s.CreateCodeFormat(context.Background(), rendezvous.FormatWords, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Split(c.Code, "-")); n != 3 {
+		t.Fatalf("want 3 words, got %q", c.Code)
+	}
+
+	// what a user might type: upper case, spaces, an accent
+	typed := strings.ToUpper(strings.ReplaceAll(c.Code, "-", "  "))
+	typed = strings.Replace(typed, "E", "É", 1)
+	appID, _, err := s.Redeem(context.Background(), typed)
+	if err != nil || appID != c.AppID {
+		t.Fatalf("redeem %q: %v", typed, err)
+	}
+	if _, _, err := s.Redeem(context.Background(), c.Code); err == nil {
+		t.Fatal("word code must be single-use")
+	}
+}
+
+func TestWordCodesUniqueUnderLoad(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute)
+	codes, err := s.CreateCodesFormat(context.Background(), rendezvous.MaxBatch, rendezvous.FormatWords, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if seen[c.Code] {
+			t.Fatalf("duplicate live code %q", c.Code)
+		}
+		seen[c.Code] = true
+	}
+}
+
+func TestCreateErrorsAreTyped(t *testing.T) {
+	s := rendezvous.NewStore(time.Minute)
+	ctx := context.Background()
+	if _, err := s.CreateCodeFormat(ctx, rendezvous.FormatWords, 5); !errors.Is(err, rendezvous.ErrFormat) {
+		t.Fatalf("want ErrFormat, got %v", err)
+	}
+	if _, err := s.CreateCodes(ctx, rendezvous.MaxBatch+1); !errors.Is(err, rendezvous.ErrBatchSize) {
+		t.Fatalf("want ErrBatchSize, got %v", err)
+	}
+	if _, _, err := s.Redeem(ctx, "0000"); !errors.Is(err, rendezvous.ErrGone) {
+		t.Fatalf("want ErrGone, got %v", err)
+	}
+}
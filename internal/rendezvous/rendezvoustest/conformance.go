@@ -0,0 +1,132 @@
+// Package rendezvoustest is a conformance suite for rendezvous code stores.
+// Every backend (in-memory, Redis, SQLite, ...) must pass Run.
+package rendezvoustest
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Store is the contract shared by rendezvous backends: codes are minted with
+// a TTL and each code redeems at most once, before it expires.
+type Store interface {
+	CreateCode(ctx context.Context) (code string, appID string, exp time.Time, err error)
+	Redeem(ctx context.Context, code string) (appID string, exp time.Time, err error)
+}
+
+// Run checks single-redeem and TTL semantics against stores built by newStore.
+func Run(t *testing.T, newStore func(ttl time.Duration) Store) {
+	t.Run("SingleRedeem", func(t *testing.T) { testSingleRedeem(t, newStore(time.Minute)) })
+	t.Run("ConcurrentRedeem", func(t *testing.T) { testConcurrentRedeem(t, newStore(time.Minute)) })
+	t.Run("TTL", func(t *testing.T) { testTTL(t, newStore(50*time.Millisecond)) })
+	t.Run("Model", func(t *testing.T) { testModel(t, newStore(time.Minute)) })
+}
+
+func testSingleRedeem(t *testing.T, s Store) {
+	ctx := context.Background()
+	code, appID, exp, err := s.CreateCode(ctx)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	got, gotExp, err := s.Redeem(ctx, code)
+	if err != nil || got != appID || !gotExp.Equal(exp) {
+		t.Fatalf("redeem: got (%v,%v,%v), want (%v,%v,nil)", got, gotExp, err, appID, exp)
+	}
+	if _, _, err := s.Redeem(ctx, code); err == nil {
+		t.Fatal("second redeem succeeded")
+	}
+	if _, _, err := s.Redeem(ctx, ""); err == nil {
+		t.Fatal("empty code redeemed")
+	}
+}
+
+func testConcurrentRedeem(t *testing.T, s Store) {
+	ctx := context.Background()
+	code, _, _, err := s.CreateCode(ctx)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := s.Redeem(ctx, code); err == nil {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := wins.Load(); n != 1 {
+		t.Fatalf("code redeemed %d times, want exactly once", n)
+	}
+}
+
+func testTTL(t *testing.T, s Store) {
+	ctx := context.Background()
+	code, _, exp, err := s.CreateCode(ctx)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	time.Sleep(time.Until(exp) + 20*time.Millisecond)
+	if _, _, err := s.Redeem(ctx, code); err == nil {
+		t.Fatal("expired code redeemed")
+	}
+}
+
+// testModel drives the store with a random op sequence and compares every
+// result with a map of live codes. The seed is logged for reproduction.
+func testModel(t *testing.T, s Store) {
+	ctx := context.Background()
+	seed := rand.Uint64()
+	t.Logf("seed %d", seed)
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	live := map[string]string{}
+	var used []string
+	for i := 0; i < 2000; i++ {
+		switch op := rng.IntN(4); {
+		case op == 0 || len(live) == 0:
+			code, appID, _, err := s.CreateCode(ctx)
+			if err != nil {
+				continue // keyspace collision; nothing changed
+			}
+			if _, dup := live[code]; dup {
+				t.Fatalf("op %d: code %s minted while still live", i, code)
+			}
+			live[code] = appID
+		case op == 1:
+			for code, want := range live {
+				got, _, err := s.Redeem(ctx, code)
+				if err != nil || got != want {
+					t.Fatalf("op %d: redeem live %s = (%v,%v), want %v", i, code, got, err, want)
+				}
+				delete(live, code)
+				used = append(used, code)
+				break
+			}
+		case op == 2 && len(used) > 0:
+			code := used[rng.IntN(len(used))]
+			if _, ok := live[code]; ok {
+				continue // re-minted since
+			}
+			if _, _, err := s.Redeem(ctx, code); err == nil {
+				t.Fatalf("op %d: used code %s redeemed again", i, code)
+			}
+		default:
+			code := fmt.Sprintf("%04d", rng.IntN(10000))
+			want, ok := live[code]
+			got, _, err := s.Redeem(ctx, code)
+			if ok != (err == nil) || got != want {
+				t.Fatalf("op %d: redeem %s = (%v,%v), live=%v", i, code, got, err, ok)
+			}
+			delete(live, code)
+		}
+	}
+}
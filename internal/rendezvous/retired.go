@@ -0,0 +1,71 @@
+package rendezvous
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// retiredEntry remembers which room a consumed or expired code pointed to.
+type retiredEntry struct {
+	appID string
+	until time.Time
+}
+
+// WithRoomLookup lets /redeem tell a code that is gone for good (410) from one
+// whose room is still open (409 already_joined): the redeemer lost the race
+// against expiry or another redemption, and the sender has to issue a new
+// code. active reports whether appID's room exists; it runs without the
+// store lock held. Retired codes are remembered for one TTL.
+func (s *Store) WithRoomLookup(active func(appID string) bool) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roomActive = active
+	if s.retired == nil {
+		s.retired = make(map[string]retiredEntry)
+	}
+	return s
+}
+
+// retireLocked remembers code's room after the code left the store. It is a
+// no-op without a room lookup; s.mu must be held.
+func (s *Store) retireLocked(code string, e entry, now time.Time) {
+	if s.roomActive == nil {
+		return
+	}
+	s.retired[code] = retiredEntry{appID: e.appID, until: now.Add(s.ttl)}
+}
+
+// sweepRetiredLocked forgets retired codes past their window; s.mu must be held.
+func (s *Store) sweepRetiredLocked(now time.Time) {
+	for code, r := range s.retired {
+		if now.After(r.until) {
+			delete(s.retired, code)
+		}
+	}
+}
+
+// goneReason adds ErrRoomActive to an ErrGone from redeem when code was
+// recently retired and its room is still open.
+func (s *Store) goneReason(code string, err error) error {
+	if errors.Is(err, ErrGone) && s.roomStillActive(code) {
+		return fmt.Errorf("%w: %w", ErrGone, ErrRoomActive)
+	}
+	return err
+}
+
+func (s *Store) roomStillActive(code string) bool {
+	if code = strings.TrimSpace(code); !codeRe.MatchString(code) {
+		code, _ = normalizeWords(code)
+	}
+	s.mu.Lock()
+	r, ok := s.retired[code]
+	active := s.roomActive
+	s.mu.Unlock()
+	if !ok || active == nil || time.Now().After(r.until) {
+		return false
+	}
+	// outside s.mu: the lookup takes the hub lock, and hub callbacks call into the store
+	return active(r.appID)
+}
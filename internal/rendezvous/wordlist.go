@@ -0,0 +1,38 @@
+package rendezvous
+
+// wordlist is the curated vocabulary for word codes: short, common, ASCII-only
+// and phonetically distinct. Its length must stay a power of two (256).
+var wordlist = [...]string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alien",
+	"alpha", "amber", "angle", "ankle", "apple", "apron", "arena", "armor",
+	"arrow", "atlas", "attic", "audio", "award", "bacon", "badge", "bagel",
+	"baker", "bamboo", "banjo", "barn", "basil", "beach", "beard", "bench",
+	"berry", "bison", "blade", "blank", "blaze", "bloom", "board", "bonus",
+	"boots", "brain", "brass", "bread", "brick", "bride", "brook", "brush",
+	"bucket", "buddy", "bugle", "cabin", "cable", "cactus", "camel", "candy",
+	"canoe", "canyon", "cargo", "carpet", "castle", "cedar", "chalk", "charm",
+	"cherry", "chess", "chief", "chili", "cider", "cinema", "circus", "civic",
+	"clay", "cliff", "clock", "cloud", "clover", "coach", "cobra", "cocoa",
+	"comet", "coral", "couch", "crane", "crater", "crown", "cube", "dairy",
+	"daisy", "dance", "delta", "denim", "desk", "diary", "diner", "disco",
+	"dolphin", "donut", "dragon", "drum", "eagle", "easel", "echo", "elbow",
+	"elder", "ember", "engine", "envoy", "fable", "falcon", "fancy", "farm",
+	"feast", "fern", "ferry", "fiber", "field", "flame", "flute", "focus",
+	"forest", "fossil", "frost", "fruit", "galaxy", "garden", "gecko", "giant",
+	"ginger", "glove", "goose", "grape", "gravel", "guitar", "hammer", "harbor",
+	"hazel", "helmet", "hero", "honey", "hotel", "husky", "igloo", "index",
+	"iris", "ivory", "jacket", "jaguar", "jelly", "jewel", "jockey", "juice",
+	"jungle", "kayak", "kettle", "koala", "ladder", "lagoon", "lamp", "laser",
+	"lemon", "lilac", "lily", "lion", "lobby", "lotus", "lunar", "magnet",
+	"mango", "maple", "marble", "meadow", "melon", "metal", "mint", "mirror",
+	"moose", "motor", "muffin", "nectar", "noble", "novel", "nugget", "oasis",
+	"ocean", "olive", "onion", "opera", "orbit", "otter", "owl", "paddle",
+	"palace", "panda", "paper", "parrot", "peach", "pearl", "pepper", "piano",
+	"pilot", "pixel", "planet", "plaza", "pony", "poppy", "potato", "prism",
+	"pumpkin", "puzzle", "quail", "quartz", "quiet", "rabbit", "radar", "radio",
+	"raven", "reef", "ribbon", "river", "robin", "rocket", "rose", "ruby",
+	"saddle", "salad", "salmon", "sandal", "satin", "scarf", "shadow", "shell",
+	"silver", "sketch", "sleigh", "socket", "sofa", "spider", "spring", "squid",
+	"stable", "stamp", "statue", "storm", "sugar", "summit", "sunny", "swan",
+	"table", "tango", "teapot", "tiger", "timber", "toast", "tomato", "topaz",
+}
@@ -0,0 +1,63 @@
+package rendezvous
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Format selects the shape of a rendezvous code.
+type Format string
+
+const (
+	FormatNumeric Format = "numeric" // 4 digits (default)
+	FormatWords   Format = "words"   // 2–3 words from wordlist, e.g. "otter-lemon"
+)
+
+// wordsRe matches a normalized word code.
+var wordsRe = regexp.MustCompile(`^[a-z]+(-[a-z]+){1,2}$`)
+
+var wordSet = func() map[string]struct{} {
+	m := make(map[string]struct{}, len(wordlist))
+	for _, w := range wordlist {
+		m[w] = struct{}{}
+	}
+	return m
+}()
+
+// foldDiacritics maps common accented Latin letters to their ASCII base.
+var foldDiacritics = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+)
+
+// normalizeWords turns user input like " Otter LÉMON " or "otter_lemon" into
+// "otter-lemon". It reports false if the result is not made of known words.
+func normalizeWords(in string) (string, bool) {
+	s := foldDiacritics.Replace(strings.ToLower(strings.TrimSpace(in)))
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == ' ' || r == '_' || r == '.' || r == '\t'
+	})
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", false
+	}
+	for _, p := range parts {
+		if _, ok := wordSet[p]; !ok {
+			return "", false
+		}
+	}
+	code := strings.Join(parts, "-")
+	return code, wordsRe.MatchString(code)
+}
+
+// wordCode builds an n-word code from random bytes (one byte per word).
+func wordCode(rnd uint32, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = wordlist[rnd&0xff]
+		rnd >>= 8
+	}
+	return strings.Join(parts, "-")
+}
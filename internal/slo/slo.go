@@ -0,0 +1,209 @@
+// Package slo derives service-level indicators in-process over a sliding
+// window, so alerts and small deployments don't need range-vector PromQL:
+// pairing success ratio, relay latency p99 and the WS abnormal close ratio.
+package slo
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+// DefaultWindow is the sliding window the indicators cover.
+const DefaultWindow = 5 * time.Minute
+
+// slots is the window's resolution: events age out one slot at a time.
+const slots = 30
+
+// relayBuckets is the number of relay latency bucket bounds.
+const relayBuckets = 15
+
+// relayBounds are the upper bounds of the relay latency buckets (100µs
+// doubling up to ~1.6s); the p99 is reported as a bucket bound.
+var relayBounds = func() []float64 {
+	b := make([]float64, relayBuckets)
+	for i := range b {
+		b[i] = 0.0001 * math.Pow(2, float64(i))
+	}
+	return b
+}()
+
+type slot struct {
+	epoch                 int64 // slot number since the unix epoch; stale slots are reused
+	pairOK, pairFailed    int64
+	closedOK, closedAbnrm int64
+	relay                 [relayBuckets + 1]int64 // per relayBounds, plus overflow
+}
+
+// Tracker counts events into a ring of slots. Its methods are safe for
+// concurrent use and do nothing on a nil Tracker.
+type Tracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	slotDur time.Duration
+	ring    [slots]slot
+	pending map[string]bool // rooms with a lone peer that hasn't been paired yet
+}
+
+// New returns a tracker over window (<= 0 means DefaultWindow).
+func New(window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Tracker{window: window, slotDur: window / slots, pending: make(map[string]bool)}
+}
+
+// slotLocked returns the current slot, resetting it if it is stale.
+func (t *Tracker) slotLocked(now time.Time) *slot {
+	epoch := now.UnixNano() / int64(t.slotDur)
+	s := &t.ring[epoch%slots]
+	if s.epoch != epoch {
+		*s = slot{epoch: epoch}
+	}
+	return s
+}
+
+// Transition follows room lifecycles; register it with hub.OnTransition. A
+// room whose first peer joined counts as a success once it pairs and as a
+// failure if it closes (or is evicted) before that.
+func (t *Tracker) Transition(appID string, from, to hub.State) {
+	t.transition(time.Now(), appID, from, to)
+}
+
+func (t *Tracker) transition(now time.Time, appID string, from, to hub.State) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case to == hub.StateHalfJoined && from == hub.StateCreated:
+		t.pending[appID] = true
+	case to == hub.StatePaired && t.pending[appID]:
+		delete(t.pending, appID)
+		t.slotLocked(now).pairOK++
+	case to == hub.StateClosed && t.pending[appID]:
+		delete(t.pending, appID)
+		t.slotLocked(now).pairFailed++
+	}
+}
+
+// SessionEnded counts a finished WS session; abnormal means it ended
+// without a close frame (read error or timeout).
+func (t *Tracker) SessionEnded(abnormal bool) { t.sessionEnded(time.Now(), abnormal) }
+
+func (t *Tracker) sessionEnded(now time.Time, abnormal bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.slotLocked(now); abnormal {
+		s.closedAbnrm++
+	} else {
+		s.closedOK++
+	}
+}
+
+// Relay records the time one signaling frame took to relay.
+func (t *Tracker) Relay(d time.Duration) { t.relay(time.Now(), d) }
+
+func (t *Tracker) relay(now time.Time, d time.Duration) {
+	if t == nil {
+		return
+	}
+	i, sec := 0, d.Seconds()
+	for i < len(relayBounds) && sec > relayBounds[i] {
+		i++
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.slotLocked(now).relay[i]++
+}
+
+// Snapshot is the indicators over the window. Ratios are NaN while there
+// were no events to derive them from.
+type Snapshot struct {
+	PairingSuccess float64 // paired / (paired + closed before pairing)
+	AbnormalClose  float64 // abnormal / all ended WS sessions
+	RelayP99       float64 // seconds; +Inf if above the largest bucket
+}
+
+// Snapshot derives the indicators as of now.
+func (t *Tracker) Snapshot() Snapshot { return t.snapshot(time.Now()) }
+
+func (t *Tracker) snapshot(now time.Time) Snapshot {
+	t.mu.Lock()
+	var sum slot
+	cur := now.UnixNano() / int64(t.slotDur)
+	for i := range t.ring {
+		s := &t.ring[i]
+		if s.epoch <= cur-slots || s.epoch > cur {
+			continue
+		}
+		sum.pairOK += s.pairOK
+		sum.pairFailed += s.pairFailed
+		sum.closedOK += s.closedOK
+		sum.closedAbnrm += s.closedAbnrm
+		for j, n := range s.relay {
+			sum.relay[j] += n
+		}
+	}
+	t.mu.Unlock()
+	return Snapshot{
+		PairingSuccess: ratio(sum.pairOK, sum.pairOK+sum.pairFailed),
+		AbnormalClose:  ratio(sum.closedAbnrm, sum.closedOK+sum.closedAbnrm),
+		RelayP99:       quantile(sum.relay[:], 0.99),
+	}
+}
+
+func ratio(n, d int64) float64 {
+	if d == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(d)
+}
+
+// quantile returns the upper bound of the bucket holding the q-quantile.
+func quantile(counts []int64, q float64) float64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, n := range counts {
+		if seen += n; seen >= rank {
+			if i < len(relayBounds) {
+				return relayBounds[i]
+			}
+			break
+		}
+	}
+	return math.Inf(1)
+}
+
+// Collectors returns gauges reading the tracker at scrape time; register
+// them with metrics.Metrics.Registry.
+func (t *Tracker) Collectors() []prometheus.Collector {
+	gauge := func(name, help string, pick func(Snapshot) float64) prometheus.Collector {
+		help = fmt.Sprintf("%s over the last %s (NaN without data)", help, t.window)
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 { return pick(t.Snapshot()) })
+	}
+	return []prometheus.Collector{
+		gauge("nt_sli_pairing_success_ratio", "Rooms that paired over rooms whose first peer joined",
+			func(s Snapshot) float64 { return s.PairingSuccess }),
+		gauge("nt_sli_ws_abnormal_close_ratio", "WS sessions that ended without a close frame over all ended sessions",
+			func(s Snapshot) float64 { return s.AbnormalClose }),
+		gauge("nt_sli_relay_latency_p99_seconds", "p99 of signaling frame relay time (bucket upper bound)",
+			func(s Snapshot) float64 { return s.RelayP99 }),
+	}
+}
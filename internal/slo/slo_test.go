@@ -0,0 +1,73 @@
+package slo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+func TestPairingSuccess(t *testing.T) {
+	tr := New(time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	if s := tr.snapshot(now); !math.IsNaN(s.PairingSuccess) {
+		t.Fatalf("empty window = %v, want NaN", s.PairingSuccess)
+	}
+	// three rooms get a first peer; two pair, one closes alone
+	for _, id := range []string{"a", "b", "c"} {
+		tr.transition(now, id, hub.StateCreated, hub.StateHalfJoined)
+	}
+	tr.transition(now, "a", hub.StateHalfJoined, hub.StatePaired)
+	tr.transition(now, "b", hub.StateHalfJoined, hub.StatePaired)
+	tr.transition(now, "c", hub.StateClosing, hub.StateClosed)
+	// a peer leaving and rejoining a paired room is not a new attempt
+	tr.transition(now, "a", hub.StatePaired, hub.StateHalfJoined)
+	tr.transition(now, "a", hub.StateHalfJoined, hub.StatePaired)
+	tr.transition(now, "a", hub.StateClosing, hub.StateClosed)
+
+	if got := tr.snapshot(now).PairingSuccess; math.Abs(got-2.0/3) > 1e-9 {
+		t.Fatalf("success = %v, want 2/3", got)
+	}
+	if len(tr.pending) != 0 {
+		t.Fatalf("pending rooms leaked: %v", tr.pending)
+	}
+	// events age out of the window
+	if s := tr.snapshot(now.Add(time.Minute + time.Second)); !math.IsNaN(s.PairingSuccess) {
+		t.Fatalf("after window = %v, want NaN", s.PairingSuccess)
+	}
+}
+
+func TestAbnormalCloseAndRelayP99(t *testing.T) {
+	tr := New(time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 9; i++ {
+		tr.sessionEnded(now, false)
+	}
+	tr.sessionEnded(now.Add(10*time.Second), true)
+	if got := tr.snapshot(now.Add(10 * time.Second)).AbnormalClose; got != 0.1 {
+		t.Fatalf("abnormal = %v, want 0.1", got)
+	}
+
+	for i := 0; i < 99; i++ {
+		tr.relay(now, 50*time.Microsecond)
+	}
+	tr.relay(now, 3*time.Millisecond)
+	if got := tr.snapshot(now).RelayP99; got != 0.0001 {
+		t.Fatalf("p99 = %v, want 0.0001", got)
+	}
+	tr.relay(now, 3*time.Millisecond)
+	if got := tr.snapshot(now).RelayP99; got != 0.0032 {
+		t.Fatalf("p99 = %v, want 0.0032", got)
+	}
+	tr.relay(now, 10*time.Second)
+	tr.relay(now, 10*time.Second)
+	if got := tr.snapshot(now).RelayP99; !math.IsInf(got, 1) {
+		t.Fatalf("p99 = %v, want +Inf", got)
+	}
+
+	var nilTracker *Tracker
+	nilTracker.Relay(time.Second)
+	nilTracker.SessionEnded(true)
+	nilTracker.Transition("x", hub.StateCreated, hub.StateHalfJoined)
+}
@@ -0,0 +1,86 @@
+package stun
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Echo answers any UDP datagram with the sender's address as JSON:
+// {"ip","port","family":"ipv4"|"ipv6","protocol":"udp"}. It is the plain-text
+// sibling of the STUN server, for clients and support tooling without a STUN
+// stack. A reply is never larger than its request, so the port can't amplify
+// reflection attacks: datagrams shorter than the reply are dropped (send 128
+// bytes of anything).
+type Echo struct {
+	conn net.PacketConn
+	m    *metrics.Metrics
+}
+
+// ListenEcho binds the UDP socket (e.g. ":3479").
+func ListenEcho(addr string) (*Echo, error) {
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Echo{conn: c, m: metrics.Default}, nil
+}
+
+// WithMetrics reports to m instead of metrics.Default. Call before Serve.
+func (e *Echo) WithMetrics(m *metrics.Metrics) *Echo {
+	e.m = m
+	return e
+}
+
+// Addr returns the bound local address.
+func (e *Echo) Addr() net.Addr { return e.conn.LocalAddr() }
+
+// Close releases the socket, e.g. when Serve never ran.
+func (e *Echo) Close() error { return e.conn.Close() }
+
+// Serve answers datagrams until ctx is done or the socket fails.
+func (e *Echo) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = e.conn.Close()
+	}()
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := e.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		udp, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		resp := echoResponse(udp)
+		if n < len(resp) {
+			e.m.WhoamiRequests.WithLabelValues("udp", "short").Inc()
+			continue
+		}
+		e.m.WhoamiRequests.WithLabelValues("udp", "ok").Inc()
+		_, _ = e.conn.WriteTo(resp, from)
+	}
+}
+
+func echoResponse(from *net.UDPAddr) []byte {
+	ap := from.AddrPort()
+	ip := ap.Addr().Unmap()
+	family := "ipv6"
+	if ip.Is4() {
+		family = "ipv4"
+	}
+	b, _ := json.Marshal(struct {
+		IP       string `json:"ip"`
+		Port     uint16 `json:"port"`
+		Family   string `json:"family"`
+		Protocol string `json:"protocol"`
+	}{ip.String(), ap.Port(), family, "udp"})
+	return b
+}
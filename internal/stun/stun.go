@@ -0,0 +1,119 @@
+// Package stun implements a minimal RFC 5389 STUN server that only answers
+// Binding requests with an XOR-MAPPED-ADDRESS. No auth, no TURN.
+package stun
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+const (
+	headerLen   = 20
+	magicCookie = 0x2112A442
+
+	typeBindingRequest  = 0x0001
+	typeBindingResponse = 0x0101
+	attrXORMappedAddr   = 0x0020
+)
+
+var errNotBinding = errors.New("not a STUN binding request")
+
+// Server answers STUN Binding requests on a UDP socket.
+type Server struct {
+	conn net.PacketConn
+	m    *metrics.Metrics
+}
+
+// Listen binds the UDP socket (e.g. ":3478").
+func Listen(addr string) (*Server, error) {
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn: c, m: metrics.Default}, nil
+}
+
+// WithMetrics reports to m instead of metrics.Default. Call before Serve.
+func (s *Server) WithMetrics(m *metrics.Metrics) *Server {
+	s.m = m
+	return s
+}
+
+// Addr returns the bound local address.
+func (s *Server) Addr() net.Addr { return s.conn.LocalAddr() }
+
+// Close releases the socket, e.g. when Serve never ran.
+func (s *Server) Close() error { return s.conn.Close() }
+
+// Serve handles requests until ctx is done or the socket fails.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = s.conn.Close()
+	}()
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		udp, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		resp, err := bindingResponse(buf[:n], udp)
+		if err != nil {
+			s.m.STUNRequests.WithLabelValues("malformed").Inc()
+			continue
+		}
+		s.m.STUNRequests.WithLabelValues("ok").Inc()
+		_, _ = s.conn.WriteTo(resp, from)
+	}
+}
+
+// bindingResponse validates a Binding request and builds the success response.
+func bindingResponse(req []byte, from *net.UDPAddr) ([]byte, error) {
+	if len(req) < headerLen || req[0]&0xC0 != 0 {
+		return nil, errNotBinding
+	}
+	if binary.BigEndian.Uint16(req[0:2]) != typeBindingRequest ||
+		binary.BigEndian.Uint32(req[4:8]) != magicCookie ||
+		int(binary.BigEndian.Uint16(req[2:4])) != len(req)-headerLen {
+		return nil, errNotBinding
+	}
+	txID := req[8:20]
+
+	ip := from.IP.To4()
+	family := byte(0x01)
+	if ip == nil {
+		ip = from.IP.To16()
+		family = 0x02
+	}
+	// XOR-MAPPED-ADDRESS value: 0, family, x-port, x-address
+	val := make([]byte, 4+len(ip))
+	val[1] = family
+	binary.BigEndian.PutUint16(val[2:4], uint16(from.Port)^uint16(magicCookie>>16))
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[0:4], magicCookie)
+	copy(key[4:], txID)
+	for i := range ip {
+		val[4+i] = ip[i] ^ key[i]
+	}
+
+	out := make([]byte, headerLen+4+len(val))
+	binary.BigEndian.PutUint16(out[0:2], typeBindingResponse)
+	binary.BigEndian.PutUint16(out[2:4], uint16(4+len(val)))
+	binary.BigEndian.PutUint32(out[4:8], magicCookie)
+	copy(out[8:20], txID)
+	binary.BigEndian.PutUint16(out[20:22], attrXORMappedAddr)
+	binary.BigEndian.PutUint16(out[22:24], uint16(len(val)))
+	copy(out[24:], val)
+	return out, nil
+}
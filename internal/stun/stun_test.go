@@ -0,0 +1,103 @@
+package stun_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/stun"
+)
+
+func TestBindingRequest(t *testing.T) {
+	s, err := stun.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = s.Serve(ctx) }()
+
+	c, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:2], 0x0001)
+	binary.BigEndian.PutUint32(req[4:8], 0x2112A442)
+	copy(req[8:], "abcdefghijkl")
+	if _, err := c.Write(req); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 64)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := buf[:n]
+	if binary.BigEndian.Uint16(resp[0:2]) != 0x0101 || string(resp[8:20]) != "abcdefghijkl" {
+		t.Fatalf("bad response header: %x", resp)
+	}
+	if binary.BigEndian.Uint16(resp[20:22]) != 0x0020 {
+		t.Fatalf("missing XOR-MAPPED-ADDRESS: %x", resp)
+	}
+	port := binary.BigEndian.Uint16(resp[26:28]) ^ 0x2112
+	ip := net.IPv4(resp[28]^0x21, resp[29]^0x12, resp[30]^0xA4, resp[31]^0x42)
+	local := c.LocalAddr().(*net.UDPAddr)
+	if int(port) != local.Port || !ip.Equal(local.IP) {
+		t.Fatalf("mapped %s:%d, want %s", ip, port, local)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	e, err := stun.ListenEcho("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = e.Serve(ctx) }()
+
+	c, err := net.Dial("udp", e.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// too short to be answered: no amplification
+	if _, err := c.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(make([]byte, 128)); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 256)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		IP       string `json:"ip"`
+		Port     int    `json:"port"`
+		Family   string `json:"family"`
+		Protocol string `json:"protocol"`
+	}
+	if err := json.Unmarshal(buf[:n], &got); err != nil {
+		t.Fatalf("%v: %s", err, buf[:n])
+	}
+	local := c.LocalAddr().(*net.UDPAddr)
+	if got.IP != "127.0.0.1" || got.Port != local.Port || got.Family != "ipv4" || got.Protocol != "udp" {
+		t.Fatalf("got %+v, want %s", got, local)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := c.Read(buf); err == nil {
+		t.Fatal("short datagram was answered")
+	}
+}
@@ -0,0 +1,164 @@
+// Package ticket issues and verifies one-time WS connect tickets. Rendezvous
+// hands a ticket to each side instead of asking clients to put the appID in
+// the /ws URL: a ticket is HMAC-signed, bound to one room and side, expires
+// after a short TTL and is accepted once, so a ticket leaked through a log or
+// a proxy is useless by the time anyone reads it.
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a ticket stays valid.
+const DefaultTTL = time.Minute
+
+// Errors returned by Verify and Redeem; match with errors.Is.
+var (
+	ErrInvalid = errors.New("invalid ticket")
+	ErrExpired = errors.New("ticket expired")
+	ErrUsed    = errors.New("ticket already used")
+)
+
+// Claims are what a ticket grants.
+type Claims struct {
+	AppID   string
+	Side    string
+	Expires time.Time
+	ID      string // random nonce; the single-use key
+}
+
+// wire is the signed payload.
+type wire struct {
+	AppID string `json:"a"`
+	Side  string `json:"s"`
+	ID    string `json:"n"`
+	Exp   int64  `json:"e"` // unix seconds
+}
+
+// Used remembers consumed ticket IDs until they expire. Consume reports
+// false if id was consumed before.
+type Used interface {
+	Consume(id string, until time.Time) bool
+}
+
+// Issuer mints and checks tickets with one secret.
+type Issuer struct {
+	secret []byte
+	ttl    time.Duration
+	used   Used
+}
+
+// New returns an issuer signing with secret; tickets live for ttl (<= 0:
+// DefaultTTL). Consumed tickets are remembered in memory, which makes them
+// single-use per instance; use WithUsed to share that across replicas.
+func New(secret []byte, ttl time.Duration) *Issuer {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Issuer{secret: secret, ttl: ttl, used: NewMemory()}
+}
+
+// WithUsed replaces the in-memory record of consumed tickets.
+func (i *Issuer) WithUsed(u Used) *Issuer {
+	i.used = u
+	return i
+}
+
+// TTL returns how long new tickets stay valid.
+func (i *Issuer) TTL() time.Duration { return i.ttl }
+
+// Issue mints a ticket for side of appID.
+func (i *Issuer) Issue(appID, side string) (string, error) {
+	var n [12]byte
+	if _, err := rand.Read(n[:]); err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(wire{AppID: appID, Side: side, ID: base64.RawURLEncoding.EncodeToString(n[:]), Exp: time.Now().Add(i.ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	return payload + "." + i.sign(payload), nil
+}
+
+// Verify checks t's signature and expiry without consuming it.
+func (i *Issuer) Verify(t string) (Claims, error) {
+	payload, sig, ok := strings.Cut(t, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(i.sign(payload))) {
+		return Claims{}, ErrInvalid
+	}
+	body, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	var w wire
+	if json.Unmarshal(body, &w) != nil || w.AppID == "" || w.Side == "" || w.ID == "" {
+		return Claims{}, ErrInvalid
+	}
+	c := Claims{AppID: w.AppID, Side: w.Side, ID: w.ID, Expires: time.Unix(w.Exp, 0)}
+	if time.Now().After(c.Expires) {
+		return Claims{}, ErrExpired
+	}
+	return c, nil
+}
+
+// Redeem consumes a verified ticket; the second call for the same ticket
+// returns ErrUsed.
+func (i *Issuer) Redeem(c Claims) error {
+	if !i.used.Consume(c.ID, c.Expires) {
+		return ErrUsed
+	}
+	return nil
+}
+
+func (i *Issuer) sign(payload string) string {
+	m := hmac.New(sha256.New, i.secret)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// Memory is the in-process Used. Entries are dropped once their ticket has
+// expired, at most once a second.
+type Memory struct {
+	mu    sync.Mutex
+	ids   map[string]time.Time
+	swept time.Time
+}
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory { return &Memory{ids: make(map[string]time.Time)} }
+
+// Consume implements Used.
+func (m *Memory) Consume(id string, until time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.swept) >= time.Second {
+		for k, u := range m.ids {
+			if now.After(u) {
+				delete(m.ids, k)
+			}
+		}
+		m.swept = now
+	}
+	if _, ok := m.ids[id]; ok {
+		return false
+	}
+	m.ids[id] = until
+	return true
+}
+
+// Len returns the number of remembered tickets.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.ids)
+}
@@ -0,0 +1,71 @@
+package ticket_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+)
+
+func TestIssueVerifyRedeem(t *testing.T) {
+	iss := ticket.New([]byte("k"), time.Minute)
+	tk, err := iss.Issue("room", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := iss.Verify(tk)
+	if err != nil || c.AppID != "room" || c.Side != "B" {
+		t.Fatalf("verify: %+v %v", c, err)
+	}
+	if err := iss.Redeem(c); err != nil {
+		t.Fatalf("first redeem: %v", err)
+	}
+	if err := iss.Redeem(c); !errors.Is(err, ticket.ErrUsed) {
+		t.Fatalf("second redeem: want ErrUsed, got %v", err)
+	}
+
+	for name, bad := range map[string]string{
+		"empty":      "",
+		"no sig":     tk[:len(tk)-44],
+		"tampered":   "x" + tk[1:],
+		"other key":  must(ticket.New([]byte("other"), time.Minute).Issue("room", "B")),
+		"not base64": "!!!." + tk[len(tk)-43:],
+	} {
+		if _, err := iss.Verify(bad); !errors.Is(err, ticket.ErrInvalid) {
+			t.Errorf("%s: want ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	iss := ticket.New([]byte("k"), -time.Second) // <= 0: DefaultTTL
+	if iss.TTL() != ticket.DefaultTTL {
+		t.Fatalf("TTL %v, want default", iss.TTL())
+	}
+	iss = ticket.New([]byte("k"), time.Nanosecond)
+	tk, _ := iss.Issue("room", "A")
+	time.Sleep(1100 * time.Millisecond) // expiry has second resolution
+	if _, err := iss.Verify(tk); !errors.Is(err, ticket.ErrExpired) {
+		t.Fatalf("want ErrExpired, got %v", err)
+	}
+}
+
+func TestMemorySweeps(t *testing.T) {
+	m := ticket.NewMemory()
+	if !m.Consume("a", time.Now().Add(-time.Second)) || m.Consume("a", time.Now()) {
+		t.Fatal("a: want first consume only")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	m.Consume("b", time.Now().Add(time.Minute))
+	if n := m.Len(); n != 1 {
+		t.Fatalf("len %d after sweep, want 1", n)
+	}
+}
+
+func must(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+// Package usage attributes signaling traffic to tenants (API keys) and keeps
+// hourly totals for usage reports.
+package usage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Retention is how far back a Report can reach.
+const Retention = 7 * 24 * time.Hour
+
+const retentionHours = int64(Retention / time.Hour)
+
+// Tenants without a known API key are reported under these names.
+const (
+	Anonymous = "anonymous" // no API key
+	Unknown   = "unknown"   // a key that isn't configured
+)
+
+// Counts are the totals of one tenant over some period.
+type Counts struct {
+	MessagesIn  int64 `json:"messagesIn"`
+	MessagesOut int64 `json:"messagesOut"`
+	BytesIn     int64 `json:"bytesIn"`
+	BytesOut    int64 `json:"bytesOut"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.MessagesIn += o.MessagesIn
+	c.MessagesOut += o.MessagesOut
+	c.BytesIn += o.BytesIn
+	c.BytesOut += o.BytesOut
+}
+
+// Row is one tenant's usage in the bucket starting at Start.
+type Row struct {
+	Start  time.Time `json:"start"`
+	Tenant string    `json:"tenant"`
+	Counts
+}
+
+// Tracker counts frames per tenant into hourly buckets. Tenant names must
+// come from a bounded set (configured keys, Anonymous, Unknown): they are
+// metric labels.
+type Tracker struct {
+	mu      sync.Mutex
+	buckets [retentionHours]hourBucket
+	m       *metrics.Metrics
+}
+
+type hourBucket struct {
+	hour    int64 // unix hour this bucket holds; stale buckets are reused
+	tenants map[string]*Counts
+}
+
+func New() *Tracker { return &Tracker{m: metrics.Default} }
+
+// WithMetrics reports to m instead of metrics.Default.
+func (t *Tracker) WithMetrics(m *metrics.Metrics) *Tracker {
+	t.m = m
+	return t
+}
+
+// Record counts one frame of size bytes received from ("in") or sent to
+// ("out") a client of tenant. A nil Tracker records nothing.
+func (t *Tracker) Record(tenant, dir string, size int) {
+	t.record(time.Now(), tenant, dir, size)
+}
+
+func (t *Tracker) record(at time.Time, tenant, dir string, size int) {
+	if t == nil {
+		return
+	}
+	t.m.TenantMessages.WithLabelValues(tenant, dir).Inc()
+	t.m.TenantBytes.WithLabelValues(tenant, dir).Add(float64(size))
+	hour := at.Unix() / 3600
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[hour%retentionHours]
+	if b.hour != hour || b.tenants == nil {
+		b.hour, b.tenants = hour, make(map[string]*Counts)
+	}
+	c := b.tenants[tenant]
+	if c == nil {
+		c = new(Counts)
+		b.tenants[tenant] = c
+	}
+	if dir == "in" {
+		c.MessagesIn++
+		c.BytesIn += int64(size)
+	} else {
+		c.MessagesOut++
+		c.BytesOut += int64(size)
+	}
+}
+
+// Report sums the hours in [from, to) into buckets of step (rounded to whole
+// hours, at least one), ordered by start then tenant. tenant "" reports all.
+// Hours older than Retention are gone.
+func (t *Tracker) Report(from, to time.Time, step time.Duration, tenant string) []Row {
+	stepH := int64(step / time.Hour)
+	if stepH < 1 {
+		stepH = 1
+	}
+	first, last := from.Unix()/3600, (to.Unix()-1)/3600
+	agg := make(map[int64]map[string]*Counts)
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.tenants == nil || b.hour < first || b.hour > last {
+			continue
+		}
+		start := first + (b.hour-first)/stepH*stepH
+		for name, c := range b.tenants {
+			if tenant != "" && name != tenant {
+				continue
+			}
+			if agg[start] == nil {
+				agg[start] = make(map[string]*Counts)
+			}
+			if agg[start][name] == nil {
+				agg[start][name] = new(Counts)
+			}
+			agg[start][name].add(*c)
+		}
+	}
+	t.mu.Unlock()
+
+	out := []Row{}
+	for start, tenants := range agg {
+		for name, c := range tenants {
+			out = append(out, Row{Start: time.Unix(start*3600, 0).UTC(), Tenant: name, Counts: *c})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Start.Equal(out[j].Start) {
+			return out[i].Start.Before(out[j].Start)
+		}
+		return out[i].Tenant < out[j].Tenant
+	})
+	return out
+}
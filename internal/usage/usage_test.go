@@ -0,0 +1,29 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportBuckets(t *testing.T) {
+	u := New()
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	u.record(day.Add(10*time.Minute), "acme", "in", 100)
+	u.record(day.Add(20*time.Minute), "acme", "out", 100)
+	u.record(day.Add(90*time.Minute), "acme", "in", 50)
+	u.record(day.Add(90*time.Minute), Anonymous, "in", 7)
+	u.record(day.Add(-time.Hour), "acme", "in", 1) // before from
+
+	hourly := u.Report(day, day.Add(24*time.Hour), time.Hour, "")
+	if len(hourly) != 3 {
+		t.Fatalf("hourly rows: %+v", hourly)
+	}
+	if r := hourly[0]; r.Tenant != "acme" || r.MessagesIn != 1 || r.MessagesOut != 1 || r.BytesIn != 100 || r.BytesOut != 100 {
+		t.Fatalf("first hour: %+v", r)
+	}
+
+	daily := u.Report(day, day.Add(24*time.Hour), 24*time.Hour, "acme")
+	if len(daily) != 1 || !daily[0].Start.Equal(day) || daily[0].MessagesIn != 2 || daily[0].BytesIn != 150 {
+		t.Fatalf("daily acme: %+v", daily)
+	}
+}
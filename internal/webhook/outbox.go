@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+)
+
+// outboxKind is the persist kind (and key prefix) of outbox deliveries.
+const outboxKind = "webhook"
+
+const (
+	sweepEvery         = time.Second
+	outboxRetryBase    = time.Second
+	DefaultMaxAttempts = 8
+)
+
+// ErrNoOutbox is returned by the outbox inspection methods when the
+// dispatcher is not backed by an outbox.
+var ErrNoOutbox = errors.New("webhook outbox not enabled")
+
+// Delivery is one event in the outbox. It is deleted once delivered; after
+// maxAttempts failures it is kept as dead-lettered until retried.
+type Delivery struct {
+	ID        string    `json:"id"`
+	Event     Event     `json:"event"`
+	Attempts  int       `json:"attempts"`
+	NextAt    time.Time `json:"nextAt"`
+	LastError string    `json:"lastError,omitempty"`
+	Dead      bool      `json:"dead,omitempty"`
+}
+
+// WithOutbox persists every event in kv before delivery, so pending deliveries
+// survive a restart. Failed deliveries are retried with jittered exponential
+// backoff and dead-lettered after maxAttempts (<= 0 uses DefaultMaxAttempts).
+// Call before Start.
+func (d *Dispatcher) WithOutbox(kv persist.KV, maxAttempts int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	d.outbox, d.maxAttempts = kv, maxAttempts
+	return d
+}
+
+func (d *Dispatcher) store(ev Event) (string, error) {
+	rec := Delivery{ID: uuid.NewString(), Event: ev, NextAt: time.Now().UTC()}
+	return rec.ID, d.save(rec)
+}
+
+func (d *Dispatcher) save(rec Delivery) error {
+	b, err := persist.Wrap(outboxKind, rec)
+	if err != nil {
+		return err
+	}
+	return d.outbox.Put(outboxKind+"/"+rec.ID, b)
+}
+
+func (d *Dispatcher) load(id string) (Delivery, error) {
+	var rec Delivery
+	b, err := d.outbox.Get(outboxKind + "/" + id)
+	if err != nil {
+		return rec, err
+	}
+	return rec, persist.Unwrap(b, outboxKind, &rec)
+}
+
+// attempt delivers one outbox entry if it is due.
+func (d *Dispatcher) attempt(ctx context.Context, id string) {
+	rec, err := d.load(id)
+	if err != nil || rec.Dead || time.Now().Before(rec.NextAt) {
+		return
+	}
+	body, err := json.Marshal(rec.Event)
+	if err != nil {
+		return
+	}
+	err = d.post(ctx, body)
+	if err == nil {
+		d.m.WebhookDeliveries.WithLabelValues("ok").Inc()
+		_ = d.outbox.Delete(outboxKind + "/" + id)
+		return
+	}
+	if ctx.Err() != nil {
+		return // shutting down; the attempt doesn't count
+	}
+	rec.Attempts, rec.LastError = rec.Attempts+1, err.Error()
+	if rec.Attempts >= d.maxAttempts {
+		rec.Dead = true
+		d.m.WebhookDeliveries.WithLabelValues("dead").Inc()
+	} else {
+		rec.NextAt = time.Now().UTC().Add(retryDelay(outboxRetryBase, rec.Attempts-1))
+		d.m.WebhookDeliveries.WithLabelValues("retried").Inc()
+	}
+	_ = d.save(rec)
+}
+
+// sweep attempts every due delivery and refreshes the outbox gauges.
+func (d *Dispatcher) sweep(ctx context.Context) {
+	recs, err := d.list()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	var pending, dead int
+	for _, rec := range recs {
+		if rec.Dead {
+			dead++
+			continue
+		}
+		pending++
+		if !now.Before(rec.NextAt) && ctx.Err() == nil {
+			d.attempt(ctx, rec.ID)
+		}
+	}
+	d.m.WebhookOutbox.WithLabelValues("pending").Set(float64(pending))
+	d.m.WebhookOutbox.WithLabelValues("dead").Set(float64(dead))
+}
+
+func (d *Dispatcher) list() ([]Delivery, error) {
+	keys, err := d.outbox.Keys(outboxKind + "/")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Delivery, 0, len(keys))
+	for _, k := range keys {
+		rec, err := d.load(strings.TrimPrefix(k, outboxKind+"/"))
+		if err != nil {
+			continue // deleted concurrently, or unreadable
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// Deliveries lists outbox entries; with dead set, only dead-lettered ones.
+func (d *Dispatcher) Deliveries(dead bool) ([]Delivery, error) {
+	if d == nil || d.outbox == nil {
+		return nil, ErrNoOutbox
+	}
+	all, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+	out := all[:0]
+	for _, rec := range all {
+		if !dead || rec.Dead {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// Retry resets a (typically dead-lettered) delivery so it is attempted again
+// right away with a fresh attempt budget. It returns persist.ErrNotFound for
+// unknown ids.
+func (d *Dispatcher) Retry(id string) error {
+	if d == nil || d.outbox == nil {
+		return ErrNoOutbox
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return persist.ErrNotFound
+	}
+	rec, err := d.load(id)
+	if err != nil {
+		return err
+	}
+	rec.Attempts, rec.Dead, rec.NextAt = 0, false, time.Now().UTC()
+	if err := d.save(rec); err != nil {
+		return err
+	}
+	select {
+	case d.queue <- job{id: id}:
+	default: // the next sweep picks it up
+	}
+	return nil
+}
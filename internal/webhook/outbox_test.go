@@ -0,0 +1,98 @@
+package webhook_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+)
+
+func TestOutboxDeadLetterAndRetry(t *testing.T) {
+	var healthy atomic.Bool
+	var got atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		got.Add(1)
+	}))
+	defer srv.Close()
+
+	kv := persist.NewMem()
+	d := webhook.New(srv.URL, "").WithOutbox(kv, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+
+	d.Emit(webhook.Event{Type: "peer_joined", AppID: "app"})
+	var dead []webhook.Delivery
+	waitFor(t, func() bool {
+		dead, _ = d.Deliveries(true)
+		return len(dead) == 1
+	})
+	if dead[0].Attempts != 1 || dead[0].LastError == "" || dead[0].Event.Type != "peer_joined" {
+		t.Fatalf("bad dead letter: %+v", dead[0])
+	}
+
+	healthy.Store(true)
+	if err := d.Retry(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return got.Load() == 1 })
+	waitFor(t, func() bool {
+		all, _ := d.Deliveries(false)
+		return len(all) == 0
+	})
+	if err := d.Retry(dead[0].ID); err != persist.ErrNotFound {
+		t.Fatalf("retry delivered entry: %v", err)
+	}
+}
+
+func TestOutboxResumesAfterRestart(t *testing.T) {
+	var got atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { got.Add(1) }))
+	defer srv.Close()
+
+	kv := persist.NewMem()
+	// queued by a dispatcher that stopped before delivering
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped := webhook.New(srv.URL, "").WithOutbox(kv, 3)
+	stopped.Emit(webhook.Event{Type: "room_state", AppID: "app"})
+	stopped.Start(ctx)
+	waitFor(t, func() bool {
+		all, _ := stopped.Deliveries(false)
+		return len(all) == 1
+	})
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	webhook.New(srv.URL, "").WithOutbox(kv, 3).Start(ctx)
+	waitFor(t, func() bool { return got.Load() == 1 })
+}
+
+func TestEmitDoesNoIO(t *testing.T) {
+	kv := persist.NewMem()
+	d := webhook.New("http://127.0.0.1:0", "").WithOutbox(kv, 3)
+	d.Emit(webhook.Event{Type: "peer_joined", AppID: "app"})
+	if all, _ := d.Deliveries(false); len(all) != 0 {
+		t.Fatalf("Emit wrote to the outbox: %+v", all)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,196 @@
+// Package webhook delivers room lifecycle events to an external HTTP endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+)
+
+// Event is the JSON body POSTed to the webhook URL.
+type Event struct {
+	Type  string         `json:"type"`
+	AppID string         `json:"appID"`
+	Side  string         `json:"side,omitempty"`
+	At    time.Time      `json:"at"`
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// Dispatcher posts events asynchronously with a few retries.
+// A nil *Dispatcher is valid and drops everything.
+type Dispatcher struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan job
+
+	outbox      persist.KV // nil => in-memory only (lossy on restart)
+	maxAttempts int
+
+	m *metrics.Metrics
+}
+
+// job is either an in-memory event or the id of an outbox delivery.
+type job struct {
+	ev Event
+	id string
+}
+
+// New creates a dispatcher for url. If secret is non-empty, each request carries
+// X-Signature: sha256=<hex hmac of body>.
+func New(url, secret string) *Dispatcher {
+	return &Dispatcher{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan job, 1024),
+		m:      metrics.Default,
+	}
+}
+
+// WithMetrics reports to m instead of metrics.Default. Call before Start.
+func (d *Dispatcher) WithMetrics(m *metrics.Metrics) *Dispatcher {
+	if d != nil {
+		d.m = m
+	}
+	return d
+}
+
+// Emit enqueues ev without blocking or I/O, so it may be called under locks;
+// events are dropped if the queue is full. With an outbox, the delivery loop
+// persists each event before its first attempt, and persists what is still
+// queued when it stops.
+func (d *Dispatcher) Emit(ev Event) {
+	if d == nil {
+		return
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	select {
+	case d.queue <- job{ev: ev}:
+	default:
+		d.m.WebhookDeliveries.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Start runs the delivery loop until ctx is done.
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		var sweep <-chan time.Time
+		if d.outbox != nil {
+			t := time.NewTicker(sweepEvery)
+			defer t.Stop()
+			sweep = t.C
+			d.sweep(ctx) // resume deliveries left over from a previous run
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				d.flush()
+				return
+			case j := <-d.queue:
+				d.run(ctx, j)
+			case <-sweep:
+				d.sweep(ctx)
+			}
+		}
+	}()
+}
+
+// run delivers j, first saving an in-memory event to the outbox if there is one.
+func (d *Dispatcher) run(ctx context.Context, j job) {
+	if j.id == "" && d.outbox != nil {
+		if id, err := d.store(j.ev); err == nil {
+			j = job{id: id}
+		}
+	}
+	if j.id != "" {
+		d.attempt(ctx, j.id)
+	} else {
+		d.deliver(ctx, j.ev)
+	}
+}
+
+// flush saves the events still queued to the outbox, for the next run to
+// deliver. Without an outbox they are lost.
+func (d *Dispatcher) flush() {
+	if d.outbox == nil {
+		return
+	}
+	for {
+		select {
+		case j := <-d.queue:
+			if j.id == "" {
+				_, _ = d.store(j.ev)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, ev Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		if d.post(ctx, body) == nil {
+			d.m.WebhookDeliveries.WithLabelValues("ok").Inc()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay(200*time.Millisecond, attempt)):
+		}
+	}
+	d.m.WebhookDeliveries.WithLabelValues("failed").Inc()
+}
+
+// retryDelay is exponential backoff from base with equal jitter, capped at maxRetryDelay.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	d := maxRetryDelay
+	if attempt < 20 {
+		d = min(base<<attempt, maxRetryDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+const maxRetryDelay = 5 * time.Minute
+
+type statusError int
+
+func (e statusError) Error() string { return "webhook status " + http.StatusText(int(e)) }
+
+func (d *Dispatcher) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(d.secret) > 0 {
+		m := hmac.New(sha256.New, d.secret)
+		m.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(m.Sum(nil)))
+	}
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return statusError(res.StatusCode)
+	}
+	return nil
+}
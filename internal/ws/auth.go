@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// Authenticator verifies a connect credential for one side of a room.
+type Authenticator interface {
+	Authenticate(ctx context.Context, p params.ConnectParams, token string) error
+}
+
+// AuthenticatorFunc adapts a function to Authenticator.
+type AuthenticatorFunc func(ctx context.Context, p params.ConnectParams, token string) error
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, p params.ConnectParams, token string) error {
+	return f(ctx, p, token)
+}
+
+// ErrAuthFailed is returned by the built-in authenticators for a bad token.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// HMACToken returns the credential HMACAuth expects for appID/side:
+// hex(HMAC-SHA256(secret, appID + ":" + side)).
+func HMACToken(secret []byte, appID, side string) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(appID + ":" + side))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// HMACAuth accepts tokens minted by HMACToken with the same secret, so an app
+// backend can authorize a side of a room without talking to this server.
+func HMACAuth(secret []byte) Authenticator {
+	return AuthenticatorFunc(func(_ context.Context, p params.ConnectParams, token string) error {
+		if !hmac.Equal([]byte(token), []byte(HMACToken(secret, p.AppID, p.Side))) {
+			return ErrAuthFailed
+		}
+		return nil
+	})
+}
+
+// WithAuth requires a credential, either as ?token= (checked before the
+// upgrade) or as a first frame {"type":"auth","token":"..."} sent within
+// timeout of the upgrade. The first frame keeps secrets out of proxy logs.
+func WithAuth(a Authenticator, timeout time.Duration) Option {
+	return func(o *wsOpts) { o.auth, o.authTimeout = a, timeout }
+}
+
+// WithTickets accepts one-time tickets from iss (see rendezvous Tickets) as
+// ?ticket=: the ticket names the room and side, so appID and side may be
+// omitted (if given they must match), and it counts as authenticated.
+func WithTickets(iss *ticket.Issuer) Option {
+	return func(o *wsOpts) { o.tickets = iss }
+}
+
+// authFirstFrame reads and verifies the auth frame before the peer is registered.
+func authFirstFrame(ctx context.Context, conn *websocket.Conn, a Authenticator, p params.ConnectParams, timeout time.Duration, m *metrics.Metrics) error {
+	start := time.Now()
+	_ = conn.SetReadDeadline(start.Add(timeout))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		m.WSAuth.WithLabelValues("frame", "timeout").Inc()
+		return err
+	}
+	var f struct {
+		Type  string `json:"type"`
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(msg, &f) != nil || f.Type != "auth" || f.Token == "" {
+		m.WSAuth.WithLabelValues("frame", "failed").Inc()
+		return errors.New("expected auth frame")
+	}
+	if err := a.Authenticate(ctx, p, f.Token); err != nil {
+		m.WSAuth.WithLabelValues("frame", "failed").Inc()
+		return err
+	}
+	m.WSAuth.WithLabelValues("frame", "ok").Inc()
+	m.WSAuthSeconds.Observe(time.Since(start).Seconds())
+	return nil
+}
@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Buffer tuning bounds: frame sizes are counted in power-of-two classes from
+// 64 B to 1 MiB (larger ones share the top class), and tuned buffers are
+// never smaller than minTunedBuffer.
+const (
+	minSizeShift   = 6
+	sizeClasses    = 15
+	minTunedBuffer = 1 << 10
+	// minTuneFrames is how many frames a direction needs before its
+	// percentiles are trusted.
+	minTuneFrames = 1000
+)
+
+// BufferTuner records the sizes of WS frames and derives upgrader buffer
+// sizes from them: the 99th percentile rounded up to a power of two, between
+// minTunedBuffer and the configured size. Most signaling frames are a few
+// KiB, so with the default 64 KiB buffers this can save most of the
+// per-connection buffer memory. In auto mode new connections get the
+// suggested sizes; otherwise the suggestions are only reported (Status).
+// Buffers bound how much is read or written per syscall, not the message
+// size: a larger message is read in several chunks, or written as several
+// frames.
+type BufferTuner struct {
+	read, write int // configured sizes, the upper bound
+	auto        bool
+	in, out     [sizeClasses]atomic.Uint64 // frames per size class
+
+	pools sync.Map // write buffer size -> *sync.Pool (see WithWriteBufferPool)
+}
+
+// NewBufferTuner returns a tuner for the configured read and write buffer
+// sizes; with auto set, NewWSHandler sizes new connections' buffers from it.
+func NewBufferTuner(read, write int, auto bool) *BufferTuner {
+	return &BufferTuner{read: read, write: write, auto: auto}
+}
+
+// WithBufferTuner feeds frame sizes to t and, if t is in auto mode, sizes
+// each new connection's buffers from it instead of WithBuffers.
+func WithBufferTuner(t *BufferTuner) Option {
+	return func(o *wsOpts) { o.tuner = t }
+}
+
+// WithWriteBufferPool shares write buffers between connections: a
+// connection holds one only while writing, instead of for its lifetime.
+func WithWriteBufferPool() Option {
+	return func(o *wsOpts) { o.writePool = true }
+}
+
+func sizeClass(n int) int {
+	c := bits.Len(uint(max(n, 1)-1)) - minSizeShift
+	return min(max(c, 0), sizeClasses-1)
+}
+
+// observe counts a frame of n bytes; dir is "in" (read) or "out" (written).
+func (t *BufferTuner) observe(dir string, n int) {
+	if t == nil {
+		return
+	}
+	if dir == "in" {
+		t.in[sizeClass(n)].Add(1)
+	} else {
+		t.out[sizeClass(n)].Add(1)
+	}
+}
+
+// BufferAdvice is the frame size distribution of one direction and the
+// buffer size it suggests.
+type BufferAdvice struct {
+	Frames     uint64 `json:"frames"`
+	P50        int    `json:"p50"` // upper bounds of the size classes
+	P95        int    `json:"p95"`
+	P99        int    `json:"p99"`
+	Configured int    `json:"configured"`
+	Suggested  int    `json:"suggested"` // Configured until minTuneFrames frames were seen
+	InUse      int    `json:"inUse"`     // what new connections get
+}
+
+// BufferStatus is the tuner's report for /statusz.
+type BufferStatus struct {
+	Auto  bool         `json:"auto"`
+	Read  BufferAdvice `json:"read"`
+	Write BufferAdvice `json:"write"`
+}
+
+// Status reports the observed frame sizes and the suggested buffers.
+func (t *BufferTuner) Status() BufferStatus {
+	return BufferStatus{Auto: t.auto, Read: t.advise(&t.in, t.read), Write: t.advise(&t.out, t.write)}
+}
+
+func (t *BufferTuner) advise(classes *[sizeClasses]atomic.Uint64, configured int) BufferAdvice {
+	var counts [sizeClasses]uint64
+	a := BufferAdvice{Configured: configured, Suggested: configured}
+	for i := range classes {
+		counts[i] = classes[i].Load()
+		a.Frames += counts[i]
+	}
+	if a.Frames > 0 {
+		a.P50, a.P95, a.P99 = percentile(&counts, a.Frames, 0.50), percentile(&counts, a.Frames, 0.95), percentile(&counts, a.Frames, 0.99)
+	}
+	if a.Frames >= minTuneFrames && configured > 0 {
+		a.Suggested = min(max(a.P99, minTunedBuffer), configured)
+	}
+	a.InUse = configured
+	if t.auto {
+		a.InUse = a.Suggested
+	}
+	return a
+}
+
+// percentile returns the upper bound of the size class holding the q-th
+// quantile of total frames.
+func percentile(counts *[sizeClasses]uint64, total uint64, q float64) int {
+	want := uint64(q*float64(total) + 0.5)
+	var seen uint64
+	for i, n := range counts {
+		if seen += n; seen >= want && seen > 0 {
+			return 1 << (i + minSizeShift)
+		}
+	}
+	return 1 << (sizeClasses - 1 + minSizeShift)
+}
+
+// upgrader returns up with the buffer sizes (and write buffer pool) for a
+// new connection.
+func (t *BufferTuner) upgrader(up *websocket.Upgrader, pooled bool) *websocket.Upgrader {
+	u := *up
+	if t != nil && t.auto {
+		st := t.Status()
+		u.ReadBufferSize, u.WriteBufferSize = st.Read.InUse, st.Write.InUse
+	}
+	if pooled {
+		u.WriteBufferPool = writePool(t, u.WriteBufferSize)
+	}
+	return &u
+}
+
+// defaultPools backs writePool for handlers without a tuner.
+var defaultPools sync.Map
+
+// writePool returns the write buffer pool for buffers of size: gorilla
+// wants one pool per buffer size.
+func writePool(t *BufferTuner, size int) websocket.BufferPool {
+	pools := &defaultPools
+	if t != nil {
+		pools = &t.pools
+	}
+	p, _ := pools.LoadOrStore(size, &sync.Pool{})
+	return p.(*sync.Pool)
+}
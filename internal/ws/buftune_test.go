@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBufferTuner(t *testing.T) {
+	bt := NewBufferTuner(64<<10, 64<<10, true)
+	up := &websocket.Upgrader{ReadBufferSize: 64 << 10, WriteBufferSize: 64 << 10}
+	for i := range minTuneFrames - 1 {
+		bt.observe("in", 300+i%1500) // <= 2 KiB
+	}
+	if u := bt.upgrader(up, false); u.ReadBufferSize != 64<<10 {
+		t.Fatalf("tuned before %d frames: %d", minTuneFrames, u.ReadBufferSize)
+	}
+	bt.observe("in", 100<<10)
+
+	st := bt.Status()
+	if st.Read.Frames != minTuneFrames || st.Read.P50 != 1<<10 || st.Read.P99 != 2<<10 {
+		t.Fatalf("read: %+v", st.Read)
+	}
+	if st.Read.Suggested != 2<<10 || st.Read.InUse != 2<<10 {
+		t.Fatalf("read suggestion: %+v", st.Read)
+	}
+	if st.Write.Frames != 0 || st.Write.InUse != 64<<10 {
+		t.Fatalf("write: %+v", st.Write)
+	}
+	u := bt.upgrader(up, true)
+	if u.ReadBufferSize != 2<<10 || u.WriteBufferSize != 64<<10 || u.WriteBufferPool == nil {
+		t.Fatalf("upgrader: read=%d write=%d pool=%v", u.ReadBufferSize, u.WriteBufferSize, u.WriteBufferPool)
+	}
+	if up.ReadBufferSize != 64<<10 {
+		t.Fatal("upgrader modified the shared one")
+	}
+
+	// advisory mode reports but keeps the configured sizes
+	adv := NewBufferTuner(64<<10, 64<<10, false)
+	for range minTuneFrames {
+		adv.observe("out", 10)
+	}
+	if st := adv.Status(); st.Write.Suggested != minTunedBuffer || st.Write.InUse != 64<<10 {
+		t.Fatalf("advisory: %+v", st.Write)
+	}
+	var none *BufferTuner
+	none.observe("in", 1)
+	if u := none.upgrader(up, false); u.ReadBufferSize != 64<<10 || u.WriteBufferPool != nil {
+		t.Fatalf("nil tuner: %+v", u)
+	}
+}
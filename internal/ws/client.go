@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ClientPolicy gates connections on the client's self-reported name/version.
+type ClientPolicy struct {
+	min map[string][]int // clientName -> minimum version
+	raw map[string]string
+}
+
+// ParseClientPolicy parses "name:minVersion[,name:minVersion...]", e.g. "web:1.4.0,ios:2.1".
+func ParseClientPolicy(spec string) (*ClientPolicy, error) {
+	p := &ClientPolicy{min: map[string][]int{}, raw: map[string]string{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, ver, ok := strings.Cut(item, ":")
+		v, vok := parseVersion(ver)
+		if !ok || name == "" || !vok {
+			return nil, fmt.Errorf("client policy: want name:version, got %q", item)
+		}
+		p.min[name], p.raw[name] = v, ver
+	}
+	return p, nil
+}
+
+// check returns a close reason if name/version is below the configured minimum.
+// Unknown names, and clients that don't report a version, are let through.
+func (p *ClientPolicy) check(name, version string) string {
+	if p == nil || name == "" || version == "" {
+		return ""
+	}
+	min, ok := p.min[name]
+	if !ok {
+		return ""
+	}
+	v, ok := parseVersion(version)
+	if !ok || compareVersions(v, min) < 0 {
+		// close reasons are capped at 123 bytes; names/versions are <= 64 each
+		r := fmt.Sprintf("client %s %s unsupported, need >= %s", name, version, p.raw[name])
+		if len(r) > 123 {
+			r = r[:123]
+		}
+		return r
+	}
+	return ""
+}
+
+// parseVersion parses the leading dotted numeric part of v ("1.4.2-beta" -> [1 4 2]).
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	parts := strings.Split(v, ".")
+	out := make([]int, len(parts))
+	for i, s := range parts {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// clientLabels caps the distinct (client, version) metric label pairs; later
+// pairs are reported as "other". Versions are reduced to major.minor.
+type clientLabels struct {
+	mu   sync.Mutex
+	seen map[[2]string]bool
+	max  int
+}
+
+var clientLabelSet = &clientLabels{seen: map[[2]string]bool{}, max: 50}
+
+func (c *clientLabels) labels(name, version string) (string, string) {
+	if name == "" {
+		return "unknown", ""
+	}
+	if v, ok := parseVersion(version); ok {
+		version = strconv.Itoa(v[0])
+		if len(v) > 1 {
+			version += "." + strconv.Itoa(v[1])
+		}
+	} else {
+		version = ""
+	}
+	k := [2]string{name, version}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.seen[k] {
+		if len(c.seen) >= c.max {
+			return "other", ""
+		}
+		c.seen[k] = true
+	}
+	return name, version
+}
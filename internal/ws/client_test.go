@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientPolicy(t *testing.T) {
+	p, err := ParseClientPolicy("web:1.4.0, ios:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, version string
+		reject        bool
+	}{
+		{"web", "1.3.9", true},
+		{"web", "1.4", false},
+		{"web", "v1.10.0-beta", false},
+		{"web", "garbage", true},
+		{"web", "", false}, // unreported version is let through
+		{"ios", "1.99", true},
+		{"android", "0.1", false}, // no policy for this client
+	}
+	for _, c := range cases {
+		if r := p.check(c.name, c.version); (r != "") != c.reject {
+			t.Errorf("%s %s: reason %q, want reject=%v", c.name, c.version, r, c.reject)
+		} else if r != "" && !strings.Contains(r, ">= ") {
+			t.Errorf("close reason not descriptive: %q", r)
+		}
+	}
+	if _, err := ParseClientPolicy("web"); err == nil {
+		t.Fatal("missing version accepted")
+	}
+}
+
+func TestClientLabelsBounded(t *testing.T) {
+	c := &clientLabels{seen: map[[2]string]bool{}, max: 2}
+	if n, v := c.labels("web", "1.4.2"); n != "web" || v != "1.4" {
+		t.Fatalf("got %s %s", n, v)
+	}
+	c.labels("ios", "2.0.0")
+	if n, _ := c.labels("android", "3"); n != "other" {
+		t.Fatalf("label set not bounded: %s", n)
+	}
+	if n, _ := c.labels("web", "1.4.9"); n != "web" {
+		t.Fatal("known pair folded into other")
+	}
+}
@@ -0,0 +1,98 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+)
+
+// debugFeedKeepAlive is how often an idle debug feed sends an SSE comment, so
+// proxies and browsers keep the stream open.
+const debugFeedKeepAlive = 15 * time.Second
+
+// NewDebugFeed serves /debug/room/{appID}/events: a server-sent event stream
+// of what the hub sees in the room (joins, leaves with their reason, state
+// changes, and the type and size of every frame in either direction), one
+// human-readable line per event:
+//
+//	event: frame
+//	data: 14:03:07.412 A → server  offer  1834 B
+//
+// Payloads are never shown. The feed needs no credentials, so mount it in
+// dev mode only.
+func NewDebugFeed(h *hub.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appID := r.PathValue("appID")
+		if appID == "" {
+			http.Error(w, "missing appID", http.StatusBadRequest)
+			return
+		}
+		fl, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		events, dropped, stop := h.Watch(appID)
+		defer stop()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+		hello := "room not open yet"
+		if st, ok := h.RoomState(appID); ok {
+			hello = fmt.Sprintf("room %s, %d peer(s)", st.State, st.Peers)
+		}
+		writeFeed(w, "hello", time.Now(), "watching "+appID+": "+hello)
+		fl.Flush()
+
+		ping := time.NewTicker(debugFeedKeepAlive)
+		defer ping.Stop()
+		var lost uint64
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ping.C:
+				_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			case ev := <-events:
+				if n := dropped(); n > lost {
+					writeFeed(w, "dropped", time.Now(), fmt.Sprintf("%d event(s) dropped, the feed fell behind", n-lost))
+					lost = n
+				}
+				writeFeed(w, ev.Kind, ev.At, describeEvent(ev))
+			}
+			fl.Flush()
+		}
+	})
+}
+
+func writeFeed(w http.ResponseWriter, event string, at time.Time, line string) {
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s %s\n\n", event, at.Format("15:04:05.000"), line)
+}
+
+// describeEvent renders ev as one line for humans.
+func describeEvent(ev hub.WatchEvent) string {
+	switch ev.Kind {
+	case hub.WatchJoin:
+		return ev.Side + " joined"
+	case hub.WatchLeave:
+		if ev.Reason != "" {
+			return ev.Side + " left (" + ev.Reason + ")"
+		}
+		return ev.Side + " left"
+	case hub.WatchState:
+		return fmt.Sprintf("room %s → %s", ev.From, ev.State)
+	case hub.WatchFrame:
+		typ := ev.Type
+		if typ == "" {
+			typ = "(no type)"
+		}
+		if ev.Dir == "in" {
+			return fmt.Sprintf("%s → server  %s  %d B", ev.Side, typ, ev.Size)
+		}
+		return fmt.Sprintf("server → %s  %s  %d B", ev.Side, typ, ev.Size)
+	}
+	return ev.Kind
+}
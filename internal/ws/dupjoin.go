@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+)
+
+// sourceKey keys sourceTag. It changes on restart: tags only need to tell
+// attempts on one instance apart, and peers can't invert them by hashing
+// candidate addresses.
+var sourceKey = func() []byte {
+	k := make([]byte, 32)
+	_, _ = rand.Read(k)
+	return k
+}()
+
+// sourceTag is a short keyed hash of where r comes from (client IP +
+// User-Agent), safe to show to another peer.
+func sourceTag(r *http.Request, clientIP func(*http.Request) string) string {
+	mac := hmac.New(sha256.New, sourceKey)
+	mac.Write([]byte(remoteIP(r, clientIP) + "\x00" + r.UserAgent()))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// duplicateJoin tells side's occupant in appID that r tried to take its side
+// (throttled by the hub) and emits the attempt as a webhook event.
+func duplicateJoin(h *hub.Hub, r *http.Request, appID, side string, cfg *wsOpts) {
+	n, notify := h.DuplicateJoin(appID, side)
+	if !notify {
+		return
+	}
+	src := sourceTag(r, cfg.clientIP)
+	_ = h.Send(appID, side, map[string]any{"type": "duplicate_join_attempt", "side": side, "source": src, "attempts": n})
+	cfg.hooks.Emit(webhook.Event{Type: "duplicate_join_attempt", AppID: appID, Side: side, Data: map[string]any{"source": src, "attempts": n}})
+}
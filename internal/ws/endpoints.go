@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// Endpoint is an alternate signaling URL a client may fail over to. Clients
+// should prefer their own region and otherwise pick by weight.
+type Endpoint struct {
+	URL    string `json:"url"`
+	Region string `json:"region,omitempty"`
+	Weight int    `json:"weight"`
+}
+
+// maxEndpointWeight bounds weights so a typo can't starve every other endpoint.
+const maxEndpointWeight = 100
+
+// ParseEndpoints parses "url[;region=r][;weight=n][,url...]", e.g.
+// "wss://b.example.com/ws;region=eu;weight=3,wss://c.example.com/ws".
+// Weights default to 1.
+func ParseEndpoints(spec string) ([]Endpoint, error) {
+	var out []Endpoint
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ";")
+		e := Endpoint{URL: strings.TrimSpace(parts[0]), Weight: 1}
+		if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return nil, fmt.Errorf("endpoints: want a ws:// or wss:// URL, got %q", e.URL)
+		}
+		for _, p := range parts[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			switch k {
+			case "region":
+				if !params.ValidRegion(v) {
+					return nil, fmt.Errorf("endpoints: %s: invalid region %q", e.URL, v)
+				}
+				e.Region = v
+			case "weight":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > maxEndpointWeight {
+					return nil, fmt.Errorf("endpoints: %s: weight must be 1..%d, got %q", e.URL, maxEndpointWeight, v)
+				}
+				e.Weight = n
+			default:
+				return nil, fmt.Errorf("endpoints: %s: unknown attribute %q", e.URL, k)
+			}
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// EndpointsFromRegions lists the region URLs (see ParseRegionURLs) other than
+// local as equally weighted endpoints, ordered by region.
+func EndpointsFromRegions(urls map[string]string, local string) []Endpoint {
+	var out []Endpoint
+	for region, u := range urls {
+		if region != local {
+			out = append(out, Endpoint{URL: u, Region: region, Weight: 1})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Region < out[j].Region })
+	return out
+}
+
+// WithAlternateEndpoints lists eps in a {"type":"welcome","endpoints":[...]}
+// frame sent to every peer once it is registered, so clients learn where to
+// fail over without a discovery service. No endpoints, no welcome frame.
+func WithAlternateEndpoints(eps []Endpoint) Option {
+	return func(o *wsOpts) { o.endpoints = eps }
+}
@@ -0,0 +1,34 @@
+package ws_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	got, err := ws.ParseEndpoints("wss://b.example.com/ws;region=eu;weight=3, wss://c.example.com/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ws.Endpoint{
+		{URL: "wss://b.example.com/ws", Region: "eu", Weight: 3},
+		{URL: "wss://c.example.com/ws", Weight: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+	for _, bad := range []string{"https://b.example.com/ws", "wss://b.example.com/ws;weight=0", "wss://b.example.com/ws;zone=x"} {
+		if _, err := ws.ParseEndpoints(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestEndpointsFromRegions(t *testing.T) {
+	got := ws.EndpointsFromRegions(map[string]string{"us": "wss://us/ws", "eu": "wss://eu/ws", "ap": "wss://ap/ws"}, "eu")
+	if len(got) != 2 || got[0].Region != "ap" || got[1].Region != "us" {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,175 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// NewFanoutHandler serves fan-out rooms (see hub.JoinFanout) at
+// ?appID=<id>&role=host|viewer. It honours the origin policy, rate limiter,
+// authentication (tokens are checked with the role as side), message size
+// and rate, and heartbeat options of NewWSHandler; the pair-room features
+// (mailbox, glare, parking, ...) don't apply.
+func NewFanoutHandler(h *hub.Hub, allowedOrigins []string, lg *slog.Logger, dev bool, options ...Option) http.Handler {
+	if lg == nil {
+		lg = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	cfg := wsOpts{readBuf: 64 << 10, writeBuf: 64 << 10, maxMsg: 1 << 20, heartbeat: 60 * time.Second, authTimeout: 5 * time.Second, shutdown: context.Background(), m: metrics.Default}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	if cfg.origin == nil {
+		if dev {
+			cfg.origin = AllowAllOrigins
+		} else {
+			cfg.origin = AllowlistPolicy(allowedOrigins)
+		}
+	}
+	up := websocket.Upgrader{
+		CheckOrigin:     func(*http.Request) bool { return true },
+		ReadBufferSize:  cfg.readBuf,
+		WriteBufferSize: cfg.writeBuf,
+		Error:           upgradeError(dev, cfg.m),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		appID, role := q.Get("appID"), q.Get("role")
+		if !cfg.ids.Valid(appID) {
+			http.Error(w, params.ErrAppID.Error(), http.StatusBadRequest)
+			return
+		}
+		if role != hub.RoleHost && role != hub.RoleViewer {
+			http.Error(w, hub.ErrInvalidRole.Error(), http.StatusBadRequest)
+			return
+		}
+		if !cfg.origin.AllowOrigin(r) {
+			http.Error(w, "forbidden origin", http.StatusForbidden)
+			return
+		}
+		if cfg.rl != nil && !cfg.rl.AllowWS(r) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		p := params.ConnectParams{AppID: appID, Side: role, Token: q.Get("token")}
+		authed := cfg.auth == nil
+		if !authed && p.Token != "" {
+			if err := cfg.auth.Authenticate(r.Context(), p, p.Token); err != nil {
+				cfg.m.WSAuth.WithLabelValues("query", "failed").Inc()
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			cfg.m.WSAuth.WithLabelValues("query", "ok").Inc()
+			authed = true
+		}
+		conn, err := cfg.tuner.upgrader(&up, cfg.writePool).Upgrade(w, r, nil)
+		if err != nil {
+			lg.Warn("ws fanout upgrade failed", "err", err, "cause", diagnoseUpgrade(r, err).Cause)
+			return
+		}
+		defer conn.Close()
+		cfg.m.WSConnections.Inc()
+		conn.SetReadLimit(cfg.maxMsg)
+		if !authed {
+			if err := authFirstFrame(r.Context(), conn, cfg.auth, p, cfg.authTimeout, cfg.m); err != nil {
+				_ = conn.WriteJSON(map[string]any{"type": "error", "code": "auth_failed", "message": err.Error()})
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "auth failed"))
+				return
+			}
+			_ = conn.WriteJSON(map[string]any{"type": "auth_ok"})
+		}
+
+		id, err := h.JoinFanout(appID, role, conn)
+		if err != nil {
+			code, closeCode := "room_type", websocket.ClosePolicyViolation
+			switch {
+			case errors.Is(err, hub.ErrHostBusy):
+				code = "host_busy"
+			case errors.Is(err, hub.ErrViewerCap):
+				// viewers come and go: worth retrying
+				code, closeCode = "viewer_cap", websocket.CloseTryAgainLater
+			}
+			_ = conn.WriteJSON(map[string]any{"type": "error", "code": code, "message": err.Error()})
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, code))
+			return
+		}
+		defer h.LeaveFanout(appID, id)
+		n, host, _ := h.Viewers(appID)
+		_ = h.SendFanout(appID, id, map[string]any{"type": "joined", "id": id, "role": role, "viewers": n, "host": host})
+
+		stopShutdown := context.AfterFunc(cfg.shutdown, func() {
+			cfg.m.WSShutdownClosed.Inc()
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, CloseReasonShutdown), time.Now().Add(time.Second))
+			time.AfterFunc(shutdownCloseGrace, func() { _ = conn.Close() })
+		})
+		defer stopShutdown()
+
+		_ = conn.SetReadDeadline(time.Now().Add(cfg.heartbeat))
+		conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(cfg.heartbeat)) })
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			t := time.NewTicker(cfg.heartbeat * 9 / 10)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+					if err := h.PingFanout(appID, id, []byte(strconv.FormatInt(time.Now().UnixNano(), 10))); err != nil {
+						_ = conn.Close()
+						return
+					}
+				}
+			}
+		}()
+
+		ml := newMsgLimiter(cfg.msgRate, cfg.msgBurst)
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if mt != websocket.TextMessage {
+				continue
+			}
+			switch act, retry := ml.take(time.Now()); act {
+			case limitWarn, limitDrop:
+				if retry > 0 {
+					cfg.m.WSBackpressure.WithLabelValues("warn").Inc()
+					_ = h.SendFanout(appID, id, map[string]any{"type": "slow_down", "retryAfterMs": retry.Milliseconds()})
+				}
+				if act == limitDrop {
+					cfg.m.WSBackpressure.WithLabelValues("drop").Inc()
+					continue
+				}
+			case limitClose:
+				cfg.m.WSBackpressure.WithLabelValues("close").Inc()
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"), time.Now().Add(time.Second))
+				return
+			}
+			var peek struct {
+				Type string `json:"type"`
+				To   string `json:"to"`
+			}
+			if json.Unmarshal(msg, &peek) != nil || peek.Type == "" {
+				cfg.m.WSMessages.WithLabelValues("malformed_json").Inc()
+				continue
+			}
+			cfg.m.WSMessages.WithLabelValues("fanout").Inc()
+			h.FanoutRelay(appID, id, peek.To, msg)
+		}
+	})
+}
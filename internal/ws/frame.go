@@ -0,0 +1,124 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// frame holds every field the handler reads from an inbound frame, so each
+// frame is decoded exactly once whatever its type. Raw payloads are copied
+// out of the read buffer (json.RawMessage does that), so the buffer can be
+// reused as soon as the frame has been handled.
+type frame struct {
+	Type string `json:"type"`
+	Echo bool   `json:"echo"`
+	// send
+	To      string          `json:"to"`
+	Payload json.RawMessage `json:"payload"`
+	TTLMs   int64           `json:"ttlMs"` // how long the mailbox may hold it (0: the server's limit)
+	// delivered, telemetry
+	Seq *uint64 `json:"seq"`
+	// hello
+	DeliveredUpTo uint64            `json:"deliveredUpTo"`
+	ClientName    string            `json:"clientName"`
+	ClientVersion string            `json:"clientVersion"`
+	Features      []string          `json:"features"` // nil: the client doesn't negotiate
+	Labels        map[string]string `json:"labels"`
+	// pin, set_mode, set_meta
+	Fpr      string          `json:"fpr"`
+	OneWay   string          `json:"oneWay"`
+	DropBox  bool            `json:"dropBox"`
+	Envelope bool            `json:"envelope"`
+	Meta     json.RawMessage `json:"meta"`
+	// goodbye, telemetry
+	Reason string `json:"reason"`
+	// telemetry
+	Event  string `json:"event"`
+	Mode   string `json:"mode"`
+	Local  string `json:"localType"`  // selected pair's local candidate type
+	Remote string `json:"remoteType"` // and remote
+	Nonce  string `json:"nonce"`
+	Bytes  int64  `json:"bytes"`      // throughput: bytes moved
+	Ms     int64  `json:"durationMs"` // in this long
+
+	// bad lists the fields (JSON names) other than type/echo that had the
+	// wrong JSON type; they were left zero. A frame type only rejects the
+	// frame when one of the fields it reads is listed (see mistyped).
+	bad []string
+}
+
+// parseFrame decodes msg into f. Syntax errors, anything but an object, and
+// a type or echo of the wrong JSON type make the frame malformed; other type
+// mismatches are only recorded in f.bad.
+func parseFrame(msg []byte, f *frame) error {
+	*f = frame{}
+	err := json.Unmarshal(msg, f)
+	var te *json.UnmarshalTypeError
+	if !errors.As(err, &te) || te.Field == "" || te.Field == "type" || te.Field == "echo" {
+		return err
+	}
+	// Unmarshal only reports the first mismatch: probe each field on its own
+	// to find them all. This is the error path, so the extra decoding is fine.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		probe, _ := json.Marshal(map[string]json.RawMessage{k: v})
+		if err := json.Unmarshal(probe, new(frame)); err != nil {
+			if strings.EqualFold(k, "type") || strings.EqualFold(k, "echo") {
+				return err
+			}
+			f.bad = append(f.bad, k)
+		}
+	}
+	return nil
+}
+
+// mistyped returns the first of fields that had the wrong JSON type, or "".
+// Names match case-insensitively, as encoding/json matches them.
+func (f *frame) mistyped(fields ...string) string {
+	for _, k := range fields {
+		if slices.ContainsFunc(f.bad, func(b string) bool { return strings.EqualFold(b, k) }) {
+			return k
+		}
+	}
+	return ""
+}
+
+// maxPooledFrame caps the read buffers kept for reuse, so one large frame
+// doesn't pin its memory for the life of the process.
+const maxPooledFrame = 64 << 10
+
+var framePool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readFrame reads the next message of c into a pooled buffer, which the
+// caller hands back with releaseFrame once done with it. Idle connections
+// hold no buffer: one is taken only when a message starts to arrive.
+func readFrame(c *websocket.Conn) (int, *bytes.Buffer, error) {
+	mt, r, err := c.NextReader()
+	if err != nil {
+		return 0, nil, err
+	}
+	buf := framePool.Get().(*bytes.Buffer)
+	if _, err := buf.ReadFrom(r); err != nil {
+		releaseFrame(buf)
+		return 0, nil, err
+	}
+	return mt, buf, nil
+}
+
+// releaseFrame returns buf (may be nil) to the pool.
+func releaseFrame(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledFrame {
+		return
+	}
+	buf.Reset()
+	framePool.Put(buf)
+}
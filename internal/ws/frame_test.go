@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseFrame(t *testing.T) {
+	var f frame
+	if err := parseFrame([]byte(`{"type":"send","to":"B","echo":true,"payload":{"n":1}}`), &f); err != nil || f.bad != nil {
+		t.Fatalf("send: %v bad=%v", err, f.bad)
+	}
+	if f.Type != "send" || f.To != "B" || !f.Echo || string(f.Payload) != `{"n":1}` {
+		t.Fatalf("send: %+v", f)
+	}
+	// a mistyped field is dropped, the rest survives
+	if err := parseFrame([]byte(`{"type":"delivered","seq":"7","to":"A"}`), &f); err != nil || f.mistyped("seq") != "seq" || f.To != "A" {
+		t.Fatalf("mistyped: %v %+v", err, f)
+	}
+	// every mismatch is found, not just the first, and only they are listed
+	if err := parseFrame([]byte(`{"type":"send","reason":1,"to":"B","TTLMS":1.5,"payload":{}}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.mistyped("to", "payload") != "" || f.mistyped("to", "ttlMs") != "ttlMs" || f.mistyped("reason") != "reason" || f.To != "B" {
+		t.Fatalf("mistyped: %+v", f)
+	}
+	// the previous frame's fields don't leak into the next
+	if err := parseFrame([]byte(`{"type":"ice"}`), &f); err != nil || f.bad != nil || f.To != "" {
+		t.Fatalf("reuse: %v %+v", err, f)
+	}
+	for _, bad := range []string{`{"type":1}`, `{"type":"send","echo":"yes"}`, `{"type":"send","reason":1,"echo":"yes"}`, `{"type":`, `[]`} {
+		if err := parseFrame([]byte(bad), &f); err == nil {
+			t.Fatalf("%s accepted", bad)
+		}
+	}
+}
+
+func TestFramePool(t *testing.T) {
+	big := framePool.Get().(*bytes.Buffer)
+	big.Grow(maxPooledFrame * 2)
+	releaseFrame(big) // too large: dropped
+	releaseFrame(nil)
+	b := framePool.Get().(*bytes.Buffer)
+	if b.Len() != 0 {
+		t.Fatalf("pooled buffer not reset: %d bytes", b.Len())
+	}
+}
+
+// sendFrame is a mailbox frame with a 16 KiB payload.
+var sendFrame = []byte(`{"type":"send","to":"B","payload":{"name":"photo.jpg","chunk":"` + strings.Repeat("x", 16<<10) + `"}}`)
+
+// BenchmarkDecodeSend compares decoding a "send" frame the way the read path
+// used to (peek at the type, decode again into a typed struct, re-marshal
+// the payload for delivery) with the single decode of parseFrame.
+func BenchmarkDecodeSend(b *testing.B) {
+	b.Run("peek+typed+marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var peek struct {
+				Type string `json:"type"`
+				Echo bool   `json:"echo"`
+			}
+			if err := json.Unmarshal(sendFrame, &peek); err != nil {
+				b.Fatal(err)
+			}
+			var m struct {
+				To      string          `json:"to"`
+				Payload json.RawMessage `json:"payload"`
+			}
+			if err := json.Unmarshal(sendFrame, &m); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := json.Marshal(map[string]any{"type": "send", "seq": i, "payload": m.Payload}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parseFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		var f frame
+		for i := 0; i < b.N; i++ {
+			if err := parseFrame(sendFrame, &f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,14 @@
+package ws
+
+import (
+	"net/http"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+)
+
+// WithGeo looks each upgrade's client address up in g: accepted connections
+// are counted by country, and the session's log lines carry country and asn.
+// clientIP extracts the client address (nil uses RemoteAddr).
+func WithGeo(g *geo.Resolver, clientIP func(*http.Request) string) Option {
+	return func(o *wsOpts) { o.geo, o.geoIP = g, clientIP }
+}
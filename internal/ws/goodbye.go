@@ -0,0 +1,23 @@
+package ws
+
+// GoodbyeReasons are the reasons a client may give in a final
+// {"type":"goodbye","reason":"..."} frame. Anything else is recorded as
+// "other" so client-chosen strings can't blow up metric cardinality.
+var GoodbyeReasons = []string{"user_cancelled", "completed", "failed", "timeout", "navigated_away"}
+
+// Reasons for peers that left without a goodbye.
+const (
+	LeftClosed   = "closed"   // normal close
+	LeftDropped  = "dropped"  // read error, timeout or server-side kick
+	LeftShutdown = "shutdown" // server shutting down
+)
+
+// goodbyeReason maps a client's goodbye reason to one of GoodbyeReasons or "other".
+func goodbyeReason(s string) string {
+	for _, r := range GoodbyeReasons {
+		if s == r {
+			return r
+		}
+	}
+	return "other"
+}
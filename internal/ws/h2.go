@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RFC 8441: WebSocket over HTTP/2 is bootstrapped with an extended CONNECT
+// (":protocol: websocket") instead of an HTTP/1.1 Upgrade. After a 200 response
+// the stream carries ordinary RFC 6455 frames, so we hand the stream to gorilla
+// dressed up as a hijacked HTTP/1.1 upgrade.
+//
+// The Go HTTP/2 server only accepts extended CONNECT with GODEBUG=http2xconnect=1.
+
+// isExtendedConnect reports an RFC 8441 WebSocket bootstrap.
+func isExtendedConnect(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect &&
+		strings.EqualFold(r.Header.Get(":protocol"), "websocket")
+}
+
+// upgradeH2 completes an extended CONNECT and returns the WebSocket over the
+// stream. Gorilla checks the request (origin, version, subprotocols) as for an
+// HTTP/1.1 upgrade and its error responses go out as they are; the 200 is sent
+// only once its handshake succeeds, with the negotiated subprotocol.
+func upgradeH2(up *websocket.Upgrader, w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	// Sec-WebSocket-Version is the client's (RFC 8441 requires it); the key
+	// exists only for gorilla, HTTP/2 has no accept handshake
+	r2 := r.Clone(r.Context())
+	r2.Method = http.MethodGet
+	r2.Proto, r2.ProtoMajor, r2.ProtoMinor = "HTTP/1.1", 1, 1
+	r2.Header.Del(":protocol")
+	r2.Header.Set("Connection", "Upgrade")
+	r2.Header.Set("Upgrade", "websocket")
+	r2.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key[:]))
+
+	sc := &h2StreamConn{body: r.Body, w: w, rc: http.NewResponseController(w), remote: addr(r.RemoteAddr), skipHandshake: true}
+	return up.Upgrade(&h2Hijacker{w: w, conn: sc}, r2, nil)
+}
+
+// h2Hijacker satisfies http.Hijacker for gorilla's Upgrade. Until the hijack
+// nothing is committed, so gorilla's error responses go to the real writer.
+type h2Hijacker struct {
+	w    http.ResponseWriter
+	conn *h2StreamConn
+}
+
+func (h *h2Hijacker) Header() http.Header         { return h.w.Header() }
+func (h *h2Hijacker) Write(p []byte) (int, error) { return h.w.Write(p) }
+func (h *h2Hijacker) WriteHeader(code int)        { h.w.WriteHeader(code) }
+func (h *h2Hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// h2StreamConn presents an HTTP/2 stream (request body + response writer) as a net.Conn.
+type h2StreamConn struct {
+	body   io.ReadCloser
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	remote net.Addr
+
+	skipHandshake bool // turn gorilla's "HTTP/1.1 101" response into the 200
+	pending       []byte
+}
+
+var headerEnd = []byte("\r\n\r\n")
+
+func (c *h2StreamConn) Read(p []byte) (int, error) { return c.body.Read(p) }
+
+func (c *h2StreamConn) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.skipHandshake {
+		c.pending = append(c.pending, p...)
+		i := bytes.Index(c.pending, headerEnd)
+		if i < 0 {
+			return n, nil
+		}
+		if err := c.accept(c.pending[:i+len(headerEnd)]); err != nil {
+			return 0, err
+		}
+		p = c.pending[i+len(headerEnd):]
+		c.pending, c.skipHandshake = nil, false
+		if len(p) == 0 {
+			return n, nil
+		}
+	}
+	if _, err := c.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, c.rc.Flush()
+}
+
+// accept sends the 200 for gorilla's 101 response hs, carrying over the
+// negotiated subprotocol and extensions.
+func (c *h2StreamConn) accept(hs []byte) error {
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(hs)), nil)
+	if err != nil {
+		return err
+	}
+	for _, k := range []string{"Sec-WebSocket-Protocol", "Sec-WebSocket-Extensions"} {
+		if v := res.Header.Get(k); v != "" {
+			c.w.Header().Set(k, v)
+		}
+	}
+	c.w.WriteHeader(http.StatusOK)
+	return c.rc.Flush()
+}
+
+func (c *h2StreamConn) Close() error         { return c.body.Close() }
+func (c *h2StreamConn) LocalAddr() net.Addr  { return addr("") }
+func (c *h2StreamConn) RemoteAddr() net.Addr { return c.remote }
+func (c *h2StreamConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.rc.SetReadDeadline(t), c.rc.SetWriteDeadline(t))
+}
+func (c *h2StreamConn) SetReadDeadline(t time.Time) error  { return c.rc.SetReadDeadline(t) }
+func (c *h2StreamConn) SetWriteDeadline(t time.Time) error { return c.rc.SetWriteDeadline(t) }
+
+type addr string
+
+func (a addr) Network() string { return "h2" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestIsExtendedConnect(t *testing.T) {
+	r := httptest.NewRequest(http.MethodConnect, "/ws", nil)
+	r.ProtoMajor = 2
+	r.Header.Set(":protocol", "websocket")
+	if !isExtendedConnect(r) {
+		t.Fatal("expected extended CONNECT")
+	}
+	r.ProtoMajor = 1
+	if isExtendedConnect(r) {
+		t.Fatal("HTTP/1.1 CONNECT is not an RFC 8441 bootstrap")
+	}
+}
+
+func TestH2StreamConnSkipsHandshake(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := &h2StreamConn{
+		body:          io.NopCloser(strings.NewReader("")),
+		w:             rec,
+		rc:            http.NewResponseController(rec),
+		skipHandshake: true,
+	}
+	// gorilla may split the 101 response across writes; frames follow.
+	for _, p := range []string{"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n", "\r\n", "\x81\x02hi"} {
+		if n, err := c.Write([]byte(p)); err != nil || n != len(p) {
+			t.Fatalf("write %q: n=%d err=%v", p, n, err)
+		}
+	}
+	if got := rec.Body.String(); got != "\x81\x02hi" {
+		t.Fatalf("stream = %q, want only the frame", got)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+}
+
+func TestUpgradeH2(t *testing.T) {
+	connect := func(hdr map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodConnect, "/ws", nil)
+		r.ProtoMajor = 2
+		r.Header.Set(":protocol", "websocket")
+		r.Header.Set("Origin", "https://app.example")
+		for k, v := range hdr {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+	allow := func(ok bool) func(*http.Request) bool { return func(*http.Request) bool { return ok } }
+
+	// rejected requests get gorilla's error status, never a 200
+	for _, c := range []struct {
+		name string
+		up   websocket.Upgrader
+		hdr  map[string]string
+		want int
+	}{
+		{"origin denied", websocket.Upgrader{CheckOrigin: allow(false)}, map[string]string{"Sec-WebSocket-Version": "13"}, http.StatusForbidden},
+		{"cross origin by default", websocket.Upgrader{}, map[string]string{"Sec-WebSocket-Version": "13"}, http.StatusForbidden},
+		{"no version", websocket.Upgrader{CheckOrigin: allow(true)}, nil, http.StatusBadRequest},
+		{"old version", websocket.Upgrader{CheckOrigin: allow(true)}, map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		if _, err := upgradeH2(&c.up, rec, connect(c.hdr)); err == nil {
+			t.Fatalf("%s: upgraded", c.name)
+		}
+		if rec.Code != c.want {
+			t.Fatalf("%s: status %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	up := websocket.Upgrader{CheckOrigin: allow(true), Subprotocols: []string{"nt.v2"}}
+	conn, err := upgradeH2(&up, rec, connect(map[string]string{"Sec-WebSocket-Version": "13", "Sec-WebSocket-Protocol": "nt.v2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("Sec-WebSocket-Protocol") != "nt.v2" || conn.Subprotocol() != "nt.v2" {
+		t.Fatalf("status %d, protocol %q/%q", rec.Code, rec.Header().Get("Sec-WebSocket-Protocol"), conn.Subprotocol())
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("handshake leaked into the stream: %q", rec.Body.String())
+	}
+}
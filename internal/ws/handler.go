@@ -1,27 +1,86 @@
 package ws
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
-	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/audit"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/flags"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ice"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redact"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/slo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/usage"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
 )
 
 type wsOpts struct {
 	readBuf, writeBuf int
 	maxMsg            int64
 	heartbeat         time.Duration
+	telemetryMax      int
+	telemetryReqSeq   bool
+	msgRate, msgBurst int
+	parkedHeartbeat   time.Duration
+	hbMin, hbMax      time.Duration
+	hbWidenAfter      int
+	glareWindow       time.Duration
+	auth              Authenticator  // nil => no authentication
+	tickets           *ticket.Issuer // nil => ?ticket= ignored
+	maxRooms          int
+	clients           *ClientPolicy              // nil => every client version accepted
+	ownerOf           func(*http.Request) string // nil => rooms are not charged to anyone
+	authTimeout       time.Duration
+	selfPair          SelfPairMode               // "" or off => origins not tracked
+	clientIP          func(*http.Request) string // for origin fingerprints; nil => RemoteAddr
+	geo               *geo.Resolver              // nil => no country/ASN enrichment
+	geoIP             func(*http.Request) string // for geo lookups; nil => RemoteAddr
+	redact            *redact.Redactor           // nil => built-in rules only
+	sessionExempt     func(*http.Request) bool   // nil => no room is exempt from the max session
+	region            string                     // this instance's region ("" => no redirects)
+	regionURLs        map[string]string          // region -> signaling URL
+	endpoints         []Endpoint                 // failover hints for the welcome frame
+	secure            func(*http.Request) bool   // non-nil => upgrades must arrive over TLS
+	ids               idgen.Set                  // accepted appID formats (nil => UUIDs)
+	shutdown          context.Context            // done => sessions are closed with CloseGoingAway
+	hooks             *webhook.Dispatcher
+	iceStats          *ice.Analytics             // nil => selected pairs not aggregated
+	usage             *usage.Tracker             // nil => traffic not attributed to tenants
+	sli               *slo.Tracker               // nil => no in-process SLIs
+	tenantOf          func(*http.Request) string // tenant name for usage
+	m                 *metrics.Metrics
 	rl                interface{ AllowWS(*http.Request) bool } // nil => no limit
+	origin            OriginPolicy                             // nil => allowlist (or allow-all in dev)
+	audit             *audit.Logger                            // nil => no audit trail
+	legacy            *legacyShim                              // nil => one protocol only
+
+	// labeler labels connections from the auth layer (nil => client labels only)
+	labeler func(*http.Request, params.ConnectParams) map[string]string
+
+	// tuner sizes buffers from observed frames (nil => fixed readBuf/writeBuf)
+	tuner     *BufferTuner
+	writePool bool // share write buffers between connections
+
+	// flags toggles protocol features at runtime (nil => all on)
+	flags *flags.Set
 }
 type Option func(*wsOpts)
 
@@ -29,6 +88,125 @@ func WithRateLimiter(rl interface{ AllowWS(*http.Request) bool }) Option {
 	return func(o *wsOpts) { o.rl = rl }
 }
 
+// WithTelemetryLimits caps telemetry events per connection (0 = unlimited) and,
+// if requireSeq is set, drops events lacking a monotonically increasing "seq".
+func WithTelemetryLimits(maxPerConn int, requireSeq bool) Option {
+	return func(o *wsOpts) { o.telemetryMax, o.telemetryReqSeq = maxPerConn, requireSeq }
+}
+
+// WithMetrics reports to m instead of metrics.Default.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *wsOpts) { o.m = m }
+}
+
+// WithICEAnalytics aggregates the candidate pair types sent with each room's
+// first "ice-connected" telemetry event.
+func WithICEAnalytics(a *ice.Analytics) Option {
+	return func(o *wsOpts) { o.iceStats = a }
+}
+
+// WithUsage attributes each connection's traffic to tenantOf(r) (see Tenants):
+// frames received from it count as "in", frames relayed on its behalf as "out".
+func WithUsage(u *usage.Tracker, tenantOf func(*http.Request) string) Option {
+	return func(o *wsOpts) { o.usage, o.tenantOf = u, tenantOf }
+}
+
+// CloseReasonShutdown is the close reason sent to peers when the server shuts down.
+const CloseReasonShutdown = "server shutting down"
+
+// shutdownCloseGrace is how long a peer has to answer the shutdown close
+// frame before its connection is closed under the read loop.
+const shutdownCloseGrace = time.Second
+
+// WithShutdown ties sessions to ctx: once it is done every registered peer
+// gets a CloseGoingAway frame with CloseReasonShutdown and its read loop is
+// unblocked within shutdownCloseGrace. Hijacked connections are invisible to
+// http.Server.Shutdown, so cancel ctx before calling it.
+func WithShutdown(ctx context.Context) Option {
+	return func(o *wsOpts) { o.shutdown = ctx }
+}
+
+// WithSLI feeds relay latencies and session outcomes to t.
+func WithSLI(t *slo.Tracker) Option {
+	return func(o *wsOpts) { o.sli = t }
+}
+
+// WithIDFormats accepts appIDs in any format of ids instead of UUIDs only.
+func WithIDFormats(ids idgen.Set) Option {
+	return func(o *wsOpts) { o.ids = ids }
+}
+
+// WithRequireTLS rejects upgrades for which secure returns false (e.g.
+// middleware.TrustedProxies.Secure) with 426, so a proxy forwarding plain
+// ws:// from the outside fails loudly instead of exposing signaling traffic.
+func WithRequireTLS(secure func(*http.Request) bool) Option {
+	return func(o *wsOpts) { o.secure = secure }
+}
+
+// WithOriginPolicy overrides the allowlist/dev origin check.
+func WithOriginPolicy(p OriginPolicy) Option {
+	return func(o *wsOpts) { o.origin = p }
+}
+
+// WithAudit records every upgrade attempt and its outcome to the audit stream.
+func WithAudit(a *audit.Logger) Option {
+	return func(o *wsOpts) { o.audit = a }
+}
+
+// WithMessageRate limits inbound frames per connection (token bucket; perSec<=0 disables).
+// Clients nearing the limit get a {"type":"slow_down","retryAfterMs":N} frame; frames over
+// it are dropped, and a client that keeps ignoring the warnings is disconnected.
+func WithMessageRate(perSec, burst int) Option {
+	return func(o *wsOpts) { o.msgRate, o.msgBurst = perSec, burst }
+}
+
+// WithParking sets the read deadline used for parked solo peers (and pings at 9/10 of it).
+func WithParking(heartbeat time.Duration) Option {
+	return func(o *wsOpts) { o.parkedHeartbeat = heartbeat }
+}
+
+// WithGlareArbitration resolves simultaneous offers on the server: within window,
+// only the first side's offer is relayed and the other side gets rollback_required.
+// 0 disables arbitration (both offers are relayed).
+func WithGlareArbitration(window time.Duration) Option {
+	return func(o *wsOpts) { o.glareWindow = window }
+}
+
+// WithRoomQuota caps concurrently open rooms per owner (e.g. client IP).
+// Opening a room beyond the cap gets 403; joining an open room is not limited.
+func WithRoomQuota(max int, ownerOf func(*http.Request) string) Option {
+	return func(o *wsOpts) { o.maxRooms, o.ownerOf = max, ownerOf }
+}
+
+// WithClientPolicy rejects clients below a minimum version for their clientName
+// (reported as query parameters or in hello) with a descriptive close reason.
+func WithClientPolicy(p *ClientPolicy) Option {
+	return func(o *wsOpts) { o.clients = p }
+}
+
+// WithFlags gates negotiated features and client policy enforcement on the
+// runtime flags fs (see package flags).
+func WithFlags(fs *flags.Set) Option {
+	return func(o *wsOpts) { o.flags = fs }
+}
+
+// WithRegion names this instance's region. A peer whose ?region= names another
+// region with a known URL gets a {"type":"redirect"} frame and is closed.
+func WithRegion(local string, urls map[string]string) Option {
+	return func(o *wsOpts) { o.region, o.regionURLs = local, urls }
+}
+
+// WithWebhooks emits room lifecycle events (e.g. peer_joined for parked peers).
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(o *wsOpts) { o.hooks = d }
+}
+
+// WithAdaptiveHeartbeat lets the heartbeat float within [min, max]: it widens by 1.5x
+// after widenAfter consecutive healthy pongs and halves after a missed pong.
+func WithAdaptiveHeartbeat(min, max time.Duration, widenAfter int) Option {
+	return func(o *wsOpts) { o.hbMin, o.hbMax, o.hbWidenAfter = min, max, widenAfter }
+}
+
 func WithBuffers(read, write int) Option {
 	return func(o *wsOpts) { o.readBuf, o.writeBuf = read, write }
 }
@@ -36,191 +214,666 @@ func WithLimits(max int64, heartbeat time.Duration) Option {
 	return func(o *wsOpts) { o.maxMsg, o.heartbeat = max, heartbeat }
 }
 
-// originAllowed checks if the Origin header is in the allowlist.
-// - Empty Origin (non-browser clients) is allowed.
-// - Items in allowedOrigins can be full origins (https://example.com) or hostnames (example.com).
-func originAllowed(allowedOrigins []string, origin string) bool {
-	if origin == "" {
-		return true // non-browser clients typically omit Origin
-	}
-	if len(allowedOrigins) == 0 {
-		return false
-	}
-	u, err := url.Parse(origin)
-	if err != nil {
-		return false
-	}
-	host := u.Hostname()
-	for _, a := range allowedOrigins {
-		a = strings.TrimSpace(a)
-		if a == "" {
-			continue
-		}
-		// exact origin match
-		if strings.EqualFold(a, origin) {
-			return true
-		}
-		// hostname match
-		if strings.EqualFold(a, host) {
-			return true
-		}
-	}
-	return false
-}
-
 func NewWSHandler(h *hub.Hub, allowedOrigins []string, lg *slog.Logger, dev bool, options ...Option) http.Handler {
 	if lg == nil {
 		lg = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo}))
 	}
-	cfg := wsOpts{readBuf: 64 << 10, writeBuf: 64 << 10, maxMsg: 1 << 20, heartbeat: 60 * time.Second}
+	cfg := wsOpts{readBuf: 64 << 10, writeBuf: 64 << 10, maxMsg: 1 << 20, heartbeat: 60 * time.Second, telemetryMax: 64, parkedHeartbeat: 5 * time.Minute, authTimeout: 5 * time.Second, shutdown: context.Background(), m: metrics.Default}
 	for _, opt := range options {
 		opt(&cfg)
 	}
-	pingPeriod := cfg.heartbeat * 9 / 10
+	if cfg.origin == nil {
+		if dev {
+			cfg.origin = AllowAllOrigins
+		} else {
+			cfg.origin = AllowlistPolicy(allowedOrigins)
+		}
+	}
 
 	up := websocket.Upgrader{
-		// Use the same policy everywhere: allow empty Origin (CLI),
-		// allow full-origins or hostnames from allowedOrigins.
-		CheckOrigin: func(r *http.Request) bool {
-			if dev {
-				return true
-			}
-			return originAllowed(allowedOrigins, r.Header.Get("Origin"))
-		},
+		// The origin policy already ran before Upgrade (with a clearer 403 body);
+		// don't consult it twice (callback policies may be remote).
+		CheckOrigin:     func(*http.Request) bool { return true },
 		ReadBufferSize:  cfg.readBuf,
 		WriteBufferSize: cfg.writeBuf,
+		Error:           upgradeError(dev, cfg.m),
+	}
+	if cfg.legacy != nil && cfg.legacy.sub != "" {
+		up.Subprotocols = []string{cfg.legacy.sub}
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		appID := r.URL.Query().Get("appID")
-		if _, err := uuid.Parse(appID); err != nil {
-			http.Error(w, "invalid appID", http.StatusBadRequest)
+		q := r.URL.Query()
+		var tc *ticket.Claims // set when the peer presented a valid ticket
+		if t := q.Get("ticket"); t != "" && cfg.tickets != nil {
+			c, err := cfg.tickets.Verify(t)
+			if err == nil && ((q.Get("appID") != "" && q.Get("appID") != c.AppID) || (q.Get("side") != "" && q.Get("side") != c.Side)) {
+				err = ticket.ErrInvalid
+			}
+			if err != nil {
+				result := "failed"
+				if errors.Is(err, ticket.ErrExpired) {
+					result = "expired"
+				}
+				cfg.m.WSAuth.WithLabelValues("ticket", result).Inc()
+				cfg.audit.WSAttempt(r, q.Get("appID"), q.Get("side"), audit.AuthFailed)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			q.Set("appID", c.AppID)
+			q.Set("side", c.Side)
+			tc = &c
+		}
+		p, err := params.ParseIDs(q, cfg.ids)
+		appID, side, sessionID := p.AppID, p.Side, p.SID
+		clientName, clientVersion := p.ClientName, p.ClientVersion
+		if cfg.secure != nil && !cfg.secure(r) {
+			cfg.m.WSInsecure.Inc()
+			cfg.audit.WSAttempt(r, appID, side, audit.Insecure)
+			w.Header().Set("Upgrade", "TLS/1.2")
+			http.Error(w, "TLS required: connect with wss://", http.StatusUpgradeRequired)
 			return
 		}
-		side := r.URL.Query().Get("side")
-		if side != "A" && side != "B" {
-			http.Error(w, "invalid side", http.StatusBadRequest)
+		if err != nil {
+			outcome := audit.BadAppID
+			switch {
+			case errors.Is(err, params.ErrSide):
+				outcome = audit.BadSide
+			case errors.Is(err, params.ErrSID):
+				outcome = audit.BadSID
+			case errors.Is(err, params.ErrClient):
+				outcome = audit.BadClient
+			case errors.Is(err, params.ErrRegion):
+				outcome = audit.BadRegion
+			}
+			cfg.audit.WSAttempt(r, appID, side, outcome)
+			params.WriteError(w, err)
+			return
+		}
+		labels := connLabels{}
+		if labels.query, err = queryLabels(q); err != nil {
+			cfg.audit.WSAttempt(r, appID, side, audit.BadLabels)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		sessionID := r.URL.Query().Get("sid")
 
-		// (Optional) for a clearer 403 body,
-		if !dev && !originAllowed(allowedOrigins, r.Header.Get("Origin")) {
+		if !cfg.origin.AllowOrigin(r) {
+			cfg.audit.WSAttempt(r, appID, side, audit.OriginDenied)
 			http.Error(w, "forbidden origin", http.StatusForbidden)
 			return
 		}
 
 		if cfg.rl != nil && !cfg.rl.AllowWS(r) {
+			cfg.audit.WSAttempt(r, appID, side, audit.RateLimited)
 			w.WriteHeader(http.StatusTooManyRequests)
 			return
 		}
-		conn, err := up.Upgrade(w, r, nil)
+
+		lg := lg
+		var where geo.Info
+		if cfg.geo != nil {
+			where = cfg.geo.Lookup(remoteIP(r, cfg.geoIP))
+			lg = lg.With("country", where.Country, "asn", where.ASN)
+		}
+
+		var owner string
+		if cfg.ownerOf != nil && cfg.maxRooms > 0 {
+			owner = cfg.ownerOf(r)
+			if !h.CanOpen(appID, owner, cfg.maxRooms) {
+				cfg.m.QuotaRejected.WithLabelValues("rooms").Inc()
+				cfg.audit.WSAttempt(r, appID, side, audit.QuotaExceeded)
+				http.Error(w, hub.ErrRoomQuota.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		var origin string // fingerprint of this peer's IP+UA, if self-pairs are tracked
+		if cfg.selfPair != "" && cfg.selfPair != SelfPairOff {
+			origin = originFingerprint(r, cfg.clientIP)
+			if h.SameOrigin(appID, side, origin) {
+				if cfg.selfPair == SelfPairDeny && !dev {
+					cfg.m.WSSelfPair.WithLabelValues("denied").Inc()
+					cfg.audit.WSAttempt(r, appID, side, audit.SelfPair)
+					http.Error(w, "both sides from the same client", http.StatusConflict)
+					return
+				}
+				cfg.m.WSSelfPair.WithLabelValues("warned").Inc()
+				lg.Warn("ws self-pair", "appID", appID, "side", side, "origin", origin)
+			}
+		}
+
+		authed := cfg.auth == nil
+		if tc != nil {
+			// redeemed last, so a peer turned away above can retry with it
+			if err := cfg.tickets.Redeem(*tc); err != nil {
+				cfg.m.WSAuth.WithLabelValues("ticket", "used").Inc()
+				cfg.audit.WSAttempt(r, appID, side, audit.AuthFailed)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			cfg.m.WSAuth.WithLabelValues("ticket", "ok").Inc()
+			authed = true
+		} else if !authed && p.Token != "" {
+			if err := cfg.auth.Authenticate(r.Context(), p, p.Token); err != nil {
+				cfg.m.WSAuth.WithLabelValues("query", "failed").Inc()
+				cfg.audit.WSAttempt(r, appID, side, audit.AuthFailed)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			cfg.m.WSAuth.WithLabelValues("query", "ok").Inc()
+			authed = true
+		}
+		var conn *websocket.Conn
+		if isExtendedConnect(r) {
+			conn, err = upgradeH2(cfg.tuner.upgrader(&up, cfg.writePool), w, r)
+		} else {
+			conn, err = cfg.tuner.upgrader(&up, cfg.writePool).Upgrade(w, r, nil)
+		}
 		if err != nil {
-			lg.Warn("ws upgrade failed", "err", err)
+			cfg.audit.WSAttempt(r, appID, side, audit.UpgradeFailed)
+			lg.Warn("ws upgrade failed", "err", err, "cause", diagnoseUpgrade(r, err).Cause)
 			return
 		}
 		defer conn.Close()
-		metrics.WSConnections.Inc()
+		cfg.m.WSConnections.Inc()
 		conn.SetReadLimit(cfg.maxMsg)
+
+		if to := regionRedirect(cfg.region, cfg.regionURLs, p.Region, r); to != "" {
+			cfg.m.WSRedirects.WithLabelValues(p.Region).Inc()
+			cfg.audit.WSAttempt(r, appID, side, audit.Redirected)
+			_ = conn.WriteJSON(map[string]any{"type": "redirect", "region": p.Region, "url": to})
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "redirect to "+p.Region), time.Now().Add(time.Second))
+			return
+		}
+
+		if !authed {
+			if err := authFirstFrame(r.Context(), conn, cfg.auth, p, cfg.authTimeout, cfg.m); err != nil {
+				cfg.audit.WSAttempt(r, appID, side, audit.AuthFailed)
+				_ = conn.WriteJSON(map[string]any{"type": "error", "code": "auth_failed", "message": err.Error()})
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "auth failed"))
+				return
+			}
+			_ = conn.WriteJSON(map[string]any{"type": "auth_ok"})
+		}
+
+		// Parked peers use a relaxed heartbeat until their partner joins.
+		var parked atomic.Bool
+		kick := make(chan struct{}, 1) // re-arm the ping timer after a park state change
+		hb := newAdaptiveHeartbeat(cfg.heartbeat, cfg.hbMin, cfg.hbMax, cfg.hbWidenAfter)
+		heartbeat := func() time.Duration {
+			if parked.Load() {
+				return cfg.parkedHeartbeat
+			}
+			return hb.current()
+		}
+		connectedAt := time.Now()
+		tenant := usage.Anonymous
+		if cfg.tenantOf != nil {
+			tenant = cfg.tenantOf(r)
+		}
+		defer func() {
+			lg.Info("ws session summary", "appID", appID, "side", side, "clientName", clientName, "clientVersion", clientVersion,
+				"duration", time.Since(connectedAt), "heartbeat", hb.current())
+		}()
 		_ = conn.SetReadDeadline(time.Now().Add(cfg.heartbeat))
 		conn.SetPongHandler(func(data string) error {
-			if err := conn.SetReadDeadline(time.Now().Add(cfg.heartbeat)); err != nil {
+			hb.pong()
+			if err := conn.SetReadDeadline(time.Now().Add(heartbeat())); err != nil {
 				return err
 			}
 			if ts, err := strconv.ParseInt(data, 10, 64); err == nil {
-				metrics.WSRTTSeconds.Observe(time.Since(time.Unix(0, ts)).Seconds())
+				cfg.m.WSRTTSeconds.Observe(time.Since(time.Unix(0, ts)).Seconds())
 			}
 			return nil
 		})
 
-		if err := h.Register(appID, side, sessionID, conn); err != nil {
+		// admitClient records the client and reports whether the version policy allows it.
+		admitClient := func() bool {
+			name, ver := clientLabelSet.labels(clientName, clientVersion)
+			reason := cfg.clients.check(clientName, clientVersion)
+			if reason != "" && !cfg.flags.Enabled(flags.StrictAdmission) {
+				// report-only while strict admission is flagged off
+				cfg.m.WSClients.WithLabelValues(name, ver, "lenient").Inc()
+				lg.Info("ws client below policy admitted", "appID", appID, "side", side, "clientName", clientName, "clientVersion", clientVersion)
+				return true
+			}
+			if reason != "" {
+				cfg.m.WSClients.WithLabelValues(name, ver, "rejected").Inc()
+				lg.Info("ws client rejected", "appID", appID, "side", side, "clientName", clientName, "clientVersion", clientVersion)
+				_ = conn.WriteJSON(map[string]any{"type": "error", "code": "client_unsupported", "message": reason})
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), time.Now().Add(time.Second))
+				return false
+			}
+			cfg.m.WSClients.WithLabelValues(name, ver, "accepted").Inc()
+			return true
+		}
+		if clientName != "" && !admitClient() {
+			cfg.audit.WSAttempt(r, appID, side, audit.ClientRejected)
+			return
+		}
+
+		if err := h.RegisterOwned(appID, side, sessionID, owner, cfg.maxRooms, conn); err != nil {
+			outcome := audit.SideBusy
+			if errors.Is(err, hub.ErrRoomQuota) {
+				outcome = audit.QuotaExceeded
+			}
+			cfg.audit.WSAttempt(r, appID, side, outcome)
 			lg.Warn("hub register failed", "err", err, "appID", appID, "side", side)
+			if errors.Is(err, hub.ErrSideBusy) {
+				duplicateJoin(h, r, appID, side, &cfg)
+				st, _ := h.RoomState(appID)
+				rejectBusy(conn, st, side, cfg.heartbeat, cfg.m)
+				return
+			}
 			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
 			return
 		}
-		defer h.Unregister(appID, conn)
+		legacy := false // the client speaks cfg.legacy: translate both ways
+		useLegacy := func(via string) {
+			legacy = true
+			cfg.m.WSLegacyConns.WithLabelValues(via).Inc()
+			h.Translate(appID, side, func(p []byte) []byte {
+				cfg.m.WSLegacyFrames.WithLabelValues("out").Inc()
+				return cfg.legacy.downgrade(p)
+			})
+		}
+		if cfg.legacy != nil && cfg.legacy.sub != "" && conn.Subprotocol() == cfg.legacy.sub {
+			useLegacy("subprotocol")
+		}
+		var goodbye string // reason from the peer's goodbye frame, if any
+		abnormal := false
+		defer func() {
+			reason := goodbye
+			switch {
+			case reason != "":
+			case cfg.shutdown.Err() != nil:
+				reason = LeftShutdown
+			case abnormal:
+				reason = LeftDropped
+			default:
+				reason = LeftClosed
+			}
+			h.SetLeft(appID, side, reason)
+			h.Unregister(appID, conn)
+			cfg.m.PeersLeft.WithLabelValues(reason).Inc()
+			cfg.hooks.Emit(webhook.Event{Type: "peer_left", AppID: appID, Side: side, Data: map[string]any{"reason": reason}})
+			_ = h.Send(appID, peerOf(side), map[string]any{"type": "peer_left", "side": side, "reason": reason})
+		}()
+		stopShutdown := context.AfterFunc(cfg.shutdown, func() {
+			cfg.m.WSShutdownClosed.Inc()
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, CloseReasonShutdown), time.Now().Add(time.Second))
+			// the peer's close echo ends the read loop; a silent peer is cut off
+			time.AfterFunc(shutdownCloseGrace, func() { _ = conn.Close() })
+		})
+		defer stopShutdown()
+		defer func() { cfg.sli.SessionEnded(abnormal) }()
+		if origin != "" {
+			h.SetOrigin(appID, side, origin)
+		}
+		if cfg.labeler != nil {
+			labels.trusted = cfg.labeler(r, p)
+		}
+		if len(labels.query) > 0 || len(labels.trusted) > 0 {
+			if err := h.SetLabels(appID, side, labels.merged()); err != nil {
+				lg.Warn("ws labels rejected", "err", err, "appID", appID, "side", side)
+			}
+		}
+		if cfg.sessionExempt != nil && cfg.sessionExempt(r) {
+			h.ExemptSession(appID)
+		}
+		cfg.audit.WSAttempt(r, appID, side, audit.Accepted)
+		if cfg.geo != nil {
+			cfg.m.WSCountry.WithLabelValues(where.CountryLabel()).Inc()
+		}
+		if len(cfg.endpoints) > 0 {
+			_ = h.Send(appID, side, map[string]any{"type": "welcome", "endpoints": cfg.endpoints})
+		}
 
 		if h.RoomSize(appID) == 2 {
-			h.BroadcastEvent(appID, map[string]any{"type": "room_full"})
+			if woke := h.Unpark(appID); len(woke) > 0 {
+				cfg.hooks.Emit(webhook.Event{Type: "peer_joined", AppID: appID, Side: side, Data: map[string]any{"parked": woke}})
+			}
+			ev := map[string]any{}
+			if p, ok := h.GetPin(appID); ok {
+				ev["pin"] = p
+			}
+			if m, ok := h.Meta(appID); ok {
+				ev["meta"] = m
+			}
+			h.NotifyPaired(appID, ev)
 		}
 
+		done := make(chan struct{})
+		defer close(done)
 		go func() {
-			t := time.NewTicker(pingPeriod)
+			t := time.NewTimer(heartbeat() * 9 / 10)
 			defer t.Stop()
-			for range t.C {
+			for {
+				select {
+				case <-done:
+					return
+				case <-kick:
+					if !t.Stop() {
+						select {
+						case <-t.C:
+						default:
+						}
+					}
+				case <-t.C:
+				}
 				payload := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+				if !parked.Load() {
+					hb.pingSent()
+				}
 				if err := h.Ping(appID, side, payload); err != nil {
 					_ = conn.Close()
 					return
 				}
+				t.Reset(heartbeat() * 9 / 10)
 			}
 		}()
+		rearm := func() {
+			_ = conn.SetReadDeadline(time.Now().Add(heartbeat()))
+			select {
+			case kick <- struct{}{}:
+			default:
+			}
+		}
 
+		tg := telemetryGuard{max: cfg.telemetryMax, requireSeq: cfg.telemetryReqSeq}
+		ml := newMsgLimiter(cfg.msgRate, cfg.msgBurst)
+		var buf *bytes.Buffer // the current frame's pooled read buffer
+		defer func() { releaseFrame(buf) }()
+		var f frame
 		for {
-			mt, msg, err := conn.ReadMessage()
+			releaseFrame(buf)
+			mt, b, err := readFrame(conn)
+			buf = b
 			if err != nil {
-				// quiet on normal closes
-				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				// quiet on normal closes and on shutdown
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && cfg.shutdown.Err() == nil {
+					abnormal = true
 					lg.Warn("ws read error", "err", err)
+					frames, _ := h.Frames(appID, side)
+					cfg.audit.WSAbnormalClose(r, appID, side, err, frames)
 				}
 				return
 			}
-			metrics.WSFrameSize.WithLabelValues("in").Observe(float64(len(msg)))
+			msg := buf.Bytes()
+			cfg.m.WSFrameSize.WithLabelValues("in").Observe(float64(len(msg)))
+			cfg.tuner.observe("in", len(msg))
 			if mt != websocket.TextMessage && mt != websocket.BinaryMessage {
+				cfg.m.WSMessages.WithLabelValues("ignored").Inc()
 				continue
 			}
-			var peek struct {
-				Type string `json:"type"`
+			cfg.usage.Record(tenant, "in", len(msg))
+			if cfg.legacy != nil {
+				if !legacy && cfg.legacy.detect(msg) {
+					useLegacy("shape")
+				}
+				if legacy {
+					cfg.m.WSLegacyFrames.WithLabelValues("in").Inc()
+					msg = cfg.legacy.upgrade(msg)
+				}
+			}
+			switch act, retry := ml.take(time.Now()); act {
+			case limitWarn, limitDrop:
+				if retry > 0 {
+					cfg.m.WSBackpressure.WithLabelValues("warn").Inc()
+					_ = h.Send(appID, side, map[string]any{"type": "slow_down", "retryAfterMs": retry.Milliseconds()})
+				}
+				if act == limitDrop {
+					cfg.m.WSBackpressure.WithLabelValues("drop").Inc()
+					continue
+				}
+			case limitClose:
+				cfg.m.WSBackpressure.WithLabelValues("close").Inc()
+				lg.Warn("ws closing flooding client", "appID", appID, "side", side)
+				_ = h.CloseConn(appID, side, websocket.ClosePolicyViolation, "rate limit exceeded")
+				return
 			}
-			if err := json.Unmarshal(msg, &peek); err != nil {
+			if err := parseFrame(msg, &f); err != nil {
+				cfg.m.WSMessages.WithLabelValues("malformed_json").Inc()
+				h.TraceIn(appID, side, "malformed_json", len(msg))
 				continue
 			}
-			t := strings.ToLower(peek.Type)
-			if t == "" {
-				t = "unknown"
+			t := strings.ToLower(f.Type)
+			// label is t for known frame types; client-chosen types must not blow up cardinality
+			label := t
+			if !knownTypes[t] {
+				label = "unknown_type"
+			}
+			cfg.m.WSMessages.WithLabelValues(label).Inc()
+			h.TraceIn(appID, side, label, len(msg))
+			cfg.m.SignalMsg.WithLabelValues(label).Inc()
+			cfg.m.SignalBytes.WithLabelValues("in", label).Add(float64(len(msg)))
+			if h.Debug(appID) {
+				lg.Info("ws frame", "appID", appID, "side", side, "type", t, "size", len(msg), "frame", cfg.redact.JSON(msg))
+			}
+			// invalid reports a mistyped field that frame type t reads, if any
+			invalid := func(fields ...string) bool {
+				k := f.mistyped(fields...)
+				if k != "" {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "field_invalid", "ref": t, "field": k})
+				}
+				return k != ""
+			}
+			switch t {
+			case "offer", "answer", "ice", "sender_ready", "send":
+				if !h.AllowedFrom(appID, side) {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "direction_not_allowed", "ref": t})
+					continue
+				}
+				if ok, retry := h.CountFrame(appID); !ok {
+					// the room looks like a renegotiation loop; the hub has told both peers
+					if retry > 0 {
+						_ = h.Send(appID, side, map[string]any{"type": "slow_down", "scope": "anomaly", "retryAfterMs": retry.Milliseconds()})
+					}
+					continue
+				}
+				if ok, retry := h.AllowRoom(appID); !ok {
+					// the room as a whole is over its fair share; drop and tell the sender
+					cfg.m.WSBackpressure.WithLabelValues("room").Inc()
+					_ = h.Send(appID, side, map[string]any{"type": "slow_down", "scope": "room", "retryAfterMs": retry.Milliseconds()})
+					continue
+				}
+			}
+			if cfg.glareWindow > 0 {
+				switch t {
+				case "offer":
+					if !h.ClaimOffer(appID, side, cfg.glareWindow) {
+						cfg.m.GlareResolved.Inc()
+						_ = h.Send(appID, side, map[string]any{"type": "rollback_required", "winner": peerOf(side)})
+						continue
+					}
+				case "answer":
+					h.ClearOffer(appID)
+				}
 			}
-			metrics.SignalMsg.WithLabelValues(t).Inc()
-			metrics.SignalBytes.WithLabelValues("in", t).Add(float64(len(msg)))
 			switch t {
 			case "offer", "answer", "ice", "sender_ready":
-				metrics.WSFrameSize.WithLabelValues("out").Observe(float64(len(msg)))
-				metrics.SignalBytes.WithLabelValues("out", t).Add(float64(len(msg)))
-				h.Broadcast(appID, conn, msg)
-			case "hello":
-				var m struct {
-					DeliveredUpTo uint64 `json:"deliveredUpTo"`
+				cfg.m.WSFrameSize.WithLabelValues("out").Observe(float64(len(msg)))
+				cfg.tuner.observe("out", len(msg))
+				cfg.m.SignalBytes.WithLabelValues("out", t).Add(float64(len(msg)))
+				cfg.usage.Record(tenant, "out", len(msg))
+				start := time.Now()
+				if f.Echo {
+					// "echo":true: the sender also gets the frame back, with seq and timestamp
+					h.RelayEcho(appID, side, conn, msg)
+				} else {
+					h.Relay(appID, side, conn, msg)
 				}
-				if err := json.Unmarshal(msg, &m); err == nil {
-					h.Hello(appID, side, sessionID, m.DeliveredUpTo)
+				took := time.Since(start)
+				cfg.m.RelayLatency.Observe(took.Seconds())
+				cfg.sli.Relay(took)
+			case "activity":
+				// {"type":"activity",...}: ephemeral presence hint. Relayed right away to a
+				// connected peer only; never queued, and not charged to the room budget.
+				if len(msg) > maxActivityBytes {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "activity_too_large", "max": maxActivityBytes})
+					continue
 				}
-			case "send":
-				var m struct {
-					To      string          `json:"to"`
-					Payload json.RawMessage `json:"payload"`
+				cfg.m.SignalBytes.WithLabelValues("out", t).Add(float64(len(msg)))
+				cfg.usage.Record(tenant, "out", len(msg))
+				h.Relay(appID, side, conn, msg)
+			case "pause", "resume":
+				// {"type":"pause"}: ask the peer to stop sending until "resume". Relayed to the
+				// peer; the hub also holds back mailbox deliveries to this side meanwhile
+				if err := h.SetPaused(appID, side, t == "pause"); err != nil {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": t + "_rejected", "message": err.Error()})
+					continue
+				}
+				h.Relay(appID, side, conn, msg)
+			case "park":
+				// {"type":"park"}: solo peer waits (relaxed heartbeat) until the partner joins.
+				// parked is set first: a partner joining right after Park returns
+				// runs the wake callback, whose reset must not be overwritten.
+				parked.Store(true)
+				err := h.Park(appID, side, func() {
+					parked.Store(false)
+					rearm()
+				})
+				if err != nil {
+					parked.Store(false)
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "park_rejected", "message": err.Error()})
+					continue
+				}
+				rearm()
+				if parked.Load() {
+					_ = h.Send(appID, side, map[string]any{"type": "parked", "heartbeatMs": cfg.parkedHeartbeat.Milliseconds()})
+				}
+			case "pin":
+				// {"type":"pin","fpr":"..."}: first pin wins; conflicting re-pins are rejected
+				if err := h.SetPin(appID, side, f.Fpr); err != nil {
+					if errors.Is(err, hub.ErrPinConflict) {
+						cfg.m.PinConflicts.Inc()
+					}
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "pin_rejected", "message": err.Error()})
+					continue
+				}
+				// tell the peer (if present) right away; late joiners get it in room_full
+				h.Broadcast(appID, conn, mustJSON(map[string]any{"type": "pinned", "pin": hub.Pin{Side: side, Fpr: f.Fpr}}))
+			case "set_mode":
+				// {"type":"set_mode","dropBox":true}: the room outlives its peers while mail is queued
+				if f.DropBox {
+					until, err := h.SetDropBox(appID, side)
+					if err != nil {
+						_ = h.Send(appID, side, map[string]any{"type": "error", "code": "mode_rejected", "message": err.Error()})
+						continue
+					}
+					h.BroadcastEvent(appID, map[string]any{"type": "mode", "dropBox": true, "expiresAt": until.UTC()})
+				}
+				// {"type":"set_mode","envelope":true}: relayed frames arrive wrapped with server metadata
+				if f.Envelope {
+					if err := h.SetEnvelope(appID); err != nil {
+						_ = h.Send(appID, side, map[string]any{"type": "error", "code": "mode_rejected", "message": err.Error()})
+						continue
+					}
+					h.BroadcastEvent(appID, map[string]any{"type": "mode", "envelope": true})
+				}
+				if (f.DropBox || f.Envelope) && f.OneWay == "" {
+					continue
 				}
-				if err := json.Unmarshal(msg, &m); err == nil {
-					_ = h.Enqueue(appID, side, strings.ToUpper(m.To), m.Payload)
+				// {"type":"set_mode","oneWay":"A"}: only A may relay/send from now on
+				if err := h.SetOneWay(appID, strings.ToUpper(f.OneWay)); err != nil {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "mode_rejected", "message": err.Error()})
+					continue
 				}
+				h.BroadcastEvent(appID, map[string]any{"type": "mode", "oneWay": strings.ToUpper(f.OneWay)})
+			case "set_meta":
+				// {"type":"set_meta","meta":{...}}: replaces the room's shared metadata
+				if err := h.SetMeta(appID, f.Meta); err != nil {
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "meta_rejected", "message": err.Error()})
+					continue
+				}
+				meta, _ := h.Meta(appID)
+				h.BroadcastEvent(appID, map[string]any{"type": "meta", "side": side, "meta": meta})
+			case "get_meta":
+				ev := map[string]any{"type": "meta", "meta": json.RawMessage("{}")}
+				if meta, ok := h.Meta(appID); ok {
+					ev["meta"] = meta
+				}
+				_ = h.Send(appID, side, ev)
+			case "delivered":
+				// {"type":"delivered","seq":N}: side has its mailbox items up to N
+				switch {
+				case invalid("seq"):
+				case f.Seq == nil:
+					// no seq is not seq 0: acking it would drop an item the client never confirmed
+					_ = h.Send(appID, side, map[string]any{"type": "error", "code": "field_missing", "ref": t, "field": "seq"})
+				default:
+					h.AckUpTo(appID, side, *f.Seq)
+				}
+			case "hello":
+				if !invalid("deliveredUpTo", "clientName", "clientVersion", "features", "labels") {
+					// the query string wins; hello only fills in a client that didn't identify itself
+					if clientName == "" && f.ClientName != "" && params.ValidClient(f.ClientName) && params.ValidClient(f.ClientVersion) {
+						clientName, clientVersion = f.ClientName, f.ClientVersion
+						if !admitClient() {
+							return
+						}
+					}
+					h.Hello(appID, side, sessionID, f.DeliveredUpTo)
+					if f.Labels != nil {
+						prev := labels.hello
+						labels.hello = f.Labels
+						if err := h.SetLabels(appID, side, labels.merged()); err != nil {
+							labels.hello = prev
+							_ = h.Send(appID, side, map[string]any{"type": "error", "code": "labels_invalid", "message": err.Error()})
+						}
+					}
+					if f.Features != nil {
+						// both peers learn what they may use once both have advertised
+						common, ready, err := h.SetFeatures(appID, side, f.Features)
+						switch {
+						case err != nil:
+							_ = h.Send(appID, side, map[string]any{"type": "error", "code": "features_invalid", "message": err.Error()})
+						case ready:
+							common = slices.DeleteFunc(common, func(f string) bool { return !cfg.flags.Enabled(f) })
+							h.BroadcastEvent(appID, map[string]any{"type": "features_negotiated", "features": common})
+							if slices.Contains(common, envelopeFeature) && h.SetEnvelope(appID) == nil {
+								h.BroadcastEvent(appID, map[string]any{"type": "mode", "envelope": true})
+							}
+						}
+					}
+				}
+			case "send":
+				if !invalid("to", "payload", "ttlMs") {
+					ttl := time.Duration(min(f.TTLMs, math.MaxInt64/int64(time.Millisecond))) * time.Millisecond
+					_ = h.EnqueueTTL(appID, side, strings.ToUpper(f.To), f.Payload, ttl, f.Echo)
+				}
+			case "goodbye":
+				goodbye = goodbyeReason(f.Reason)
 			//{"type":"telemetry","event":"ice-connected"}
 			case "telemetry":
-				var tm struct {
-					Event  string `json:"event"`
-					Reason string `json:"reason"`
-					Mode   string `json:"mode"`
+				if ok, why := tg.admit(f.Seq, f.Nonce); !ok {
+					cfg.m.TelemetryDropped.WithLabelValues(why).Inc()
+					continue
 				}
-				_ = json.Unmarshal(msg, &tm)
-				mode := strings.ToLower(strings.TrimSpace(tm.Mode))
+				mode := strings.ToLower(strings.TrimSpace(f.Mode))
 				if mode == "" {
 					mode = "unspecified"
 				}
-				switch strings.ToLower(tm.Event) {
+				switch strings.ToLower(f.Event) {
 				case "ice-connected":
 					if dt, first := h.MarkEstablished(appID); first {
-						metrics.SessionEstablished.WithLabelValues(mode).Inc()
-						metrics.SessionTTF.Observe(dt.Seconds())
+						cfg.m.SessionEstablished.WithLabelValues(mode).Inc()
+						cfg.m.SessionTTF.Observe(dt.Seconds())
+						cfg.iceStats.Record(strings.ToLower(f.Local), strings.ToLower(f.Remote))
 					}
 				case "ice-failed":
-					metrics.SessionFailed.WithLabelValues("ice-failed").Inc()
+					if h.MarkFailed(appID) {
+						cfg.m.SessionFailed.WithLabelValues("ice-failed").Inc()
+					}
+				case "throughput":
+					// one finished data-channel transfer; repeatable, unlike the session events
+					rate, ok := throughputRate(f.Bytes, f.Ms)
+					if !ok {
+						cfg.m.TelemetryDropped.WithLabelValues("invalid").Inc()
+						continue
+					}
+					cfg.m.TransferThroughput.WithLabelValues(throughputMode(mode)).Observe(rate)
+					cfg.m.TransferBytes.WithLabelValues(throughputMode(mode)).Observe(float64(f.Bytes))
 				default:
 					// no-op
 				}
@@ -230,3 +883,30 @@ func NewWSHandler(h *hub.Hub, allowedOrigins []string, lg *slog.Logger, dev bool
 		}
 	})
 }
+
+// maxActivityBytes caps activity frames; they are hints, not payload carriers.
+const maxActivityBytes = 512
+
+// envelopeFeature, negotiated by both peers, turns on relay envelopes as
+// set_mode envelope does.
+const envelopeFeature = "envelope"
+
+// knownTypes are the inbound frame types the handler acts on.
+var knownTypes = map[string]bool{
+	"offer": true, "answer": true, "ice": true, "sender_ready": true, "activity": true,
+	"park": true, "pin": true, "set_mode": true, "set_meta": true, "get_meta": true,
+	"delivered": true, "hello": true, "send": true, "telemetry": true, "goodbye": true,
+	"pause": true, "resume": true,
+}
+
+func peerOf(side string) string {
+	if side == "A" {
+		return "B"
+	}
+	return "A"
+}
+
+func mustJSON(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptiveHeartbeat widens the heartbeat after `widenAfter` consecutive healthy
+// pongs and halves it after a missed one, staying within [min, max].
+// With min == max it degenerates to a fixed heartbeat.
+type adaptiveHeartbeat struct {
+	mu          sync.Mutex
+	cur         time.Duration
+	min, max    time.Duration
+	widenAfter  int
+	healthy     int
+	outstanding bool
+}
+
+func newAdaptiveHeartbeat(initial, min, max time.Duration, widenAfter int) *adaptiveHeartbeat {
+	if min <= 0 || max <= 0 || min > max {
+		min, max = initial, initial
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+	if widenAfter <= 0 {
+		widenAfter = 5
+	}
+	return &adaptiveHeartbeat{cur: initial, min: min, max: max, widenAfter: widenAfter}
+}
+
+// current returns the heartbeat (read-deadline base); pings go out at 9/10 of it.
+func (a *adaptiveHeartbeat) current() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cur
+}
+
+// pingSent is called before each ping; an unanswered previous ping counts as a miss.
+func (a *adaptiveHeartbeat) pingSent() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.outstanding {
+		a.healthy = 0
+		a.cur /= 2
+		if a.cur < a.min {
+			a.cur = a.min
+		}
+	}
+	a.outstanding = true
+}
+
+// pong is called for every pong received.
+func (a *adaptiveHeartbeat) pong() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.outstanding = false
+	a.healthy++
+	if a.healthy >= a.widenAfter {
+		a.healthy = 0
+		a.cur = a.cur * 3 / 2
+		if a.cur > a.max {
+			a.cur = a.max
+		}
+	}
+}
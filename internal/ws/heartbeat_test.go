@@ -0,0 +1,30 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveHeartbeatBounds(t *testing.T) {
+	a := newAdaptiveHeartbeat(10*time.Second, 5*time.Second, 20*time.Second, 2)
+	for i := 0; i < 20; i++ {
+		a.pingSent()
+		a.pong()
+	}
+	if got := a.current(); got != 20*time.Second {
+		t.Fatalf("healthy link should widen to max, got %s", got)
+	}
+	for i := 0; i < 5; i++ {
+		a.pingSent() // never answered
+	}
+	if got := a.current(); got != 5*time.Second {
+		t.Fatalf("misses should shrink to min, got %s", got)
+	}
+
+	fixed := newAdaptiveHeartbeat(10*time.Second, 0, 0, 0)
+	fixed.pingSent()
+	fixed.pingSent()
+	if got := fixed.current(); got != 10*time.Second {
+		t.Fatalf("fixed heartbeat changed: %s", got)
+	}
+}
@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// labelParam prefixes query parameters that label the connection
+// (?label.platform=ios&label.app_version=1.4.2).
+const labelParam = "label."
+
+// WithLabeler labels each connection from the auth layer (e.g. its tenant).
+// fn runs once the peer is registered; its labels win over those the client
+// sent, so a client can't claim another tenant.
+func WithLabeler(fn func(*http.Request, params.ConnectParams) map[string]string) Option {
+	return func(o *wsOpts) { o.labeler = fn }
+}
+
+// queryLabels returns the label.<key> parameters of q, validated.
+func queryLabels(q url.Values) (map[string]string, error) {
+	var out map[string]string
+	for k, v := range q {
+		key, ok := strings.CutPrefix(k, labelParam)
+		if !ok || len(v) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[key] = v[0]
+	}
+	return out, hub.ValidLabels(out)
+}
+
+// connLabels are a connection's labels by source. The query string wins
+// over hello (as for clientName) and the labeler over both.
+type connLabels struct {
+	query, hello, trusted map[string]string
+}
+
+func (l *connLabels) merged() map[string]string {
+	out := maps.Clone(l.hello)
+	if out == nil {
+		out = make(map[string]string, len(l.query)+len(l.trusted))
+	}
+	maps.Copy(out, l.query)
+	maps.Copy(out, l.trusted)
+	return out
+}
@@ -0,0 +1,131 @@
+package ws
+
+import "encoding/json"
+
+// LegacyProtocol describes an older wire protocol still accepted during its
+// deprecation window. A connection speaks it if it negotiated Subprotocol or,
+// failing that, once it sends a frame only the legacy protocol produces (a
+// legacy frame type or field name). From then on its inbound frames are
+// upgraded before the handler acts on them, and the frames the hub writes to
+// it are downgraded. Field renames apply to top-level fields only.
+type LegacyProtocol struct {
+	// Subprotocol is what legacy clients offer in Sec-WebSocket-Protocol,
+	// e.g. "nt.v1"; empty relies on detection by frame shape alone.
+	Subprotocol string
+	// Types maps legacy frame types to current ones.
+	Types map[string]string
+	// Fields maps legacy field names to current ones, by current frame type;
+	// the "" entry applies to frames of every type.
+	Fields map[string]map[string]string
+}
+
+// WithLegacyProtocol translates between p and the current protocol for
+// clients that speak p. Usage is counted in nt_ws_legacy_connections_total
+// and nt_ws_legacy_frames_total, to tell when p can be dropped.
+func WithLegacyProtocol(p LegacyProtocol) Option {
+	return func(o *wsOpts) { o.legacy = newLegacyShim(p) }
+}
+
+// legacyShim holds a LegacyProtocol's renames in both directions.
+type legacyShim struct {
+	sub        string
+	up, down   map[string]string            // frame types
+	upF, downF map[string]map[string]string // fields, by current type
+}
+
+func newLegacyShim(p LegacyProtocol) *legacyShim {
+	s := &legacyShim{
+		sub:   p.Subprotocol,
+		up:    p.Types,
+		down:  make(map[string]string, len(p.Types)),
+		upF:   p.Fields,
+		downF: make(map[string]map[string]string, len(p.Fields)),
+	}
+	for old, cur := range p.Types {
+		s.down[cur] = old
+	}
+	for typ, m := range p.Fields {
+		s.downF[typ] = make(map[string]string, len(m))
+		for old, cur := range m {
+			s.downF[typ][cur] = old
+		}
+	}
+	return s
+}
+
+// detect reports whether msg can only have come from a legacy client.
+func (s *legacyShim) detect(msg []byte) bool {
+	f, typ, ok := decodeFrame(msg)
+	if !ok {
+		return false
+	}
+	cur, renamed := s.up[typ]
+	if renamed {
+		return true
+	}
+	for k := range f {
+		if _, ok := s.upF[""][k]; ok {
+			return true
+		}
+		if _, ok := s.upF[cur][k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// upgrade rewrites a legacy frame into the current protocol.
+func (s *legacyShim) upgrade(msg []byte) []byte {
+	return s.rewrite(msg, s.up, s.upF, true)
+}
+
+// downgrade rewrites a current frame into the legacy protocol.
+func (s *legacyShim) downgrade(msg []byte) []byte {
+	return s.rewrite(msg, s.down, s.downF, false)
+}
+
+// rewrite renames msg's type and fields. fields are keyed by the current
+// type, which is the renamed one when upgrading and the original otherwise.
+// Frames that aren't JSON objects, or need no change, are returned as is.
+func (s *legacyShim) rewrite(msg []byte, types map[string]string, fields map[string]map[string]string, upgrading bool) []byte {
+	f, typ, ok := decodeFrame(msg)
+	if !ok {
+		return msg
+	}
+	cur, changed := typ, false
+	if t, ok := types[typ]; ok {
+		f["type"], _ = json.Marshal(t)
+		changed = true
+		if upgrading {
+			cur = t
+		}
+	}
+	for _, m := range []map[string]string{fields[""], fields[cur]} {
+		for from, to := range m {
+			if v, ok := f[from]; ok {
+				delete(f, from)
+				f[to] = v
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return msg
+	}
+	out, err := json.Marshal(f)
+	if err != nil {
+		return msg
+	}
+	return out
+}
+
+// decodeFrame splits a JSON object frame into its fields and type.
+func decodeFrame(msg []byte) (map[string]json.RawMessage, string, bool) {
+	var f map[string]json.RawMessage
+	if json.Unmarshal(msg, &f) != nil || f == nil {
+		return nil, "", false
+	}
+	var typ string
+	_ = json.Unmarshal(f["type"], &typ)
+	return f, typ, true
+}
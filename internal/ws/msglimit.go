@@ -0,0 +1,71 @@
+package ws
+
+import "time"
+
+type limitAction int
+
+const (
+	limitAllow limitAction = iota
+	limitWarn              // allowed, but the client should back off
+	limitDrop              // over the limit: frame dropped, client warned
+	limitClose             // warnings ignored: close the connection
+)
+
+// msgLimiter is a per-connection token bucket with a soft threshold.
+// Owned by a single read loop; not safe for concurrent use.
+type msgLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	tokens   float64
+	last     time.Time
+	warnedAt time.Time
+	strikes  int // frames dropped since the last allowed one
+}
+
+// softFraction of the bucket left triggers a slow_down warning.
+const softFraction = 0.2
+
+func newMsgLimiter(perSec, burst int) *msgLimiter {
+	if perSec <= 0 {
+		return nil
+	}
+	if burst < perSec {
+		burst = perSec
+	}
+	return &msgLimiter{rate: float64(perSec), burst: float64(burst), tokens: float64(burst)}
+}
+
+// take consumes one token and returns what to do with the frame plus a retry hint.
+func (l *msgLimiter) take(now time.Time) (limitAction, time.Duration) {
+	if l == nil {
+		return limitAllow, 0
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	// time until the bucket is back above the soft threshold
+	retry := time.Duration((l.burst*softFraction - l.tokens + 1) / l.rate * float64(time.Second))
+	if l.tokens >= 1 {
+		l.tokens--
+		l.strikes = 0
+		if l.tokens < l.burst*softFraction && now.Sub(l.warnedAt) >= time.Second {
+			l.warnedAt = now
+			return limitWarn, retry
+		}
+		return limitAllow, 0
+	}
+	l.strikes++
+	if l.strikes > int(l.burst) {
+		return limitClose, retry
+	}
+	if now.Sub(l.warnedAt) >= time.Second {
+		l.warnedAt = now
+		return limitDrop, retry
+	}
+	return limitDrop, 0
+}
@@ -0,0 +1,43 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMsgLimiterWarnDropClose(t *testing.T) {
+	l := newMsgLimiter(10, 10)
+	now := time.Unix(1000, 0)
+
+	var warned, dropped bool
+	for i := 0; i < 10; i++ {
+		a, _ := l.take(now)
+		switch a {
+		case limitWarn:
+			warned = true
+		case limitDrop, limitClose:
+			t.Fatalf("frame %d should be allowed within burst", i)
+		}
+	}
+	if !warned {
+		t.Fatal("expected a soft-limit warning before the bucket empties")
+	}
+	for i := 0; i < 10; i++ {
+		if a, _ := l.take(now); a == limitDrop {
+			dropped = true
+		} else if a == limitClose {
+			t.Fatalf("closed too early at %d", i)
+		}
+	}
+	if !dropped {
+		t.Fatal("expected drops once the bucket is empty")
+	}
+	if a, _ := l.take(now); a != limitClose {
+		t.Fatalf("ignoring warnings should close, got %v", a)
+	}
+
+	// after backing off, frames flow again
+	if a, _ := l.take(now.Add(2 * time.Second)); a != limitAllow {
+		t.Fatalf("expected allow after refill, got %v", a)
+	}
+}
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OriginPolicy decides whether a WS upgrade with the request's Origin is accepted.
+type OriginPolicy interface {
+	AllowOrigin(r *http.Request) bool
+}
+
+// OriginPolicyFunc adapts a plain function to OriginPolicy.
+type OriginPolicyFunc func(r *http.Request) bool
+
+func (f OriginPolicyFunc) AllowOrigin(r *http.Request) bool { return f(r) }
+
+// AllowAllOrigins accepts every origin (dev mode).
+var AllowAllOrigins OriginPolicy = OriginPolicyFunc(func(*http.Request) bool { return true })
+
+// AllowlistPolicy accepts empty origins and origins listed as full origin or hostname.
+type AllowlistPolicy []string
+
+func (a AllowlistPolicy) AllowOrigin(r *http.Request) bool {
+	return originAllowed(a, r.Header.Get("Origin"))
+}
+
+// originAllowed checks if the Origin header is in the allowlist.
+// - Empty Origin (non-browser clients) is allowed.
+// - Items in allowedOrigins can be full origins (https://example.com) or hostnames (example.com).
+func originAllowed(allowedOrigins []string, origin string) bool {
+	if origin == "" {
+		return true // non-browser clients typically omit Origin
+	}
+	if len(allowedOrigins) == 0 {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	for _, a := range allowedOrigins {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		// exact origin match
+		if strings.EqualFold(a, origin) {
+			return true
+		}
+		// hostname match
+		if strings.EqualFold(a, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// CallbackPolicy asks an external HTTP service whether an origin is allowed:
+// GET <url>?origin=<origin> answering 200 means allowed, anything else denied.
+// Decisions are cached per origin for TTL; transport errors deny and are not cached.
+type CallbackPolicy struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedDecision
+}
+
+type cachedDecision struct {
+	allow bool
+	exp   time.Time
+}
+
+// maxOriginCache bounds the callback cache; it is reset when full.
+const maxOriginCache = 4096
+
+func NewCallbackPolicy(callbackURL string, ttl time.Duration) *CallbackPolicy {
+	return &CallbackPolicy{
+		url:    callbackURL,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 2 * time.Second},
+		cache:  make(map[string]cachedDecision),
+	}
+}
+
+func (p *CallbackPolicy) AllowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // non-browser clients typically omit Origin
+	}
+	now := time.Now()
+	p.mu.Lock()
+	d, ok := p.cache[origin]
+	p.mu.Unlock()
+	if ok && now.Before(d.exp) {
+		return d.allow
+	}
+
+	allow, err := p.ask(r.Context(), origin)
+	if err != nil {
+		return false
+	}
+	p.mu.Lock()
+	if len(p.cache) >= maxOriginCache {
+		p.cache = make(map[string]cachedDecision)
+	}
+	p.cache[origin] = cachedDecision{allow: allow, exp: now.Add(p.ttl)}
+	p.mu.Unlock()
+	return allow
+}
+
+func (p *CallbackPolicy) ask(ctx context.Context, origin string) (bool, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return false, err
+	}
+	q := u.Query()
+	q.Set("origin", origin)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	return res.StatusCode == http.StatusOK, nil
+}
@@ -0,0 +1,61 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+func TestCallbackPolicyCaches(t *testing.T) {
+	var calls int32
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Query().Get("origin") == "https://good.example" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer auth.Close()
+
+	p := ws.NewCallbackPolicy(auth.URL, time.Minute)
+	req := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Origin", origin)
+		return r
+	}
+
+	for i := 0; i < 3; i++ {
+		if !p.AllowOrigin(req("https://good.example")) {
+			t.Fatal("good origin denied")
+		}
+	}
+	if p.AllowOrigin(req("https://evil.example")) {
+		t.Fatal("evil origin allowed")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("want 2 callback hits (cached), got %d", n)
+	}
+	if !p.AllowOrigin(httptest.NewRequest(http.MethodGet, "/ws", nil)) {
+		t.Fatal("empty origin should be allowed")
+	}
+}
+
+func TestAllowlistPolicy(t *testing.T) {
+	p := ws.AllowlistPolicy{"example.com", "https://app.example.org"}
+	for origin, want := range map[string]bool{
+		"https://example.com":     true,
+		"https://app.example.org": true,
+		"https://other.net":       false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Origin", origin)
+		if got := p.AllowOrigin(r); got != want {
+			t.Fatalf("%s: got %v want %v", origin, got, want)
+		}
+	}
+}
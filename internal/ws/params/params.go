@@ -0,0 +1,141 @@
+// Package params parses and validates the query parameters of a signaling
+// connect request (/ws today; other transports can reuse it).
+package params
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+)
+
+// MaxSIDLen bounds the client-chosen session id.
+const MaxSIDLen = 128
+
+// ConnectParams is a validated connect request.
+type ConnectParams struct {
+	AppID string // room id as sent by the client (see idgen)
+	Side  string // "A" or "B"
+	SID   string // optional client session id (opaque, <= MaxSIDLen printable ASCII)
+	Token string // optional credential; prefer the first-frame auth handshake
+
+	ClientName    string // optional, e.g. "web"; [A-Za-z0-9._+-], <= MaxClientLen
+	ClientVersion string // optional, e.g. "1.4.2"; same charset
+
+	Region string // optional region the room was created in (from rendezvous); [a-z0-9-], <= MaxRegionLen
+}
+
+// MaxClientLen bounds clientName/clientVersion.
+const MaxClientLen = 64
+
+// MaxRegionLen bounds region.
+const MaxRegionLen = 32
+
+// Sentinel causes; match with errors.Is.
+var (
+	ErrAppID  = errors.New("invalid appID")
+	ErrSide   = errors.New("invalid side")
+	ErrSID    = errors.New("invalid sid")
+	ErrClient = errors.New("invalid clientName or clientVersion")
+	ErrRegion = errors.New("invalid region")
+)
+
+// Error reports the first invalid parameter.
+type Error struct {
+	Param string // query parameter name
+	Value string // offending value
+	Err   error  // one of the sentinels above
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Status is the HTTP status for the error (always 400 for now).
+func (e *Error) Status() int { return http.StatusBadRequest }
+
+// FromRequest parses r's query string.
+func FromRequest(r *http.Request) (ConnectParams, error) { return Parse(r.URL.Query()) }
+
+// Parse validates q, accepting UUID appIDs. On error the returned
+// ConnectParams still carries the raw values so callers can log/audit them.
+func Parse(q url.Values) (ConnectParams, error) { return ParseIDs(q, nil) }
+
+// ParseIDs is Parse accepting appIDs in any format of ids (nil: UUIDs).
+func ParseIDs(q url.Values, ids idgen.Set) (ConnectParams, error) {
+	p := ConnectParams{
+		AppID: q.Get("appID"), Side: q.Get("side"), SID: q.Get("sid"), Token: q.Get("token"),
+		ClientName: q.Get("clientName"), ClientVersion: q.Get("clientVersion"),
+		Region: q.Get("region"),
+	}
+	if !ids.Valid(p.AppID) {
+		return p, &Error{Param: "appID", Value: p.AppID, Err: ErrAppID}
+	}
+	if p.Side != "A" && p.Side != "B" {
+		return p, &Error{Param: "side", Value: p.Side, Err: ErrSide}
+	}
+	if !validSID(p.SID) {
+		return p, &Error{Param: "sid", Value: p.SID, Err: ErrSID}
+	}
+	if !ValidClient(p.ClientName) {
+		return p, &Error{Param: "clientName", Value: p.ClientName, Err: ErrClient}
+	}
+	if !ValidClient(p.ClientVersion) {
+		return p, &Error{Param: "clientVersion", Value: p.ClientVersion, Err: ErrClient}
+	}
+	if !ValidRegion(p.Region) {
+		return p, &Error{Param: "region", Value: p.Region, Err: ErrRegion}
+	}
+	return p, nil
+}
+
+// WriteError writes err as a plain-text HTTP error; non-param errors map to 400 too.
+func WriteError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	var pe *Error
+	if errors.As(err, &pe) {
+		status = pe.Status()
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// ValidClient reports whether s is acceptable as a client name or version
+// (empty is allowed: both are optional).
+func ValidClient(s string) bool {
+	if len(s) > MaxClientLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '+' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidRegion reports whether s is acceptable as a region name (empty is allowed).
+func ValidRegion(s string) bool {
+	if len(s) > MaxRegionLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func validSID(s string) bool {
+	if len(s) > MaxSIDLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package params_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+const app = "6f1c1c3e-8a43-4b0a-9d7e-2a3c5b0f9e11"
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		query string
+		want  error
+	}{
+		{"appID=" + app + "&side=A", nil},
+		{"appID=" + app + "&side=B&sid=tab-1", nil},
+		{"side=A", params.ErrAppID},
+		{"appID=nope&side=A", params.ErrAppID},
+		{"appID=" + app, params.ErrSide},
+		{"appID=" + app + "&side=a", params.ErrSide},
+		{"appID=" + app + "&side=A&sid=has%20space", params.ErrSID},
+		{"appID=" + app + "&side=A&sid=" + strings.Repeat("x", params.MaxSIDLen+1), params.ErrSID},
+		{"appID=" + app + "&side=A&clientName=web&clientVersion=1.4.2-rc.1", nil},
+		{"appID=" + app + "&side=A&clientName=we%20b", params.ErrClient},
+		{"appID=" + app + "&side=A&region=EU", params.ErrRegion},
+	}
+	for _, c := range cases {
+		q, _ := url.ParseQuery(c.query)
+		p, err := params.Parse(q)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", c.query, err, c.want)
+			continue
+		}
+		if err == nil && (p.AppID != app || p.Side == "") {
+			t.Errorf("%s: bad params %+v", c.query, p)
+		}
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	const ulid = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	ids := idgen.Set{idgen.ULID, idgen.UUIDv4}
+	for _, id := range []string{ulid, app} {
+		if _, err := params.ParseIDs(url.Values{"appID": {id}, "side": {"A"}}, ids); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+	if _, err := params.Parse(url.Values{"appID": {ulid}, "side": {"A"}}); !errors.Is(err, params.ErrAppID) {
+		t.Errorf("ulid accepted by default: %v", err)
+	}
+	if _, err := params.ParseIDs(url.Values{"appID": {app}, "side": {"A"}}, idgen.Set{idgen.ULID}); !errors.Is(err, params.ErrAppID) {
+		t.Errorf("uuid accepted by a ulid-only set: %v", err)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	_, err := params.Parse(url.Values{"appID": {app}, "side": {"C"}})
+	var pe *params.Error
+	if !errors.As(err, &pe) || pe.Param != "side" || pe.Value != "C" {
+		t.Fatalf("want *params.Error for side, got %#v", err)
+	}
+	rr := httptest.NewRecorder()
+	params.WriteError(rr, err)
+	if rr.Code != http.StatusBadRequest || strings.TrimSpace(rr.Body.String()) != "invalid side" {
+		t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+	}
+}
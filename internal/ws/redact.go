@@ -0,0 +1,9 @@
+package ws
+
+import "github.com/collapsinghierarchy/nt-backend-wrtc/internal/redact"
+
+// WithRedactor applies r to frame contents in per-room debug logs. Without
+// it the built-in rules still strip SDP addresses and candidate IPs.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(o *wsOpts) { o.redact = r }
+}
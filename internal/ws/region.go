@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// ParseRegionURLs parses "region=url[,region=url...]", e.g.
+// "eu=wss://eu.example.com/ws,us=wss://us.example.com/ws".
+func ParseRegionURLs(spec string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		region, raw, ok := strings.Cut(item, "=")
+		if !ok || region == "" || !params.ValidRegion(region) {
+			return nil, fmt.Errorf("region urls: want region=url, got %q", item)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return nil, fmt.Errorf("region urls: %s: want a ws:// or wss:// URL, got %q", region, raw)
+		}
+		out[region] = raw
+	}
+	return out, nil
+}
+
+// regionRedirect returns where a peer asking for region should connect
+// instead, or "" if it belongs here (or the region has no configured URL).
+// The original query string is carried over.
+func regionRedirect(local string, urls map[string]string, region string, r *http.Request) string {
+	if local == "" || region == "" || region == local {
+		return ""
+	}
+	base, ok := urls[region]
+	if !ok {
+		return ""
+	}
+	u, _ := url.Parse(base) // validated by ParseRegionURLs
+	u.RawQuery = r.URL.RawQuery
+	return u.String()
+}
@@ -0,0 +1,45 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Backoff is the retry schedule suggested to a peer turned away from a busy
+// side: wait InitialMs, then multiply by Factor per attempt up to MaxMs, with
+// jitter.
+type Backoff struct {
+	InitialMs int64   `json:"initialMs"`
+	MaxMs     int64   `json:"maxMs"`
+	Factor    float64 `json:"factor"`
+}
+
+// retryInitial is the first suggested wait for a busy side.
+const retryInitial = time.Second
+
+// rejectBusy tells a peer whose side of appID is taken why, and whether it
+// may come back, then closes. A side stays busy until its occupant leaves or
+// misses a heartbeat, so retrying makes sense unless the room is established
+// (both peers report a working connection); the backoff tops out at the
+// heartbeat, by which time a dead occupant has been dropped.
+func rejectBusy(conn *websocket.Conn, st hub.RoomStatus, side string, heartbeat time.Duration, m *metrics.Metrics) {
+	code := "side_busy"
+	if st.Peers >= 2 {
+		code = "room_full"
+	}
+	m.RoomFullRejects.WithLabelValues(string(st.State)).Inc()
+	ev := map[string]any{"type": "error", "code": code, "side": side, "mightFreeUp": st.State != hub.StateEstablished}
+	closeCode, reason := websocket.ClosePolicyViolation, code
+	if st.State != hub.StateEstablished {
+		b := Backoff{InitialMs: retryInitial.Milliseconds(), MaxMs: max(heartbeat, retryInitial).Milliseconds(), Factor: 2}
+		ev["retryAfterMs"], ev["backoff"] = b.InitialMs, b
+		closeCode, reason = websocket.CloseTryAgainLater, fmt.Sprintf("%s; retry in %dms", code, b.InitialMs)
+	}
+	_ = conn.WriteJSON(ev)
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+}
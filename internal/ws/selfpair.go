@@ -0,0 +1,52 @@
+package ws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// SelfPairMode says what to do when both sides of a room join from the same
+// origin fingerprint (client IP + User-Agent) — usually one device that
+// connected as A and B by mistake.
+type SelfPairMode string
+
+const (
+	SelfPairOff  SelfPairMode = "off"
+	SelfPairWarn SelfPairMode = "warn" // log and count, but accept
+	SelfPairDeny SelfPairMode = "deny" // 409 before the upgrade (warn in dev mode)
+)
+
+// ParseSelfPairMode parses "off", "warn" or "deny".
+func ParseSelfPairMode(s string) (SelfPairMode, error) {
+	switch m := SelfPairMode(s); m {
+	case SelfPairOff, SelfPairWarn, SelfPairDeny:
+		return m, nil
+	}
+	return "", fmt.Errorf("self-pair mode must be off, warn or deny, got %q", s)
+}
+
+// WithSelfPair records each side's origin fingerprint and applies mode when
+// both match. clientIP extracts the client address (nil uses RemoteAddr).
+func WithSelfPair(mode SelfPairMode, clientIP func(*http.Request) string) Option {
+	return func(o *wsOpts) { o.selfPair, o.clientIP = mode, clientIP }
+}
+
+// originFingerprint is a short, non-reversible tag for where a peer connects from.
+func originFingerprint(r *http.Request, clientIP func(*http.Request) string) string {
+	sum := sha256.Sum256([]byte(remoteIP(r, clientIP) + "\x00" + r.UserAgent()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// remoteIP is clientIP(r), or the host of RemoteAddr if clientIP is nil.
+func remoteIP(r *http.Request, clientIP func(*http.Request) string) string {
+	if clientIP != nil {
+		return clientIP(r)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/usage"
+)
+
+// WithSessionExempt exempts rooms joined by a request for which exempt returns
+// true from the hub's maximum session duration (see hub.SetMaxSession).
+func WithSessionExempt(exempt func(*http.Request) bool) Option {
+	return func(o *wsOpts) { o.sessionExempt = exempt }
+}
+
+// APIKeyHeader carries the caller's API key for exemptions and usage attribution.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeys returns a matcher for requests whose X-API-Key is one of keys
+// (comma-separated; blanks ignored). No keys matches nothing.
+func APIKeys(keys string) func(*http.Request) bool {
+	var sums [][sha256.Size]byte
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			sums = append(sums, sha256.Sum256([]byte(k)))
+		}
+	}
+	return func(r *http.Request) bool {
+		got := r.Header.Get(APIKeyHeader)
+		if got == "" {
+			return false
+		}
+		// compare fixed-size digests so timing doesn't leak key lengths
+		sum := sha256.Sum256([]byte(got))
+		for _, s := range sums {
+			if subtle.ConstantTimeCompare(sum[:], s[:]) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Tenants parses "name:key[,name:key...]" and returns the tenant of a request
+// by its X-API-Key: the configured name, usage.Anonymous without a key, or
+// usage.Unknown for any other key. Names are metric labels, so the result is
+// always one of a bounded set.
+func Tenants(spec string) (func(*http.Request) string, error) {
+	names := map[[sha256.Size]byte]string{}
+	for i, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(item, ":")
+		if !ok || name == "" || key == "" || name == usage.Anonymous || name == usage.Unknown {
+			// don't echo the entry: it may be a key
+			return nil, fmt.Errorf("tenants: entry %d is not name:key (or uses a reserved name)", i+1)
+		}
+		names[sha256.Sum256([]byte(key))] = name
+	}
+	return func(r *http.Request) string {
+		got := r.Header.Get(APIKeyHeader)
+		if got == "" {
+			return usage.Anonymous
+		}
+		// hashed map lookup: keys are never compared byte by byte
+		if name, ok := names[sha256.Sum256([]byte(got))]; ok {
+			return name
+		}
+		return usage.Unknown
+	}, nil
+}
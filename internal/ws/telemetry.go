@@ -0,0 +1,78 @@
+package ws
+
+// telemetryGuard enforces per-connection telemetry caps and replay protection.
+// It is owned by a single read loop and needs no locking.
+type telemetryGuard struct {
+	max        int  // max telemetry events per connection (0 = unlimited)
+	requireSeq bool // reject events without a "seq"
+
+	count   int
+	lastSeq uint64 // highest seq admitted, once seenSeq
+	seenSeq bool
+	nonces  map[string]struct{}
+}
+
+// maxNonces bounds the per-connection nonce set.
+const maxNonces = 256
+
+// admit reports whether a telemetry event may be counted, and the drop reason if not.
+func (g *telemetryGuard) admit(seq *uint64, nonce string) (bool, string) {
+	if g.max > 0 && g.count >= g.max {
+		return false, "cap"
+	}
+	if seq == nil {
+		if g.requireSeq {
+			return false, "missing_seq"
+		}
+	} else {
+		if g.seenSeq && *seq <= g.lastSeq {
+			return false, "replay"
+		}
+	}
+	if nonce != "" {
+		if _, dup := g.nonces[nonce]; dup {
+			return false, "replay"
+		}
+		if g.nonces == nil {
+			g.nonces = make(map[string]struct{})
+		}
+		if len(g.nonces) >= maxNonces {
+			return false, "cap"
+		}
+		g.nonces[nonce] = struct{}{}
+	}
+	if seq != nil {
+		g.lastSeq, g.seenSeq = *seq, true
+	}
+	g.count++
+	return true, ""
+}
+
+// Bounds of a plausible throughput report; anything outside is dropped as
+// "invalid" rather than skewing the histograms.
+const (
+	maxThroughputBytes = 1 << 40             // 1 TiB in one transfer
+	maxThroughputMs    = 24 * 60 * 60 * 1000 // a day
+	maxThroughputRate  = 125e9               // bytes/s: ten times a 100 Gbit/s link
+)
+
+// throughputMode maps a client-reported transport mode to a bounded label.
+func throughputMode(mode string) string {
+	switch mode {
+	case "p2p", "relay":
+		return mode
+	case "":
+		return "unspecified"
+	}
+	return "other"
+}
+
+// throughputRate validates a throughput report of n bytes in ms milliseconds
+// and returns the rate in bytes per second.
+func throughputRate(n, ms int64) (float64, bool) {
+	if n <= 0 || n > maxThroughputBytes || ms <= 0 || ms > maxThroughputMs {
+		return 0, false
+	}
+	rate := float64(n) / (float64(ms) / 1e3)
+	return rate, rate <= maxThroughputRate
+}
@@ -0,0 +1,63 @@
+package ws
+
+import "testing"
+
+func TestTelemetryGuard(t *testing.T) {
+	u := func(v uint64) *uint64 { return &v }
+
+	g := telemetryGuard{max: 3}
+	if ok, _ := g.admit(u(1), "n1"); !ok {
+		t.Fatal("first event should pass")
+	}
+	if ok, why := g.admit(u(1), ""); ok || why != "replay" {
+		t.Fatalf("repeated seq: ok=%v why=%q", ok, why)
+	}
+	if ok, why := g.admit(u(2), "n1"); ok || why != "replay" {
+		t.Fatalf("repeated nonce: ok=%v why=%q", ok, why)
+	}
+	_, _ = g.admit(u(3), "")
+	_, _ = g.admit(u(4), "")
+	if ok, why := g.admit(u(5), ""); ok || why != "cap" {
+		t.Fatalf("over cap: ok=%v why=%q", ok, why)
+	}
+
+	strict := telemetryGuard{requireSeq: true}
+	if ok, why := strict.admit(nil, ""); ok || why != "missing_seq" {
+		t.Fatalf("missing seq: ok=%v why=%q", ok, why)
+	}
+
+	// seq may start at 0
+	zero := telemetryGuard{}
+	if ok, why := zero.admit(u(0), ""); !ok {
+		t.Fatalf("first event with seq 0 dropped: %q", why)
+	}
+	if ok, why := zero.admit(u(0), ""); ok || why != "replay" {
+		t.Fatalf("repeated seq 0: ok=%v why=%q", ok, why)
+	}
+	if ok, _ := zero.admit(u(1), ""); !ok {
+		t.Fatal("seq 1 after 0 should pass")
+	}
+}
+
+func TestThroughputRate(t *testing.T) {
+	if r, ok := throughputRate(10<<20, 2000); !ok || r != 5<<20 {
+		t.Fatalf("10 MiB in 2s: %v %v", r, ok)
+	}
+	for _, c := range []struct{ n, ms int64 }{
+		{0, 1000},                   // nothing moved
+		{1 << 20, 0},                // no duration
+		{-1, 1000},                  // negative
+		{1 << 41, 1000},             // too large
+		{1 << 20, 48 * 3600 * 1000}, // too long
+		{1 << 39, 1},                // implausibly fast
+	} {
+		if _, ok := throughputRate(c.n, c.ms); ok {
+			t.Fatalf("%d bytes in %dms accepted", c.n, c.ms)
+		}
+	}
+	for in, want := range map[string]string{"p2p": "p2p", "relay": "relay", "": "unspecified", "turn-tcp": "other"} {
+		if got := throughputMode(in); got != want {
+			t.Fatalf("mode %q -> %q, want %q", in, got, want)
+		}
+	}
+}
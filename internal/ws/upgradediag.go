@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// Upgrade failure causes, the cause label of nt_ws_upgrade_failures_total.
+const (
+	upgradeMethod       = "method"         // not a GET
+	upgradeConnection   = "connection"     // no "upgrade" token in Connection
+	upgradeUpgrade      = "upgrade"        // no "websocket" token in Upgrade
+	upgradeProxy        = "proxy_stripped" // either of the two, behind a proxy
+	upgradeVersion      = "version"        // Sec-WebSocket-Version isn't 13
+	upgradeKey          = "key"            // Sec-WebSocket-Key missing or malformed
+	upgradeNotHijacking = "not_hijackable" // the connection can't be taken over (e.g. HTTP/2)
+	upgradeOther        = "other"
+)
+
+// upgradeHints tell a developer what to do about each cause.
+var upgradeHints = map[string]string{
+	upgradeMethod:       "WebSocket handshakes are GET requests; use a WebSocket client, not fetch/XHR",
+	upgradeConnection:   "send 'Connection: Upgrade' (browsers and WebSocket libraries do)",
+	upgradeUpgrade:      "send 'Upgrade: websocket' (browsers and WebSocket libraries do)",
+	upgradeProxy:        "a proxy dropped the hop-by-hop Upgrade/Connection headers; configure it to pass WebSocket upgrades (nginx: proxy_http_version 1.1 and proxy_set_header Upgrade/Connection)",
+	upgradeVersion:      "only Sec-WebSocket-Version 13 (RFC 6455) is supported",
+	upgradeKey:          "Sec-WebSocket-Key must be 16 random bytes, base64-encoded",
+	upgradeNotHijacking: "the request arrived over a transport that can't be upgraded; over HTTP/2 use RFC 8441 extended CONNECT or fall back to HTTP/1.1",
+}
+
+// upgradeDiagnosis explains a failed WebSocket upgrade. It is the JSON body
+// of the error response in dev mode.
+type upgradeDiagnosis struct {
+	Error  string `json:"error"`
+	Cause  string `json:"cause"`
+	Detail string `json:"detail,omitempty"` // the upgrader's own message
+	// Missing lists the handshake headers absent or wrong, as "Name: expected".
+	Missing []string `json:"missingHeaders,omitempty"`
+	// Proxy lists the headers that show a proxy on the way (Via, X-Forwarded-For, ...).
+	Proxy []string `json:"proxyHeaders,omitempty"`
+	Hint  string   `json:"hint,omitempty"`
+}
+
+// proxyHeaders betray an intermediary between the client and the server.
+var proxyHeaders = []string{"Via", "Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Real-Ip"}
+
+// diagnoseUpgrade inspects the handshake headers of r, whose upgrade failed
+// with reason (may be nil), and names the most likely cause.
+func diagnoseUpgrade(r *http.Request, reason error) upgradeDiagnosis {
+	d := upgradeDiagnosis{Error: "websocket upgrade failed", Cause: upgradeOther}
+	if reason != nil {
+		d.Detail = reason.Error()
+	}
+	for _, h := range proxyHeaders {
+		if v := r.Header.Get(h); v != "" {
+			d.Proxy = append(d.Proxy, h+": "+v)
+		}
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") {
+		d.Missing = append(d.Missing, "Connection: Upgrade")
+	}
+	if !headerHasToken(r.Header, "Upgrade", "websocket") {
+		d.Missing = append(d.Missing, "Upgrade: websocket")
+	}
+	hopByHop := len(d.Missing) > 0
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		d.Missing = append(d.Missing, "Sec-WebSocket-Version: 13")
+	}
+	if k, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key")); err != nil || len(k) != 16 {
+		d.Missing = append(d.Missing, "Sec-WebSocket-Key: <base64 of 16 bytes>")
+	}
+
+	switch {
+	case r.Method != http.MethodGet:
+		d.Cause = upgradeMethod
+	case hopByHop && len(d.Proxy) > 0 && r.Header.Get("Sec-WebSocket-Key") != "":
+		// the client did start a handshake, but the hop-by-hop headers were lost
+		d.Cause = upgradeProxy
+	case !headerHasToken(r.Header, "Connection", "upgrade"):
+		d.Cause = upgradeConnection
+	case !headerHasToken(r.Header, "Upgrade", "websocket"):
+		d.Cause = upgradeUpgrade
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		d.Cause = upgradeVersion
+	case len(d.Missing) > 0:
+		d.Cause = upgradeKey
+	case reason != nil && strings.Contains(reason.Error(), "Hijacker"):
+		d.Cause = upgradeNotHijacking
+	}
+	d.Hint = upgradeHints[d.Cause]
+	return d
+}
+
+// headerHasToken reports whether the comma-separated header name of h
+// contains token, case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeError is the Upgrader's Error callback: it counts the failure by
+// cause and, in dev mode, answers with the diagnosis as JSON. Production
+// responses stay terse, since the headers seen may be the client's own.
+func upgradeError(dev bool, m *metrics.Metrics) func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	return func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		d := diagnoseUpgrade(r, reason)
+		m.WSUpgradeFailed.WithLabelValues(d.Cause).Inc()
+		w.Header().Set("Sec-Websocket-Version", "13")
+		if !dev {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(d)
+	}
+}
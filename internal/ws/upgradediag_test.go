@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+func TestDiagnoseUpgrade(t *testing.T) {
+	handshake := func(method string, h map[string]string) *http.Request {
+		r := httptest.NewRequest(method, "/ws", nil)
+		for k, v := range map[string]string{
+			"Connection": "keep-alive, Upgrade", "Upgrade": "websocket",
+			"Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==",
+		} {
+			r.Header.Set(k, v)
+		}
+		for k, v := range h {
+			if v == "" {
+				r.Header.Del(k)
+			} else {
+				r.Header.Set(k, v)
+			}
+		}
+		return r
+	}
+	for _, c := range []struct {
+		name   string
+		method string
+		h      map[string]string
+		cause  string
+	}{
+		{"post", http.MethodPost, nil, upgradeMethod},
+		{"no connection", "GET", map[string]string{"Connection": ""}, upgradeConnection},
+		{"no upgrade", "GET", map[string]string{"Upgrade": "h2c"}, upgradeUpgrade},
+		{"proxy", "GET", map[string]string{"Connection": "", "Upgrade": "", "Via": "1.1 lb"}, upgradeProxy},
+		{"version", "GET", map[string]string{"Sec-WebSocket-Version": "8"}, upgradeVersion},
+		{"key", "GET", map[string]string{"Sec-WebSocket-Key": "short"}, upgradeKey},
+	} {
+		if d := diagnoseUpgrade(handshake(c.method, c.h), nil); d.Cause != c.cause || d.Hint == "" {
+			t.Errorf("%s: cause %q (hint %q), want %q", c.name, d.Cause, d.Hint, c.cause)
+		}
+	}
+}
+
+func TestUpgradeFailureBody(t *testing.T) {
+	for _, dev := range []bool{true, false} {
+		m := metrics.New()
+		ts := httptest.NewServer(NewWSHandler(hub.New(), nil, nil, dev, WithMetrics(m)))
+		// a plain GET, as if a proxy had stripped the upgrade headers
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws?side=A&appID="+uuid.NewString(), nil)
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d upgradeDiagnosis
+		isJSON := strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json")
+		if isJSON {
+			_ = json.NewDecoder(resp.Body).Decode(&d)
+		}
+		resp.Body.Close()
+		ts.Close()
+
+		if resp.StatusCode != http.StatusBadRequest || isJSON != dev {
+			t.Fatalf("dev=%v: %s, json=%v", dev, resp.Status, isJSON)
+		}
+		if dev && (d.Cause != upgradeProxy || len(d.Missing) != 2 || len(d.Proxy) != 1) {
+			t.Fatalf("diagnosis: %+v", d)
+		}
+		if n := testutil.ToFloat64(m.WSUpgradeFailed.WithLabelValues(upgradeProxy)); n != 1 {
+			t.Fatalf("dev=%v: nt_ws_upgrade_failures_total{cause=proxy_stripped} = %v", dev, n)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+//go:build integration
+
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+// Run with: go test -tags integration -run WebRTC ./internal/ws/
+
+// signal is the frame shape both peers use over /ws.
+type signal struct {
+	Type      string                   `json:"type"`
+	SDP       string                   `json:"sdp,omitempty"`
+	Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+}
+
+// rtcPeer is a pion peer connection signalling through one /ws connection.
+type rtcPeer struct {
+	t  *testing.T
+	pc *webrtc.PeerConnection
+	ws *websocket.Conn
+
+	wmu sync.Mutex // gorilla allows one concurrent writer
+
+	mu      sync.Mutex
+	remote  bool // remote description set
+	pending []webrtc.ICECandidateInit
+}
+
+func newRTCPeer(t *testing.T, ts *httptest.Server, appID, side string) *rtcPeer {
+	t.Helper()
+	var se webrtc.SettingEngine
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &rtcPeer{t: t, pc: pc, ws: dial(t, ts, appID, side)}
+	_ = p.ws.SetReadDeadline(time.Time{})
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			init := c.ToJSON()
+			p.send(signal{Type: "ice", Candidate: &init})
+		}
+	})
+	t.Cleanup(func() {
+		_ = pc.Close()
+		_ = p.ws.Close()
+	})
+	return p
+}
+
+func (p *rtcPeer) send(v any) {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if err := p.ws.WriteJSON(v); err != nil {
+		p.t.Logf("signal write: %v", err)
+	}
+}
+
+// setRemote applies a description and flushes candidates that arrived early.
+func (p *rtcPeer) setRemote(d webrtc.SessionDescription) error {
+	if err := p.pc.SetRemoteDescription(d); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.remote = true
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	for _, c := range pending {
+		if err := p.pc.AddICECandidate(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *rtcPeer) addCandidate(c webrtc.ICECandidateInit) error {
+	p.mu.Lock()
+	if !p.remote {
+		p.pending = append(p.pending, c)
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+	return p.pc.AddICECandidate(c)
+}
+
+// signalLoop handles relayed frames until the socket closes. The answering
+// side replies to offers; room_full starts the offerer.
+func (p *rtcPeer) signalLoop(offerer bool, errs chan<- error) {
+	for {
+		var s signal
+		if err := p.ws.ReadJSON(&s); err != nil {
+			return
+		}
+		var err error
+		switch s.Type {
+		case "room_full":
+			if offerer {
+				var o webrtc.SessionDescription
+				if o, err = p.pc.CreateOffer(nil); err == nil {
+					if err = p.pc.SetLocalDescription(o); err == nil {
+						p.send(signal{Type: "offer", SDP: o.SDP})
+					}
+				}
+			}
+		case "offer":
+			if err = p.setRemote(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: s.SDP}); err == nil {
+				var a webrtc.SessionDescription
+				if a, err = p.pc.CreateAnswer(nil); err == nil {
+					if err = p.pc.SetLocalDescription(a); err == nil {
+						p.send(signal{Type: "answer", SDP: a.SDP})
+					}
+				}
+			}
+		case "answer":
+			err = p.setRemote(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: s.SDP})
+		case "ice":
+			if s.Candidate != nil {
+				err = p.addCandidate(*s.Candidate)
+			}
+		}
+		if err != nil {
+			errs <- err
+			return
+		}
+	}
+}
+
+func TestWebRTCDataChannelOverSignaling(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 30*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := newRTCPeer(t, ts, appID, "A")
+
+	// A creates the channel before the offer so it is negotiated in it
+	dc, err := a.pc.CreateDataChannel("e2e", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+
+	b := newRTCPeer(t, ts, appID, "B")
+	got := make(chan string, 1)
+	b.pc.OnDataChannel(func(d *webrtc.DataChannel) {
+		d.OnMessage(func(m webrtc.DataChannelMessage) {
+			select {
+			case got <- string(m.Data):
+			default:
+			}
+		})
+	})
+
+	errs := make(chan error, 2)
+	go a.signalLoop(true, errs)
+	go b.signalLoop(false, errs)
+
+	select {
+	case <-opened:
+	case err := <-errs:
+		t.Fatalf("signaling: %v", err)
+	case <-time.After(20 * time.Second):
+		t.Fatalf("data channel did not open (A ICE %s, B ICE %s)", a.pc.ICEConnectionState(), b.pc.ICEConnectionState())
+	}
+	if err := dc.SendText("ping"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-got:
+		if m != "ping" {
+			t.Fatalf("got %q", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered over the data channel")
+	}
+
+	// the client reports success the way real clients do
+	a.send(map[string]any{"type": "telemetry", "event": "ice-connected", "localType": "host", "remoteType": "host"})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st, ok := h.RoomState(appID)
+		if ok && st.State == hub.StateEstablished {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("room state %+v %v, want established", st, ok)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
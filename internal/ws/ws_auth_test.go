@@ -0,0 +1,115 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+func TestFirstFrameAuth(t *testing.T) {
+	secret := []byte("k")
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithAuth(ws.HMACAuth(secret), time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	app := uuid.NewString()
+
+	// good token: auth_ok, then registered
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	if err := a.WriteJSON(map[string]string{"type": "auth", "token": ws.HMACToken(secret, app, "A")}); err != nil {
+		t.Fatal(err)
+	}
+	var f struct{ Type, Code string }
+	if err := a.ReadJSON(&f); err != nil || f.Type != "auth_ok" {
+		t.Fatalf("want auth_ok, got %+v %v", f, err)
+	}
+	if n := h.RoomSize(app); n != 1 {
+		t.Fatalf("room size %d after auth, want 1", n)
+	}
+
+	// token for the other side: rejected and never registered
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+	if err := b.WriteJSON(map[string]string{"type": "auth", "token": ws.HMACToken(secret, app, "A")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ReadJSON(&f); err != nil || f.Code != "auth_failed" {
+		t.Fatalf("want auth_failed, got %+v %v", f, err)
+	}
+	if _, _, err := b.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("want 1008 close, got %v", err)
+	}
+	if n := h.RoomSize(app); n != 1 {
+		t.Fatalf("room size %d after failed auth, want 1", n)
+	}
+}
+
+func TestQueryTokenAuth(t *testing.T) {
+	secret := []byte("k")
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(hub.New(), nil, nil, true, ws.WithAuth(ws.HMACAuth(secret), time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	app := uuid.NewString()
+	base := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?appID=" + app + "&side=B&token="
+
+	_, resp, err := websocket.DefaultDialer.Dial(base+"bad", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad token: want 401, got %v %v", resp, err)
+	}
+	c, _, err := websocket.DefaultDialer.Dial(base+ws.HMACToken(secret, app, "B"), nil)
+	if err != nil {
+		t.Fatalf("good token: %v", err)
+	}
+	c.Close()
+}
+
+func TestTicketAuth(t *testing.T) {
+	iss := ticket.New([]byte("k"), time.Minute)
+	h := hub.New()
+	mux := http.NewServeMux()
+	// HMAC auth stays on: a ticket replaces it, no auth frame needed
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithAuth(ws.HMACAuth([]byte("other")), time.Second), ws.WithTickets(iss)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	app := uuid.NewString()
+	base := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?ticket="
+
+	tk, err := iss.Issue(app, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(base+tk+"&side=B", nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("side mismatch: want 401, got %v %v", resp, err)
+	}
+	a, _, err := websocket.DefaultDialer.Dial(base+tk, nil)
+	if err != nil {
+		t.Fatalf("good ticket: %v", err)
+	}
+	defer a.Close()
+	deadline := time.Now().Add(time.Second)
+	for h.RoomSize(app) != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := h.RoomSize(app); n != 1 {
+		t.Fatalf("room size %d after ticket, want 1", n)
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(base+tk, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused ticket: want 401, got %v %v", resp, err)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(base+tk[:len(tk)-2]+"xx", nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("tampered ticket: want 401, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,120 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+type fanFrame struct {
+	Type, ID, Role, From, Code, Joined, Left, Msg string
+	Viewers, Count                                int
+}
+
+// readUntil reads frames from c until one of type typ arrives.
+func readUntil(t *testing.T, c *websocket.Conn, typ string) fanFrame {
+	t.Helper()
+	for {
+		var f fanFrame
+		if err := c.ReadJSON(&f); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if f.Type == typ {
+			return f
+		}
+	}
+}
+
+func TestFanoutRoom(t *testing.T) {
+	h := hub.New()
+	h.SetMaxViewers(2)
+	mux := http.NewServeMux()
+	mux.Handle("/ws/fanout", ws.NewFanoutHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	appID := uuid.NewString()
+	join := func(role string) *websocket.Conn {
+		t.Helper()
+		c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws/fanout?appID="+appID+"&role="+role, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		return c
+	}
+
+	host := join("host")
+	defer host.Close()
+	if f := readUntil(t, host, "joined"); f.ID != "host" || f.Viewers != 0 {
+		t.Fatalf("host joined: %+v", f)
+	}
+	v1 := join("viewer")
+	defer v1.Close()
+	if f := readUntil(t, v1, "joined"); f.ID != "v1" || f.Role != "viewer" {
+		t.Fatalf("viewer joined: %+v", f)
+	}
+	v2 := join("viewer")
+	defer v2.Close()
+	readUntil(t, v2, "joined")
+	if f := readUntil(t, host, "viewers"); f.Count != 1 || f.Joined != "v1" {
+		t.Fatalf("first count: %+v", f)
+	}
+	if f := readUntil(t, host, "viewers"); f.Count != 2 || f.Joined != "v2" {
+		t.Fatalf("second count: %+v", f)
+	}
+
+	// the cap turns a third viewer away with a retry hint
+	v3 := join("viewer")
+	defer v3.Close()
+	if f := readUntil(t, v3, "error"); f.Code != "viewer_cap" {
+		t.Fatalf("over cap: %+v", f)
+	}
+	if _, _, err := v3.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Fatalf("close = %v, want 1013", err)
+	}
+
+	// host frames reach every viewer
+	if err := host.WriteJSON(map[string]any{"type": "meta", "msg": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*websocket.Conn{v1, v2} {
+		if f := readUntil(t, v, "meta"); f.Msg != "hi" {
+			t.Fatalf("viewer got %+v", f)
+		}
+	}
+	// viewer frames only reach the host, tagged with the sender (not spoofable)
+	if err := v2.WriteJSON(map[string]any{"type": "reaction", "from": "host"}); err != nil {
+		t.Fatal(err)
+	}
+	if f := readUntil(t, host, "reaction"); f.From != "v2" {
+		t.Fatalf("host got %+v", f)
+	}
+	// and "to" addresses one viewer
+	if err := host.WriteJSON(map[string]any{"type": "answer", "to": "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, v2, "answer")
+	if err := host.WriteJSON(map[string]any{"type": "meta", "msg": "bye"}); err != nil {
+		t.Fatal(err)
+	}
+	if f := readUntil(t, v1, "meta"); f.Msg != "bye" {
+		t.Fatalf("v1 got a frame addressed to v2 or lost one: %+v", f)
+	}
+
+	// the appID is taken for pair rooms while the fan-out room is open
+	if err := h.Register(appID, "A", "", nil); err == nil {
+		t.Fatal("pair room opened on a fan-out appID")
+	}
+	v1.Close()
+	if f := readUntil(t, host, "viewers"); f.Count != 1 || f.Left != "v1" {
+		t.Fatalf("after leave: %+v", f)
+	}
+}
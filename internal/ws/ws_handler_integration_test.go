@@ -1,14 +1,22 @@
 package ws_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redact"
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -84,3 +92,578 @@ func TestWSRoomFullAndRelay(t *testing.T) {
 		t.Fatalf("relay mismatch: %q", payload)
 	}
 }
+
+func TestWSActivityRelay(t *testing.T) {
+	h := hub.New()
+	// a room budget of one frame: activity must not draw from it
+	h.SetRoomRate(1, 1)
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	_, _, _ = a.ReadMessage() // room_full
+	_, _, _ = b.ReadMessage()
+
+	for i := 0; i < 3; i++ {
+		frame := `{"type":"activity","state":"typing"}`
+		if err := a.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+		if _, p, err := b.ReadMessage(); err != nil || string(p) != frame {
+			t.Fatalf("activity %d: %q %v", i, p, err)
+		}
+	}
+	if _, _, mailbox := h.Stats(); mailbox != 0 {
+		t.Fatalf("activity was queued: %d", mailbox)
+	}
+}
+
+func TestWSDuplicateJoin(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	waitFor(t, func() bool { return h.RoomSize(appID) == 1 })
+	for i := 0; i < 2; i++ {
+		dup := dial(t, ts, appID, "A")
+		var rej struct{ Type, Code string }
+		if err := dup.ReadJSON(&rej); err != nil || rej.Code != "side_busy" {
+			t.Fatalf("duplicate: want side_busy, got %+v (%v)", rej, err)
+		}
+		dup.Close()
+	}
+	// the occupant hears of the first attempt only; the second is throttled
+	var f struct {
+		Type, Side, Source string
+		Attempts           int
+	}
+	if err := a.ReadJSON(&f); err != nil || f.Type != "duplicate_join_attempt" || f.Side != "A" || f.Source == "" || f.Attempts != 1 {
+		t.Fatalf("occupant: got %+v (%v)", f, err)
+	}
+	_ = a.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, p, err := a.ReadMessage(); err == nil {
+		t.Fatalf("second notice not throttled: %s", p)
+	}
+	if st, _ := h.RoomState(appID); st.DuplicateJoins != 2 {
+		t.Fatalf("duplicateJoins = %d, want 2", st.DuplicateJoins)
+	}
+}
+
+func TestWSPauseResume(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	_, _, _ = a.ReadMessage() // room_full
+	_, _, _ = b.ReadMessage()
+
+	var f struct {
+		Type string
+		Seq  uint64
+	}
+	// B pauses: A is told, and mailbox items for B are held
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"pause"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReadJSON(&f); err != nil || f.Type != "pause" {
+		t.Fatalf("want pause, got %+v (%v)", f, err)
+	}
+	if st, _ := h.RoomState(appID); strings.Join(st.Paused, ",") != "B" {
+		t.Fatalf("paused = %v", st.Paused)
+	}
+	for i := 0; i < 2; i++ {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"send","to":"B","payload":{"n":1}}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { _, _, n := h.Stats(); return n == 2 })
+	_ = b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, p, err := b.ReadMessage(); err == nil {
+		t.Fatalf("delivered while paused: %s", p)
+	}
+	b.Close()
+	waitFor(t, func() bool { st, _ := h.RoomState(appID); return st.Peers == 1 })
+
+	// the pause ends with the connection
+	if st, _ := h.RoomState(appID); len(st.Paused) != 0 {
+		t.Fatalf("pause outlived B: %v", st.Paused)
+	}
+	// pause then resume: the held items are replayed in order
+	b = dial(t, ts, appID, "B")
+	defer b.Close()
+	_, _, _ = b.ReadMessage() // room_full
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"pause"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"resume"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(0); want < 2; want++ {
+		if err := b.ReadJSON(&f); err != nil || f.Type != "send" || f.Seq != want {
+			t.Fatalf("replay %d: %+v (%v)", want, f, err)
+		}
+	}
+	if st, _ := h.RoomState(appID); len(st.Paused) != 0 {
+		t.Fatalf("still paused: %v", st.Paused)
+	}
+}
+
+func TestWSFeaturesNegotiated(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	_, _, _ = a.ReadMessage() // room_full
+	_, _, _ = b.ReadMessage()
+
+	_ = a.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","features":["ice_batch","binary"]}`))
+	_ = b.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","features":["binary"]}`))
+	for _, c := range []*websocket.Conn{a, b} {
+		var f struct {
+			Type     string   `json:"type"`
+			Features []string `json:"features"`
+		}
+		if err := c.ReadJSON(&f); err != nil || f.Type != "features_negotiated" || len(f.Features) != 1 || f.Features[0] != "binary" {
+			t.Fatalf("got %+v %v", f, err)
+		}
+	}
+}
+
+func TestWSUnpairedEviction(t *testing.T) {
+	h := hub.New()
+	h.SetMaxUnpaired(1)
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	first, second := uuid.NewString(), uuid.NewString()
+	old := dial(t, ts, first, "A")
+	defer old.Close()
+	waitFor(t, func() bool { return h.RoomSize(first) == 1 })
+	c := dial(t, ts, second, "A") // over the cap: first is evicted
+	defer c.Close()
+
+	var f struct {
+		Type string `json:"type"`
+	}
+	if err := old.ReadJSON(&f); err != nil || f.Type != "pairing_timeout" {
+		t.Fatalf("got %+v %v, want pairing_timeout", f, err)
+	}
+	_, _, err := old.ReadMessage()
+	if !websocket.IsCloseError(err, hub.ClosePairingTimeout) {
+		t.Fatalf("close = %v, want %d", err, hub.ClosePairingTimeout)
+	}
+	if h.RoomSize(second) != 1 {
+		t.Fatal("new room not admitted")
+	}
+}
+
+func TestWSGoodbyeReason(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	type left struct{ Type, Side, Reason string }
+	for _, tc := range []struct{ goodbye, want string }{
+		{`{"type":"goodbye","reason":"user_cancelled"}`, "user_cancelled"},
+		{`{"type":"goodbye","reason":"something else"}`, "other"},
+		{"", ws.LeftClosed},
+	} {
+		b := dial(t, ts, appID, "B")
+		_, _, _ = b.ReadMessage() // room_full
+		if tc.goodbye != "" {
+			_ = b.WriteMessage(websocket.TextMessage, []byte(tc.goodbye))
+		}
+		_ = b.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		b.Close()
+		for {
+			var f left
+			if err := a.ReadJSON(&f); err != nil {
+				t.Fatal(err)
+			}
+			if f.Type == "room_full" {
+				continue
+			}
+			if f != (left{"peer_left", "B", tc.want}) {
+				t.Fatalf("got %+v, want peer_left %s", f, tc.want)
+			}
+			break
+		}
+		if st, _ := h.RoomState(appID); st.Left["B"] != tc.want {
+			t.Fatalf("room left = %v, want B:%s", st.Left, tc.want)
+		}
+	}
+}
+
+func TestWSRoomFullRetryHint(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 4*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	waitFor(t, func() bool { return h.RoomSize(appID) == 2 })
+
+	type rejected struct {
+		Code         string
+		MightFreeUp  bool
+		RetryAfterMs int64
+		Backoff      *ws.Backoff
+	}
+	third := dial(t, ts, appID, "B")
+	defer third.Close()
+	var f rejected
+	if err := third.ReadJSON(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Code != "room_full" || !f.MightFreeUp || f.RetryAfterMs != 1000 || f.Backoff == nil || f.Backoff.MaxMs != 4000 {
+		t.Fatalf("got %+v", f)
+	}
+	if _, _, err := third.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Fatalf("close = %v, want 1013", err)
+	}
+
+	// an established room is unlikely to free up: no retry hint
+	h.MarkEstablished(appID)
+	fourth := dial(t, ts, appID, "A")
+	defer fourth.Close()
+	f = rejected{}
+	if err := fourth.ReadJSON(&f); err != nil || f.Code != "room_full" || f.MightFreeUp || f.Backoff != nil {
+		t.Fatalf("established: got %+v %v", f, err)
+	}
+	if _, _, err := fourth.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("close = %v, want 1008", err)
+	}
+}
+
+// syncBuffer is a log sink safe for the handler's goroutines.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestWSDebugFrameRedacted(t *testing.T) {
+	var logs syncBuffer
+	lg := slog.New(slog.NewJSONHandler(&logs, nil))
+	r, err := redact.New("meta.user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, lg, true, ws.WithLimits(1<<20, 2*time.Second), ws.WithRedactor(r)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	h.SetDebug(appID, time.Minute, 1)
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	waitFor(t, func() bool { return h.RoomSize(appID) == 2 })
+
+	offer := map[string]any{"type": "offer", "sdp": "v=0\r\nc=IN IP4 203.0.113.7\r\n", "meta": map[string]any{"user": "alice"}}
+	if err := a.WriteJSON(offer); err != nil {
+		t.Fatal(err)
+	}
+	// the peer gets the frame untouched
+	for {
+		var f map[string]any
+		if err := b.ReadJSON(&f); err != nil {
+			t.Fatal(err)
+		}
+		if f["type"] == "offer" {
+			if f["sdp"] != offer["sdp"] {
+				t.Fatalf("relayed sdp changed: %v", f["sdp"])
+			}
+			break
+		}
+	}
+	waitFor(t, func() bool { return strings.Contains(logs.String(), `"msg":"ws frame"`) })
+	if out := logs.String(); strings.Contains(out, "203.0.113.7") || strings.Contains(out, "alice") || !strings.Contains(out, "c=IN IP4 [redacted]") {
+		t.Fatalf("debug log not redacted:\n%s", out)
+	}
+}
+
+func TestWSRelayEnvelope(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	defer b.Close()
+	_, _, _ = a.ReadMessage() // room_full
+	_, _, _ = b.ReadMessage()
+
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_mode","envelope":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	var mode struct {
+		Type     string
+		Envelope bool
+	}
+	if err := b.ReadJSON(&mode); err != nil || mode.Type != "mode" || !mode.Envelope {
+		t.Fatalf("want mode envelope, got %+v (%v)", mode, err)
+	}
+	_, _, _ = a.ReadMessage() // mode
+
+	start := time.Now().UnixMilli()
+	for _, frame := range []string{`{"type":"offer","sdp":"v=0"}`, `{"type":"ice","candidate":"c1"}`} {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []string{"offer", "ice"} {
+		var env struct {
+			From      string
+			RelayedAt int64
+			Seq       uint64
+			Payload   json.RawMessage
+		}
+		if err := b.ReadJSON(&env); err != nil {
+			t.Fatal(err)
+		}
+		var inner struct{ Type string }
+		_ = json.Unmarshal(env.Payload, &inner)
+		if env.From != "A" || env.Seq != uint64(i) || env.RelayedAt < start || inner.Type != want {
+			t.Fatalf("envelope %d: %+v %s", i, env, env.Payload)
+		}
+	}
+	if st, _ := h.RoomState(appID); !st.Envelope {
+		t.Fatal("room status: envelope not set")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+	}
+}
+
+func TestWSShutdownUnderLoad(t *testing.T) {
+	h := hub.New()
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 30*time.Second), ws.WithShutdown(ctx)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	const rooms = 10
+	stop := make(chan struct{})
+	var senders sync.WaitGroup
+	var readers []*websocket.Conn
+	for i := 0; i < rooms; i++ {
+		appID := uuid.NewString()
+		a, b := dial(t, ts, appID, "A"), dial(t, ts, appID, "B")
+		defer a.Close()
+		defer b.Close()
+		readers = append(readers, a, b)
+		senders.Add(1)
+		go func() { // keep frames flowing A -> B until shutdown
+			defer senders.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"ice","candidate":"x"}`)); err != nil {
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	// a peer that never reads can't answer the close frame
+	silent := dial(t, ts, uuid.NewString(), "A")
+	defer silent.Close()
+	waitFor(t, func() bool { _, conns, _ := h.Stats(); return conns == 2*rooms+1 })
+
+	shutdown()
+	close(stop)
+	for i, c := range readers {
+		_ = c.SetReadDeadline(time.Now().Add(3 * time.Second))
+		for {
+			_, _, err := c.ReadMessage()
+			if err == nil {
+				continue
+			}
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway || ce.Text != ws.CloseReasonShutdown {
+				t.Fatalf("conn %d: got %v, want 1001 %q", i, err, ws.CloseReasonShutdown)
+			}
+			break
+		}
+	}
+	senders.Wait()
+	waitFor(t, func() bool { _, conns, _ := h.Stats(); return conns == 0 })
+}
+
+func TestWSRoomFullOncePerConnection(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	type full struct {
+		Type        string
+		Sides       []string
+		Established bool
+		Epoch       int
+	}
+	read := func(c *websocket.Conn) full {
+		t.Helper()
+		var f full
+		if err := c.ReadJSON(&f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	appID := uuid.NewString()
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	for _, c := range []*websocket.Conn{a, b} {
+		if f := read(c); f.Type != "room_full" || f.Epoch != 1 || f.Established || strings.Join(f.Sides, ",") != "A,B" {
+			t.Fatalf("first pairing: %+v", f)
+		}
+	}
+
+	// B flaps: the new connection is told, A isn't told again
+	b.Close()
+	if f := read(a); f.Type != "peer_left" {
+		t.Fatalf("want peer_left, got %+v", f)
+	}
+	b = dial(t, ts, appID, "B")
+	defer b.Close()
+	if f := read(b); f.Type != "room_full" || f.Epoch != 2 {
+		t.Fatalf("rejoin: %+v", f)
+	}
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"offer","sdp":"x"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if f := read(a); f.Type != "offer" {
+		t.Fatalf("A got %+v before the offer", f)
+	}
+}
+
+func TestDebugFeed(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second)))
+	mux.Handle("GET /debug/room/{appID}/events", ws.NewDebugFeed(h))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	appID := uuid.NewString()
+
+	res, err := http.Get(ts.URL + "/debug/room/" + appID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	lines := make(chan string, 64)
+	go func() {
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			if l, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				lines <- l[len("15:04:05.000 "):]
+			}
+		}
+		close(lines)
+	}()
+	expect := func(want string) {
+		t.Helper()
+		for {
+			select {
+			case l, ok := <-lines:
+				if !ok {
+					t.Fatalf("feed ended before %q", want)
+				}
+				if strings.HasPrefix(l, want) {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("no %q in feed", want)
+			}
+		}
+	}
+	expect("watching " + appID + ": room not open yet")
+
+	a := dial(t, ts, appID, "A")
+	defer a.Close()
+	b := dial(t, ts, appID, "B")
+	expect("A joined")
+	expect("B joined")
+	expect("room half_joined → paired")
+	_, _, _ = a.ReadMessage() // room_full
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"offer","sdp":"x"}`)); err != nil {
+		t.Fatal(err)
+	}
+	expect("A → server  offer  26 B")
+	expect("server → B  offer  26 B")
+	_ = b.WriteJSON(map[string]string{"type": "goodbye", "reason": "completed"})
+	b.Close()
+	expect("B left (completed)")
+}
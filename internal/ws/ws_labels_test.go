@@ -0,0 +1,67 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+func TestWSLabels(t *testing.T) {
+	h := hub.New()
+	m := metrics.New()
+	h.SetMetrics(m)
+	h.SetLabelMetrics([]string{"platform"})
+	tenant := func(*http.Request, params.ConnectParams) map[string]string {
+		return map[string]string{"tenant": "acme"}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, 2*time.Second), ws.WithMetrics(m), ws.WithLabeler(tenant)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	appID := uuid.NewString()
+	u := "ws" + ts.URL[len("http"):] + "/ws?appID=" + appID + "&side=A"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(u+"&label.platform=i%3Cos", nil); err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad label: want 400, got %v", err)
+	}
+	a, _, err := websocket.DefaultDialer.Dial(u+"&label.platform=ios&label.tenant=other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { st, _ := h.RoomState(appID); return st.Labels["A"]["platform"] == "ios" })
+	if st, _ := h.RoomState(appID); st.Labels["A"]["tenant"] != "acme" {
+		t.Fatalf("labeler should win: %v", st.Labels["A"])
+	}
+
+	// hello fills in keys the query didn't set
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","labels":{"platform":"web","app_version":"1.4.2"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { st, _ := h.RoomState(appID); return st.Labels["A"]["app_version"] == "1.4.2" })
+	if st, _ := h.RoomState(appID); st.Labels["A"]["platform"] != "ios" {
+		t.Fatalf("query should win over hello: %v", st.Labels["A"])
+	}
+	_ = a.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","labels":{"Bad":"x"}}`))
+	var f struct{ Type, Code string }
+	_ = a.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := a.ReadJSON(&f); err != nil || f.Code != "labels_invalid" {
+		t.Fatalf("want labels_invalid, got %+v (%v)", f, err)
+	}
+
+	ios := m.WSLabeledConns.WithLabelValues("platform", "ios")
+	if got := testutil.ToFloat64(ios); got != 1 {
+		t.Fatalf("ios connections = %v, want 1", got)
+	}
+	_ = a.Close()
+	waitFor(t, func() bool { return testutil.ToFloat64(ios) == 0 })
+}
@@ -0,0 +1,95 @@
+package ws_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+func TestLegacyProtocolShim(t *testing.T) {
+	m := metrics.New()
+	v1 := ws.LegacyProtocol{
+		Subprotocol: "nt.v1",
+		Types:       map[string]string{"candidate": "ice"},
+		Fields:      map[string]map[string]string{"ice": {"cand": "candidate"}},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(hub.New(), nil, nil, true,
+		ws.WithLimits(1<<20, 2*time.Second), ws.WithMetrics(m), ws.WithLegacyProtocol(v1)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dialProto := func(appID, side string, protos ...string) *websocket.Conn {
+		t.Helper()
+		u, _ := url.Parse(ts.URL)
+		u.Scheme, u.Path = "ws", "/ws"
+		u.RawQuery = url.Values{"appID": {appID}, "side": {side}}.Encode()
+		d := websocket.Dialer{Subprotocols: protos}
+		c, _, err := d.Dial(u.String(), nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", side, err)
+		}
+		_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		return c
+	}
+	// relay sends frame from one side and returns what the other one got
+	relay := func(from, to *websocket.Conn, frame string) map[string]any {
+		t.Helper()
+		if err := from.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+		_, p, err := to.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f map[string]any
+		_ = json.Unmarshal(p, &f)
+		return f
+	}
+
+	for _, via := range []string{"subprotocol", "shape"} {
+		t.Run(via, func(t *testing.T) {
+			appID := uuid.NewString()
+			var old *websocket.Conn
+			if via == "subprotocol" {
+				old = dialProto(appID, "A", "nt.v1")
+				if old.Subprotocol() != "nt.v1" {
+					t.Fatalf("negotiated %q", old.Subprotocol())
+				}
+			} else {
+				old = dialProto(appID, "A")
+			}
+			defer old.Close()
+			cur := dialProto(appID, "B")
+			defer cur.Close()
+			_, _, _ = old.ReadMessage() // room_full
+			_, _, _ = cur.ReadMessage()
+
+			// v1 in, v2 out to the current peer ...
+			if f := relay(old, cur, `{"type":"candidate","cand":"c1"}`); f["type"] != "ice" || f["candidate"] != "c1" {
+				t.Fatalf("upgraded: %v", f)
+			}
+			// ... and back down for the legacy one
+			if f := relay(cur, old, `{"type":"ice","candidate":"c2"}`); f["type"] != "candidate" || f["cand"] != "c2" {
+				t.Fatalf("downgraded: %v", f)
+			}
+			if n := testutil.ToFloat64(m.WSLegacyConns.WithLabelValues(via)); n != 1 {
+				t.Fatalf("legacy connections via %s = %v", via, n)
+			}
+		})
+	}
+	if n := testutil.ToFloat64(m.WSLegacyFrames.WithLabelValues("in")); n != 2 {
+		t.Fatalf("legacy frames in = %v, want 2", n)
+	}
+}
@@ -0,0 +1,59 @@
+package ws_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestParkThenPeerJoinFiresWebhook(t *testing.T) {
+	events := make(chan webhook.Event, 4)
+	hookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhook.Event
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer hookSrv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := webhook.New(hookSrv.URL, "")
+	d.Start(ctx)
+
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true,
+		ws.WithLimits(1<<20, time.Second), ws.WithParking(time.Minute), ws.WithWebhooks(d)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"park"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var f struct{ Type string }
+	if err := a.ReadJSON(&f); err != nil || f.Type != "parked" {
+		t.Fatalf("want parked, got %q (%v)", f.Type, err)
+	}
+
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+	select {
+	case ev := <-events:
+		if ev.Type != "peer_joined" || ev.AppID != app || ev.Side != "B" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no peer_joined webhook")
+	}
+}
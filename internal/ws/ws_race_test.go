@@ -3,6 +3,7 @@ package ws_test
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -10,9 +11,11 @@ import (
 	"time"
 
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
 	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestPingAndBroadcastNoRace(t *testing.T) {
@@ -109,3 +112,375 @@ func TestMailboxSendHelloDelivered(t *testing.T) {
 		t.Fatalf("delivered write: %v", err)
 	}
 }
+
+func TestDeliveredAcksMailbox(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+	for range 3 {
+		_ = h.Enqueue(app, "A", "B", json.RawMessage(`{}`))
+	}
+	// without a seq nothing is acked, not even item 0
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"delivered"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_ = b.SetReadDeadline(time.Now().Add(time.Second))
+		var f struct{ Type, Code, Field string }
+		if err := b.ReadJSON(&f); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if f.Type == "error" {
+			if f.Code != "field_missing" || f.Field != "seq" {
+				t.Fatalf("bad error frame: %+v", f)
+			}
+			break
+		}
+	}
+	if items, _ := h.MailboxItems(app, "B"); len(items) != 3 {
+		t.Fatalf("seq-less delivered acked: %d items left", len(items))
+	}
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"delivered","seq":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		items, _ := h.MailboxItems(app, "B")
+		return len(items) == 1 && items[0].Seq == 2
+	})
+}
+
+func TestOneWayRoomRejectsReverse(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_mode","oneWay":"A"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// wait until B has seen the mode change
+	for {
+		var f struct{ Type string }
+		if err := b.ReadJSON(&f); err != nil {
+			t.Fatalf("read mode: %v", err)
+		}
+		if f.Type == "mode" {
+			break
+		}
+	}
+	if err := b.WriteMessage(websocket.TextMessage, []byte(`{"type":"offer","sdp":"x"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		var f struct{ Type, Code string }
+		if err := b.ReadJSON(&f); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if f.Type == "error" {
+			if f.Code != "direction_not_allowed" {
+				t.Fatalf("unexpected error code %q", f.Code)
+			}
+			return
+		}
+	}
+	t.Fatal("no direction_not_allowed error received")
+}
+
+func TestSendEchoToSender(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"send","to":"B","echo":true,"payload":{"n":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = a.SetReadDeadline(time.Now().Add(time.Second))
+		var f struct {
+			Type, To string
+			Echo     bool
+			Seq      uint64
+			Ts       int64
+			Payload  json.RawMessage
+		}
+		if err := a.ReadJSON(&f); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if f.Type == "send" {
+			if !f.Echo || f.To != "B" || f.Seq != 0 || f.Ts == 0 || string(f.Payload) != `{"n":1}` {
+				t.Fatalf("bad echo frame: %+v", f)
+			}
+			return
+		}
+	}
+	t.Fatal("sender got no echo")
+}
+
+func TestSendWithMistypedField(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+
+	// a mistyped field send doesn't read is ignored: the item is queued
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"send","to":"B","payload":{"n":1},"reason":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		items, _ := h.MailboxItems(app, "B")
+		return len(items) == 1 && items[0].Size == len(`{"n":1}`)
+	})
+
+	// one it does read gets an error instead of a silent drop
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"send","to":"B","payload":{"n":2},"ttlMs":1.5}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = a.SetReadDeadline(time.Now().Add(time.Second))
+		var f struct{ Type, Code, Ref, Field string }
+		if err := a.ReadJSON(&f); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if f.Type == "error" {
+			if f.Code != "field_invalid" || f.Ref != "send" || f.Field != "ttlMs" {
+				t.Fatalf("bad error frame: %+v", f)
+			}
+			if items, _ := h.MailboxItems(app, "B"); len(items) != 1 {
+				t.Fatalf("mistyped send queued: %d items", len(items))
+			}
+			return
+		}
+	}
+	t.Fatal("no field_invalid error received")
+}
+
+func TestRelayEchoToSender(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	b := dial(t, ts, app, "B")
+	defer b.Close()
+	_, _, _ = a.ReadMessage() // room_full
+	_, _, _ = b.ReadMessage()
+
+	start := time.Now().UnixMilli()
+	for _, frame := range []string{`{"type":"ice","candidate":"c0"}`, `{"type":"offer","sdp":"v=0","echo":true}`} {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the sender gets only the echoed frame, wrapped
+	_ = a.SetReadDeadline(time.Now().Add(time.Second))
+	var echo struct {
+		Type    string
+		Echo    bool
+		Seq     uint64
+		Ts      int64
+		Payload json.RawMessage
+	}
+	if err := a.ReadJSON(&echo); err != nil {
+		t.Fatal(err)
+	}
+	var inner struct{ Type string }
+	_ = json.Unmarshal(echo.Payload, &inner)
+	if echo.Type != "" || !echo.Echo || echo.Seq != 1 || echo.Ts < start || inner.Type != "offer" {
+		t.Fatalf("bad echo frame: %+v %s", echo, echo.Payload)
+	}
+	// the peer gets both frames as sent
+	for _, want := range []string{"ice", "offer"} {
+		_ = b.SetReadDeadline(time.Now().Add(time.Second))
+		var f struct{ Type string }
+		if err := b.ReadJSON(&f); err != nil || f.Type != want {
+			t.Fatalf("peer got %+v (%v), want %s", f, err, want)
+		}
+	}
+}
+
+func TestWSMessagesCountsMalformedAndUnknown(t *testing.T) {
+	h := hub.New()
+	m := metrics.New() // isolated from other tests' counts
+	h.SetMetrics(m)
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithLimits(1<<20, time.Second), ws.WithMetrics(m)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	count := func(label string) float64 { return testutil.ToFloat64(m.WSMessages.WithLabelValues(label)) }
+	malformed, unknown, hello := count("malformed_json"), count("unknown_type"), count("hello")
+
+	a := dial(t, ts, uuid.NewString(), "A")
+	defer a.Close()
+	for _, f := range []string{`{not json`, `{"type":"x-custom"}`, `{}`, `{"type":"hello"}`} {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for count("hello") == hello && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d := count("malformed_json") - malformed; d != 1 {
+		t.Fatalf("malformed_json += %v, want 1", d)
+	}
+	if d := count("unknown_type") - unknown; d != 2 {
+		t.Fatalf("unknown_type += %v, want 2", d)
+	}
+}
+
+func TestOutdatedClientRejected(t *testing.T) {
+	cp, _ := ws.ParseClientPolicy("web:1.4.0")
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithClientPolicy(cp)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	u := "ws" + ts.URL[len("http"):] + "/ws?appID=" + app + "&side=A&clientName=web&clientVersion=1.3.0"
+	c, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var f struct{ Type, Code string }
+	if err := c.ReadJSON(&f); err != nil || f.Code != "client_unsupported" {
+		t.Fatalf("want client_unsupported, got %+v %v", f, err)
+	}
+	_, _, err = c.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation || ce.Text == "" {
+		t.Fatalf("want 1008 with reason, got %v", err)
+	}
+	if n := h.RoomSize(app); n != 0 {
+		t.Fatalf("rejected client registered (room size %d)", n)
+	}
+}
+
+func TestWrongRegionRedirected(t *testing.T) {
+	urls, err := ws.ParseRegionURLs("eu=wss://eu.example.com/ws,us=wss://us.example.com/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true, ws.WithRegion("eu", urls)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	u := "ws" + ts.URL[len("http"):] + "/ws?appID=" + app + "&side=A&region=us"
+	c, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var f struct{ Type, Region, URL string }
+	if err := c.ReadJSON(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != "redirect" || f.Region != "us" || f.URL != "wss://us.example.com/ws?appID="+app+"&side=A&region=us" {
+		t.Fatalf("bad redirect: %+v", f)
+	}
+	if n := h.RoomSize(app); n != 0 {
+		t.Fatalf("redirected peer registered (room size %d)", n)
+	}
+
+	// no region hint: served here
+	a := dial(t, ts, uuid.NewString(), "A")
+	defer a.Close()
+}
+
+func TestSelfPairDenied(t *testing.T) {
+	h := hub.New()
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, false, ws.WithSelfPair(ws.SelfPairDeny, nil)))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	// A's origin is recorded right after it registers
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if st, _ := h.RoomState(app); st.Origins["A"] != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("A's origin never recorded")
+		}
+	}
+
+	u := "ws" + ts.URL[len("http"):] + "/ws?appID=" + app + "&side=B"
+	_, res, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil || res == nil || res.StatusCode != http.StatusConflict {
+		t.Fatalf("want 409 for same-origin B, got %v %v", res, err)
+	}
+	if st, _ := h.RoomState(app); len(st.Origins) != 1 || st.Origins["A"] == "" {
+		t.Fatalf("origins: %+v", st.Origins)
+	}
+}
+
+func TestMaxSessionWarnsThenCloses(t *testing.T) {
+	h := hub.New()
+	h.SetMaxSession(time.Hour, time.Minute)
+	mux := http.NewServeMux()
+	mux.Handle("/ws", ws.NewWSHandler(h, nil, nil, true))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	app := uuid.NewString()
+	a := dial(t, ts, app, "A")
+	defer a.Close()
+	for h.RoomSize(app) != 1 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	h.ExpireSessions(time.Now().Add(time.Hour - 30*time.Second))
+	var f struct {
+		Type string
+		In   int
+	}
+	if err := a.ReadJSON(&f); err != nil || f.Type != "session_expiring" || f.In < 25 || f.In > 30 {
+		t.Fatalf("want session_expiring in ~30s, got %+v %v", f, err)
+	}
+	h.ExpireSessions(time.Now().Add(2 * time.Hour))
+	_, _, err := a.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != hub.CloseSessionExpired {
+		t.Fatalf("want close %d, got %v", hub.CloseSessionExpired, err)
+	}
+}
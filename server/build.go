@@ -0,0 +1,611 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/admin"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/audit"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/breaker"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/flags"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/health"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ice"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/k8s"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/logs"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redact"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redis"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/rendezvous"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/slo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/stun"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/usage"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/webhook"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws/params"
+)
+
+// build wires everything New returns; on error the caller runs s.closers.
+func (s *Server) build() error {
+	cfg := s.cfg
+
+	// 1) Logging, instance labels, metrics
+	if s.opts.inst != nil {
+		s.inst = *s.opts.inst
+	} else {
+		s.inst = k8s.InstanceFromEnv()
+	}
+	base, err := s.logger()
+	if err != nil {
+		return err
+	}
+	if s.log, err = s.srvLogger(base); err != nil {
+		return err
+	}
+	if len(cfg.DeprecatedEnv) > 0 {
+		s.log.Warn("deprecated unprefixed env vars in use; set the prefixed names instead",
+			zap.String("prefix", cfg.EnvPrefix), zap.Strings("vars", cfg.DeprecatedEnv))
+	}
+	s.m = s.opts.metrics
+	if s.m == nil {
+		s.m = metrics.Default
+	}
+	s.m.InstanceInfo.WithLabelValues(s.inst.Pod, s.inst.Zone).Set(1)
+	s.m.ConfigureBuckets(metrics.Buckets{
+		TTF:          cfg.BucketsTTF,
+		RTT:          cfg.BucketsRTT,
+		RelayLatency: cfg.BucketsRelayLatency,
+		FrameSize:    cfg.BucketsFrameSize,
+	})
+	if err := s.m.Disable(cfg.MetricsDisable...); err != nil {
+		return fmt.Errorf("invalid METRICS_DISABLE: %w", err)
+	}
+
+	if s.proxies, err = middleware.ParseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	var allow *middleware.IPAllowlist
+	if len(cfg.AllowCIDRs) > 0 {
+		if allow, err = middleware.NewIPAllowlist(cfg.AllowCIDRs, s.proxies); err != nil {
+			return fmt.Errorf("invalid ALLOW_CIDRS: %w", err)
+		}
+	}
+	if cfg.GeoIPDB != "" {
+		if s.geo, err = geo.Open(cfg.GeoIPDB, cfg.GeoIPCacheSize); err != nil {
+			return fmt.Errorf("GEOIP_DB: %w", err)
+		}
+	}
+	var auditLog *audit.Logger
+	if cfg.AuditLog != "" {
+		if auditLog, err = audit.New(cfg.AuditLog, s.proxies); err != nil {
+			return fmt.Errorf("audit log: %w", err)
+		}
+		auditLog.WithGeo(s.geo)
+		s.closers = append(s.closers, func() { _ = auditLog.Sync() })
+	}
+	newRL, err := s.rateLimiters()
+	if err != nil {
+		return err
+	}
+	wsRL := newRL("ws", cfg.WSRatePerMin)
+	httpRL := newRL("http", cfg.HTTPRatePerMin)
+
+	// 2) Mux + core endpoints
+	s.mux = http.NewServeMux()
+	s.hc = health.New()
+	s.mux.Handle("/healthz", s.hc.Healthz())
+	s.mux.Handle("/readyz", s.hc.Readyz())
+	s.mux.Handle("/statusz", s.hc.Statusz())
+	s.mux.Handle(cfg.MetricsRoute, s.m.Handler())
+	var served []Feature // public features actually mounted, for GET /config
+	if s.enabled(ICE) {
+		if err := s.ice(httpRL); err != nil {
+			return err
+		}
+		served = append(served, ICE)
+	}
+	iceStats := ice.NewAnalytics().WithMetrics(s.m)
+	usageStats := usage.New().WithMetrics(s.m)
+	sli := slo.New(slo.DefaultWindow)
+	for _, c := range sli.Collectors() {
+		// a second Server sharing the metrics keeps reporting the first one's SLIs
+		if err := s.m.Registry().Register(c); err != nil && !errors.As(err, new(prometheus.AlreadyRegisteredError)) {
+			return fmt.Errorf("sli collectors: %w", err)
+		}
+	}
+
+	ids, err := idgen.ParseSet(cfg.AppIDFormats)
+	if err != nil {
+		return fmt.Errorf("invalid APPID_FORMATS: %w", err)
+	}
+	if cfg.WSTicketSecret != "" {
+		s.tickets = ticket.New([]byte(cfg.WSTicketSecret), cfg.WSTicketTTL)
+	}
+
+	// 3) Rendezvous API (rate-limited if configured)
+	var rz *rendezvous.Store
+	if s.enabled(Rendezvous) {
+		if rz, err = s.rendezvous(ids, httpRL, newRL); err != nil {
+			return err
+		}
+		served = append(served, Rendezvous)
+	}
+	if err := s.checkLimiters(); err != nil {
+		return err
+	}
+
+	// 4) WebSocket signaling (big-handler compatible) + WS rate limit + tuning
+	var hooks *webhook.Dispatcher
+	if cfg.WebhookURL != "" {
+		hooks = webhook.New(cfg.WebhookURL, cfg.WebhookSecret).WithMetrics(s.m)
+		if cfg.PersistDir != "" {
+			kv, err := openPersist(cfg)
+			if err != nil {
+				return fmt.Errorf("webhook outbox: %w", err)
+			}
+			hooks.WithOutbox(kv, cfg.WebhookMaxAttempts)
+		}
+		s.job(hooks.Start)
+	}
+	local, err := flags.Parse(cfg.FeatureFlags)
+	if err != nil {
+		return fmt.Errorf("invalid FEATURE_FLAGS: %w", err)
+	}
+	s.flags = flags.New(local).Logger(logs.Slog(s.log.With(zap.String("sys", "flags")))).WithMetrics(s.m)
+	if cfg.FeatureFlagsURL != "" {
+		s.flags.Poll(cfg.FeatureFlagsURL, cfg.FeatureFlagsInterval)
+		s.job(s.flags.Start)
+	}
+	s.buffers = ws.NewBufferTuner(cfg.WSReadBuf, cfg.WSWriteBuf, cfg.WSBuffersAuto)
+	wsOptions, err := s.wsOptions(wsRL, sli, iceStats, usageStats, auditLog, hooks, ids)
+	if err != nil {
+		return err
+	}
+	// ws/hub log through slog; per-room debug output (admin API) lands here too
+	wsFirst, wsThen, err := logs.ParseSample(cfg.LogWSSample)
+	if err != nil {
+		return fmt.Errorf("LOG_WS_SAMPLE: %w", err)
+	}
+	wsLog := logs.Slog(logs.Sampled(base, wsFirst, wsThen).With(zap.String("sys", "ws"), zap.String("pod", s.inst.Pod)))
+	h := hub.New()
+	s.hub = h
+	h.SetMetrics(s.m)
+	h.SetLogger(wsLog)
+	h.SetRoomRate(cfg.RoomMsgRate, cfg.RoomMsgBurst)
+	h.SetFrameLimits(hub.FrameLimits{Total: cfg.RoomMaxFrames, PerMin: cfg.RoomMaxFramesPerMin})
+	h.SetTraceFrames(cfg.WSTraceFrames)
+	h.SetMetaLimit(cfg.RoomMetaMaxBytes)
+	h.SetResumeGrace(cfg.RoomResumeGrace)
+	h.SetOfferMaxAge(cfg.MailboxOfferMaxAge)
+	h.SetMailboxTTL(cfg.MailboxTTL)
+	h.SetDropBoxTTL(cfg.DropBoxTTL)
+	s.job(h.StartJanitor)
+	h.SetMaxUnpaired(cfg.MaxUnpairedRooms)
+	h.SetMaxViewers(cfg.FanoutMaxViewers)
+	h.SetLabelMetrics(cfg.WSLabelMetrics)
+	if cfg.HubSnapshot {
+		if err := s.restoreHub(h); err != nil {
+			return fmt.Errorf("hub snapshot: %w", err)
+		}
+	}
+	if chaos := (hub.Chaos{Latency: cfg.ChaosLatency, Jitter: cfg.ChaosJitter, Drop: cfg.ChaosDrop, Seed: uint64(cfg.ChaosSeed)}); chaos.Enabled() {
+		s.log.Warn("injecting network conditions on the relay path", zap.Duration("latency", chaos.Latency),
+			zap.Duration("jitter", chaos.Jitter), zap.Float64("drop", chaos.Drop), zap.Uint64("seed", chaos.Seed))
+		h.SetChaos(chaos)
+	}
+	s.m.ObserveHub(h.Stats)
+	s.m.ObserveMailboxAge(h.OldestMailboxItem)
+	h.OnTransition(sli.Transition)
+	if cfg.MaxSessionDuration > 0 {
+		h.SetMaxSession(cfg.MaxSessionDuration, cfg.MaxSessionWarn)
+		s.job(h.StartSessionLimits)
+	}
+	if rz != nil {
+		// a redeem that lost the race against expiry gets a reissue hint while the room is open
+		rz.WithRoomLookup(func(appID string) bool { return h.RoomSize(appID) > 0 })
+		if cfg.RendezvousMultiRedeem {
+			// codes stay redeemable until both peers are in the room
+			h.OnTransition(func(appID string, _, to hub.State) {
+				if to == hub.StatePaired {
+					rz.MarkPaired(appID)
+				}
+			})
+		}
+	}
+	if s.enabled(Push) {
+		notifier, err := newNotifier(cfg, h, ids, s.m)
+		if err != nil {
+			return err
+		}
+		if notifier != nil {
+			s.job(notifier.Start)
+			s.mux.Handle("/push/", httpRL.Middleware()(http.StripPrefix("/push", notifier.Routes())))
+			served = append(served, Push)
+			// a lone peer (just joined, or whose partner left) wakes the other side
+			h.OnTransition(func(appID string, _, to hub.State) {
+				switch to {
+				case hub.StateHalfJoined:
+					notifier.Notify(appID, "A", string(to))
+					notifier.Notify(appID, "B", string(to))
+				case hub.StateClosed:
+					notifier.Forget(appID)
+				}
+			})
+		}
+	}
+	if hooks != nil {
+		h.OnTransition(func(appID string, from, to hub.State) {
+			hooks.Emit(webhook.Event{Type: "room_state", AppID: appID, Data: map[string]any{"from": from, "to": to}})
+		})
+	}
+	s.hc.Register("hub", func() health.Component {
+		return health.Component{OK: true, Detail: map[string]any{"rooms": h.Rooms(), "states": h.StateCounts()}}
+	})
+	if s.enabled(WebSocket) {
+		wsHandler := ws.NewWSHandler(
+			h,
+			cfg.CORSOrigins, // exact origins; ignored when DevMode=true
+			wsLog,
+			cfg.DevMode, // allow all origins in dev
+			wsOptions...,
+		)
+		s.mux.Handle("/ws", wsHandler)
+		s.mux.Handle("/ws/fanout", ws.NewFanoutHandler(h, cfg.CORSOrigins, wsLog, cfg.DevMode, wsOptions...))
+		served = append(served, WebSocket)
+	}
+	// client bootstrap: public settings, so SDKs don't hard-code limits
+	s.mux.Handle("GET /config", httpRL.Middleware()(clientConfigHandler(newClientConfig(cfg, served))))
+	if cfg.DevMode {
+		// unauthenticated view of room traffic metadata, for client developers
+		s.mux.Handle("GET /debug/room/{appID}/events", ws.NewDebugFeed(h))
+	}
+
+	// Security headers: one set for everything, plus a CSP for the admin group
+	secure := func(h http.Handler) http.Handler { return h }
+	adminSecure := secure
+	if cfg.SecurityHeaders {
+		sec := middleware.DefaultSecurityHeaders()
+		sec.HSTSMaxAge = cfg.HSTSMaxAge
+		csp := cfg.AdminCSP
+		if csp == "" {
+			csp = middleware.AdminCSP
+		}
+		secure, adminSecure = sec.Middleware(), sec.WithCSP(csp).Middleware()
+	}
+
+	// Admin API (only when a token is configured)
+	routes := middleware.NewRoutes(s.mux)
+	if cfg.AdminToken != "" && s.enabled(Admin) {
+		adm := admin.New(h, cfg.AdminToken).WithAudit(auditLog).WithWebhooks(hooks).WithUsage(usageStats).WithICEAnalytics(iceStats)
+		s.mux.Handle("/admin/", adminSecure(http.StripPrefix("/admin", adm.Routes())))
+		routes.Mount("/admin/", adm.Pattern)
+	}
+	for _, r := range s.opts.routes {
+		s.mux.Handle(r.pattern, r.h)
+	}
+
+	// 5) HTTP server with timeouts; the allowlist guards every route
+	var root http.Handler = s.mux
+	if allow != nil {
+		root = allow.Middleware(func(r *http.Request, ip string) {
+			s.m.IPDenied.Inc()
+			auditLog.IPDenied(r, ip)
+		})(root)
+	}
+	s.srv = &http.Server{
+		Addr:              cfg.BindAddr(),
+		Handler:           logs.Middleware(s.log)(middleware.HTTPMetrics(s.m, routes.Name)(secure(root))),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.H2C {
+		// h2c for the HTTP API; /ws keeps working via HTTP/1.1 Upgrade (or
+		// RFC 8441 extended CONNECT when GODEBUG=http2xconnect=1).
+		s.srv.Protocols = new(http.Protocols)
+		s.srv.Protocols.SetHTTP1(true)
+		s.srv.Protocols.SetHTTP2(true)
+		s.srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// 6) TLS if any cert+key pair is set
+	if !s.opts.noTLS {
+		if s.tc, err = tlsConfig(cfg); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		s.srv.TLSConfig = s.tc
+	}
+	return nil
+}
+
+// rateLimiters returns the constructor for the named per-minute limiters,
+// applying RATE_LIMIT_ALGORITHMS and the shared Redis counter.
+func (s *Server) rateLimiters() (func(name string, perMin int) *middleware.Limiter, error) {
+	cfg := s.cfg
+	var rlCounter func(name string) middleware.Counter
+	if cfg.RateLimitRedisURL != "" {
+		rc, err := redis.Parse(cfg.RateLimitRedisURL, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_REDIS_URL: %w", err)
+		}
+		s.redis = rc
+		s.closers = append(s.closers, func() { _ = rc.Close() })
+		// one breaker for all limiters: they share the connection, and its outage
+		s.redisBrk = breaker.New("redis", cfg.BreakerFailures, cfg.BreakerCooldown).WithMetrics(s.m)
+		rlCounter = func(name string) middleware.Counter { return redis.NewCounter(rc, "nt:rl:"+name+":") }
+	}
+	algos, err := middleware.ParseAlgorithms(cfg.RateLimitAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_ALGORITHMS: %w", err)
+	}
+	for name, a := range algos {
+		if a == middleware.Distributed && rlCounter == nil {
+			return nil, fmt.Errorf("RATE_LIMIT_ALGORITHMS: %s: distributed needs RATE_LIMIT_REDIS_URL", name)
+		}
+	}
+	s.algos = algos
+	return func(name string, perMin int) *middleware.Limiter {
+		l := middleware.New(perMin).Named(name).TrustProxies(s.proxies).WithMetrics(s.m)
+		if perMin > 0 {
+			s.job(l.StartJanitor)
+		}
+		a, ok := algos[name]
+		if rlCounter != nil && (!ok || a == middleware.Distributed) {
+			l.Shared(rlCounter(name)).Breaker(s.redisBrk)
+		}
+		if ok {
+			l.UseAlgorithm(a)
+		}
+		s.limiters[name] = l
+		return l
+	}, nil
+}
+
+// checkLimiters rejects RATE_LIMIT_ALGORITHMS entries for unknown limiters and
+// reports the limiters in /statusz, and the Redis breaker in /healthz and
+// /readyz according to FAILSAFE_MODE.
+func (s *Server) checkLimiters() error {
+	for name := range s.algos {
+		if !knownLimiters[name] {
+			return fmt.Errorf("RATE_LIMIT_ALGORITHMS: unknown limiter %q (want ws, http, batch or check)", name)
+		}
+	}
+	if b := s.redisBrk; b != nil {
+		// limiters count locally while the breaker is open, so the instance
+		// keeps serving; "unready" asks the load balancer to prefer others
+		s.hc.Register("redis", func() health.Component {
+			st := b.Status()
+			return health.Component{OK: st.State == "closed", Detail: map[string]any{"breaker": st}}
+		})
+		down := func() error {
+			if st := b.State(); st != breaker.Closed {
+				return fmt.Errorf("circuit %s, rate limits counted locally", st)
+			}
+			return nil
+		}
+		if s.cfg.FailsafeMode == "unready" {
+			s.hc.RegisterReadiness("redis", down)
+		} else {
+			s.hc.RegisterDegraded("redis", down)
+		}
+	}
+	s.hc.RegisterStatus("featureFlags", func() any { return s.flags.Status() })
+	s.hc.RegisterStatus("wsBuffers", func() any { return s.buffers.Status() })
+	s.hc.RegisterStatus("rateLimits", func() any {
+		out := make(map[string]middleware.LimiterStatus, len(s.limiters))
+		for name, l := range s.limiters {
+			out[name] = l.Status()
+		}
+		return out
+	})
+	return nil
+}
+
+// knownLimiters are valid RATE_LIMIT_ALGORITHMS names even when their feature
+// is left out.
+var knownLimiters = map[string]bool{"ws": true, "http": true, "batch": true, "check": true}
+
+// ice mounts /ice-servers and /whoami, and binds the optional embedded STUN
+// and UDP echo listeners.
+func (s *Server) ice(httpRL *middleware.Limiter) error {
+	cfg := s.cfg
+	// Optional embedded STUN (binding responses only), advertised via /ice-servers
+	stunPort := 0
+	if cfg.STUNAddr != "" {
+		st, err := stun.Listen(cfg.STUNAddr)
+		if err != nil {
+			return fmt.Errorf("stun listen: %w", err)
+		}
+		st.WithMetrics(s.m)
+		stunPort = st.Addr().(*net.UDPAddr).Port
+		s.closers = append(s.closers, func() { _ = st.Close() })
+		log.Printf("serving STUN on %s", st.Addr())
+		s.job(func(ctx context.Context) {
+			go func() {
+				if err := st.Serve(ctx); err != nil {
+					log.Printf("stun: %v", err)
+				}
+			}()
+		})
+	}
+	s.mux.Handle("/ice-servers", ice.Handler(cfg.ICEServers, stunPort))
+	// Reflexive address echo (HTTP, plus UDP if configured) for NAT debugging
+	echoPort := 0
+	if cfg.WhoamiUDPAddr != "" {
+		echo, err := stun.ListenEcho(cfg.WhoamiUDPAddr)
+		if err != nil {
+			return fmt.Errorf("whoami udp listen: %w", err)
+		}
+		echo.WithMetrics(s.m)
+		echoPort = echo.Addr().(*net.UDPAddr).Port
+		s.closers = append(s.closers, func() { _ = echo.Close() })
+		log.Printf("serving UDP echo on %s", echo.Addr())
+		s.job(func(ctx context.Context) {
+			go func() {
+				if err := echo.Serve(ctx); err != nil {
+					log.Printf("whoami udp: %v", err)
+				}
+			}()
+		})
+	}
+	s.mux.Handle("/whoami", httpRL.Middleware()(ice.WhoAmI(s.proxies.ClientIP, echoPort, s.m)))
+	return nil
+}
+
+// rendezvous builds the code store, its janitor and health reports, and
+// mounts /rendezvous/.
+func (s *Server) rendezvous(ids idgen.Set, httpRL *middleware.Limiter, newRL func(string, int) *middleware.Limiter) (*rendezvous.Store, error) {
+	cfg := s.cfg
+	rz := rendezvous.NewStore(cfg.RoomTTL).IDFormats(ids).LimitOwners(cfg.MaxCodesPerOwner, s.proxies.ClientIP).SetRegion(cfg.Region).MultiRedeem(cfg.RendezvousMultiRedeem).Idempotency(cfg.RendezvousIdempotencyTTL).CheckLimit(cfg.RendezvousCheckLimit).SetMetrics(s.m)
+	if s.tickets != nil {
+		rz.Tickets(s.tickets)
+	}
+	if cfg.K8sLeaderElection {
+		el, err := k8s.NewInClusterElector(s.inst, cfg.K8sLeaseName, cfg.K8sLeaseDuration)
+		if err != nil {
+			return nil, fmt.Errorf("leader election: %w", err)
+		}
+		el.OnChange = func(leader bool) {
+			s.log.Info("janitor leadership changed", zap.Bool("leader", leader))
+			if leader {
+				s.m.JanitorLeader.Set(1)
+			} else {
+				s.m.JanitorLeader.Set(0)
+			}
+		}
+		// The code store is per replica, so its sweep runs everywhere; the
+		// Lease only decides who would run work on shared stores.
+		s.job(func(ctx context.Context) { go el.Run(ctx) })
+	} else {
+		s.m.JanitorLeader.Set(1)
+	}
+	s.job(rz.StartJanitor)
+	s.hc.Register("rendezvous", func() health.Component {
+		d := map[string]any{"codes": rz.Len()}
+		if t := rz.LastSweep(); !t.IsZero() {
+			d["lastJanitorRun"] = t.UTC()
+		}
+		return health.Component{OK: true, Detail: d}
+	})
+	if cfg.RendezvousReadyMaxUtil > 0 {
+		s.hc.RegisterReadiness("rendezvous", func() error {
+			if u := 100 * rz.Utilization(); u >= cfg.RendezvousReadyMaxUtil {
+				return fmt.Errorf("code keyspace %.0f%% utilized", u)
+			}
+			return nil
+		})
+	}
+	rzHandler := http.StripPrefix("/rendezvous", rz.Routes())
+	s.mux.Handle("/rendezvous/", httpRL.Middleware()(rzHandler))
+	// batch minting gets its own bucket so kiosks don't starve interactive clients
+	batchRL := newRL("batch", cfg.BatchRatePerMin)
+	// code previews are a brute-force oracle; keep their bucket tight
+	checkRL := newRL("check", cfg.CheckRatePerMin)
+	s.mux.Handle("/rendezvous/codes/batch", batchRL.Middleware()(rzHandler))
+	s.mux.Handle("/rendezvous/check", checkRL.Middleware()(rzHandler))
+	return rz, nil
+}
+
+// wsOptions translates the WS settings into ws.Options.
+func (s *Server) wsOptions(wsRL *middleware.Limiter, sli *slo.Tracker, iceStats *ice.Analytics, usageStats *usage.Tracker, auditLog *audit.Logger, hooks *webhook.Dispatcher, ids idgen.Set) ([]ws.Option, error) {
+	cfg := s.cfg
+	proxies := s.proxies
+	opts := []ws.Option{
+		ws.WithShutdown(s.sessions),
+		ws.WithMetrics(s.m),
+		ws.WithSLI(sli),
+		ws.WithBuffers(cfg.WSReadBuf, cfg.WSWriteBuf),
+		ws.WithLimits(cfg.WSMaxMsg, cfg.Heartbeat),
+		ws.WithRateLimiter(wsRL),
+		ws.WithTelemetryLimits(cfg.TelemetryMaxPerConn, cfg.TelemetryRequireSeq),
+		ws.WithICEAnalytics(iceStats),
+		ws.WithAudit(auditLog),
+		ws.WithMessageRate(cfg.WSMsgRate, cfg.WSMsgBurst),
+		ws.WithParking(cfg.WSParkedHeartbeat),
+		ws.WithGlareArbitration(cfg.GlareWindow),
+		ws.WithRoomQuota(cfg.MaxRoomsPerOwner, proxies.ClientIP),
+		ws.WithAdaptiveHeartbeat(cfg.HeartbeatMin, cfg.HeartbeatMax, cfg.HeartbeatWidenAfter),
+		ws.WithWebhooks(hooks),
+		ws.WithIDFormats(ids),
+		ws.WithBufferTuner(s.buffers),
+		ws.WithFlags(s.flags),
+	}
+	if cfg.WSWriteBufferPool {
+		opts = append(opts, ws.WithWriteBufferPool())
+	}
+	if cfg.MinClientVersions != "" {
+		cp, err := ws.ParseClientPolicy(cfg.MinClientVersions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIN_CLIENT_VERSIONS: %w", err)
+		}
+		opts = append(opts, ws.WithClientPolicy(cp))
+	}
+	selfPair, err := ws.ParseSelfPairMode(cfg.WSSelfPair)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WS_SELF_PAIR: %w", err)
+	}
+	opts = append(opts, ws.WithSelfPair(selfPair, proxies.ClientIP))
+	var tenantOf func(*http.Request) string // nil: all traffic is anonymous
+	if cfg.TenantKeys != "" {
+		if tenantOf, err = ws.Tenants(cfg.TenantKeys); err != nil {
+			return nil, fmt.Errorf("invalid TENANT_KEYS: %w", err)
+		}
+	}
+	opts = append(opts, ws.WithUsage(usageStats, tenantOf))
+	if tenantOf != nil {
+		// the API key's tenant labels the connection, whatever the client claims
+		opts = append(opts, ws.WithLabeler(func(r *http.Request, _ params.ConnectParams) map[string]string {
+			return map[string]string{"tenant": tenantOf(r)}
+		}))
+	}
+	if cfg.MaxSessionExemptKeys != "" {
+		opts = append(opts, ws.WithSessionExempt(ws.APIKeys(cfg.MaxSessionExemptKeys)))
+	}
+	if cfg.WSRequireTLS {
+		opts = append(opts, ws.WithRequireTLS(proxies.Secure))
+	}
+	var endpoints []ws.Endpoint
+	if cfg.RegionURLs != "" {
+		urls, err := ws.ParseRegionURLs(cfg.RegionURLs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REGION_URLS: %w", err)
+		}
+		opts = append(opts, ws.WithRegion(cfg.Region, urls))
+		endpoints = ws.EndpointsFromRegions(urls, cfg.Region)
+	}
+	if cfg.AltEndpoints != "" {
+		if endpoints, err = ws.ParseEndpoints(cfg.AltEndpoints); err != nil {
+			return nil, fmt.Errorf("invalid ALT_ENDPOINTS: %w", err)
+		}
+	}
+	opts = append(opts, ws.WithAlternateEndpoints(endpoints))
+	if cfg.WSAuthSecret != "" {
+		opts = append(opts, ws.WithAuth(ws.HMACAuth([]byte(cfg.WSAuthSecret)), cfg.WSAuthTimeout))
+	}
+	if s.tickets != nil {
+		opts = append(opts, ws.WithTickets(s.tickets))
+	}
+	if s.geo != nil {
+		opts = append(opts, ws.WithGeo(s.geo, proxies.ClientIP))
+	}
+	red, err := redact.New(cfg.LogRedactFields, cfg.LogRedactPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_REDACT_FIELDS/LOG_REDACT_PATTERN: %w", err)
+	}
+	opts = append(opts, ws.WithRedactor(red))
+	if cfg.OriginCallbackURL != "" && !cfg.DevMode {
+		opts = append(opts, ws.WithOriginPolicy(ws.NewCallbackPolicy(cfg.OriginCallbackURL, cfg.OriginCallbackTTL)))
+	}
+	return opts, nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+)
+
+// ClientConfig is the body of GET /config: the public settings an SDK needs
+// to configure itself against this deployment. It holds nothing secret.
+type ClientConfig struct {
+	// WS is nil when the WebSocket feature is off.
+	WS *ClientWS `json:"ws,omitempty"`
+	// Paths of the other public APIs; empty when off.
+	ICEServers string `json:"iceServers,omitempty"`
+	Rendezvous string `json:"rendezvous,omitempty"`
+	Push       string `json:"push,omitempty"`
+	// AppIDFormats lists the accepted room ID formats, the first one is what
+	// rendezvous hands out.
+	AppIDFormats []string `json:"appIDFormats"`
+	// Features lists what this deployment offers beyond the basic relay.
+	Features []string `json:"features"`
+	// Branding is CLIENT_BRANDING, passed through as is.
+	Branding json.RawMessage `json:"branding,omitempty"`
+}
+
+// ClientWS describes the /ws endpoint.
+type ClientWS struct {
+	Path            string `json:"path"`
+	FanoutPath      string `json:"fanoutPath"`
+	MaxMessageBytes int64  `json:"maxMessageBytes"`
+	// The server pings every heartbeat; with an adaptive heartbeat the
+	// interval moves between min and max (all equal otherwise).
+	HeartbeatMs    int64 `json:"heartbeatMs"`
+	HeartbeatMinMs int64 `json:"heartbeatMinMs"`
+	HeartbeatMaxMs int64 `json:"heartbeatMaxMs"`
+	// Per-connection frame rate (0 = unlimited).
+	MsgRatePerSec int `json:"msgRatePerSec"`
+	MsgBurst      int `json:"msgBurst,omitempty"`
+	// Subprotocols the server negotiates in Sec-WebSocket-Protocol.
+	Subprotocols []string `json:"subprotocols"`
+	// Auth is "token" when an HMAC connect token is required, else "none";
+	// Tickets reports whether rendezvous tickets are accepted.
+	Auth    string `json:"auth"`
+	Tickets bool   `json:"tickets"`
+}
+
+// newClientConfig describes cfg for clients; features are the server
+// features that ended up enabled.
+func newClientConfig(cfg config.Config, features []Feature) ClientConfig {
+	on := make(map[Feature]bool, len(features))
+	for _, f := range features {
+		on[f] = true
+	}
+	cc := ClientConfig{Features: []string{}}
+	for _, f := range strings.Split(cfg.AppIDFormats, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			cc.AppIDFormats = append(cc.AppIDFormats, f)
+		}
+	}
+	if on[WebSocket] {
+		hbMin, hbMax := cfg.Heartbeat, cfg.Heartbeat
+		if cfg.HeartbeatMin > 0 && cfg.HeartbeatMax > 0 {
+			hbMin, hbMax = cfg.HeartbeatMin, cfg.HeartbeatMax
+		}
+		ws := &ClientWS{
+			Path: "/ws", FanoutPath: "/ws/fanout",
+			MaxMessageBytes: cfg.WSMaxMsg,
+			HeartbeatMs:     cfg.Heartbeat.Milliseconds(),
+			HeartbeatMinMs:  hbMin.Milliseconds(),
+			HeartbeatMaxMs:  hbMax.Milliseconds(),
+			MsgRatePerSec:   cfg.WSMsgRate,
+			MsgBurst:        cfg.WSMsgBurst,
+			Subprotocols:    []string{},
+			Auth:            "none",
+			Tickets:         cfg.WSTicketSecret != "",
+		}
+		if cfg.WSAuthSecret != "" {
+			ws.Auth = "token"
+		}
+		cc.WS = ws
+		cc.Features = append(cc.Features, "mailbox", "fanout", "pause", "parking")
+		if cfg.GlareWindow > 0 {
+			cc.Features = append(cc.Features, "glare_arbitration")
+		}
+	}
+	if on[ICE] {
+		cc.ICEServers = "/ice-servers"
+		cc.Features = append(cc.Features, "whoami")
+	}
+	if on[Rendezvous] {
+		cc.Rendezvous = "/rendezvous"
+		cc.Features = append(cc.Features, "rendezvous")
+	}
+	if on[Push] {
+		cc.Push = "/push"
+		cc.Features = append(cc.Features, "push")
+	}
+	if cfg.ClientBranding != "" {
+		cc.Branding = json.RawMessage(cfg.ClientBranding)
+	}
+	return cc
+}
+
+// clientConfigHandler serves cc, which only changes on restart.
+func clientConfigHandler(cc ClientConfig) http.Handler {
+	body, _ := json.Marshal(cc)
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_, _ = w.Write(body)
+	})
+}
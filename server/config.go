@@ -0,0 +1,31 @@
+package server
+
+import (
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/health"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/k8s"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+)
+
+// The server's API types live in internal packages; these aliases let code
+// outside this module name them, fill in a Config and use what New returns.
+type (
+	// Config holds the settings documented in the README.
+	Config = config.Config
+	// Hub holds the rooms (see Server.Hub).
+	Hub = hub.Hub
+	// HealthChecker backs /healthz, /readyz and /statusz (see Server.Health).
+	HealthChecker = health.Checker
+	// Instance labels logs and metrics (see WithInstance).
+	Instance = k8s.Instance
+	// Metrics is a set of collectors on its own registry (see WithMetrics).
+	Metrics = metrics.Metrics
+)
+
+// LoadConfig reads a Config from the environment, with the README's
+// defaults. Adjust it as needed, then check it with Validate before New.
+func LoadConfig() Config { return config.Load() }
+
+// NewMetrics returns a fresh set of collectors for WithMetrics.
+func NewMetrics() *Metrics { return metrics.New() }
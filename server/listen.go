@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+)
+
+// listen opens the HTTP listener with the configured socket options:
+// TCP keepalive (so idle WS connections through NATs stay mapped),
+// TCP_NODELAY and SO_REUSEPORT.
+func listen(ctx context.Context, cfg config.Config) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if cfg.TCPKeepAlive < 0 {
+		lc.KeepAliveConfig = net.KeepAliveConfig{Enable: false}
+		lc.KeepAlive = -1
+	} else if cfg.TCPKeepAlive > 0 {
+		lc.KeepAliveConfig = net.KeepAliveConfig{Enable: true, Idle: cfg.TCPKeepAlive, Interval: cfg.TCPKeepAlive, Count: 3}
+	}
+	if cfg.ReusePort {
+		lc.Control = reusePort
+	}
+	ln, err := lc.Listen(ctx, "tcp", cfg.BindAddr())
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.TCPNoDelay {
+		ln = noDelayListener{ln.(*net.TCPListener)}
+	}
+	return ln, nil
+}
+
+// noDelayListener turns Nagle back on (Go disables it on every TCP conn by default).
+type noDelayListener struct{ *net.TCPListener }
+
+func (l noDelayListener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	_ = c.SetNoDelay(false)
+	return c, nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/k8s"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/logs"
+)
+
+// Feature is a group of endpoints that Without leaves out.
+type Feature string
+
+const (
+	Rendezvous Feature = "rendezvous" // /rendezvous/* and the code janitor
+	WebSocket  Feature = "ws"         // /ws
+	Admin      Feature = "admin"      // /admin/* (also off without ADMIN_TOKEN)
+	Push       Feature = "push"       // /push/* and the notifier (also off without credentials)
+	ICE        Feature = "ice"        // /ice-servers, /whoami, embedded STUN and the UDP echo port
+)
+
+// Option customizes New.
+type Option func(*options)
+
+type options struct {
+	logger   logs.Logger
+	inst     *k8s.Instance
+	metrics  *Metrics
+	ln       net.Listener
+	embedded bool
+	noTLS    bool
+	without  map[Feature]bool
+	routes   []route
+}
+
+type route struct {
+	pattern string
+	h       http.Handler
+}
+
+// WithLogger sets the base logger (default: built from the LOG_* settings).
+func WithLogger(l logs.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithInstance sets the instance labels (default: k8s.InstanceFromEnv).
+func WithInstance(in Instance) Option {
+	return func(o *options) { o.inst = &in }
+}
+
+// WithMetrics registers the server's collectors on m and serves them on
+// METRICS_ROUTE (default: the process-wide set). Give each Server in a
+// process its own NewMetrics so their gauges don't overwrite each other.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) { o.metrics = m }
+}
+
+// WithListener serves on ln instead of opening HOST:PORT; the TCP_* and
+// SO_REUSEPORT settings are not applied to it. Useful for tests on
+// 127.0.0.1:0.
+func WithListener(ln net.Listener) Option {
+	return func(o *options) { o.ln = ln }
+}
+
+// Embedded makes Start run the background jobs without listening; the caller
+// serves Handler from its own http.Server.
+func Embedded() Option {
+	return func(o *options) { o.embedded = true }
+}
+
+// WithoutTLS serves plain HTTP even when certificates are configured.
+func WithoutTLS() Option {
+	return func(o *options) { o.noTLS = true }
+}
+
+// Without leaves the given features out, e.g. Without(Rendezvous, WebSocket,
+// Push, ICE) for an admin-only binary.
+func Without(fs ...Feature) Option {
+	return func(o *options) {
+		for _, f := range fs {
+			o.without[f] = true
+		}
+	}
+}
+
+// WithRoute mounts h at pattern on the server's mux, behind the same access
+// log and security headers as the built-in routes.
+func WithRoute(pattern string, h http.Handler) Option {
+	return func(o *options) { o.routes = append(o.routes, route{pattern, h}) }
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+)
+
+// LoadKeyring returns the configured at-rest keyring, or nil if none is set.
+func LoadKeyring(cfg config.Config) (*persist.Keyring, error) {
+	switch {
+	case cfg.PersistKeys != "":
+		return persist.ParseKeyring(cfg.PersistKeys)
+	case cfg.PersistKeysFile != "":
+		return persist.LoadKeyringFile(cfg.PersistKeysFile)
+	}
+	return nil, nil
+}
+
+// openPersist opens PERSIST_DIR, sealed with the at-rest keyring if one is set.
+func openPersist(cfg config.Config) (persist.KV, error) {
+	d, err := persist.NewDir(cfg.PersistDir)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := LoadKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if kr == nil {
+		return d, nil
+	}
+	return persist.NewEncrypted(d, kr), nil
+}
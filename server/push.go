@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/push"
+)
+
+// newNotifier builds the push notifier from cfg, or returns nil when neither
+// WebPush nor FCM is configured.
+func newNotifier(cfg config.Config, h *hub.Hub, ids idgen.Set, m *metrics.Metrics) (*push.Notifier, error) {
+	if cfg.PushVAPIDPrivateKey == "" && cfg.PushFCMCredentialsFile == "" {
+		return nil, nil
+	}
+	n, err := push.New(cfg.PushTitle, cfg.PushBody, cfg.PushSubscriptionTTL)
+	if err != nil {
+		return nil, fmt.Errorf("push templates: %w", err)
+	}
+	n.SkipConnected(h.Connected).IDFormats(ids).WithMetrics(m)
+	if cfg.PushVAPIDPrivateKey != "" {
+		wp, err := push.NewWebPush(cfg.PushVAPIDPublicKey, cfg.PushVAPIDPrivateKey, cfg.PushVAPIDSubject)
+		if err != nil {
+			return nil, fmt.Errorf("webpush: %w", err)
+		}
+		n.WithWebPush(wp)
+	}
+	if cfg.PushFCMCredentialsFile != "" {
+		b, err := os.ReadFile(cfg.PushFCMCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: %w", err)
+		}
+		f, err := push.NewFCM(b)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: %w", err)
+		}
+		n.WithFCM(f)
+	}
+	return n, nil
+}
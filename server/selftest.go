@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/idgen"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+// selfTestTimeout bounds each network step of SelfTest.
+const selfTestTimeout = 5 * time.Second
+
+// Self-test step outcomes.
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped"
+)
+
+// SelfCheck is one step of a self-test.
+type SelfCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // CheckOK, CheckFailed or CheckSkipped
+	Detail any    `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+	TookMs int64  `json:"tookMs"`
+}
+
+// SelfTestReport is the result of SelfTest; OK is false if any step failed.
+type SelfTestReport struct {
+	OK     bool        `json:"ok"`
+	Checks []SelfCheck `json:"checks"`
+}
+
+// SelfTest boots a server from cfg and exercises it end to end: it builds
+// every subsystem, validates the TLS certificates, binds HOST:PORT, pings
+// Redis, creates and redeems a rendezvous code through its own listener and
+// relays a frame between a loopback WS pair, then shuts down. Once a step
+// fails, the remaining ones are skipped.
+//
+// Webhooks, janitor leader election and hub snapshots are turned off for
+// the run, so a self-test next to a live deployment neither posts events,
+// takes the lease nor consumes the deployment's snapshot. opts are passed to New (e.g. WithListener in tests).
+func SelfTest(ctx context.Context, cfg config.Config, opts ...Option) SelfTestReport {
+	cfg.WebhookURL = ""
+	cfg.K8sLeaderElection = false
+	cfg.DrainDelay = 0
+	cfg.HubSnapshot = false
+
+	var rep SelfTestReport
+	failed := false
+	step := func(name string, fn func() (any, error)) {
+		if failed {
+			rep.Checks = append(rep.Checks, SelfCheck{Name: name, Status: CheckSkipped, Detail: "earlier step failed"})
+			return
+		}
+		start := time.Now()
+		d, err := fn()
+		c := SelfCheck{Name: name, Status: CheckOK, Detail: d, TookMs: time.Since(start).Milliseconds()}
+		if errors.Is(err, errSkipped) {
+			c.Status = CheckSkipped
+		} else if err != nil {
+			c.Status, c.Error, failed = CheckFailed, err.Error(), true
+		}
+		rep.Checks = append(rep.Checks, c)
+	}
+
+	step("config", func() (any, error) { return nil, cfg.Validate() })
+	var s *Server
+	step("build", func() (any, error) {
+		var err error
+		s, err = New(cfg, opts...)
+		return nil, err
+	})
+	if s != nil {
+		defer func() { _ = s.Shutdown(context.Background()) }()
+	}
+	step("tls", func() (any, error) { return s.checkTLS() })
+	step("listen", func() (any, error) {
+		if err := s.Start(ctx); err != nil {
+			return nil, err
+		}
+		if s.Addr() == nil {
+			return nil, fmt.Errorf("embedded server has no listener")
+		}
+		return map[string]any{"addr": s.Addr().String()}, nil
+	})
+	step("redis", func() (any, error) { return s.checkRedis(ctx) })
+
+	base, client := s.selfURL()
+	var code, codeTicket, appID, ticketB string
+	rzOn := s != nil && s.enabled(Rendezvous)
+	step("rendezvous", func() (any, error) {
+		if !rzOn {
+			return "feature disabled", errSkipped
+		}
+		var created struct{ Code, AppID, Ticket string }
+		if err := postJSON(ctx, client, base+"/rendezvous/code", `{}`, &created); err != nil {
+			return nil, fmt.Errorf("create code: %w", err)
+		}
+		code, codeTicket = created.Code, created.Ticket
+		var redeemed struct{ AppID, Ticket string }
+		if err := postJSON(ctx, client, base+"/rendezvous/redeem", fmt.Sprintf(`{"code":%q}`, code), &redeemed); err != nil {
+			return nil, fmt.Errorf("redeem code: %w", err)
+		}
+		if redeemed.AppID != created.AppID {
+			return nil, fmt.Errorf("redeemed appID %q, created %q", redeemed.AppID, created.AppID)
+		}
+		appID, ticketB = redeemed.AppID, redeemed.Ticket
+		return map[string]any{"appID": appID, "tickets": codeTicket != ""}, nil
+	})
+	step("websocket", func() (any, error) {
+		if s == nil || !s.enabled(WebSocket) {
+			return "feature disabled", errSkipped
+		}
+		if appID == "" {
+			// no rendezvous: any fresh id in the primary format will do
+			ids, err := idgen.ParseSet(cfg.AppIDFormats)
+			if err != nil {
+				return nil, err
+			}
+			appID = ids.New()
+		}
+		return s.checkWSPair(ctx, base, appID, codeTicket, ticketB)
+	})
+
+	rep.OK = !failed
+	return rep
+}
+
+// errSkipped marks a step that does not apply to the configuration.
+var errSkipped = errors.New("skipped")
+
+// checkTLS reports the configured certificates; expired, not yet valid and
+// (outside DEV) untrusted ones fail.
+func (s *Server) checkTLS() (any, error) {
+	if s.tc == nil {
+		return "TLS not configured", errSkipped
+	}
+	now := time.Now()
+	var certs []map[string]any
+	for _, c := range s.tc.Certificates {
+		leaf := c.Leaf
+		certs = append(certs, map[string]any{"names": leaf.DNSNames, "notAfter": leaf.NotAfter.UTC()})
+		if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return certs, fmt.Errorf("%v: valid %s to %s", leaf.DNSNames, leaf.NotBefore.UTC(), leaf.NotAfter.UTC())
+		}
+		if s.cfg.DevMode {
+			continue
+		}
+		inter := x509.NewCertPool()
+		for _, der := range c.Certificate[1:] {
+			if ic, err := x509.ParseCertificate(der); err == nil {
+				inter.AddCert(ic)
+			}
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: inter, CurrentTime: now}); err != nil {
+			return certs, fmt.Errorf("%v: %w", leaf.DNSNames, err)
+		}
+	}
+	return certs, nil
+}
+
+// checkRedis sends PING to the shared rate-limit store.
+func (s *Server) checkRedis(ctx context.Context) (any, error) {
+	if s.redis == nil {
+		return "RATE_LIMIT_REDIS_URL not set", errSkipped
+	}
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+	start := time.Now()
+	r, err := s.redis.Do(ctx, "PING")
+	if err != nil {
+		return nil, err
+	}
+	if r != "PONG" {
+		return nil, fmt.Errorf("PING replied %v", r)
+	}
+	return map[string]any{"rttMs": time.Since(start).Milliseconds()}, nil
+}
+
+// selfURL returns the base URL of the server's own listener and a client for
+// it. Certificates were checked by checkTLS and don't name the loopback
+// address, so the client skips verification.
+func (s *Server) selfURL() (string, *http.Client) {
+	if s == nil || s.ln == nil {
+		return "", nil
+	}
+	addr := s.ln.Addr().(*net.TCPAddr)
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		host = "127.0.0.1"
+		if addr.IP.To4() == nil {
+			host = "::1"
+		}
+	}
+	hostport := net.JoinHostPort(host, fmt.Sprint(addr.Port))
+	if s.tc == nil {
+		return "http://" + hostport, &http.Client{Timeout: selfTestTimeout}
+	}
+	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	return "https://" + hostport, &http.Client{Timeout: selfTestTimeout, Transport: tr}
+}
+
+func postJSON(ctx context.Context, c *http.Client, u, body string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkWSPair joins both sides of appID over the server's own listener and
+// relays one frame from A to B.
+func (s *Server) checkWSPair(ctx context.Context, base, appID, ticketA, ticketB string) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+	d := websocket.Dialer{HandshakeTimeout: selfTestTimeout, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	dial := func(side, tk string) (*websocket.Conn, error) {
+		u, _ := url.Parse(base)
+		u.Scheme = map[string]string{"http": "ws", "https": "wss"}[u.Scheme]
+		u.Path = "/ws"
+		q := url.Values{"appID": {appID}, "side": {side}}
+		switch {
+		case tk != "":
+			q.Set("ticket", tk)
+		case s.cfg.WSAuthSecret != "":
+			q.Set("token", ws.HMACToken([]byte(s.cfg.WSAuthSecret), appID, side))
+		}
+		u.RawQuery = q.Encode()
+		// one User-Agent per side, so WS_SELF_PAIR=deny lets the pair through
+		c, resp, err := d.DialContext(ctx, u.String(), http.Header{"User-Agent": {"nt-selftest/" + side}})
+		if err != nil {
+			if resp != nil {
+				err = fmt.Errorf("%w (%s)", err, resp.Status)
+			}
+			return nil, fmt.Errorf("side %s: %w", side, err)
+		}
+		dl, _ := ctx.Deadline()
+		_ = c.SetReadDeadline(dl)
+		return c, nil
+	}
+	start := time.Now()
+	a, err := dial("A", ticketA)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	b, err := dial("B", ticketB)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	if err := readType(a, "room_full"); err != nil {
+		return nil, fmt.Errorf("pairing: %w", err)
+	}
+	if err := a.WriteMessage(websocket.TextMessage, []byte(`{"type":"offer","sdp":"selftest"}`)); err != nil {
+		return nil, err
+	}
+	if err := readType(b, "offer"); err != nil {
+		return nil, fmt.Errorf("relay: %w", err)
+	}
+	return map[string]any{"appID": appID, "rttMs": time.Since(start).Milliseconds()}, nil
+}
+
+// readType reads frames from c until one of type typ arrives; an error frame
+// ends the wait.
+func readType(c *websocket.Conn, typ string) error {
+	for {
+		_, p, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var f struct{ Type, Code string }
+		_ = json.Unmarshal(p, &f)
+		switch f.Type {
+		case typ:
+			return nil
+		case "error":
+			return fmt.Errorf("error frame %q", f.Code)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package server assembles the signaling server from a Config: mux,
+// middlewares, hub, stores and background jobs. cmd/server is a thin wrapper
+// around it; variants (an admin-only binary, a plain-HTTP test binary, an
+// embedded server) pick Options instead of copying the wiring.
+//
+//	s, err := server.New(server.LoadConfig(), server.WithoutTLS())
+//	...
+//	if err := s.Start(ctx); err != nil { ... }
+//	<-ctx.Done()
+//	_ = s.Shutdown(context.Background())
+//
+// Collectors are registered on the process-wide default set unless
+// WithMetrics gives a Server its own, so several can run in one process.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/breaker"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/flags"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/geo"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/health"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/k8s"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/logs"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/metrics"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/middleware"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/redis"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ticket"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/ws"
+)
+
+// shutdownTimeout bounds the wait for in-flight requests and WS sessions
+// after the drain delay.
+const shutdownTimeout = 10 * time.Second
+
+// Server is an assembled signaling server. Build it with New, then Start it
+// and Shutdown it once.
+type Server struct {
+	cfg  config.Config
+	opts options
+	log  logs.Logger
+	inst k8s.Instance
+	m    *metrics.Metrics
+
+	hub *hub.Hub
+	hc  *health.Checker
+	mux *http.ServeMux
+	srv *http.Server
+	tc  *tls.Config
+
+	proxies  middleware.TrustedProxies
+	limiters map[string]*middleware.Limiter
+	algos    map[string]middleware.Algorithm
+	redis    *redis.Client    // nil => no shared rate-limit counter
+	redisBrk *breaker.Breaker // set with redis
+	tickets  *ticket.Issuer   // nil => WS tickets disabled
+	geo      *geo.Resolver    // nil => no country/ASN enrichment
+
+	snapshots persist.KV      // HUB_SNAPSHOT store; nil => not enabled
+	buffers   *ws.BufferTuner // frame sizes and WS buffer advice, for /statusz
+	flags     *flags.Set      // runtime protocol feature flags
+
+	// WS sessions outlive srv.Shutdown (hijacked); they end when this is cancelled
+	sessions      context.Context
+	closeSessions context.CancelFunc
+
+	jobs     []func(ctx context.Context) // background work, run by Start
+	closers  []func()                    // run last by Shutdown, in reverse
+	stopJobs context.CancelFunc
+	ln       net.Listener
+	errc     chan error
+}
+
+// New assembles a server from cfg. It binds the UDP listeners (STUN, echo)
+// but starts nothing else; see Start.
+func New(cfg Config, opts ...Option) (*Server, error) {
+	s := &Server{cfg: cfg, opts: options{without: map[Feature]bool{}}, limiters: map[string]*middleware.Limiter{}, errc: make(chan error, 1)}
+	for _, o := range opts {
+		o(&s.opts)
+	}
+	s.sessions, s.closeSessions = context.WithCancel(context.Background())
+	if err := s.build(); err != nil {
+		s.closeSessions()
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handler returns the root handler (access log and security headers included).
+func (s *Server) Handler() http.Handler { return s.srv.Handler }
+
+// Hub returns the server's hub.
+func (s *Server) Hub() *Hub { return s.hub }
+
+// Health returns the health checker behind /healthz, /readyz and /statusz.
+func (s *Server) Health() *HealthChecker { return s.hc }
+
+// Addr returns the listening address once Start returned (nil if embedded).
+func (s *Server) Addr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Err reports a failure of the HTTP server after Start; it never carries
+// http.ErrServerClosed.
+func (s *Server) Err() <-chan error { return s.errc }
+
+// Start runs the background jobs and, unless Embedded, starts serving. It
+// returns once the listener is open; ctx only bounds opening it.
+func (s *Server) Start(ctx context.Context) error {
+	if !s.opts.embedded {
+		ln := s.opts.ln
+		if ln == nil {
+			var err error
+			if ln, err = listen(ctx, s.cfg); err != nil {
+				return fmt.Errorf("listen: %w", err)
+			}
+		}
+		s.ln = ln
+	}
+	jobs, stop := context.WithCancel(context.Background())
+	s.stopJobs = stop
+	for _, job := range s.jobs {
+		job(jobs)
+	}
+	if s.ln == nil {
+		return nil
+	}
+	go func() {
+		var err error
+		if s.tc != nil {
+			log.Printf("serving HTTPS on %s for %v", s.ln.Addr(), certNames(s.tc))
+			err = s.srv.ServeTLS(s.ln, "", "")
+		} else {
+			log.Printf("serving HTTP on %s", s.ln.Addr())
+			err = s.srv.Serve(s.ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.errc <- err
+		}
+	}()
+	return nil
+}
+
+// Shutdown drains the server: /readyz fails for DRAIN_DELAY so load
+// balancers move away, then WS sessions get a 1001 close, the listener closes
+// and in-flight requests finish, and the background jobs stop. The wait after
+// the drain delay is bounded by ctx and by 10s.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.hc.SetDraining()
+	if d := s.cfg.DrainDelay; d > 0 {
+		log.Printf("draining for %s", d)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+	// rooms go away with their last peer: save them before closing sessions
+	s.saveHub()
+	s.closeSessions()
+	var err error
+	if s.ln != nil {
+		err = s.srv.Shutdown(ctx)
+	}
+	if n := waitSessions(ctx, s.hub); n > 0 {
+		log.Printf("shutdown: %d WS sessions still open", n)
+	}
+	if s.stopJobs != nil {
+		s.stopJobs()
+	}
+	s.close()
+	return err
+}
+
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
+// job registers background work for Start; fn must not block.
+func (s *Server) job(fn func(ctx context.Context)) { s.jobs = append(s.jobs, fn) }
+
+func (s *Server) enabled(f Feature) bool { return !s.opts.without[f] }
+
+// waitSessions waits until every WS session has left the hub or ctx is done,
+// and returns how many are left.
+func waitSessions(ctx context.Context, h *hub.Hub) int {
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for {
+		if _, conns, _ := h.Stats(); conns == 0 || ctx.Err() != nil {
+			return conns
+		}
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+	}
+}
+
+// logger builds the base logger from the LOG_* settings unless one was given.
+func (s *Server) logger() (logs.Logger, error) {
+	if s.opts.logger != nil {
+		return s.opts.logger, nil
+	}
+	base, err := logs.Build(logs.Options{
+		Level:      s.cfg.LogLevel,
+		Format:     s.cfg.LogFormat,
+		Output:     s.cfg.LogOutput,
+		MaxSizeMB:  s.cfg.LogMaxSizeMB,
+		MaxBackups: s.cfg.LogMaxBackups,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("logs: %w", err)
+	}
+	s.closers = append(s.closers, func() { _ = base.Sync() })
+	return base, nil
+}
+
+// srvLogger is the access/ops logger: base sampled per LOG_SAMPLE.
+func (s *Server) srvLogger(base logs.Logger) (logs.Logger, error) {
+	first, then, err := logs.ParseSample(s.cfg.LogSample)
+	if err != nil {
+		return nil, fmt.Errorf("LOG_SAMPLE: %w", err)
+	}
+	return logs.Sampled(base, first, then).With(zap.String("sys", "srv"), zap.String("pod", s.inst.Pod), zap.String("zone", s.inst.Zone)), nil
+}
@@ -0,0 +1,273 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/server"
+)
+
+func TestServerLifecycle(t *testing.T) {
+	cfg := server.LoadConfig()
+	cfg.DevMode = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("extra")) })
+	s, err := server.New(cfg,
+		server.WithListener(ln),
+		server.WithoutTLS(),
+		server.WithLogger(zap.NewNop()),
+		server.Without(server.Push),
+		server.WithRoute("/extra", extra),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + s.Addr().String()
+
+	for path, want := range map[string]int{
+		"/healthz":           http.StatusOK,
+		"/extra":             http.StatusOK,
+		"/ice-servers":       http.StatusOK,
+		"/push/subscribe":    http.StatusNotFound,
+		"/rendezvous/check":  http.StatusBadRequest,
+		"/rendezvous/nosuch": http.StatusNotFound,
+	} {
+		res, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("GET %s: %d, want %d", path, res.StatusCode, want)
+		}
+	}
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws?appID=0b9f5c3e-1c1e-4c2a-9d5e-2f7e0b1a6c11&side=A", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Hub().RoomSize("0b9f5c3e-1c1e-4c2a-9d5e-2f7e0b1a6c11") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the peer answers the 1001 close, so Shutdown doesn't wait for the cutoff
+	go func() {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Fatal("still serving after Shutdown")
+	}
+	if _, conns, _ := s.Hub().Stats(); conns != 0 {
+		t.Fatalf("%d WS sessions left after Shutdown", conns)
+	}
+	select {
+	case err := <-s.Err():
+		t.Fatalf("Err after Shutdown: %v", err)
+	default:
+	}
+}
+
+func TestServerConfigErrors(t *testing.T) {
+	cfg := server.LoadConfig()
+	cfg.RateLimitAlgorithms = "nosuch:token-bucket"
+	if _, err := server.New(cfg, server.WithLogger(zap.NewNop())); err == nil || !strings.Contains(err.Error(), "unknown limiter") {
+		t.Fatalf("want unknown limiter error, got %v", err)
+	}
+	cfg = server.LoadConfig()
+	cfg.AppIDFormats = "uuidv9"
+	if _, err := server.New(cfg, server.WithLogger(zap.NewNop())); err == nil || errors.Unwrap(err) == nil {
+		t.Fatalf("want wrapped APPID_FORMATS error, got %v", err)
+	}
+}
+
+func TestServerClientConfig(t *testing.T) {
+	cfg := server.LoadConfig()
+	cfg.AppIDFormats = "uuidv4, ulid"
+	cfg.WSMaxMsg = 256 << 10
+	cfg.Heartbeat = 30 * time.Second
+	cfg.WSAuthSecret = "s3cret"
+	cfg.ClientBranding = `{"name":"Acme Share","color":"#0a84ff"}`
+	s, err := server.New(cfg, server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push, server.Rendezvous))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /config: %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "s3cret") {
+		t.Fatal("GET /config leaks the WS auth secret")
+	}
+	var cc server.ClientConfig
+	if err := json.Unmarshal(rr.Body.Bytes(), &cc); err != nil {
+		t.Fatal(err)
+	}
+	if cc.WS == nil || cc.WS.MaxMessageBytes != 256<<10 || cc.WS.HeartbeatMs != 30000 || cc.WS.Auth != "token" {
+		t.Fatalf("ws: %+v", cc.WS)
+	}
+	if cc.Rendezvous != "" || cc.Push != "" || cc.ICEServers != "/ice-servers" {
+		t.Fatalf("paths: %+v", cc)
+	}
+	if strings.Join(cc.AppIDFormats, ",") != "uuidv4,ulid" || string(cc.Branding) != cfg.ClientBranding {
+		t.Fatalf("formats %v, branding %s", cc.AppIDFormats, cc.Branding)
+	}
+
+	cfg.ClientBranding = `["not","an","object"]`
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("CLIENT_BRANDING array accepted")
+	}
+}
+
+func TestServerOwnMetrics(t *testing.T) {
+	cfg := server.LoadConfig()
+	scrape := func(s *server.Server) string {
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, cfg.MetricsRoute, nil))
+		return rr.Body.String()
+	}
+	var srvs []*server.Server
+	for _, pod := range []string{"pod-a", "pod-b"} {
+		s, err := server.New(cfg, server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push),
+			server.WithInstance(server.Instance{Pod: pod}), server.WithMetrics(server.NewMetrics()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srvs = append(srvs, s)
+	}
+	_ = srvs[0].Hub().Register("0b9f5c3e-1c1e-4c2a-9d5e-2f7e0b1a6c11", "A", "", nil)
+
+	// each server reports its own hub and instance, not the last one built
+	for i, want := range []string{"nt_rooms_active 1", "nt_rooms_active 0"} {
+		body := scrape(srvs[i])
+		if !strings.Contains(body, want) {
+			t.Errorf("server %d: want %q in\n%s", i, want, body)
+		}
+		own, other := []string{"pod-a", "pod-b"}[i], []string{"pod-b", "pod-a"}[i]
+		if !strings.Contains(body, `pod="`+own+`"`) || strings.Contains(body, `pod="`+other+`"`) {
+			t.Errorf("server %d: wrong instance labels", i)
+		}
+	}
+}
+
+func TestServerRedisFailsafe(t *testing.T) {
+	// nothing listens on the reserved port: every Redis call fails fast
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+
+	for mode, want := range map[string]int{"local": http.StatusOK, "unready": http.StatusServiceUnavailable} {
+		cfg := server.LoadConfig()
+		cfg.RateLimitRedisURL = "redis://" + dead
+		cfg.HTTPRatePerMin = 10
+		cfg.BreakerFailures = 1
+		cfg.FailsafeMode = mode
+		s, err := server.New(cfg, server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the request is still served, counted locally
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: /whoami during outage: %d", mode, rr.Code)
+		}
+		rr = httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rr.Code != want || !strings.Contains(rr.Body.String(), "circuit open") {
+			t.Fatalf("%s: /readyz %d %s", mode, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestServerSelfTest(t *testing.T) {
+	cfg := server.LoadConfig()
+	cfg.WSAuthSecret = "s3cret"
+	cfg.WSTicketSecret = "t1cket"
+	cfg.WSSelfPair = "deny"
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := server.SelfTest(context.Background(), cfg, server.WithListener(ln), server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push))
+	status := map[string]string{}
+	for _, c := range rep.Checks {
+		status[c.Name] = c.Status
+	}
+	if !rep.OK || status["rendezvous"] != server.CheckOK || status["websocket"] != server.CheckOK || status["redis"] != server.CheckSkipped {
+		t.Fatalf("self-test: %+v", rep)
+	}
+
+	// a dead Redis fails its step and skips the rest
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead.Close()
+	cfg.RateLimitRedisURL = "redis://" + dead.Addr().String()
+	rep = server.SelfTest(context.Background(), cfg, server.WithListener(ln), server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push))
+	last := rep.Checks[len(rep.Checks)-1]
+	if rep.OK || rep.Checks[4].Name != "redis" || rep.Checks[4].Status != server.CheckFailed || last.Status != server.CheckSkipped {
+		t.Fatalf("self-test with dead Redis: %+v", rep)
+	}
+}
+
+func TestServerHubSnapshot(t *testing.T) {
+	cfg := server.LoadConfig()
+	cfg.PersistDir = t.TempDir()
+	cfg.HubSnapshot = true
+	build := func() *server.Server {
+		s, err := server.New(cfg, server.WithoutTLS(), server.WithLogger(zap.NewNop()), server.Without(server.Push, server.Rendezvous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	const appID = "0b9f5c3e-1c1e-4c2a-9d5e-2f7e0b1a6c11"
+	s := build()
+	if err := s.Hub().Enqueue(appID, "A", "B", json.RawMessage(`{"pub":"k"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s = build()
+	defer func() { _ = s.Shutdown(context.Background()) }()
+	_ = s.Hub().Enqueue(appID, "A", "B", json.RawMessage(`{"n":2}`))
+	if items, _ := s.Hub().MailboxItems(appID, "B"); len(items) != 2 {
+		t.Fatalf("restored mailbox: %+v", items)
+	}
+}
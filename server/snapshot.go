@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/hub"
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/persist"
+)
+
+// hubSnapshotKind names the HUB_SNAPSHOT entry; it lives at hubSnapshotKey.
+const (
+	hubSnapshotKind = "hub"
+	hubSnapshotKey  = hubSnapshotKind + "/snapshot"
+)
+
+// restoreHub loads the snapshot the previous process saved on shutdown into
+// h and deletes it, so it is applied once. An unreadable snapshot is logged
+// and dropped rather than blocking startup.
+func (s *Server) restoreHub(h *hub.Hub) error {
+	kv, err := openPersist(s.cfg)
+	if err != nil {
+		return err
+	}
+	s.snapshots = kv
+	b, err := kv.Get(hubSnapshotKey)
+	if errors.Is(err, persist.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap hub.Snapshot
+	if err := persist.Unwrap(b, hubSnapshotKind, &snap); err != nil {
+		s.log.Warn("hub snapshot unreadable, dropped", zap.Error(err))
+	} else {
+		n := h.Restore(snap, s.cfg.RoomTTL)
+		s.log.Info("hub snapshot restored", zap.Int("rooms", n), zap.Int("saved", len(snap.Rooms)), zap.Duration("age", time.Since(snap.At)))
+	}
+	return kv.Delete(hubSnapshotKey)
+}
+
+// saveHub writes the hub's snapshot for the next process to restore.
+func (s *Server) saveHub() {
+	if s.snapshots == nil {
+		return
+	}
+	snap := s.hub.Snapshot()
+	b, err := persist.Wrap(hubSnapshotKind, snap)
+	if err == nil {
+		err = s.snapshots.Put(hubSnapshotKey, b)
+	}
+	if err != nil {
+		s.log.Error("hub snapshot not saved", zap.Error(err))
+		return
+	}
+	s.log.Info("hub snapshot saved", zap.Int("rooms", len(snap.Rooms)))
+}
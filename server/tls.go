@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/collapsinghierarchy/nt-backend-wrtc/internal/config"
+)
+
+// tlsConfig loads TLS_CERT_FILE/TLS_KEY_FILE and every TLS_CERTS pair. With
+// several certificates the handshake picks the one whose names match the
+// client's SNI (the first is the fallback). Returns nil when TLS is off.
+func tlsConfig(cfg config.Config) (*tls.Config, error) {
+	var pairs [][2]string
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		pairs = append(pairs, [2]string{cfg.TLSCertFile, cfg.TLSKeyFile})
+	}
+	for _, p := range cfg.TLSCerts {
+		cert, key, _ := strings.Cut(p, ":")
+		pairs = append(pairs, [2]string{cert, key})
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, p := range pairs {
+		c, err := tls.LoadX509KeyPair(p[0], p[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p[0], err)
+		}
+		if c.Leaf == nil {
+			if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+				return nil, fmt.Errorf("%s: %w", p[0], err)
+			}
+		}
+		tc.Certificates = append(tc.Certificates, c)
+	}
+	return tc, nil
+}
+
+// certNames lists the DNS names served, for the startup log.
+func certNames(tc *tls.Config) []string {
+	var out []string
+	for _, c := range tc.Certificates {
+		out = append(out, c.Leaf.DNSNames...)
+	}
+	return out
+}